@@ -3,10 +3,17 @@ package main
 import (
 	"context"
 	"log"
+	"log/slog"
+	"time"
 
 	"github.com/Fearcon14/level3-cloud/Week4_API/internal/api"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/auth"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/authstore"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/backupstore"
 	"github.com/Fearcon14/level3-cloud/Week4_API/internal/k8s"
 	"github.com/Fearcon14/level3-cloud/Week4_API/internal/logstore"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/opstore"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/watcher"
 )
 
 func main() {
@@ -16,9 +23,26 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to create dynamic client: %v", err)
 	}
-	store := k8s.NewRedisFailoverStore(dynamicClient, cfg.PaaSNamespace, cfg.RedisFailoverTemplatePath, cfg.DefaultStorageClass)
+	storeConfig, err := cfg.StoreConfig()
+	if err != nil {
+		log.Fatalf("invalid instance store config: %v", err)
+	}
+	store := k8s.NewRedisFailoverStore(dynamicClient, storeConfig)
+	// Reads are served from informers once they have synced; until then they go to the API server and
+	// GET /readyz reports 503.
+	if err := store.StartInformers(context.Background(), cfg.InformerResync); err != nil {
+		log.Fatalf("failed to start informers: %v", err)
+	}
+	go func() {
+		if store.WaitForCacheSync(context.Background()) {
+			log.Printf("instance informer caches synced")
+		}
+	}()
 
 	var logStore logstore.Store
+	var authStore authstore.Store = authstore.NewMemoryStore()
+	var backupStore backupstore.Store
+	var opStore opstore.Store
 	if cfg.DatabaseURL != "" {
 		ps, err := logstore.NewPostgresStore(context.Background(), cfg.DatabaseURL)
 		if err != nil {
@@ -26,10 +50,76 @@ func main() {
 		}
 		defer ps.Close()
 		logStore = ps
+		authStore = authstore.NewPostgresStore(ps.DB())
+		backupStore = backupstore.NewPostgresStore(ps.DB())
+		opStore = opstore.NewPostgresStore(ps.DB())
 		log.Printf("log store connected (audit and service logs enabled)")
+
+		// Status service logs come from one elected replica, independent of GET traffic.
+		statusWatcher := &watcher.StatusWatcher{Source: store, States: ps, Logger: slog.Default()}
+		go func() {
+			if err := k8s.RunWhileLeader(context.Background(), cfg.LeaderConfig(watcher.StatusLeaseName), slog.Default(), statusWatcher.Run); err != nil {
+				log.Printf("status watcher disabled: %v", err)
+			}
+		}()
+		// Kubernetes Warning Events (e.g. FailedScheduling) are the only place tenants learn why an
+		// instance does not start.
+		eventWatcher := &watcher.EventWatcher{Source: store, States: ps, Logger: slog.Default()}
+		go func() {
+			if err := k8s.RunWhileLeader(context.Background(), cfg.LeaderConfig(watcher.EventLeaseName), slog.Default(), eventWatcher.Run); err != nil {
+				log.Printf("event watcher disabled: %v", err)
+			}
+		}()
+		// Scheduled backups (backupSchedule on create/PATCH) need the backup metadata to be shared.
+		if cfg.Backup.Bucket != "" {
+			backupScheduler := &watcher.BackupScheduler{Source: store, Jobs: store, Backups: backupStore, Logs: ps, Logger: slog.Default()}
+			go func() {
+				if err := k8s.RunWhileLeader(context.Background(), cfg.LeaderConfig(watcher.BackupLeaseName), slog.Default(), backupScheduler.Run); err != nil {
+					log.Printf("backup scheduler disabled: %v", err)
+				}
+			}()
+		}
+	} else {
+		log.Printf("no DATABASE_URL: users, backup metadata and operations are kept in memory and lost on restart")
+	}
+	// Rotated passwords stay valid for their grace period; one elected replica removes them afterwards.
+	passwordRetirer := &watcher.PasswordRetirer{Source: store, Logs: logStore, Logger: slog.Default()}
+	go func() {
+		if err := k8s.RunWhileLeader(context.Background(), cfg.LeaderConfig(watcher.PasswordLeaseName), slog.Default(), passwordRetirer.Run); err != nil {
+			log.Printf("password retirer disabled: %v", err)
+		}
+	}()
+
+	if cfg.BootstrapUser != "" && cfg.BootstrapPassword != "" {
+		if err := api.EnsureBootstrapUser(context.Background(), authStore, cfg.BootstrapUser, cfg.BootstrapPassword); err != nil {
+			log.Fatalf("failed to create bootstrap user: %v", err)
+		}
 	}
 
-	e := api.NewServer(cfg, store, logStore)
+	keys, generated, err := auth.LoadKeySet(cfg.KeySetConfig())
+	if err != nil {
+		log.Fatalf("failed to load JWT keys: %v", err)
+	}
+	if generated {
+		log.Printf("no JWT signing key configured: using an ephemeral key (tokens are lost on restart and not valid across replicas)")
+	}
+	log.Printf("JWT signing key id %q", keys.ActiveKeyID())
+
+	var oidc *auth.OIDCProvider
+	if cfg.OIDCIssuerURL != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		oidc, err = auth.DiscoverOIDC(ctx, cfg.OIDCConfig())
+		cancel()
+		if err != nil {
+			log.Fatalf("failed to set up OIDC login: %v", err)
+		}
+		log.Printf("OIDC login enabled (issuer %s)", oidc.Issuer())
+	}
+
+	e, err := api.NewServer(cfg, store, logStore, authStore, backupStore, opStore, keys, oidc, storeConfig.Plans)
+	if err != nil {
+		log.Fatalf("failed to set up API server: %v", err)
+	}
 
 	log.Printf("API server started on %s", cfg.APIListenAddr)
 	if err := e.Start(cfg.APIListenAddr); err != nil {
@@ -0,0 +1,287 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/authstore"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+	"github.com/labstack/echo/v5"
+)
+
+// API key scopes. JWT-authenticated users implicitly hold all of them. Scopes narrow, never widen,
+// what the key's role allows.
+const (
+	scopeInstancesRead   = "instances:read"
+	scopeInstancesWrite  = "instances:write"
+	scopeCredentialsRead = "credentials:read"
+	scopeCacheRead       = "cache:read"
+	scopeCacheWrite      = "cache:write"
+	scopeLogsRead        = "logs:read"
+)
+
+var allScopes = []string{scopeInstancesRead, scopeInstancesWrite, scopeCredentialsRead, scopeCacheRead, scopeCacheWrite, scopeLogsRead}
+
+const (
+	// apiKeyPrefix marks API key values: paas_<id>_<secret>. The id is public and used for lookup,
+	// the whole value is only ever stored as a SHA-256 hash.
+	apiKeyPrefix  = "paas_"
+	apiKeyNameMax = 64
+
+	// Principal.AuthMethod values.
+	authMethodJWT    = "jwt"
+	authMethodAPIKey = "apikey"
+)
+
+// AuthMiddleware accepts either an API key (X-API-Key header or "Bearer paas_...") or a bearer JWT
+// and stores the caller as Principal, acting in the tenant the credential belongs to. JWT sessions may
+// switch to an organization tenant (see selectOrg); API keys are bound to the tenant they were created in.
+func (a *Application) AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	withJWT := a.JWTMiddleware(a.selectOrg(next))
+	withKey := a.APIKeyMiddleware(next)
+	return func(c *echo.Context) error {
+		if apiKeyFromRequest(c.Request()) != "" {
+			return withKey(c)
+		}
+		return withJWT(c)
+	}
+}
+
+// APIKeyMiddleware authenticates the request with an API key. Revoked, expired or unknown keys and keys of
+// disabled or deleted users get 401.
+func (a *Application) APIKeyMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c *echo.Context) error {
+		raw := apiKeyFromRequest(c.Request())
+		id, ok := parseAPIKey(raw)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid api key"})
+		}
+		ctx := c.Request().Context()
+		key, err := a.Auth.GetAPIKey(ctx, id)
+		if err != nil {
+			if errors.Is(err, authstore.ErrNotFound) {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid api key"})
+			}
+			a.Logger.Error("api key lookup failed", "error", err)
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "failed to validate api key"})
+		}
+		now := time.Now()
+		if key.KeyHash != hashToken(raw) || key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid api key"})
+		}
+		// Disabling a user stops their keys like their sessions.
+		creator, err := a.Auth.GetUser(ctx, key.CreatedBy)
+		if err != nil {
+			if errors.Is(err, authstore.ErrNotFound) {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid api key"})
+			}
+			a.Logger.Error("user lookup failed", "username", key.CreatedBy, "error", err)
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "failed to validate api key"})
+		}
+		if creator.Disabled {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid api key"})
+		}
+
+		role := roleOrOwner(key.Role)
+		if org, ok := strings.CutPrefix(key.Tenant, orgTenantPrefix); ok {
+			// Keys of an organization stop working when their creator leaves it and never exceed
+			// the creator's current role there.
+			m, err := a.Auth.GetMembership(ctx, org, key.CreatedBy)
+			if err != nil {
+				if errors.Is(err, authstore.ErrNotFound) {
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid api key"})
+				}
+				a.Logger.Error("membership lookup failed", "org", org, "error", err)
+				return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "failed to validate api key"})
+			}
+			if roleRank[m.Role] < roleRank[role] {
+				role = m.Role
+			}
+		}
+
+		go func() {
+			if err := a.Auth.TouchAPIKey(context.Background(), key.ID, now.UTC()); err != nil {
+				a.Logger.Error("failed to record api key usage", "id", key.ID, "error", err)
+			}
+		}()
+
+		p := &Principal{
+			Subject:    key.CreatedBy,
+			Tenant:     key.Tenant,
+			Role:       role,
+			AuthMethod: authMethodAPIKey,
+			APIKeyID:   key.ID,
+			Scopes:     key.Scopes,
+		}
+		if org, ok := strings.CutPrefix(key.Tenant, orgTenantPrefix); ok {
+			p.Org = org
+		}
+		setPrincipal(c, p)
+		return next(c)
+	}
+}
+
+// requireScope rejects API key requests that lack scope with 403. JWT sessions pass unchanged.
+func requireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			if p := principalOf(c); p != nil && p.AuthMethod == authMethodAPIKey {
+				if !slices.Contains(p.Scopes, scope) {
+					return c.JSON(http.StatusForbidden, map[string]string{"error": "api key lacks scope " + scope})
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// requireSession rejects API key requests with 403, e.g. so a leaked key cannot mint further keys.
+func requireSession(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c *echo.Context) error {
+		if p := principalOf(c); p != nil && p.AuthMethod == authMethodAPIKey {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "not allowed with an api key"})
+		}
+		return next(c)
+	}
+}
+
+// ListAPIKeys returns the caller's API keys (GET /api/v1/apikeys); see Principal.apiKeyCreator.
+func (a *Application) ListAPIKeys(c *echo.Context) error {
+	p := principalOf(c)
+	keys, err := a.Auth.ListAPIKeys(c.Request().Context(), p.Tenant, p.apiKeyCreator())
+	if err != nil {
+		a.Logger.Error("failed to list api keys", "user", p.Tenant, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list api keys"})
+	}
+	out := make([]models.APIKey, 0, len(keys))
+	for i := range keys {
+		out = append(out, apiKeyToModel(&keys[i]))
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+// CreateAPIKey creates a tenant-scoped API key (POST /api/v1/apikeys). The key value is returned only once.
+func (a *Application) CreateAPIKey(c *echo.Context) error {
+	user := tenantOf(c)
+	var req models.CreateAPIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		a.Logger.Error("failed to bind request", "error", err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > apiKeyNameMax {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "name is required (max 64 characters)"})
+	}
+	if len(req.Scopes) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "at least one scope is required"})
+	}
+	for _, s := range req.Scopes {
+		if !slices.Contains(allScopes, s) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "unknown scope " + s + " (allowed: " + strings.Join(allScopes, ", ") + ")"})
+		}
+	}
+	scopes := slices.Compact(slices.Sorted(slices.Values(req.Scopes)))
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "expiresAt must be in the future"})
+	}
+
+	id, raw, err := newAPIKey()
+	if err != nil {
+		a.Logger.Error("failed to generate api key", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create api key"})
+	}
+	key := authstore.APIKey{
+		ID:        id,
+		Tenant:    user,
+		Name:      req.Name,
+		KeyHash:   hashToken(raw),
+		Scopes:    scopes,
+		Role:      currentRole(c),
+		CreatedBy: subjectOf(c),
+		ExpiresAt: req.ExpiresAt,
+		CreatedAt: time.Now().UTC(),
+	}
+	ctx := c.Request().Context()
+	if err := a.Auth.CreateAPIKey(ctx, key); err != nil {
+		a.Logger.Error("failed to store api key", "user", user, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create api key"})
+	}
+	a.writeAuditLog(ctx, user, "", "apikey_create", map[string]any{"id": id, "name": key.Name, "scopes": scopes})
+	return c.JSON(http.StatusCreated, models.CreateAPIKeyResponse{APIKey: apiKeyToModel(&key), Key: raw})
+}
+
+// RevokeAPIKey revokes one of the caller's API keys (DELETE /api/v1/apikeys/:id); see
+// Principal.apiKeyCreator. Keys the caller may not manage are not found.
+func (a *Application) RevokeAPIKey(c *echo.Context) error {
+	p := principalOf(c)
+	user := p.Tenant
+	id := c.Param("id")
+	ctx := c.Request().Context()
+	if err := a.Auth.RevokeAPIKey(ctx, user, p.apiKeyCreator(), id); err != nil {
+		if errors.Is(err, authstore.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "api key not found"})
+		}
+		a.Logger.Error("failed to revoke api key", "user", user, "id", id, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to revoke api key"})
+	}
+	a.writeAuditLog(ctx, user, "", "apikey_revoke", map[string]any{"id": id})
+	return c.NoContent(http.StatusNoContent)
+}
+
+// apiKeyFromRequest returns the API key from X-API-Key or an "Authorization: Bearer paas_..." header.
+func apiKeyFromRequest(r *http.Request) string {
+	if k := r.Header.Get("X-API-Key"); k != "" {
+		return k
+	}
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && strings.HasPrefix(bearer, apiKeyPrefix) {
+		return bearer
+	}
+	return ""
+}
+
+// parseAPIKey extracts the id from paas_<id>_<secret>.
+func parseAPIKey(raw string) (string, bool) {
+	rest, ok := strings.CutPrefix(raw, apiKeyPrefix)
+	if !ok {
+		return "", false
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return "", false
+	}
+	return id, true
+}
+
+// newAPIKey returns a fresh key id and the full key value.
+func newAPIKey() (id, raw string, err error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	id = hex.EncodeToString(b)
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return id, apiKeyPrefix + id + "_" + secret, nil
+}
+
+// apiKeyToModel maps a stored key to the API model.
+func apiKeyToModel(k *authstore.APIKey) models.APIKey {
+	return models.APIKey{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     apiKeyPrefix + k.ID,
+		Scopes:     k.Scopes,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		RevokedAt:  k.RevokedAt,
+		CreatedAt:  k.CreatedAt,
+	}
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/backupstore"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/k8s"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+	"github.com/labstack/echo/v5"
+)
+
+func backupToModel(b backupstore.Backup) models.Backup {
+	return models.Backup{
+		ID:          b.ID,
+		InstanceID:  b.InstanceID,
+		State:       b.State,
+		Location:    b.Location,
+		SizeBytes:   b.SizeBytes,
+		Error:       b.Error,
+		CreatedBy:   b.CreatedBy,
+		Scheduled:   b.Scheduled,
+		CreatedAt:   b.CreatedAt,
+		CompletedAt: b.CompletedAt,
+	}
+}
+
+// backupsUnavailable writes 503 when backups are not configured.
+func backupsUnavailable(c *echo.Context) error {
+	return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": k8s.ErrBackupsDisabled.Error()})
+}
+
+// refreshBackup updates a running backup from its Job. The first replica to record the outcome writes the
+// backup_completed or backup_failed service log.
+func (a *Application) refreshBackup(ctx context.Context, b *backupstore.Backup) {
+	if b.State != models.BackupRunning || a.BackupJobs == nil {
+		return
+	}
+	st, err := a.BackupJobs.BackupStatus(ctx, b.ID, b.Location)
+	if err != nil {
+		a.Logger.Warn("backup status check failed", "backupId", b.ID, "error", err)
+		return
+	}
+	if st.State == models.BackupRunning {
+		return
+	}
+	now := time.Now().UTC()
+	b.State, b.SizeBytes, b.Error, b.CompletedAt = st.State, st.SizeBytes, st.Error, &now
+	if err := a.Backups.UpdateBackup(ctx, *b); err != nil {
+		if !errors.Is(err, backupstore.ErrNotFound) {
+			a.Logger.Error("backup update failed", "backupId", b.ID, "error", err)
+		}
+		return
+	}
+	a.writeServiceLog(ctx, b.Tenant, b.InstanceID, "backup_"+b.State, "backup "+b.ID+" "+b.State, map[string]any{
+		"backupId":  b.ID,
+		"location":  b.Location,
+		"sizeBytes": b.SizeBytes,
+		"error":     b.Error,
+		"scheduled": b.Scheduled,
+	})
+}
+
+// startBackup starts a backup of instance id and records it, including the backup_create audit log entry
+// (with details added to it). Returns k8s.ErrNotFound if the instance does not exist and
+// k8s.ErrBackupsDisabled if backups are not configured.
+func (a *Application) startBackup(ctx context.Context, user, id string, details map[string]any) (*backupstore.Backup, error) {
+	if a.BackupJobs == nil {
+		return nil, k8s.ErrBackupsDisabled
+	}
+	backupID, err := backupstore.NewID()
+	if err != nil {
+		return nil, fmt.Errorf("generate backup id: %w", err)
+	}
+	location, err := a.BackupJobs.StartBackup(ctx, id, backupID)
+	if err != nil {
+		return nil, err
+	}
+	actor := actorFromContext(ctx)
+	if actor == "" {
+		actor = user
+	}
+	b := &backupstore.Backup{
+		ID:         backupID,
+		Tenant:     user,
+		InstanceID: id,
+		State:      models.BackupRunning,
+		Location:   location,
+		CreatedBy:  actor,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := a.Backups.CreateBackup(ctx, *b); err != nil {
+		// Without its record no one would finish or delete the backup: remove the Job and its file.
+		if derr := a.BackupJobs.DeleteBackupObject(context.WithoutCancel(ctx), backupID, location); derr != nil {
+			a.Logger.Error("failed to remove unrecorded backup", "backupId", backupID, "error", derr)
+		}
+		return nil, fmt.Errorf("store backup %s: %w", backupID, err)
+	}
+	audit := map[string]any{"backupId": backupID, "location": location}
+	for k, v := range details {
+		audit[k] = v
+	}
+	a.writeAuditLog(ctx, user, id, "backup_create", audit)
+	return b, nil
+}
+
+// CreateBackup starts an RDB backup of the instance to object storage (POST /instances/:id/backups) and
+// responds 202 with the running backup; poll the Location header for the outcome. Returns 404 if the
+// instance does not exist and 503 if backups are not configured.
+func (a *Application) CreateBackup(c *echo.Context) error {
+	id := c.Param("id")
+	user := tenantOf(c)
+	ctx, err := k8s.WithTenant(c.Request().Context(), user)
+	if err != nil {
+		return tenantError(c, err)
+	}
+	b, err := a.startBackup(ctx, user, id, nil)
+	if err != nil {
+		switch {
+		case errors.Is(err, k8s.ErrNotFound):
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "instance not found"})
+		case errors.Is(err, k8s.ErrBackupsDisabled):
+			return backupsUnavailable(c)
+		}
+		a.Logger.Error("failed to start backup", "id", id, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create backup"})
+	}
+	c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/api/v1/instances/%s/backups/%s", id, b.ID))
+	return c.JSON(http.StatusAccepted, backupToModel(*b))
+}
+
+// ListBackups returns the instance's backups, newest first (GET /instances/:id/backups). Backups outlive
+// their instance, so the instance does not have to exist.
+func (a *Application) ListBackups(c *echo.Context) error {
+	id := c.Param("id")
+	user := tenantOf(c)
+	ctx, err := k8s.WithTenant(c.Request().Context(), user)
+	if err != nil {
+		return tenantError(c, err)
+	}
+	backups, err := a.Backups.ListBackups(ctx, user, id)
+	if err != nil {
+		a.Logger.Error("failed to list backups", "id", id, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list backups"})
+	}
+	out := make([]models.Backup, len(backups))
+	for i := range backups {
+		a.refreshBackup(ctx, &backups[i])
+		out[i] = backupToModel(backups[i])
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+// getBackup loads the tenant's backup of instance id. If it returns nil, it has written the error response
+// (404 for unknown backups) and returns the result of writing it.
+func (a *Application) getBackup(c *echo.Context, ctx context.Context, user, id string) (*backupstore.Backup, error) {
+	b, err := a.Backups.GetBackup(ctx, user, c.Param("backupId"))
+	if err == nil && b.InstanceID != id {
+		err = backupstore.ErrNotFound
+	}
+	if err != nil {
+		if errors.Is(err, backupstore.ErrNotFound) {
+			return nil, c.JSON(http.StatusNotFound, map[string]string{"error": "backup not found"})
+		}
+		a.Logger.Error("failed to get backup", "id", id, "error", err)
+		return nil, c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get backup"})
+	}
+	return b, nil
+}
+
+// GetBackup returns one backup of the instance (GET /instances/:id/backups/:backupId).
+func (a *Application) GetBackup(c *echo.Context) error {
+	id := c.Param("id")
+	user := tenantOf(c)
+	ctx, err := k8s.WithTenant(c.Request().Context(), user)
+	if err != nil {
+		return tenantError(c, err)
+	}
+	b, resp := a.getBackup(c, ctx, user, id)
+	if b == nil {
+		return resp
+	}
+	a.refreshBackup(ctx, b)
+	return c.JSON(http.StatusOK, backupToModel(*b))
+}
+
+// DeleteBackup removes a backup and its RDB file (DELETE /instances/:id/backups/:backupId). Returns 409
+// while the backup is still running.
+func (a *Application) DeleteBackup(c *echo.Context) error {
+	id := c.Param("id")
+	user := tenantOf(c)
+	ctx, err := k8s.WithTenant(c.Request().Context(), user)
+	if err != nil {
+		return tenantError(c, err)
+	}
+	if a.BackupJobs == nil {
+		return backupsUnavailable(c)
+	}
+	b, resp := a.getBackup(c, ctx, user, id)
+	if b == nil {
+		return resp
+	}
+	a.refreshBackup(ctx, b)
+	if !backupToModel(*b).Done() {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "backup is still running"})
+	}
+	if err := a.BackupJobs.DeleteBackupObject(ctx, b.ID, b.Location); err != nil {
+		a.Logger.Error("failed to delete backup object", "backupId", b.ID, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to delete backup"})
+	}
+	if err := a.Backups.DeleteBackup(ctx, user, b.ID); err != nil && !errors.Is(err, backupstore.ErrNotFound) {
+		a.Logger.Error("failed to delete backup", "backupId", b.ID, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to delete backup"})
+	}
+	a.writeAuditLog(ctx, user, id, "backup_delete", map[string]any{"backupId": b.ID, "location": b.Location})
+	return c.NoContent(http.StatusNoContent)
+}
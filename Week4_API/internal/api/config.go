@@ -1,9 +1,30 @@
 package api
 
 import (
+	"fmt"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/auth"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/cache"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/k8s"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Default per-tenant quota; room for a handful of default (3+3 replica) instances.
+const (
+	defaultQuotaMaxInstances = 5
+	defaultQuotaCPU          = "8"
+	defaultQuotaMemory       = "16Gi"
+	defaultQuotaStorage      = "50Gi"
 )
 
+// defaultInformerResync is how often the instance store's informers replay their caches.
+const defaultInformerResync = 10 * time.Minute
+
 // Config holds API and RedisFailover backend settings. Only RedisFailover is used as the instance backend.
 type Config struct {
 	KubeConfigPath            string
@@ -11,9 +32,77 @@ type Config struct {
 	APIListenAddr             string
 	RedisFailoverTemplatePath string
 	DefaultStorageClass       string
+	// StorageClasses (PAAS_STORAGE_CLASSES, comma-separated) limits the StorageClasses tenants may use and
+	// GET /api/v1/storage-classes lists; empty allows every class of the cluster.
+	StorageClasses []string
+	// Per-tenant quota, installed as ResourceQuota/LimitRange in each tenant namespace and checked before
+	// creating or resizing instances: PAAS_QUOTA_MAX_INSTANCES (default 5), PAAS_QUOTA_CPU (default 8),
+	// PAAS_QUOTA_MEMORY (default 16Gi) and PAAS_QUOTA_STORAGE (default 50Gi). "0" disables a limit.
+	QuotaMaxInstances int
+	QuotaCPU          string
+	QuotaMemory       string
+	QuotaStorage      string
+	// OperationTimeout fails instance operations whose rollout takes longer (PAAS_OPERATION_TIMEOUT, default 15m).
+	OperationTimeout time.Duration
+	// InformerResync is the resync period of the instance store's informers (PAAS_INFORMER_RESYNC, default 10m).
+	InformerResync time.Duration
+	// LeaseNamespace (PAAS_LEASE_NAMESPACE, default PaaSNamespace) holds the Lease that elects the replica
+	// running background controllers; PodName (POD_NAME, default the hostname) identifies this replica.
+	LeaseNamespace string
+	PodName        string
+	// Backups are written by Jobs to an S3-compatible bucket (PAAS_BACKUP_S3_BUCKET; unset disables
+	// backups) at PAAS_BACKUP_S3_ENDPOINT (empty for AWS S3, e.g. http://minio.minio.svc:9000 for MinIO)
+	// in PAAS_BACKUP_S3_REGION, with PAAS_BACKUP_S3_ACCESS_KEY and PAAS_BACKUP_S3_SECRET_KEY. The Job images
+	// can be overridden with PAAS_BACKUP_REDIS_IMAGE and PAAS_BACKUP_UPLOADER_IMAGE.
+	Backup k8s.BackupConfig
+	// PlansFile is a YAML file with the service plan catalog (PAAS_PLANS_FILE); empty uses k8s.DefaultPlans.
+	PlansFile string
 	// DatabaseURL is the PostgreSQL connection string for user-centric logs (audit_logs, service_logs).
 	// If empty, log store is nil and audit/service log writes and GET /instances/:id/logs are skipped.
+	// The same connection backs the user store (users table); without it users are kept in memory.
 	DatabaseURL string
+
+	// AdminUsers may create, disable and enable local users (PAAS_ADMIN_USERS, comma-separated).
+	AdminUsers []string
+	// AllowRegistration enables public sign-up via POST /api/register (PAAS_ALLOW_REGISTRATION=true).
+	AllowRegistration bool
+	// BootstrapUser and BootstrapPassword create an initial user at startup if it does not exist yet
+	// (PAAS_BOOTSTRAP_USER, PAAS_BOOTSTRAP_PASSWORD). Useful for the in-memory store and first deployments.
+	BootstrapUser     string
+	BootstrapPassword string
+
+	// JWT signing keys. JWTSigningKey (PEM, JWT_SIGNING_KEY) or JWTSigningKeyFile (JWT_SIGNING_KEY_FILE) select
+	// RS256/ES256 from the key type; JWTSecret (JWT_SECRET) is the legacy HS256 fallback. If none is set an
+	// ephemeral key is generated (tokens are then lost on restart and not valid across HPA replicas).
+	JWTSigningKey     string
+	JWTSigningKeyFile string
+	JWTSecret         string
+	JWTKeyID          string // JWT_KEY_ID; kid header of issued tokens (default: key thumbprint)
+	// JWTVerifyKeys lists previous keys still accepted during rotation (JWT_VERIFY_KEYS, comma-separated "kid=path").
+	JWTVerifyKeys []string
+	JWTIssuer     string // JWT_ISSUER; "iss" claim of issued tokens (default "paas-api")
+	// AccessTokenTTL (JWT_ACCESS_TOKEN_TTL, default 15m) and RefreshTokenTTL (JWT_REFRESH_TOKEN_TTL, default 168h)
+	// bound token lifetimes; values use Go duration syntax.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// OpenID Connect login (GET /api/oidc/login). Enabled when OIDCIssuerURL (OIDC_ISSUER_URL) is set;
+	// OIDC_CLIENT_ID, OIDC_CLIENT_SECRET and OIDC_REDIRECT_URL (our /api/oidc/callback URL) are then required.
+	OIDCIssuerURL    string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       []string // OIDC_SCOPES, comma-separated (default "openid,profile,email")
+	// OIDCUsernameClaim (OIDC_USERNAME_CLAIM, default "preferred_username") names the claim the username of a
+	// new SSO user is derived from; "name@domain" becomes "name-domain". Logins find users by issuer and subject.
+	OIDCUsernameClaim string
+	// OIDCAcceptAccessTokens (OIDC_ACCEPT_ACCESS_TOKENS=true) lets /api/v1 accept JWT access tokens issued by
+	// the provider, for audience OIDCAudience (OIDC_AUDIENCE, default: the client id).
+	OIDCAcceptAccessTokens bool
+	OIDCAudience           string
+	// OIDCPostLoginRedirect (OIDC_POST_LOGIN_REDIRECT) is the frontend URL the callback redirects to, with the
+	// tokens in the URL fragment. If empty the callback responds with the LoginResponse JSON.
+	OIDCPostLoginRedirect string
 }
 
 // GetConfig loads config from environment with centralized defaults.
@@ -37,13 +126,175 @@ func GetConfig() *Config {
 	if defaultStorageClass == "" {
 		defaultStorageClass = "premium-perf1-stackit"
 	}
+	oidcUsernameClaim := os.Getenv("OIDC_USERNAME_CLAIM")
+	if oidcUsernameClaim == "" {
+		oidcUsernameClaim = "preferred_username"
+	}
+	podName := os.Getenv("POD_NAME")
+	if podName == "" {
+		podName, _ = os.Hostname()
+	}
+	jwtIssuer := os.Getenv("JWT_ISSUER")
+	if jwtIssuer == "" {
+		jwtIssuer = "paas-api"
+	}
+	backup := k8s.BackupConfig{
+		Endpoint:      os.Getenv("PAAS_BACKUP_S3_ENDPOINT"),
+		Region:        os.Getenv("PAAS_BACKUP_S3_REGION"),
+		Bucket:        os.Getenv("PAAS_BACKUP_S3_BUCKET"),
+		AccessKey:     os.Getenv("PAAS_BACKUP_S3_ACCESS_KEY"),
+		SecretKey:     os.Getenv("PAAS_BACKUP_S3_SECRET_KEY"),
+		RedisImage:    os.Getenv("PAAS_BACKUP_REDIS_IMAGE"),
+		UploaderImage: os.Getenv("PAAS_BACKUP_UPLOADER_IMAGE"),
+	}
 
 	return &Config{
-		KubeConfigPath:           kubeConfigPath,
-		PaaSNamespace:            paasNamespace,
-		APIListenAddr:            apiListenAddr,
+		KubeConfigPath:            kubeConfigPath,
+		PaaSNamespace:             paasNamespace,
+		APIListenAddr:             apiListenAddr,
 		RedisFailoverTemplatePath: templatePath,
-		DefaultStorageClass:      defaultStorageClass,
-		DatabaseURL:              databaseURL,
+		DefaultStorageClass:       defaultStorageClass,
+		StorageClasses:            splitList(os.Getenv("PAAS_STORAGE_CLASSES")),
+		QuotaMaxInstances:         intEnv("PAAS_QUOTA_MAX_INSTANCES", defaultQuotaMaxInstances),
+		QuotaCPU:                  stringEnv("PAAS_QUOTA_CPU", defaultQuotaCPU),
+		QuotaMemory:               stringEnv("PAAS_QUOTA_MEMORY", defaultQuotaMemory),
+		QuotaStorage:              stringEnv("PAAS_QUOTA_STORAGE", defaultQuotaStorage),
+		InformerResync:            durationEnv("PAAS_INFORMER_RESYNC", defaultInformerResync),
+		LeaseNamespace:            stringEnv("PAAS_LEASE_NAMESPACE", paasNamespace),
+		PodName:                   podName,
+		PlansFile:                 os.Getenv("PAAS_PLANS_FILE"),
+		Backup:                    backup,
+		OperationTimeout:          durationEnv("PAAS_OPERATION_TIMEOUT", defaultOperationTimeout),
+		DatabaseURL:               databaseURL,
+		AdminUsers:                splitList(os.Getenv("PAAS_ADMIN_USERS")),
+		AllowRegistration:         os.Getenv("PAAS_ALLOW_REGISTRATION") == "true",
+		BootstrapUser:             os.Getenv("PAAS_BOOTSTRAP_USER"),
+		BootstrapPassword:         os.Getenv("PAAS_BOOTSTRAP_PASSWORD"),
+		JWTSigningKey:             os.Getenv("JWT_SIGNING_KEY"),
+		JWTSigningKeyFile:         os.Getenv("JWT_SIGNING_KEY_FILE"),
+		JWTSecret:                 os.Getenv("JWT_SECRET"),
+		JWTKeyID:                  os.Getenv("JWT_KEY_ID"),
+		JWTVerifyKeys:             splitList(os.Getenv("JWT_VERIFY_KEYS")),
+		JWTIssuer:                 jwtIssuer,
+		AccessTokenTTL:            durationEnv("JWT_ACCESS_TOKEN_TTL", defaultAccessTokenTTL),
+		RefreshTokenTTL:           durationEnv("JWT_REFRESH_TOKEN_TTL", defaultRefreshTokenTTL),
+		OIDCIssuerURL:             os.Getenv("OIDC_ISSUER_URL"),
+		OIDCClientID:              os.Getenv("OIDC_CLIENT_ID"),
+		OIDCClientSecret:          os.Getenv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:           os.Getenv("OIDC_REDIRECT_URL"),
+		OIDCScopes:                splitList(os.Getenv("OIDC_SCOPES")),
+		OIDCUsernameClaim:         oidcUsernameClaim,
+		OIDCAcceptAccessTokens:    os.Getenv("OIDC_ACCEPT_ACCESS_TOKENS") == "true",
+		OIDCAudience:              os.Getenv("OIDC_AUDIENCE"),
+		OIDCPostLoginRedirect:     os.Getenv("OIDC_POST_LOGIN_REDIRECT"),
+	}
+}
+
+// KeySetConfig returns the JWT key settings in the form expected by auth.LoadKeySet.
+func (c *Config) KeySetConfig() auth.KeySetConfig {
+	return auth.KeySetConfig{
+		SigningKeyPEM:  c.JWTSigningKey,
+		SigningKeyFile: c.JWTSigningKeyFile,
+		KeyID:          c.JWTKeyID,
+		HMACSecret:     c.JWTSecret,
+		VerifyKeys:     c.JWTVerifyKeys,
+	}
+}
+
+// splitList splits a comma-separated env value into trimmed, non-empty items.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// stringEnv returns the env value, or def when unset.
+func stringEnv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// intEnv parses a non-negative integer env value, falling back to def when unset or invalid.
+func intEnv(key string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n < 0 {
+		return def
+	}
+	return n
+}
+
+// StoreConfig returns the instance store settings for k8s.NewRedisFailoverStore. Quota quantities must
+// parse as Kubernetes quantities, the plans file, if set, must hold a valid catalog and the default
+// StorageClass must be allowed.
+func (c *Config) StoreConfig() (k8s.StoreConfig, error) {
+	quota := k8s.Quota{MaxInstances: c.QuotaMaxInstances}
+	for _, q := range []struct {
+		env, value string
+		dst        *resource.Quantity
+	}{
+		{"PAAS_QUOTA_CPU", c.QuotaCPU, &quota.CPU},
+		{"PAAS_QUOTA_MEMORY", c.QuotaMemory, &quota.Memory},
+		{"PAAS_QUOTA_STORAGE", c.QuotaStorage, &quota.Storage},
+	} {
+		v, err := resource.ParseQuantity(q.value)
+		if err != nil {
+			return k8s.StoreConfig{}, fmt.Errorf("%s: %w", q.env, err)
+		}
+		*q.dst = v
+	}
+	plans, err := k8s.LoadPlanCatalog(c.PlansFile)
+	if err != nil {
+		return k8s.StoreConfig{}, fmt.Errorf("PAAS_PLANS_FILE: %w", err)
+	}
+	if len(c.StorageClasses) > 0 && !slices.Contains(c.StorageClasses, c.DefaultStorageClass) {
+		return k8s.StoreConfig{}, fmt.Errorf("PAAS_DEFAULT_STORAGE_CLASS %q is not in PAAS_STORAGE_CLASSES", c.DefaultStorageClass)
+	}
+	return k8s.StoreConfig{
+		Namespace:           c.PaaSNamespace,
+		TemplatePath:        c.RedisFailoverTemplatePath,
+		DefaultStorageClass: c.DefaultStorageClass,
+		StorageClasses:      c.StorageClasses,
+		Quota:               quota,
+		Plans:               plans,
+		Backup:              c.Backup,
+		BackupSchedules:     c.Backup.Bucket != "" && c.DatabaseURL != "",
+		RedisAdmin:          cache.NewClient(),
+	}, nil
+}
+
+// LeaderConfig returns the settings for k8s.RunWhileLeader on the given Lease.
+func (c *Config) LeaderConfig(leaseName string) k8s.LeaderConfig {
+	return k8s.LeaderConfig{
+		KubeConfigPath: c.KubeConfigPath,
+		Namespace:      c.LeaseNamespace,
+		LeaseName:      leaseName,
+		Identity:       c.PodName,
+	}
+}
+
+// durationEnv parses a duration env value, falling back to def when unset, invalid or not positive.
+func durationEnv(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
+// OIDCConfig returns the provider settings in the form expected by auth.DiscoverOIDC.
+func (c *Config) OIDCConfig() auth.OIDCConfig {
+	return auth.OIDCConfig{
+		IssuerURL:    c.OIDCIssuerURL,
+		ClientID:     c.OIDCClientID,
+		ClientSecret: c.OIDCClientSecret,
+		RedirectURL:  c.OIDCRedirectURL,
+		Scopes:       c.OIDCScopes,
+		Audience:     c.OIDCAudience,
 	}
 }
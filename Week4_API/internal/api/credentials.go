@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/k8s"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+	"github.com/labstack/echo/v5"
+)
+
+// defaultPasswordGracePeriod is how long the previous password keeps working when the rotation request
+// does not say.
+const defaultPasswordGracePeriod = 5 * time.Minute
+
+// GetCredentials returns the endpoint and current password of the instance (GET /instances/:id/credentials)
+// and writes a credentials_read audit entry for each retrieval. Returns 404 if the instance does not exist
+// and 410 if it was created with revealCredentialsOnce: its password was only in the responses of the calls
+// that set it, and rotating it is the way to get a new one.
+func (a *Application) GetCredentials(c *echo.Context) error {
+	id := c.Param("id")
+	user := tenantOf(c)
+	ctx, err := k8s.WithTenant(c.Request().Context(), user)
+	if err != nil {
+		return tenantError(c, err)
+	}
+	inst, err := a.Store.GetInstance(ctx, id)
+	if err == nil && inst == nil {
+		err = k8s.ErrNotFound
+	}
+	var creds *models.InstanceCredentials
+	if err == nil && !inst.RevealCredentialsOnce {
+		creds, err = a.Store.GetCredentials(ctx, id)
+	}
+	if err != nil {
+		if errors.Is(err, k8s.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "instance not found"})
+		}
+		a.Logger.Error("failed to get credentials", "id", id, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get credentials"})
+	}
+	if creds == nil {
+		a.writeAuditLog(ctx, user, id, "credentials_read", map[string]any{"revealed": false})
+		return c.JSON(http.StatusGone, map[string]string{"error": "the password of this instance is only revealed once; rotate the credentials to get a new one"})
+	}
+	a.writeAuditLog(ctx, user, id, "credentials_read", map[string]any{"revealed": true})
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, creds)
+}
+
+// RotateCredentials gives the instance a new password (POST /instances/:id/credentials/rotate) and returns
+// it. Clients using the previous password keep working for gracePeriodSeconds (default 300, at most
+// 86400; 0 invalidates it at once). The audit log records the rotation but never a password. Returns 404
+// if the instance does not exist and 409 if its pods cannot be reconfigured right now (e.g. while not all
+// of them are running).
+func (a *Application) RotateCredentials(c *echo.Context) error {
+	id := c.Param("id")
+	if a.Passwords == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "password rotation is not available"})
+	}
+	var req models.RotateCredentialsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	grace := defaultPasswordGracePeriod
+	if req.GracePeriodSeconds != nil {
+		grace = time.Duration(*req.GracePeriodSeconds) * time.Second
+		if *req.GracePeriodSeconds < 0 || grace > k8s.MaxPasswordGracePeriod {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("gracePeriodSeconds must be between 0 and %d", int(k8s.MaxPasswordGracePeriod.Seconds()))})
+		}
+	}
+	user := tenantOf(c)
+	ctx, err := k8s.WithTenant(c.Request().Context(), user)
+	if err != nil {
+		return tenantError(c, err)
+	}
+	rotation, err := a.Passwords.RotatePassword(ctx, id, grace)
+	if err != nil {
+		switch {
+		case errors.Is(err, k8s.ErrNotFound):
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "instance not found"})
+		case errors.Is(err, k8s.ErrRotationUnavailable):
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		a.Logger.Error("failed to rotate password", "id", id, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to rotate password"})
+	}
+	a.writeAuditLog(ctx, user, id, "credentials_rotate", map[string]any{"gracePeriodSeconds": int(grace.Seconds())})
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, rotation)
+}
@@ -6,15 +6,16 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
-	"strings"
-	"sync"
 	"time"
 
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/auth"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/authstore"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/backupstore"
 	"github.com/Fearcon14/level3-cloud/Week4_API/internal/cache"
 	"github.com/Fearcon14/level3-cloud/Week4_API/internal/k8s"
 	"github.com/Fearcon14/level3-cloud/Week4_API/internal/logstore"
 	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/opstore"
 	"github.com/labstack/echo/v5"
 )
 
@@ -24,34 +25,98 @@ const MaxCacheKeyLength = 512
 // Application holds dependencies for our handlers (e.g. K8s client, Logger etc.)
 type Application struct {
 	Store       k8s.InstanceStore
+	Plans       *k8s.PlanCatalog // served by GET /api/v1/plans; should match the store's catalog
 	CacheClient cache.ClientInterface
 	LogStore    logstore.Store // nil if DATABASE_URL unset; audit/service log writes and ListLogs no-op or skip
+	Auth        authstore.Store
 	Logger      *slog.Logger
-	// lastInstanceStatus is used to detect status changes for service log (key: instanceID, value: status).
-	lastInstanceStatus   map[string]string
-	lastInstanceStatusMu sync.RWMutex
+	// Backups holds backup metadata; BackupJobs writes and removes the RDB files (nil disables backups).
+	Backups    backupstore.Store
+	BackupJobs k8s.BackupJobs
+	// Passwords rotates instance passwords (nil disables POST /instances/:id/credentials/rotate).
+	Passwords k8s.PasswordRotator
+	// Keys signs issued tokens and verifies incoming ones; JWTIssuer is the "iss" claim of issued tokens.
+	Keys      *auth.KeySet
+	JWTIssuer string
+	// AccessTokenTTL and RefreshTokenTTL bound the lifetime of issued tokens.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// AdminUsers may manage local users (create/disable/enable).
+	AdminUsers map[string]bool
+	// AllowRegistration enables public sign-up via POST /api/register.
+	AllowRegistration bool
+	// OIDC is the external identity provider for GET /api/oidc/login; nil disables SSO.
+	OIDC *auth.OIDCProvider
+	// OIDCUsernameClaim names the ID token claim the username of a new SSO user is derived from.
+	OIDCUsernameClaim string
+	// OIDCAcceptAccessTokens lets JWTMiddleware accept access tokens issued by OIDC.
+	OIDCAcceptAccessTokens bool
+	// OIDCPostLoginRedirect is the frontend URL the OIDC callback redirects to (tokens in the fragment).
+	OIDCPostLoginRedirect string
+	// OperationTimeout fails operations whose rollout does not finish in time; OperationPollInterval is
+	// how often their instance's pods are checked.
+	OperationTimeout      time.Duration
+	OperationPollInterval time.Duration
+	// Operations holds the operations of instance calls, shared by all replicas when in Postgres.
+	Operations opstore.Store
 }
 
-func NewApplication(store k8s.InstanceStore, cacheClient cache.ClientInterface, logStore logstore.Store, logger *slog.Logger) *Application {
+// NewApplication returns an Application with the default plan catalog and an ephemeral signing key, both
+// replaced by NewServer with the configured ones.
+func NewApplication(store k8s.InstanceStore, cacheClient cache.ClientInterface, logStore logstore.Store, authStore authstore.Store, logger *slog.Logger) (*Application, error) {
 	if cacheClient == nil {
 		cacheClient = cache.NewClient()
 	}
-	return &Application{
-		Store:                store,
-		CacheClient:          cacheClient,
-		LogStore:             logStore,
-		Logger:               logger,
-		lastInstanceStatus:   make(map[string]string),
+	if authStore == nil {
+		authStore = authstore.NewMemoryStore()
+	}
+	plans, err := k8s.NewPlanCatalog(k8s.DefaultPlans())
+	if err != nil {
+		return nil, fmt.Errorf("default plans: %w", err)
 	}
+	// Ephemeral signing key until NewServer installs the configured key set.
+	keys, _, err := auth.LoadKeySet(auth.KeySetConfig{})
+	if err != nil {
+		return nil, fmt.Errorf("generate signing key: %w", err)
+	}
+	return &Application{
+		Store:                 store,
+		CacheClient:           cacheClient,
+		LogStore:              logStore,
+		Auth:                  authStore,
+		Logger:                logger,
+		Backups:               backupstore.NewMemoryStore(),
+		Keys:                  keys,
+		Plans:                 plans,
+		JWTIssuer:             "paas-api",
+		AccessTokenTTL:        defaultAccessTokenTTL,
+		RefreshTokenTTL:       defaultRefreshTokenTTL,
+		AdminUsers:            make(map[string]bool),
+		OIDCUsernameClaim:     "preferred_username",
+		OperationTimeout:      defaultOperationTimeout,
+		OperationPollInterval: defaultOperationPollInterval,
+		Operations:            opstore.NewMemoryStore(),
+	}, nil
 }
 
+// logWriteTimeout bounds a background log write. Writes are detached from the caller's context, which
+// often ends right after the call (a finished request, a timed out operation).
+const logWriteTimeout = 10 * time.Second
+
 // writeAuditLog appends an audit log entry in the background. No-op if LogStore is nil. Errors are logged only.
+// The actor is taken from ctx (see withActor) and defaults to tenantUser.
 func (a *Application) writeAuditLog(ctx context.Context, tenantUser, instanceID, action string, details map[string]any) {
 	if a.LogStore == nil {
 		return
 	}
+	actor := actorFromContext(ctx)
+	if actor == "" {
+		actor = tenantUser
+	}
 	go func() {
-		if err := a.LogStore.AppendAuditLog(context.Background(), tenantUser, instanceID, action, details); err != nil {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), logWriteTimeout)
+		defer cancel()
+		if err := a.LogStore.AppendAuditLog(ctx, tenantUser, actor, instanceID, action, details); err != nil {
 			a.Logger.Error("audit log write failed", "instanceId", instanceID, "action", action, "error", err)
 		}
 	}()
@@ -63,30 +128,100 @@ func (a *Application) writeServiceLog(ctx context.Context, tenantUser, instanceI
 		return
 	}
 	go func() {
-		if err := a.LogStore.AppendServiceLog(context.Background(), tenantUser, instanceID, eventType, message, metadata); err != nil {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), logWriteTimeout)
+		defer cancel()
+		if err := a.LogStore.AppendServiceLog(ctx, tenantUser, instanceID, eventType, message, metadata); err != nil {
 			a.Logger.Error("service log write failed", "instanceId", instanceID, "eventType", eventType, "error", err)
 		}
 	}()
 }
 
-// namespaceForUser maps a user identifier (e.g. from X-User header) to a Kubernetes namespace.
-// Example: "alice" -> "tenant-alice".
-func namespaceForUser(user string) string {
-	user = strings.TrimSpace(strings.ToLower(user))
-	if user == "" {
-		return ""
+// tenantError writes the response for a failed k8s.WithTenant: 401 without a principal, otherwise 400
+// because the tenant name cannot be mapped onto a namespace.
+func tenantError(c *echo.Context, err error) error {
+	if principalOf(c) == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthenticated"})
+	}
+	return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+}
+
+// quotaError writes 409 (instance count) or 422 (CPU, memory, storage) if err is a k8s.QuotaExceededError.
+func quotaError(c *echo.Context, err error) (bool, error) {
+	var qe *k8s.QuotaExceededError
+	if !errors.As(err, &qe) {
+		return false, nil
+	}
+	status := http.StatusUnprocessableEntity
+	if qe.Resource == "instances" {
+		status = http.StatusConflict
 	}
-	return "tenant-" + user
+	return true, c.JSON(status, map[string]string{"error": qe.Error()})
+}
+
+// backupError writes 400 for unusable cloneFrom/restoreFrom sources and backup schedules, and 503 if they
+// need backups that are not configured.
+func backupError(c *echo.Context, err error) (bool, error) {
+	switch {
+	case errors.Is(err, k8s.ErrInvalidRestore), errors.Is(err, k8s.ErrInvalidSchedule):
+		return true, c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, k8s.ErrBackupsDisabled):
+		return true, c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+	}
+	return false, nil
+}
+
+// planError writes 400 for invalid plans and 422 for disallowed plan changes.
+func planError(c *echo.Context, err error) (bool, error) {
+	switch {
+	case errors.Is(err, k8s.ErrInvalidPlan):
+		return true, c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, k8s.ErrPlanChangeNotAllowed):
+		return true, c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+	return false, nil
+}
+
+// specError writes 400 if err rejects a Redis config parameter, persistence setting, resource value or
+// StorageClass.
+func specError(c *echo.Context, err error) (bool, error) {
+	if !errors.Is(err, k8s.ErrInvalidConfig) && !errors.Is(err, k8s.ErrInvalidPersistence) && !errors.Is(err, k8s.ErrInvalidResources) &&
+		!errors.Is(err, k8s.ErrInvalidStorageClass) {
+		return false, nil
+	}
+	return true, c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+}
+
+// storageError writes 422 for capacity changes the instance's volumes cannot make: shrinking, or growing
+// on a StorageClass without volume expansion.
+func storageError(c *echo.Context, err error) (bool, error) {
+	if !errors.Is(err, k8s.ErrCapacityShrink) && !errors.Is(err, k8s.ErrVolumeExpansionUnsupported) {
+		return false, nil
+	}
+	return true, c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+}
+
+// ListPlans returns the service plan catalog.
+func (a *Application) ListPlans(c *echo.Context) error {
+	return c.JSON(http.StatusOK, a.Plans.Plans())
+}
+
+// ListStorageClasses returns the StorageClasses instances may use, with their volume expansion support.
+func (a *Application) ListStorageClasses(c *echo.Context) error {
+	classes, err := a.Store.ListStorageClasses(c.Request().Context())
+	if err != nil {
+		a.Logger.Error("failed to list storage classes", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list storage classes"})
+	}
+	return c.JSON(http.StatusOK, classes)
 }
 
 // ListInstances returns a list of all Redis instances in the store's namespace.
 func (a *Application) ListInstances(c *echo.Context) error {
-	user := c.Request().Header.Get("X-User")
-	ns := namespaceForUser(user)
-	if ns == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "missing or empty X-User header"})
+	user := tenantOf(c)
+	ctx, err := k8s.WithTenant(c.Request().Context(), user)
+	if err != nil {
+		return tenantError(c, err)
 	}
-	ctx := k8s.WithNamespace(c.Request().Context(), ns)
 
 	instances, err := a.Store.ListInstances(ctx)
 	if err != nil {
@@ -99,12 +234,11 @@ func (a *Application) ListInstances(c *echo.Context) error {
 // GetInstance returns a single Redis instance by name (id). Returns 404 if not found.
 func (a *Application) GetInstance(c *echo.Context) error {
 	id := c.Param("id")
-	user := c.Request().Header.Get("X-User")
-	ns := namespaceForUser(user)
-	if ns == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "missing or empty X-User header"})
+	user := tenantOf(c)
+	ctx, err := k8s.WithTenant(c.Request().Context(), user)
+	if err != nil {
+		return tenantError(c, err)
 	}
-	ctx := k8s.WithNamespace(c.Request().Context(), ns)
 
 	instance, err := a.Store.GetInstance(ctx, id)
 	if err != nil {
@@ -115,84 +249,165 @@ func (a *Application) GetInstance(c *echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get instance"})
 	}
 
-	// Service log: record status change (best-effort)
-	a.lastInstanceStatusMu.Lock()
-	key := user + "/" + id
-	prev := a.lastInstanceStatus[key]
-	if prev != instance.Status {
-		a.lastInstanceStatus[key] = instance.Status
-		a.lastInstanceStatusMu.Unlock()
-		if prev != "" {
-			a.writeServiceLog(ctx, user, id, "status_change", "Instance status changed to "+instance.Status, map[string]any{"previous": prev})
-		}
-	} else {
-		a.lastInstanceStatusMu.Unlock()
-	}
-
 	return c.JSON(http.StatusOK, instance)
 }
 
-// CreateInstance creates a new Redis instance from the request.
+// CreateInstance creates a new Redis instance from the request and returns the operation following its
+// rollout (see respondOperation).
 func (a *Application) CreateInstance(c *echo.Context) error {
 	var req models.CreateRedisRequest
+	wait, err := waitParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 
 	if err := c.Bind(&req); err != nil {
 		a.Logger.Error("failed to bind request", "error", err)
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Errorf("failed to bind request").Error()})
 	}
 
-	if req.Name == "" || req.Capacity == "" {
+	if req.Name == "" {
 		a.Logger.Error("missing required fields")
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "name and capacity are required"})
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "name is required"})
 	}
 
-	user := c.Request().Header.Get("X-User")
-	ns := namespaceForUser(user)
-	if ns == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "missing or empty X-User header"})
+	user := tenantOf(c)
+	ctx, err := k8s.WithTenant(c.Request().Context(), user)
+	if err != nil {
+		return tenantError(c, err)
+	}
+
+	details := map[string]any{"name": req.Name}
+	if req.CloneFrom != nil {
+		// Reject what the create would reject before the backup of the source instance is taken.
+		if err := a.Store.ValidateCreate(ctx, req); err != nil {
+			return a.createError(c, err)
+		}
+		if ok, resp := a.resolveClone(c, ctx, user, &req); !ok {
+			return resp
+		}
+		details["cloneFrom"] = req.CloneFrom.InstanceID
+		req.CloneFrom = nil
 	}
-	ctx := k8s.WithNamespace(c.Request().Context(), ns)
 
 	instance, err := a.Store.CreateInstance(ctx, req)
 	if err != nil {
-		a.Logger.Error("failed to create instance", "error", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to create instance: %v", err)})
-	}
-	a.writeAuditLog(ctx, user, instance.ID, "create", map[string]any{
-		"name":             req.Name,
-		"capacity":         req.Capacity,
-		"redisReplicas":    instance.RedisReplicas,
-		"sentinelReplicas": instance.SentinelReplicas,
-	})
-	return c.JSON(http.StatusCreated, instance)
+		return a.createError(c, err)
+	}
+	details["plan"] = instance.Plan
+	details["capacity"] = instance.Capacity
+	details["persistence"] = instance.Persistence
+	details["redisReplicas"] = instance.RedisReplicas
+	details["sentinelReplicas"] = instance.SentinelReplicas
+	if instance.RestoredFrom != "" {
+		details["restoredFrom"] = instance.RestoredFrom
+	}
+	if req.BackupSchedule != nil {
+		details["backupSchedule"] = req.BackupSchedule
+	}
+	if req.RevealCredentialsOnce {
+		details["revealCredentialsOnce"] = true
+	}
+	if len(req.Config) > 0 {
+		details["config"] = req.Config
+	}
+	a.writeAuditLog(ctx, user, instance.ID, "create", details)
+	return a.operationResponse(c, ctx, user, "create", instance.ID, instance, wait)
+}
+
+// createError writes the response for a create the store rejected (see Store.CreateInstance and
+// Store.ValidateCreate).
+func (a *Application) createError(c *echo.Context, err error) error {
+	if ok, resp := planError(c, err); ok {
+		return resp
+	}
+	if ok, resp := quotaError(c, err); ok {
+		return resp
+	}
+	if ok, resp := backupError(c, err); ok {
+		return resp
+	}
+	if ok, resp := specError(c, err); ok {
+		return resp
+	}
+	a.Logger.Error("failed to create instance", "error", err)
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to create instance: %v", err)})
+}
+
+// resolveClone turns req.CloneFrom into a restore of a new backup of the source instance, which the new
+// instance's pods wait for. If the create fails afterwards, the backup stays as a regular backup of the
+// source. If it returns false, it has written the error response and returns the result of writing it.
+func (a *Application) resolveClone(c *echo.Context, ctx context.Context, user string, req *models.CreateRedisRequest) (bool, error) {
+	if req.RestoreFrom != nil {
+		return false, c.JSON(http.StatusBadRequest, map[string]string{"error": "cloneFrom and restoreFrom cannot be combined"})
+	}
+	source := req.CloneFrom.InstanceID
+	if source == "" {
+		return false, c.JSON(http.StatusBadRequest, map[string]string{"error": "cloneFrom.instanceId is required"})
+	}
+	b, err := a.startBackup(ctx, user, source, map[string]any{"cloneTo": req.Name})
+	if err != nil {
+		switch {
+		case errors.Is(err, k8s.ErrNotFound):
+			return false, c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("cloneFrom: instance %q not found", source)})
+		case errors.Is(err, k8s.ErrBackupsDisabled):
+			return false, backupsUnavailable(c)
+		}
+		a.Logger.Error("failed to start clone backup", "id", source, "error", err)
+		return false, c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create instance"})
+	}
+	req.RestoreFrom = &models.RestoreSource{RDBURL: b.Location}
+	return true, nil
 }
 
 // PatchInstance applies a partial update to an existing Redis instance.
-// It can update the display name, Redis replicas, Sentinel replicas, and capacity (PVC size).
+// It can update the display name, Redis replicas, Sentinel replicas, capacity (PVC size), Redis and
+// Sentinel resources, the plan, the backup schedule and Redis config parameters.
+// Returns the operation following the rollout (see respondOperation).
 func (a *Application) PatchInstance(c *echo.Context) error {
 	id := c.Param("id")
 	var req models.PatchInstanceRequest
+	wait, err := waitParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 	if err := c.Bind(&req); err != nil {
 		a.Logger.Error("failed to bind request", "error", err)
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
 	}
 
 	// Basic guard: ensure at least one field is provided.
-	if req.Name == nil && req.Capacity == nil && req.RedisReplicas == nil && req.SentinelReplicas == nil {
+	if req.Name == nil && req.Capacity == nil && req.RedisReplicas == nil && req.SentinelReplicas == nil && req.Plan == nil && req.BackupSchedule == nil && req.Config == nil &&
+		req.CPURequest == nil && req.MemoryRequest == nil && req.CPULimit == nil && req.MemoryLimit == nil &&
+		req.SentinelCPURequest == nil && req.SentinelMemoryRequest == nil && req.SentinelCPULimit == nil && req.SentinelMemoryLimit == nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "at least one field must be provided"})
 	}
 
-	user := c.Request().Header.Get("X-User")
-	ns := namespaceForUser(user)
-	if ns == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "missing or empty X-User header"})
+	user := tenantOf(c)
+	ctx, err := k8s.WithTenant(c.Request().Context(), user)
+	if err != nil {
+		return tenantError(c, err)
 	}
-	ctx := k8s.WithNamespace(c.Request().Context(), ns)
 	updated, err := a.Store.PatchInstance(ctx, id, req)
 	if err != nil {
 		if errors.Is(err, k8s.ErrNotFound) {
 			return c.JSON(http.StatusNotFound, map[string]string{"error": "instance not found"})
 		}
+		if ok, resp := planError(c, err); ok {
+			return resp
+		}
+		if ok, resp := quotaError(c, err); ok {
+			return resp
+		}
+		if ok, resp := backupError(c, err); ok {
+			return resp
+		}
+		if ok, resp := specError(c, err); ok {
+			return resp
+		}
+		if ok, resp := storageError(c, err); ok {
+			return resp
+		}
 		a.Logger.Error("failed to update instance", "id", id, "error", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update instance"})
 	}
@@ -200,6 +415,9 @@ func (a *Application) PatchInstance(c *echo.Context) error {
 	if req.Name != nil {
 		details["name"] = *req.Name
 	}
+	if req.Plan != nil {
+		details["plan"] = *req.Plan
+	}
 	if req.Capacity != nil {
 		details["capacity"] = *req.Capacity
 	}
@@ -209,19 +427,38 @@ func (a *Application) PatchInstance(c *echo.Context) error {
 	if req.SentinelReplicas != nil {
 		details["sentinelReplicas"] = *req.SentinelReplicas
 	}
+	if req.BackupSchedule != nil {
+		details["backupSchedule"] = req.BackupSchedule
+	}
+	if req.Config != nil {
+		details["config"] = req.Config
+	}
+	for field, v := range map[string]*string{
+		"cpuRequest": req.CPURequest, "memoryRequest": req.MemoryRequest, "cpuLimit": req.CPULimit, "memoryLimit": req.MemoryLimit,
+		"sentinelCpuRequest": req.SentinelCPURequest, "sentinelMemoryRequest": req.SentinelMemoryRequest,
+		"sentinelCpuLimit": req.SentinelCPULimit, "sentinelMemoryLimit": req.SentinelMemoryLimit,
+	} {
+		if v != nil {
+			details[field] = *v
+		}
+	}
 	a.writeAuditLog(ctx, user, id, "update", details)
-	return c.JSON(http.StatusOK, updated)
+	return a.operationResponse(c, ctx, user, "update", id, updated, wait)
 }
 
-// DeleteInstance deletes an existing Redis instance. Returns 404 if the instance does not exist.
+// DeleteInstance deletes an existing Redis instance and returns the operation following the removal
+// (see respondOperation). Returns 404 if the instance does not exist.
 func (a *Application) DeleteInstance(c *echo.Context) error {
 	id := c.Param("id")
-	user := c.Request().Header.Get("X-User")
-	ns := namespaceForUser(user)
-	if ns == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "missing or empty X-User header"})
+	wait, err := waitParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	user := tenantOf(c)
+	ctx, err := k8s.WithTenant(c.Request().Context(), user)
+	if err != nil {
+		return tenantError(c, err)
 	}
-	ctx := k8s.WithNamespace(c.Request().Context(), ns)
 	if err := a.Store.DeleteInstance(ctx, id); err != nil {
 		if errors.Is(err, k8s.ErrNotFound) {
 			return c.JSON(http.StatusNotFound, map[string]string{"error": "instance not found"})
@@ -230,7 +467,24 @@ func (a *Application) DeleteInstance(c *echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to delete instance"})
 	}
 	a.writeAuditLog(ctx, user, id, "delete", map[string]any{"instanceId": id})
-	return c.NoContent(http.StatusNoContent)
+	return a.operationResponse(c, ctx, user, "delete", id, nil, wait)
+}
+
+// operationResponse starts the operation for an accepted call and responds with it. The initial password
+// of a created instance is only in this response, not in the operation kept for GET /operations/:id.
+func (a *Application) operationResponse(c *echo.Context, ctx context.Context, tenant, opType, id string, inst *models.RedisInstance, wait time.Duration) error {
+	tracked := inst
+	if inst != nil && inst.Password != "" {
+		withoutPassword := *inst
+		withoutPassword.Password = ""
+		tracked = &withoutPassword
+	}
+	op, err := a.startOperation(ctx, tenant, opType, id, tracked)
+	if err != nil {
+		a.Logger.Error("failed to start operation", "id", id, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to track operation"})
+	}
+	return a.respondOperation(c, ctx, tenant, op, wait, inst)
 }
 
 // SetCache stores a key-value pair in the Redis instance's cache (POST /instances/:id/cache).
@@ -238,22 +492,21 @@ func (a *Application) DeleteInstance(c *echo.Context) error {
 // Returns 400 if key/value are missing or key is too long; 404 if instance not found; 503 if Redis is unreachable.
 func (a *Application) SetCache(c *echo.Context) error {
 	id := c.Param("id")
-	user := c.Request().Header.Get("X-User")
-	ns := namespaceForUser(user)
-	if ns == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "missing or empty X-User header"})
+	user := tenantOf(c)
+	ctx, err := k8s.WithTenant(c.Request().Context(), user)
+	if err != nil {
+		return tenantError(c, err)
 	}
-	ctx := k8s.WithNamespace(c.Request().Context(), ns)
 
-	instance, err := a.Store.GetInstance(ctx, id)
+	creds, err := a.Store.GetCredentials(ctx, id)
 	if err != nil {
 		if errors.Is(err, k8s.ErrNotFound) {
 			return c.JSON(http.StatusNotFound, map[string]string{"error": "instance not found"})
 		}
-		a.Logger.Error("get instance for cache set failed", "id", id, "error", err)
+		a.Logger.Error("get credentials for cache set failed", "id", id, "error", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get instance"})
 	}
-	if instance.PublicEndpoint == "" {
+	if creds.Endpoint == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "instance has no public endpoint (not ready)"})
 	}
 
@@ -272,7 +525,7 @@ func (a *Application) SetCache(c *echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "ttlSeconds must be non-negative"})
 	}
 
-	if err := a.CacheClient.Set(ctx, instance.PublicEndpoint, instance.Password, cache.SetOptions{
+	if err := a.CacheClient.Set(ctx, creds.Endpoint, creds.Password, cache.SetOptions{
 		Key:        req.Key,
 		Value:      req.Value,
 		TTLSeconds: req.TTLSeconds,
@@ -293,29 +546,28 @@ func (a *Application) SetCache(c *echo.Context) error {
 func (a *Application) GetCache(c *echo.Context) error {
 	id := c.Param("id")
 	key := c.Param("key")
-	user := c.Request().Header.Get("X-User")
-	ns := namespaceForUser(user)
-	if ns == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "missing or empty X-User header"})
+	user := tenantOf(c)
+	ctx, err := k8s.WithTenant(c.Request().Context(), user)
+	if err != nil {
+		return tenantError(c, err)
 	}
-	ctx := k8s.WithNamespace(c.Request().Context(), ns)
 
-	instance, err := a.Store.GetInstance(ctx, id)
+	creds, err := a.Store.GetCredentials(ctx, id)
 	if err != nil {
 		if errors.Is(err, k8s.ErrNotFound) {
 			return c.JSON(http.StatusNotFound, map[string]string{"error": "instance not found"})
 		}
-		a.Logger.Error("get instance for cache get failed", "id", id, "error", err)
+		a.Logger.Error("get credentials for cache get failed", "id", id, "error", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get instance"})
 	}
-	if instance.PublicEndpoint == "" {
+	if creds.Endpoint == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "instance has no public endpoint (not ready)"})
 	}
 	if key == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "key is required"})
 	}
 
-	value, err := a.CacheClient.Get(ctx, instance.PublicEndpoint, instance.Password, key)
+	value, err := a.CacheClient.Get(ctx, creds.Endpoint, creds.Password, key)
 	if err != nil {
 		if errors.Is(err, cache.ErrKeyNotFound) {
 			return c.JSON(http.StatusNotFound, map[string]string{"error": "cache key not found"})
@@ -327,21 +579,20 @@ func (a *Application) GetCache(c *echo.Context) error {
 	return c.JSON(http.StatusOK, models.GetCacheResponse{Key: key, Value: value})
 }
 
-// ListLogs returns audit and/or service logs for the instance. Instance must belong to the tenant (X-User).
+// ListLogs returns audit and/or service logs for the instance. Instance must belong to the caller's tenant.
 func (a *Application) ListLogs(c *echo.Context) error {
 	id := c.Param("id")
-	user := c.Request().Header.Get("X-User")
-	ns := namespaceForUser(user)
-	if ns == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "missing or empty X-User header"})
+	user := tenantOf(c)
+	ctx, err := k8s.WithTenant(c.Request().Context(), user)
+	if err != nil {
+		return tenantError(c, err)
 	}
 	if a.LogStore == nil {
 		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "log store not configured"})
 	}
-	ctx := k8s.WithNamespace(c.Request().Context(), ns)
 
 	// Ensure instance exists and belongs to tenant
-	_, err := a.Store.GetInstance(ctx, id)
+	_, err = a.Store.GetInstance(ctx, id)
 	if err != nil {
 		if errors.Is(err, k8s.ErrNotFound) {
 			return c.JSON(http.StatusNotFound, map[string]string{"error": "instance not found"})
@@ -382,6 +633,7 @@ func (a *Application) ListLogs(c *echo.Context) error {
 			Details:    entries[i].Details,
 			Metadata:   entries[i].Metadata,
 			TenantUser: entries[i].TenantUser,
+			Actor:      entries[i].Actor,
 			InstanceID: entries[i].InstanceID,
 		}
 	}
@@ -390,15 +642,14 @@ func (a *Application) ListLogs(c *echo.Context) error {
 
 // ListLogsAll returns audit and/or service logs for the tenant (all instances), optionally filtered by instanceId.
 func (a *Application) ListLogsAll(c *echo.Context) error {
-	user := c.Request().Header.Get("X-User")
-	ns := namespaceForUser(user)
-	if ns == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "missing or empty X-User header"})
+	user := tenantOf(c)
+	ctx, err := k8s.WithTenant(c.Request().Context(), user)
+	if err != nil {
+		return tenantError(c, err)
 	}
 	if a.LogStore == nil {
 		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "log store not configured"})
 	}
-	ctx := k8s.WithNamespace(c.Request().Context(), ns)
 
 	opts := logstore.ListOpts{}
 	if t := c.QueryParam("type"); t != "" {
@@ -446,6 +697,7 @@ func (a *Application) ListLogsAll(c *echo.Context) error {
 			Details:    entries[i].Details,
 			Metadata:   entries[i].Metadata,
 			TenantUser: entries[i].TenantUser,
+			Actor:      entries[i].Actor,
 			InstanceID: entries[i].InstanceID,
 		}
 	}
@@ -459,7 +711,7 @@ func parseInt(s string) (int, error) {
 	return n, err
 }
 
-// Login handles user authentication and issues a JWT
+// Login handles user authentication and issues an access token (JWT) plus a refresh token
 func (a *Application) Login(c *echo.Context) error {
 	var req models.LoginRequest
 	if err := c.Bind(&req); err != nil {
@@ -467,28 +719,53 @@ func (a *Application) Login(c *echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
 	}
 
-	// Hardcoded auth check
-	// TODO: Implement proper auth check
-	if req.Username != "kevin" || req.Password != "KevinsPassword" {
+	// Unknown users are still run through bcrypt so they cannot be told apart from wrong passwords by timing.
+	user, err := a.Auth.GetUser(c.Request().Context(), req.Username)
+	if err != nil && !errors.Is(err, authstore.ErrNotFound) {
+		a.Logger.Error("failed to look up user", "username", req.Username, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to authenticate"})
+	}
+	if !authstore.VerifyPassword(user, req.Password) || user.Disabled {
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid credentials"})
 	}
 
-	// Create claims
-	claims := jwt.MapClaims{
-		"sub": req.Username,
-		"exp": time.Now().Add(time.Hour * 72).Unix(), // Token expires after 72 hours
+	if req.Org != "" {
+		if _, err := a.Auth.GetMembership(c.Request().Context(), req.Org, user.Username); err != nil {
+			if errors.Is(err, authstore.ErrNotFound) {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "not a member of organization " + req.Org})
+			}
+			a.Logger.Error("failed to look up membership", "org", req.Org, "error", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to authenticate"})
+		}
 	}
 
-	// Create Token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Sign token with secret
-	// TODO: Load secret from env
-	t, err := token.SignedString([]byte("kevins-super-secret-key"))
+	resp, refreshTokenID, err := a.issueTokens(c.Request().Context(), user, req.Org)
 	if err != nil {
-		a.Logger.Error("failed to sign token", "error", err)
+		a.Logger.Error("failed to issue tokens", "error", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to sign token"})
 	}
+	a.writeAuditLog(withActor(c.Request().Context(), user.Username), user.Username, "", "login", map[string]any{"refreshTokenId": refreshTokenID})
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// readinessChecker is implemented by stores that serve reads from caches which must sync first.
+type readinessChecker interface {
+	Ready() bool
+}
+
+// Readyz reports whether this replica can serve requests (GET /readyz): 503 until the instance store's
+// informer caches have synced, so the Service only routes to replicas with a warm cache.
+func (a *Application) Readyz(c *echo.Context) error {
+	if rc, ok := a.Store.(readinessChecker); ok && !rc.Ready() {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"status": "syncing"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
 
-	return c.JSON(http.StatusOK, models.LoginResponse{Token: t})
+// JWKS publishes the public signing keys (active and still-accepted previous keys) so other services
+// can validate tokens issued by this API (GET /.well-known/jwks.json).
+func (a *Application) JWKS(c *echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, a.Keys.JWKS())
 }
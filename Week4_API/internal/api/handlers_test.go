@@ -5,14 +5,26 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"log/slog"
 
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/auth"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/auth/oidctest"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/authstore"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/backupstore"
 	"github.com/Fearcon14/level3-cloud/Week4_API/internal/k8s"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/logstore"
 	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v5"
 )
 
@@ -21,8 +33,12 @@ type mockStore struct {
 	ListInstancesFn          func(ctx context.Context) ([]models.RedisInstance, error)
 	GetInstanceFn            func(ctx context.Context, id string) (*models.RedisInstance, error)
 	CreateInstanceFn         func(ctx context.Context, req models.CreateRedisRequest) (*models.RedisInstance, error)
+	ValidateCreateFn         func(ctx context.Context, req models.CreateRedisRequest) error
 	PatchInstanceFn          func(ctx context.Context, id string, req models.PatchInstanceRequest) (*models.RedisInstance, error)
 	DeleteInstanceFn         func(ctx context.Context, id string) error
+	InstanceProgressFn       func(ctx context.Context, id string) (*models.InstanceProgress, error)
+	GetCredentialsFn         func(ctx context.Context, id string) (*models.InstanceCredentials, error)
+	ListStorageClassesFn     func(ctx context.Context) ([]models.StorageClass, error)
 }
 
 func (m *mockStore) ListInstances(ctx context.Context) ([]models.RedisInstance, error) {
@@ -46,6 +62,13 @@ func (m *mockStore) CreateInstance(ctx context.Context, req models.CreateRedisRe
 	return m.CreateInstanceFn(ctx, req)
 }
 
+func (m *mockStore) ValidateCreate(ctx context.Context, req models.CreateRedisRequest) error {
+	if m.ValidateCreateFn == nil {
+		return nil
+	}
+	return m.ValidateCreateFn(ctx, req)
+}
+
 func (m *mockStore) PatchInstance(ctx context.Context, id string, req models.PatchInstanceRequest) (*models.RedisInstance, error) {
 	if m.PatchInstanceFn == nil {
 		return nil, nil
@@ -60,24 +83,116 @@ func (m *mockStore) DeleteInstance(ctx context.Context, id string) error {
 	return m.DeleteInstanceFn(ctx, id)
 }
 
+// InstanceProgress reports a fully rolled out instance unless InstanceProgressFn is set.
+func (m *mockStore) InstanceProgress(ctx context.Context, id string) (*models.InstanceProgress, error) {
+	if m.InstanceProgressFn == nil {
+		return &models.InstanceProgress{Status: "running", ReadyPods: 6, Pods: 6, ExpectedPods: 6, RolledOut: true}, nil
+	}
+	return m.InstanceProgressFn(ctx, id)
+}
+
+func (m *mockStore) GetCredentials(ctx context.Context, id string) (*models.InstanceCredentials, error) {
+	if m.GetCredentialsFn == nil {
+		return nil, nil
+	}
+	return m.GetCredentialsFn(ctx, id)
+}
+
+func (m *mockStore) ListStorageClasses(ctx context.Context) ([]models.StorageClass, error) {
+	if m.ListStorageClassesFn == nil {
+		return nil, nil
+	}
+	return m.ListStorageClassesFn(ctx)
+}
+
+// recordingLogStore keeps appended audit and service logs in memory; listing is not supported.
+type recordingLogStore struct {
+	mu      sync.Mutex
+	entries []logstore.LogEntry
+}
+
+func (r *recordingLogStore) AppendAuditLog(ctx context.Context, tenantUser, actor, instanceID, action string, details map[string]any) error {
+	if err := ctx.Err(); err != nil {
+		return err // like the database, which refuses writes with an ended context
+	}
+	b, _ := json.Marshal(details)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, logstore.LogEntry{Type: "audit", TenantUser: tenantUser, Actor: actor, InstanceID: instanceID, Action: action, Details: b})
+	return nil
+}
+
+func (r *recordingLogStore) AppendServiceLog(ctx context.Context, tenantUser, instanceID, eventType, message string, metadata map[string]any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b, _ := json.Marshal(metadata)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, logstore.LogEntry{Type: "service", TenantUser: tenantUser, InstanceID: instanceID, Action: eventType, Message: message, Metadata: b})
+	return nil
+}
+
+func (r *recordingLogStore) ListLogs(ctx context.Context, tenantUser, instanceID string, opts logstore.ListOpts) ([]logstore.LogEntry, error) {
+	return nil, nil
+}
+
+func (r *recordingLogStore) ListLogsAll(ctx context.Context, tenantUser string, opts logstore.ListOpts) ([]logstore.LogEntry, error) {
+	return nil, nil
+}
+
+func (r *recordingLogStore) CountLogs(ctx context.Context, tenantUser string, opts logstore.ListOpts) (int, error) {
+	return 0, nil
+}
+
+// waitFor returns the first entry with the given action, waiting for the background writes of the handlers.
+func (r *recordingLogStore) waitFor(t *testing.T, action string) logstore.LogEntry {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		r.mu.Lock()
+		for _, e := range r.entries {
+			if e.Action == action {
+				r.mu.Unlock()
+				return e
+			}
+		}
+		r.mu.Unlock()
+	}
+	t.Fatalf("no %s log entry", action)
+	return logstore.LogEntry{}
+}
+
+// testUserHash is the bcrypt hash of "KevinsPassword", computed once for all tests.
+var testUserHash, _ = authstore.HashPassword("KevinsPassword")
+
 // newTestApp creates an Application with a mock store and a no-op logger. LogStore is nil.
+// The in-memory user store is seeded with kevin / KevinsPassword.
 func newTestApp(store k8s.InstanceStore) *Application {
 	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
-	return NewApplication(store, nil, nil, logger)
+	users := authstore.NewMemoryStore()
+	if _, err := users.CreateUser(context.Background(), "kevin", testUserHash); err != nil {
+		panic(err)
+	}
+	app, err := NewApplication(store, nil, nil, users, logger)
+	if err != nil {
+		panic(err)
+	}
+	return app
 }
 
-// newTestEchoWithAuth returns an Echo and the v1 group protected by JWTMiddleware.
+// newTestEchoWithAuth returns an Echo and the v1 group protected by AuthMiddleware (JWT or API key).
 // Register POST /api/login on e; register protected routes on v1 (e.g. v1.POST("/instances", app.CreateInstance)).
 func newTestEchoWithAuth(app *Application) (*echo.Echo, *echo.Group) {
 	e := echo.New()
+	e.Pre(stripIdentityHeaders)
 	e.POST("/api/login", app.Login)
 	v1 := e.Group("/api/v1")
-	v1.Use(JWTMiddleware)
+	v1.Use(app.AuthMiddleware)
 	return e, v1
 }
 
 // getTestBearerToken performs a login and returns "Bearer <token>" for use in protected requests.
-// Uses the same credentials as the real Login handler (kevin / KevinsPassword).
+// Uses the user seeded by newTestApp (kevin / KevinsPassword).
 func getTestBearerToken(t *testing.T, e *echo.Echo) string {
 	t.Helper()
 	loginBody := []byte(`{"username":"kevin","password":"KevinsPassword"}`)
@@ -131,7 +246,7 @@ func TestCreateInstance_Handler(t *testing.T) {
 					}, nil
 				},
 			},
-			wantStatusCode: http.StatusCreated,
+			wantStatusCode: http.StatusAccepted,
 		},
 		{
 			name: "missing required fields returns 400",
@@ -154,6 +269,111 @@ func TestCreateInstance_Handler(t *testing.T) {
 			},
 			wantStatusCode: http.StatusInternalServerError,
 		},
+		{
+			name: "instance quota exceeded returns 409",
+			body: map[string]any{
+				"name":     "test-redis",
+				"capacity": "1Gi",
+			},
+			mockStore: &mockStore{
+				CreateInstanceFn: func(ctx context.Context, req models.CreateRedisRequest) (*models.RedisInstance, error) {
+					return nil, &k8s.QuotaExceededError{Resource: "instances", Requested: "1", Used: "5", Limit: "5"}
+				},
+			},
+			wantStatusCode: http.StatusConflict,
+		},
+		{
+			name: "storage quota exceeded returns 422",
+			body: map[string]any{
+				"name":     "test-redis",
+				"capacity": "100Gi",
+			},
+			mockStore: &mockStore{
+				CreateInstanceFn: func(ctx context.Context, req models.CreateRedisRequest) (*models.RedisInstance, error) {
+					return nil, fmt.Errorf("wrapped: %w", &k8s.QuotaExceededError{Resource: "storage", Requested: "300Gi", Used: "0", Limit: "50Gi"})
+				},
+			},
+			wantStatusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "unknown plan returns 400",
+			body: map[string]any{
+				"name": "test-redis",
+				"plan": "gold",
+			},
+			mockStore: &mockStore{
+				CreateInstanceFn: func(ctx context.Context, req models.CreateRedisRequest) (*models.RedisInstance, error) {
+					return nil, fmt.Errorf("%w: unknown plan %q", k8s.ErrInvalidPlan, req.Plan)
+				},
+			},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "invalid backup schedule returns 400",
+			body: map[string]any{
+				"name":           "test-redis",
+				"backupSchedule": map[string]any{"cron": "daily"},
+			},
+			mockStore: &mockStore{
+				CreateInstanceFn: func(ctx context.Context, req models.CreateRedisRequest) (*models.RedisInstance, error) {
+					return nil, fmt.Errorf("validation: %w", k8s.ValidateBackupSchedule(*req.BackupSchedule))
+				},
+			},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "capacity without persistence returns 400",
+			body: map[string]any{
+				"name":        "test-redis",
+				"capacity":    "1Gi",
+				"persistence": "none",
+			},
+			mockStore: &mockStore{
+				CreateInstanceFn: func(ctx context.Context, req models.CreateRedisRequest) (*models.RedisInstance, error) {
+					return nil, fmt.Errorf("validation: %w", k8s.ValidateCreateRedisRequest(req))
+				},
+			},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "unknown persistence returns 400",
+			body: map[string]any{
+				"name":        "test-redis",
+				"persistence": "disk",
+			},
+			mockStore: &mockStore{
+				CreateInstanceFn: func(ctx context.Context, req models.CreateRedisRequest) (*models.RedisInstance, error) {
+					return nil, fmt.Errorf("validation: %w", k8s.ValidateCreateRedisRequest(req))
+				},
+			},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "invalid config returns 400",
+			body: map[string]any{
+				"name":   "test-redis",
+				"config": map[string]any{"maxmemory-policy": "lru"},
+			},
+			mockStore: &mockStore{
+				CreateInstanceFn: func(ctx context.Context, req models.CreateRedisRequest) (*models.RedisInstance, error) {
+					return nil, fmt.Errorf("validation: %w", k8s.ValidateRedisConfig(req.Config))
+				},
+			},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "unknown storage class returns 400",
+			body: map[string]any{
+				"name":         "test-redis",
+				"storageClass": "premium-perf1-stackti",
+			},
+			mockStore: &mockStore{
+				CreateInstanceFn: func(ctx context.Context, req models.CreateRedisRequest) (*models.RedisInstance, error) {
+					return nil, fmt.Errorf("%w: %q does not exist", k8s.ErrInvalidStorageClass, req.StorageClass)
+				},
+			},
+			wantStatusCode: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
@@ -181,6 +401,311 @@ func TestCreateInstance_Handler(t *testing.T) {
 	}
 }
 
+func TestPlans_Handler(t *testing.T) {
+	store := &mockStore{
+		PatchInstanceFn: func(ctx context.Context, id string, req models.PatchInstanceRequest) (*models.RedisInstance, error) {
+			if *req.Plan == "dev" {
+				return nil, fmt.Errorf("%w: %q cannot change to %q", k8s.ErrPlanChangeNotAllowed, "ha-large", "dev")
+			}
+			return &models.RedisInstance{ID: id, Plan: *req.Plan}, nil
+		},
+	}
+	app := newTestApp(store)
+	e, v1 := newTestEchoWithAuth(app)
+	v1.GET("/plans", app.ListPlans)
+	v1.PATCH("/instances/:id", app.PatchInstance)
+	token := getTestBearerToken(t, e)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/plans", nil)
+	req.Header.Set("Authorization", token)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	var plans []models.Plan
+	if err := json.Unmarshal(rec.Body.Bytes(), &plans); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("list plans: status %d, err %v", rec.Code, err)
+	}
+	if len(plans) != len(k8s.DefaultPlans()) {
+		t.Fatalf("list plans: got %d plans, want %d", len(plans), len(k8s.DefaultPlans()))
+	}
+
+	for plan, want := range map[string]int{"standard": http.StatusAccepted, "dev": http.StatusUnprocessableEntity} {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/instances/r1", strings.NewReader(`{"plan":"`+plan+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("patch to %s: status %d, want %d; body=%s", plan, rec.Code, want, rec.Body.String())
+		}
+	}
+}
+
+func TestListStorageClasses_Handler(t *testing.T) {
+	want := []models.StorageClass{{Name: "premium-perf1-stackit", Provisioner: "cinder.csi.openstack.org", AllowVolumeExpansion: true, Default: true}}
+	app := newTestApp(&mockStore{
+		ListStorageClassesFn: func(ctx context.Context) ([]models.StorageClass, error) {
+			return want, nil
+		},
+	})
+	e, v1 := newTestEchoWithAuth(app)
+	v1.GET("/storage-classes", app.ListStorageClasses)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/storage-classes", nil)
+	req.Header.Set("Authorization", getTestBearerToken(t, e))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	var classes []models.StorageClass
+	if err := json.Unmarshal(rec.Body.Bytes(), &classes); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("list storage classes: status %d, err %v", rec.Code, err)
+	}
+	if len(classes) != 1 || classes[0] != want[0] {
+		t.Fatalf("list storage classes: got %+v, want %+v", classes, want)
+	}
+}
+
+func TestPatchInstance_Config(t *testing.T) {
+	var got models.PatchInstanceRequest
+	app := newTestApp(&mockStore{
+		PatchInstanceFn: func(ctx context.Context, id string, req models.PatchInstanceRequest) (*models.RedisInstance, error) {
+			if err := k8s.ValidatePatchInstanceRequest(req); err != nil {
+				return nil, fmt.Errorf("validation: %w", err)
+			}
+			got = req
+			return &models.RedisInstance{ID: id, Config: req.Config}, nil
+		},
+	})
+	e, v1 := newTestEchoWithAuth(app)
+	v1.PATCH("/instances/:id", app.PatchInstance)
+	token := getTestBearerToken(t, e)
+
+	for body, want := range map[string]int{
+		`{"config":{"maxmemory-policy":"allkeys-lfu","timeout":""}}`: http.StatusAccepted,
+		`{"config":{"maxmemory-policy":"lru"}}`:                      http.StatusBadRequest,
+		`{"config":{"appendonly":"yes"}}`:                            http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/instances/r1", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("patch %s: status %d, want %d; body=%s", body, rec.Code, want, rec.Body.String())
+		}
+	}
+	if got.Config["maxmemory-policy"] != "allkeys-lfu" || got.Config["timeout"] != "" {
+		t.Fatalf("store request %+v", got)
+	}
+}
+
+func TestPatchInstance_Resources(t *testing.T) {
+	app := newTestApp(&mockStore{
+		PatchInstanceFn: func(ctx context.Context, id string, req models.PatchInstanceRequest) (*models.RedisInstance, error) {
+			if err := k8s.ValidatePatchInstanceRequest(req); err != nil {
+				return nil, fmt.Errorf("validation: %w", err)
+			}
+			return &models.RedisInstance{ID: id}, nil
+		},
+	})
+	e, v1 := newTestEchoWithAuth(app)
+	v1.PATCH("/instances/:id", app.PatchInstance)
+	token := getTestBearerToken(t, e)
+
+	for body, want := range map[string]int{
+		`{"cpuRequest":"250m","memoryLimit":"1Gi"}`:                    http.StatusAccepted,
+		`{"sentinelCpuLimit":""}`:                                      http.StatusAccepted,
+		`{"cpuRequest":"1","cpuLimit":"500m"}`:                         http.StatusBadRequest,
+		`{"memoryLimit":"lots"}`:                                       http.StatusBadRequest,
+		`{"sentinelMemoryRequest":"1Gi","sentinelMemoryLimit":"64Mi"}`: http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/instances/r1", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("patch %s: status %d, want %d; body=%s", body, rec.Code, want, rec.Body.String())
+		}
+	}
+}
+
+func TestPatchInstance_Capacity(t *testing.T) {
+	app := newTestApp(&mockStore{
+		PatchInstanceFn: func(ctx context.Context, id string, req models.PatchInstanceRequest) (*models.RedisInstance, error) {
+			switch *req.Capacity {
+			case "512Mi":
+				return nil, fmt.Errorf("%w: 512Mi is below the current 1Gi", k8s.ErrCapacityShrink)
+			case "5Gi":
+				return nil, fmt.Errorf("%w: storage class \"standard\" does not allow volume expansion", k8s.ErrVolumeExpansionUnsupported)
+			}
+			return &models.RedisInstance{ID: id, Capacity: *req.Capacity}, nil
+		},
+	})
+	e, v1 := newTestEchoWithAuth(app)
+	v1.PATCH("/instances/:id", app.PatchInstance)
+	token := getTestBearerToken(t, e)
+
+	for capacity, want := range map[string]int{"2Gi": http.StatusAccepted, "512Mi": http.StatusUnprocessableEntity, "5Gi": http.StatusUnprocessableEntity} {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/instances/r1", strings.NewReader(`{"capacity":"`+capacity+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("capacity %s: status %d, want %d; body=%s", capacity, rec.Code, want, rec.Body.String())
+		}
+	}
+}
+
+func TestOperations_Handler(t *testing.T) {
+	var mu sync.Mutex
+	ready, rolledOut := 2, true
+	deleted, podsLeft := false, 0
+	store := &mockStore{
+		CreateInstanceFn: func(ctx context.Context, req models.CreateRedisRequest) (*models.RedisInstance, error) {
+			return &models.RedisInstance{ID: req.Name, Name: req.Name, Password: "initial"}, nil
+		},
+		PatchInstanceFn: func(ctx context.Context, id string, req models.PatchInstanceRequest) (*models.RedisInstance, error) {
+			return &models.RedisInstance{ID: id, Name: id}, nil
+		},
+		InstanceProgressFn: func(ctx context.Context, id string) (*models.InstanceProgress, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if deleted {
+				return &models.InstanceProgress{Status: "deleted", Pods: podsLeft, Deleted: true}, nil
+			}
+			return &models.InstanceProgress{Status: "pending", ReadyPods: ready, Pods: 6, ExpectedPods: 6, RolledOut: rolledOut}, nil
+		},
+	}
+	app := newTestApp(store)
+	app.OperationPollInterval = 10 * time.Millisecond
+	e, v1 := newTestEchoWithAuth(app)
+	v1.POST("/instances", app.CreateInstance)
+	v1.PATCH("/instances/:id", app.PatchInstance)
+	v1.DELETE("/instances/:id", app.DeleteInstance)
+	v1.GET("/operations/:id", app.GetOperation)
+	token := getTestBearerToken(t, e)
+	do := func(method, target, body string) (*httptest.ResponseRecorder, models.Operation) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		var op models.Operation
+		_ = json.Unmarshal(rec.Body.Bytes(), &op)
+		return rec, op
+	}
+
+	if rec, _ := do(http.MethodPost, "/api/v1/instances?wait=true&timeout=forever", `{"name":"r1"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid timeout: got %d, want 400", rec.Code)
+	}
+
+	// Not ready within the wait: 202 with the operation to poll.
+	rec, op := do(http.MethodPost, "/api/v1/instances?wait=true&timeout=50ms", `{"name":"r1"}`)
+	if rec.Code != http.StatusAccepted || op.Type != "create" || op.Done() || op.Instance == nil || op.Instance.Password != "initial" {
+		t.Fatalf("create: got %d, op %+v", rec.Code, op)
+	}
+	if loc := rec.Header().Get(echo.HeaderLocation); loc != "/api/v1/operations/"+op.ID {
+		t.Fatalf("create: Location %q", loc)
+	}
+	if _, got := do(http.MethodGet, "/api/v1/operations/"+op.ID, ""); got.State != models.OperationRunning || got.Message != "2/6 pods ready" {
+		t.Fatalf("running: got state %q, message %q", got.State, got.Message)
+	}
+	// Only the create response carries the initial password.
+	if _, got := do(http.MethodGet, "/api/v1/operations/"+op.ID, ""); got.Instance == nil || got.Instance.Password != "" {
+		t.Fatalf("operation instance %+v", got.Instance)
+	}
+
+	mu.Lock()
+	ready = 6
+	mu.Unlock()
+	if rec, got := do(http.MethodGet, "/api/v1/operations/"+op.ID+"?wait=true&timeout=5s", ""); rec.Code != http.StatusOK || got.State != models.OperationSucceeded || got.CompletedAt == nil {
+		t.Fatalf("wait for create: got %d, op %+v", rec.Code, got)
+	}
+
+	// An update is not done while the pods, although ready, still run the previous spec.
+	mu.Lock()
+	rolledOut = false
+	mu.Unlock()
+	rec, op = do(http.MethodPatch, "/api/v1/instances/r1?wait=true&timeout=50ms", `{"redisReplicas":3}`)
+	if rec.Code != http.StatusAccepted || op.State != models.OperationRunning || op.Message != "rolling out, 6/6 pods ready" {
+		t.Fatalf("update before the rollout: got %d, op %+v", rec.Code, op)
+	}
+	mu.Lock()
+	rolledOut = true
+	mu.Unlock()
+	if rec, got := do(http.MethodGet, "/api/v1/operations/"+op.ID+"?wait=true&timeout=5s", ""); rec.Code != http.StatusOK || got.State != models.OperationSucceeded {
+		t.Fatalf("wait for update: got %d, op %+v", rec.Code, got)
+	}
+
+	// A delete is done once the pods are gone too, not just the instance.
+	mu.Lock()
+	deleted, podsLeft = true, 2
+	mu.Unlock()
+	rec, op = do(http.MethodDelete, "/api/v1/instances/r1?wait=true&timeout=50ms", "")
+	if rec.Code != http.StatusAccepted || op.Message != "deleting, 2 pods left" {
+		t.Fatalf("delete with pods left: got %d, op %+v", rec.Code, op)
+	}
+	mu.Lock()
+	podsLeft = 0
+	mu.Unlock()
+	if rec, got := do(http.MethodGet, "/api/v1/operations/"+op.ID+"?wait=true&timeout=5s", ""); rec.Code != http.StatusOK || got.State != models.OperationSucceeded {
+		t.Fatalf("delete: got %d, op %+v", rec.Code, got)
+	}
+	if rec, _ := do(http.MethodGet, "/api/v1/operations/unknown", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown operation: got %d, want 404", rec.Code)
+	}
+
+	// Another replica sharing the operation store reports and finishes an operation that the replica
+	// which started it no longer checks (e.g. after a restart).
+	mu.Lock()
+	deleted, ready = false, 2
+	mu.Unlock()
+	app.OperationPollInterval = time.Hour
+	rec, op = do(http.MethodPost, "/api/v1/instances", `{"name":"r3"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("create r3: got %d", rec.Code)
+	}
+	replica := newTestApp(store)
+	replica.Operations = app.Operations
+	replica.OperationPollInterval = 10 * time.Millisecond
+	e2, v2 := newTestEchoWithAuth(replica)
+	v2.GET("/operations/:id", replica.GetOperation)
+	token2 := getTestBearerToken(t, e2)
+	getOnReplica := func(target string) (*httptest.ResponseRecorder, models.Operation) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", token2)
+		rec := httptest.NewRecorder()
+		e2.ServeHTTP(rec, req)
+		var op models.Operation
+		_ = json.Unmarshal(rec.Body.Bytes(), &op)
+		return rec, op
+	}
+	if rec, got := getOnReplica("/api/v1/operations/" + op.ID); rec.Code != http.StatusOK || got.State != models.OperationRunning {
+		t.Fatalf("operation on another replica: got %d, op %+v", rec.Code, got)
+	}
+	mu.Lock()
+	ready = 6
+	mu.Unlock()
+	if rec, got := getOnReplica("/api/v1/operations/" + op.ID + "?wait=true&timeout=5s"); rec.Code != http.StatusOK || got.State != models.OperationSucceeded {
+		t.Fatalf("wait on another replica: got %d, op %+v", rec.Code, got)
+	}
+
+	// A timed out operation fails and is still logged, although its context has ended.
+	mu.Lock()
+	ready = 2
+	mu.Unlock()
+	app.OperationPollInterval = 10 * time.Millisecond
+	logs := &recordingLogStore{}
+	app.LogStore = logs
+	app.OperationTimeout = 30 * time.Millisecond
+	if rec, got := do(http.MethodPost, "/api/v1/instances?wait=true&timeout=5s", `{"name":"r2"}`); rec.Code != http.StatusOK || got.State != models.OperationFailed || !strings.Contains(got.Error, "timed out") {
+		t.Fatalf("create timing out: got %d, op %+v", rec.Code, got)
+	}
+	if entry := logs.waitFor(t, "operation_failed"); entry.InstanceID != "r2" {
+		t.Fatalf("operation_failed log %+v", entry)
+	}
+}
+
 // GET single Instance
 func TestGetInstance_Handler(t *testing.T) {
 	tests := []struct {
@@ -321,14 +846,14 @@ func TestDeleteInstance_Handler(t *testing.T) {
 		wantStatusCode int
 	}{
 		{
-			name: "success no content",
+			name: "success returns operation",
 			id:   "redis-1",
 			mockStore: &mockStore{
 				DeleteInstanceFn: func(ctx context.Context, id string) error {
 					return nil
 				},
 			},
-			wantStatusCode: http.StatusNoContent,
+			wantStatusCode: http.StatusAccepted,
 		},
 		{
 			name: "not found",
@@ -370,3 +895,1040 @@ func TestDeleteInstance_Handler(t *testing.T) {
 		})
 	}
 }
+
+// POST /api/login
+func TestLogin_Handler(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		disabled       bool
+		wantStatusCode int
+	}{
+		{name: "success", body: `{"username":"kevin","password":"KevinsPassword"}`, wantStatusCode: http.StatusOK},
+		{name: "wrong password", body: `{"username":"kevin","password":"nope"}`, wantStatusCode: http.StatusUnauthorized},
+		{name: "unknown user", body: `{"username":"mallory","password":"KevinsPassword"}`, wantStatusCode: http.StatusUnauthorized},
+		{name: "disabled user", body: `{"username":"kevin","password":"KevinsPassword"}`, disabled: true, wantStatusCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(&mockStore{})
+			if tt.disabled {
+				if err := app.Auth.SetUserDisabled(context.Background(), "kevin", true); err != nil {
+					t.Fatalf("disable user: %v", err)
+				}
+			}
+			e, _ := newTestEchoWithAuth(app)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/login", bytes.NewReader([]byte(tt.body)))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatusCode {
+				t.Fatalf("unexpected status code: got %d, want %d; body=%s", rec.Code, tt.wantStatusCode, rec.Body.String())
+			}
+		})
+	}
+}
+
+// POST /api/v1/users
+func TestCreateUser_Handler(t *testing.T) {
+	tests := []struct {
+		name           string
+		admin          bool
+		body           string
+		wantStatusCode int
+	}{
+		{name: "admin creates user", admin: true, body: `{"username":"alice","password":"alicespassword"}`, wantStatusCode: http.StatusCreated},
+		{name: "non-admin forbidden", body: `{"username":"alice","password":"alicespassword"}`, wantStatusCode: http.StatusForbidden},
+		{name: "duplicate username", admin: true, body: `{"username":"kevin","password":"anotherpassword"}`, wantStatusCode: http.StatusConflict},
+		{name: "invalid username", admin: true, body: `{"username":"Bob Smith","password":"bobspassword"}`, wantStatusCode: http.StatusBadRequest},
+		{name: "short password", admin: true, body: `{"username":"alice","password":"short"}`, wantStatusCode: http.StatusBadRequest},
+		{name: "reserved username", admin: true, body: `{"username":"kube-system","password":"bobspassword"}`, wantStatusCode: http.StatusBadRequest},
+		{name: "double hyphen", admin: true, body: `{"username":"bob--smith","password":"bobspassword"}`, wantStatusCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(&mockStore{})
+			app.AdminUsers["kevin"] = tt.admin
+			e, v1 := newTestEchoWithAuth(app)
+			v1.POST("/users", app.CreateUser)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/users", bytes.NewReader([]byte(tt.body)))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set("Authorization", getTestBearerToken(t, e))
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatusCode {
+				t.Fatalf("unexpected status code: got %d, want %d; body=%s", rec.Code, tt.wantStatusCode, rec.Body.String())
+			}
+		})
+	}
+}
+
+// Protected routes reject tokens not signed by the application's key set.
+func TestEnsureBootstrapUser(t *testing.T) {
+	ctx := context.Background()
+	users := authstore.NewMemoryStore()
+	for _, name := range []string{"org-x", "Admin", "kube-system"} {
+		if err := EnsureBootstrapUser(ctx, users, name, "long-enough"); err == nil {
+			t.Errorf("bootstrap user %q accepted", name)
+		}
+	}
+	if err := EnsureBootstrapUser(ctx, users, "admin", "long-enough"); err != nil {
+		t.Fatalf("bootstrap admin: %v", err)
+	}
+	if _, err := users.GetUser(ctx, "admin"); err != nil {
+		t.Fatalf("get admin: %v", err)
+	}
+}
+
+func TestJWTMiddleware_RejectsForeignTokens(t *testing.T) {
+	app := newTestApp(&mockStore{})
+	e, v1 := newTestEchoWithAuth(app)
+	v1.GET("/instances", app.ListInstances)
+
+	// Legacy token signed with the old hardcoded HMAC secret.
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": "paas-api",
+		"sub": "kevin",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("kevins-super-secret-key"))
+	if err != nil {
+		t.Fatalf("sign forged token: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		authorization  string
+		wantStatusCode int
+	}{
+		{name: "valid token", authorization: getTestBearerToken(t, e), wantStatusCode: http.StatusOK},
+		{name: "forged hmac token", authorization: "Bearer " + forged, wantStatusCode: http.StatusUnauthorized},
+		{name: "missing token", authorization: "", wantStatusCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/instances", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatusCode {
+				t.Fatalf("unexpected status code: got %d, want %d; body=%s", rec.Code, tt.wantStatusCode, rec.Body.String())
+			}
+		})
+	}
+}
+
+// loginForTokens logs in as kevin and returns the full login response.
+func loginForTokens(t *testing.T, e *echo.Echo) models.LoginResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/login", bytes.NewReader([]byte(`{"username":"kevin","password":"KevinsPassword"}`)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login failed: status %d, body %s", rec.Code, rec.Body.String())
+	}
+	var out models.LoginResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("parse login response: %v", err)
+	}
+	return out
+}
+
+// POST /api/refresh and POST /api/logout
+func TestRefreshAndLogout_Handler(t *testing.T) {
+	app := newTestApp(&mockStore{})
+	logs := &recordingLogStore{}
+	app.LogStore = logs
+	e, v1 := newTestEchoWithAuth(app)
+	e.POST("/api/refresh", app.Refresh)
+	e.POST("/api/logout", app.Logout, app.JWTMiddleware)
+	v1.GET("/instances", app.ListInstances)
+
+	do := func(method, path, authorization, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := loginForTokens(t, e)
+	if first.RefreshToken == "" || first.ExpiresIn <= 0 {
+		t.Fatalf("login response missing refresh token or expiry: %+v", first)
+	}
+
+	// Refresh rotates the refresh token.
+	rec := do(http.MethodPost, "/api/refresh", "", `{"refreshToken":"`+first.RefreshToken+`"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+	var second models.LoginResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &second); err != nil {
+		t.Fatalf("parse refresh response: %v", err)
+	}
+	// The audit log links the rotated token to the one issued at login.
+	var login, refresh map[string]string
+	_ = json.Unmarshal(logs.waitFor(t, "login").Details, &login)
+	_ = json.Unmarshal(logs.waitFor(t, "token_refresh").Details, &refresh)
+	if login["refreshTokenId"] == "" || refresh["refreshTokenId"] != login["refreshTokenId"] || refresh["newRefreshTokenId"] == "" {
+		t.Fatalf("token_refresh %v after login %v", refresh, login)
+	}
+
+	// Reusing the rotated token fails and revokes the whole family.
+	if rec := do(http.MethodPost, "/api/refresh", "", `{"refreshToken":"`+first.RefreshToken+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("reuse of rotated refresh token: got %d, want 401", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/refresh", "", `{"refreshToken":"`+second.RefreshToken+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh after reuse detection: got %d, want 401", rec.Code)
+	}
+
+	// Logout revokes the access token by jti.
+	third := loginForTokens(t, e)
+	bearer := "Bearer " + third.Token
+	if rec := do(http.MethodGet, "/api/v1/instances", bearer, ""); rec.Code != http.StatusOK {
+		t.Fatalf("list before logout: got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/logout", bearer, `{"refreshToken":"`+third.RefreshToken+`"}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("logout: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/api/v1/instances", bearer, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("list after logout: got %d, want 401", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/refresh", "", `{"refreshToken":"`+third.RefreshToken+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh after logout: got %d, want 401", rec.Code)
+	}
+}
+
+// /api/v1/apikeys and API key authentication
+func TestAPIKeys_Handler(t *testing.T) {
+	app := newTestApp(&mockStore{})
+	e, v1 := newTestEchoWithAuth(app)
+	v1.GET("/apikeys", app.ListAPIKeys, requireSession)
+	v1.POST("/apikeys", app.CreateAPIKey, requireSession)
+	v1.DELETE("/apikeys/:id", app.RevokeAPIKey, requireSession)
+	v1.GET("/instances", app.ListInstances, requireScope(scopeInstancesRead))
+	v1.POST("/instances", app.CreateInstance, requireScope(scopeInstancesWrite))
+
+	do := func(method, path string, headers map[string]string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	session := map[string]string{"Authorization": getTestBearerToken(t, e)}
+
+	if rec := do(http.MethodPost, "/api/v1/apikeys", session, `{"name":"ci","scopes":["instances:admin"]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown scope: got %d, want 400", rec.Code)
+	}
+	rec := do(http.MethodPost, "/api/v1/apikeys", session, `{"name":"ci","scopes":["instances:read"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create api key: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+	var created models.CreateAPIKeyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("parse create response: %v", err)
+	}
+	if !strings.HasPrefix(created.Key, "paas_"+created.ID+"_") {
+		t.Fatalf("unexpected key format %q (id %q)", created.Key, created.ID)
+	}
+
+	// The key authenticates as the creating tenant, via either header.
+	if rec := do(http.MethodGet, "/api/v1/instances", map[string]string{"X-API-Key": created.Key}, ""); rec.Code != http.StatusOK {
+		t.Fatalf("list with X-API-Key: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/api/v1/instances", map[string]string{"Authorization": "Bearer " + created.Key}, ""); rec.Code != http.StatusOK {
+		t.Fatalf("list with bearer api key: got %d", rec.Code)
+	}
+	// Scopes and session-only routes are enforced.
+	if rec := do(http.MethodPost, "/api/v1/instances", map[string]string{"X-API-Key": created.Key}, `{"name":"x"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("create without instances:write: got %d, want 403", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/v1/apikeys", map[string]string{"X-API-Key": created.Key}, `{"name":"x","scopes":["instances:read"]}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("create api key with api key: got %d, want 403", rec.Code)
+	}
+	// A tampered secret is rejected.
+	if rec := do(http.MethodGet, "/api/v1/instances", map[string]string{"X-API-Key": created.Key + "x"}, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("tampered key: got %d, want 401", rec.Code)
+	}
+	// Keys stop working while their creator is disabled.
+	ctx := context.Background()
+	if err := app.Auth.SetUserDisabled(ctx, "kevin", true); err != nil {
+		t.Fatal(err)
+	}
+	if rec := do(http.MethodGet, "/api/v1/instances", map[string]string{"X-API-Key": created.Key}, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("key of disabled user: got %d, want 401", rec.Code)
+	}
+	if err := app.Auth.SetUserDisabled(ctx, "kevin", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// List never returns the secret.
+	rec = do(http.MethodGet, "/api/v1/apikeys", session, "")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), created.Key) {
+		t.Fatalf("list api keys: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+
+	if rec := do(http.MethodDelete, "/api/v1/apikeys/"+created.ID, session, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("revoke: got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/v1/instances", map[string]string{"X-API-Key": created.Key}, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("list with revoked key: got %d, want 401", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/v1/apikeys/"+created.ID, session, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("revoke twice: got %d, want 404", rec.Code)
+	}
+}
+
+// Role enforcement: viewers may read, operators may patch, only owners may delete.
+func TestRoles_Handler(t *testing.T) {
+	app := newTestApp(&mockStore{
+		GetInstanceFn: func(ctx context.Context, id string) (*models.RedisInstance, error) {
+			return &models.RedisInstance{ID: id, Name: id}, nil
+		},
+	})
+	app.AdminUsers = map[string]bool{"kevin": true}
+	if _, err := app.Auth.CreateUser(context.Background(), "vera", testUserHash); err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	e, v1 := newTestEchoWithAuth(app)
+	v1.PUT("/users/:username/role", app.SetUserRole, requireSession)
+	v1.GET("/instances/:id", app.GetInstance, app.requireRole(authstore.RoleViewer))
+	v1.DELETE("/instances/:id", app.DeleteInstance, app.requireRole(authstore.RoleOwner))
+
+	do := func(method, path, authorization, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", authorization)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	login := func(username string) string {
+		req := httptest.NewRequest(http.MethodPost, "/api/login", bytes.NewReader([]byte(`{"username":"`+username+`","password":"KevinsPassword"}`)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		var out models.LoginResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil || out.Token == "" {
+			t.Fatalf("login %s: status %d, body %s", username, rec.Code, rec.Body.String())
+		}
+		return "Bearer " + out.Token
+	}
+
+	admin := login("kevin")
+	if rec := do(http.MethodPut, "/api/v1/users/vera/role", admin, `{"role":"superuser"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid role: got %d, want 400", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/api/v1/users/vera/role", admin, `{"role":"viewer"}`); rec.Code != http.StatusOK {
+		t.Fatalf("set role: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+
+	viewer := login("vera")
+	if rec := do(http.MethodGet, "/api/v1/instances/a", viewer, ""); rec.Code != http.StatusOK {
+		t.Fatalf("viewer get: got %d, want 200", rec.Code)
+	}
+	rec := do(http.MethodDelete, "/api/v1/instances/a", viewer, "")
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "requires owner") {
+		t.Fatalf("viewer delete: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPut, "/api/v1/users/vera/role", viewer, `{"role":"owner"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("non-admin set role: got %d, want 403", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/v1/instances/a", admin, ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("owner delete: got %d, want 202", rec.Code)
+	}
+}
+
+// Organizations: invitation flow, X-Org tenant selection and membership roles.
+func TestOrgs_Handler(t *testing.T) {
+	app := newTestApp(&mockStore{})
+	if _, err := app.Auth.CreateUser(context.Background(), "vera", testUserHash); err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	e, v1 := newTestEchoWithAuth(app)
+	v1.POST("/orgs", app.CreateOrg, requireSession)
+	v1.POST("/orgs/:org/invitations", app.InviteOrgMember, requireSession)
+	v1.GET("/invitations", app.ListMyInvitations, requireSession)
+	v1.POST("/invitations/:id/accept", app.AcceptInvitation, requireSession)
+	v1.DELETE("/orgs/:org/members/:username", app.RemoveOrgMember, requireSession)
+	v1.PUT("/orgs/:org/members/:username", app.SetOrgMemberRole, requireSession)
+	v1.GET("/apikeys", app.ListAPIKeys, requireSession)
+	v1.POST("/apikeys", app.CreateAPIKey, requireSession)
+	v1.DELETE("/apikeys/:id", app.RevokeAPIKey, requireSession)
+	v1.DELETE("/instances/:id", app.DeleteInstance, app.requireRole(authstore.RoleOwner))
+	v1.GET("/whoami", func(c *echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{
+			"tenant": tenantOf(c),
+			"actor":  subjectOf(c),
+			"role":   currentRole(c),
+		})
+	})
+
+	do := func(method, path, authorization, org, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", authorization)
+		if org != "" {
+			req.Header.Set("X-Org", org)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	login := func(username string) string {
+		req := httptest.NewRequest(http.MethodPost, "/api/login", bytes.NewReader([]byte(`{"username":"`+username+`","password":"KevinsPassword"}`)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		var out models.LoginResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil || out.Token == "" {
+			t.Fatalf("login %s: status %d, body %s", username, rec.Code, rec.Body.String())
+		}
+		return "Bearer " + out.Token
+	}
+	kevin, vera := login("kevin"), login("vera")
+
+	if rec := do(http.MethodPost, "/api/v1/orgs", kevin, "", `{"name":"acme"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("create org: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/api/v1/whoami", vera, "acme", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("non-member X-Org: got %d, want 403", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/v1/orgs/acme/invitations", vera, "", `{"username":"vera","role":"owner"}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("non-member invite: got %d, want 404", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/v1/orgs/acme/invitations", kevin, "", `{"username":"vera","role":"operator"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("invite: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+
+	rec := do(http.MethodGet, "/api/v1/invitations", vera, "", "")
+	var invs []models.Invitation
+	if err := json.Unmarshal(rec.Body.Bytes(), &invs); err != nil || len(invs) != 1 {
+		t.Fatalf("list invitations: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, "/api/v1/invitations/"+invs[0].ID+"/accept", kevin, "", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("accept someone else's invitation: got %d, want 404", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/v1/invitations/"+invs[0].ID+"/accept", vera, "", ""); rec.Code != http.StatusOK {
+		t.Fatalf("accept: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+
+	// With X-Org the tenant is the org, the actor stays the member and the membership role applies.
+	rec = do(http.MethodGet, "/api/v1/whoami", vera, "acme", "")
+	var who map[string]string
+	_ = json.Unmarshal(rec.Body.Bytes(), &who)
+	if who["tenant"] != "org-acme" || who["actor"] != "vera" || who["role"] != authstore.RoleOperator {
+		t.Fatalf("whoami in org: got %v", who)
+	}
+	if ns, _ := k8s.TenantNamespace(who["tenant"]); ns != "tenant-org-acme" {
+		t.Fatalf("org namespace: got %q", ns)
+	}
+	if rec := do(http.MethodDelete, "/api/v1/instances/a", vera, "acme", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("operator delete in org: got %d, want 403", rec.Code)
+	}
+
+	// Members below owner only revoke the org's API keys they created; owners revoke all.
+	createKey := func(authorization string) string {
+		t.Helper()
+		rec := do(http.MethodPost, "/api/v1/apikeys", authorization, "acme", `{"name":"ci","scopes":["instances:read"]}`)
+		var key models.CreateAPIKeyResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &key); err != nil || rec.Code != http.StatusCreated {
+			t.Fatalf("create org api key: got %d; body=%s", rec.Code, rec.Body.String())
+		}
+		return key.ID
+	}
+	if rec := do(http.MethodPut, "/api/v1/orgs/acme/members/vera", kevin, "", `{"role":"viewer"}`); rec.Code != http.StatusOK {
+		t.Fatalf("set viewer: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+	kevinsKey, verasKey := createKey(kevin), createKey(vera)
+	listKeys := func(authorization string) []string {
+		t.Helper()
+		rec := do(http.MethodGet, "/api/v1/apikeys", authorization, "acme", "")
+		var keys []models.APIKey
+		if err := json.Unmarshal(rec.Body.Bytes(), &keys); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("list org api keys: got %d; body=%s", rec.Code, rec.Body.String())
+		}
+		ids := make([]string, 0, len(keys))
+		for _, k := range keys {
+			ids = append(ids, k.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	if ids := listKeys(vera); !slices.Equal(ids, []string{verasKey}) {
+		t.Fatalf("viewer lists org api keys: got %v, want only %s", ids, verasKey)
+	}
+	if ids, want := listKeys(kevin), slices.Sorted(slices.Values([]string{kevinsKey, verasKey})); !slices.Equal(ids, want) {
+		t.Fatalf("owner lists org api keys: got %v, want %v", ids, want)
+	}
+	if rec := do(http.MethodDelete, "/api/v1/apikeys/"+kevinsKey, vera, "acme", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("viewer revokes another member's key: got %d, want 404", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/v1/apikeys/"+verasKey, vera, "acme", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("viewer revokes own key: got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/v1/apikeys/"+createKey(vera), kevin, "acme", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("owner revokes a member's key: got %d", rec.Code)
+	}
+
+	// The last owner cannot leave; a member can.
+	if rec := do(http.MethodDelete, "/api/v1/orgs/acme/members/kevin", kevin, "", ""); rec.Code != http.StatusConflict {
+		t.Fatalf("last owner leaves: got %d, want 409", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/v1/orgs/acme/members/vera", vera, "", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("member leaves: got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/v1/whoami", vera, "acme", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("former member X-Org: got %d, want 403", rec.Code)
+	}
+}
+
+func TestOIDC_Handler(t *testing.T) {
+	idp := oidctest.New("paas", "s3cret")
+	defer idp.Close()
+	idp.SetUserClaims(jwt.MapClaims{"sub": "00u7", "preferred_username": "Olga@Example.com"})
+	provider, err := auth.DiscoverOIDC(context.Background(), auth.OIDCConfig{
+		IssuerURL:    idp.Issuer(),
+		ClientID:     "paas",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://paas.local/api/oidc/callback",
+	})
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	app := newTestApp(&mockStore{})
+	app.OIDC = provider
+	app.OIDCAcceptAccessTokens = true
+	e, v1 := newTestEchoWithAuth(app)
+	e.GET("/api/oidc/login", app.OIDCLogin)
+	e.GET("/api/oidc/callback", app.OIDCCallback)
+	v1.POST("/oidc/link", app.OIDCLink)
+	v1.GET("/whoami", func(c *echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"tenant": tenantOf(c), "role": currentRole(c)})
+	})
+
+	// signIn takes a started flow (its cookie and the provider URL) through the IdP as the IdP's current
+	// user and returns the cookie and the query the IdP redirects back with.
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	signIn := func(start *httptest.ResponseRecorder, authURL string) (*http.Cookie, *url.URL) {
+		t.Helper()
+		cookies := start.Result().Cookies()
+		if len(cookies) != 1 || !cookies[0].HttpOnly {
+			t.Fatalf("login cookie: %v", cookies)
+		}
+		resp, err := noRedirect.Get(authURL)
+		if err != nil {
+			t.Fatalf("authorize: %v", err)
+		}
+		resp.Body.Close()
+		back, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatalf("authorize redirect: %v", err)
+		}
+		return cookies[0], back
+	}
+	callback := func(cookie *http.Cookie, back *url.URL) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/oidc/callback?"+back.RawQuery, nil)
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	login := func() (*http.Cookie, *url.URL) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil))
+		if rec.Code != http.StatusFound {
+			t.Fatalf("login: got %d", rec.Code)
+		}
+		return signIn(rec, rec.Header().Get("Location"))
+	}
+	whoami := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/whoami", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	tokenOf := func(rec *httptest.ResponseRecorder) string {
+		t.Helper()
+		var login models.LoginResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &login); err != nil || login.Token == "" {
+			t.Fatalf("callback response: %s", rec.Body.String())
+		}
+		return login.Token
+	}
+
+	cookie, back := login()
+	forged := back.Query()
+	forged.Set("state", "forged")
+	if rec := callback(cookie, &url.URL{RawQuery: forged.Encode()}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("callback with wrong state: got %d, want 400", rec.Code)
+	}
+	rec := callback(cookie, back)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+	token := tokenOf(rec)
+
+	// The user was provisioned from the claim, domain included, and our own token works.
+	if _, err := app.Auth.GetUser(context.Background(), "olga-example-com"); err != nil {
+		t.Fatalf("provisioned user: %v", err)
+	}
+	if rec := whoami(token); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"tenant":"olga-example-com"`) {
+		t.Fatalf("whoami with issued token: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+
+	// IdP access tokens are accepted directly and select the user by subject, whatever the username
+	// claim says; they are rejected for another audience.
+	access := idp.SignToken(jwt.MapClaims{"sub": "00u7", "preferred_username": "someone-else", "aud": "paas"})
+	if rec := whoami(access); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"tenant":"olga-example-com"`) {
+		t.Fatalf("whoami with idp token: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := whoami(idp.SignToken(jwt.MapClaims{"sub": "00u7", "preferred_username": "olga", "aud": "other"})); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("idp token for other audience: got %d, want 401", rec.Code)
+	}
+
+	// Another account whose claim names an existing user does not get that user.
+	idp.SetUserClaims(jwt.MapClaims{"sub": "mallory", "preferred_username": "kevin"})
+	if rec := callback(login()); rec.Code != http.StatusConflict {
+		t.Fatalf("callback for a taken username: got %d, want 409; body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := whoami(idp.SignToken(jwt.MapClaims{"sub": "mallory", "preferred_username": "kevin", "aud": "paas"})); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("idp token for a taken username: got %d, want 401", rec.Code)
+	}
+
+	// Kevin links his account explicitly from a session; it then signs in as kevin.
+	startLink := func() (*http.Cookie, *url.URL) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/oidc/link", nil)
+		req.Header.Set("Authorization", getTestBearerToken(t, e))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		var link models.OIDCLinkResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &link); rec.Code != http.StatusOK || err != nil || link.URL == "" {
+			t.Fatalf("start link: got %d; body=%s", rec.Code, rec.Body.String())
+		}
+		return signIn(rec, link.URL)
+	}
+	idp.SetUserClaims(jwt.MapClaims{"sub": "k-1", "preferred_username": "kevin@example.com"})
+	if rec := callback(startLink()); rec.Code != http.StatusOK || !strings.Contains(whoami(tokenOf(rec)).Body.String(), `"tenant":"kevin"`) {
+		t.Fatalf("link: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := callback(login()); rec.Code != http.StatusOK || !strings.Contains(whoami(tokenOf(rec)).Body.String(), `"tenant":"kevin"`) {
+		t.Fatalf("login with linked account: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+	if _, err := app.Auth.GetUser(context.Background(), "kevin-example-com"); !errors.Is(err, authstore.ErrNotFound) {
+		t.Fatalf("linked account provisioned a user: %v", err)
+	}
+	// An account linked to another user stays there, and a link cookie cannot be forged.
+	idp.SetUserClaims(jwt.MapClaims{"sub": "00u7", "preferred_username": "Olga@Example.com"})
+	if rec := callback(startLink()); rec.Code != http.StatusConflict {
+		t.Fatalf("link of an account linked elsewhere: got %d, want 409", rec.Code)
+	}
+	cookie, back = login()
+	cookie.Value += ".forged-link-token"
+	if rec := callback(cookie, back); rec.Code != http.StatusBadRequest {
+		t.Fatalf("callback with a forged link token: got %d, want 400", rec.Code)
+	}
+
+	app.OIDCAcceptAccessTokens = false
+	if rec := whoami(access); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("idp token with acceptance disabled: got %d, want 401", rec.Code)
+	}
+}
+
+func TestPrincipal_IgnoresClientIdentityHeader(t *testing.T) {
+	called := false
+	app := newTestApp(&mockStore{
+		ListInstancesFn: func(ctx context.Context) ([]models.RedisInstance, error) {
+			called = true
+			return nil, nil
+		},
+	})
+	e, v1 := newTestEchoWithAuth(app)
+	// A handler mistakenly registered outside the protected group.
+	e.GET("/unprotected/instances", app.ListInstances)
+	v1.GET("/whoami", func(c *echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"tenant": tenantOf(c), "header": c.Request().Header.Get("X-User")})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/unprotected/instances", nil)
+	req.Header.Set("X-User", "kevin")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || called {
+		t.Fatalf("spoofed X-User on unprotected route: got %d (store called: %v), want 401", rec.Code, called)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/whoami", nil)
+	req.Header.Set("Authorization", getTestBearerToken(t, e))
+	req.Header.Set("X-User", "mallory")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	var who map[string]string
+	_ = json.Unmarshal(rec.Body.Bytes(), &who)
+	if rec.Code != http.StatusOK || who["tenant"] != "kevin" || who["header"] != "" {
+		t.Fatalf("spoofed X-User on protected route: got %d %v", rec.Code, who)
+	}
+}
+
+func TestTenantNamespace(t *testing.T) {
+	long := strings.Repeat("a", 60)
+	tests := []struct {
+		tenant  string
+		want    string
+		wantErr bool
+	}{
+		{tenant: "alice", want: "tenant-alice"},
+		{tenant: "org-acme", want: "tenant-org-acme"},
+		{tenant: strings.Repeat("b", 56), want: "tenant-" + strings.Repeat("b", 56)},
+		{tenant: "", wantErr: true},
+		{tenant: "Bob Smith", wantErr: true},
+		{tenant: "bob--smith", wantErr: true},
+		{tenant: "-bob", wantErr: true},
+		{tenant: "default", wantErr: true},
+		{tenant: "kube-system", wantErr: true},
+		{tenant: strings.Repeat("a", 254), wantErr: true},
+	}
+	for _, tt := range tests {
+		ns, err := k8s.TenantNamespace(tt.tenant)
+		if (err != nil) != tt.wantErr || ns != tt.want {
+			t.Errorf("TenantNamespace(%q) = %q, %v; want %q (error: %v)", tt.tenant, ns, err, tt.want, tt.wantErr)
+		}
+	}
+
+	// Long tenants are shortened deterministically to a valid label, distinct per tenant.
+	a, _ := k8s.TenantNamespace(long)
+	again, _ := k8s.TenantNamespace(long)
+	b, _ := k8s.TenantNamespace(long + "b")
+	if len(a) > 63 || a != again || a == b || !strings.Contains(a, "--") {
+		t.Fatalf("long tenants: %q, %q, %q", a, again, b)
+	}
+}
+
+// syncingStore is a mockStore whose informer caches have not synced yet.
+type syncingStore struct {
+	mockStore
+	ready bool
+}
+
+func (s *syncingStore) Ready() bool { return s.ready }
+
+func TestReadyz_Handler(t *testing.T) {
+	store := &syncingStore{}
+	app := newTestApp(store)
+	e := echo.New()
+	e.GET("/readyz", app.Readyz)
+	for _, tc := range []struct {
+		ready bool
+		want  int
+	}{{false, http.StatusServiceUnavailable}, {true, http.StatusOK}} {
+		store.ready = tc.ready
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rec.Code != tc.want {
+			t.Errorf("ready=%v: status %d, want %d", tc.ready, rec.Code, tc.want)
+		}
+	}
+}
+
+// fakeBackupJobs is a test double for k8s.BackupJobs; status maps backup ids to their Job's state.
+type fakeBackupJobs struct {
+	mu      sync.Mutex
+	status  map[string]k8s.BackupStatus
+	deleted []string
+}
+
+func (f *fakeBackupJobs) StartBackup(ctx context.Context, instanceID, backupID string) (string, error) {
+	if instanceID != "cache" {
+		return "", fmt.Errorf("%w: %s", k8s.ErrNotFound, instanceID)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status[backupID] = k8s.BackupStatus{State: models.BackupRunning}
+	return "s3://backups/" + backupID + ".rdb", nil
+}
+
+func (f *fakeBackupJobs) BackupStatus(ctx context.Context, backupID, location string) (*k8s.BackupStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	st := f.status[backupID]
+	return &st, nil
+}
+
+func (f *fakeBackupJobs) DeleteBackupObject(ctx context.Context, backupID, location string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleted = append(f.deleted, location)
+	return nil
+}
+
+func TestBackups_Handler(t *testing.T) {
+	app := newTestApp(&mockStore{})
+	jobs := &fakeBackupJobs{status: map[string]k8s.BackupStatus{}}
+	e, v1 := newTestEchoWithAuth(app)
+	v1.GET("/instances/:id/backups", app.ListBackups)
+	v1.GET("/instances/:id/backups/:backupId", app.GetBackup)
+	v1.POST("/instances/:id/backups", app.CreateBackup)
+	v1.DELETE("/instances/:id/backups/:backupId", app.DeleteBackup)
+	bearer := getTestBearerToken(t, e)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", bearer)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/api/v1/instances/cache/backups"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("backups not configured: got %d, want 503", rec.Code)
+	}
+	app.BackupJobs = jobs
+	if rec := do(http.MethodPost, "/api/v1/instances/missing/backups"); rec.Code != http.StatusNotFound {
+		t.Fatalf("backup of missing instance: got %d, want 404", rec.Code)
+	}
+	rec := do(http.MethodPost, "/api/v1/instances/cache/backups")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("create backup: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+	var created models.Backup
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("parse backup: %v", err)
+	}
+	path := "/api/v1/instances/cache/backups/" + created.ID
+	if created.State != models.BackupRunning || created.CreatedBy != "kevin" || rec.Header().Get(echo.HeaderLocation) != path {
+		t.Fatalf("created %+v, location %q", created, rec.Header().Get(echo.HeaderLocation))
+	}
+	if rec := do(http.MethodDelete, path); rec.Code != http.StatusConflict {
+		t.Fatalf("delete running backup: got %d, want 409", rec.Code)
+	}
+
+	// The Job's outcome is recorded on the next read.
+	jobs.mu.Lock()
+	jobs.status[created.ID] = k8s.BackupStatus{State: models.BackupCompleted, SizeBytes: 42}
+	jobs.mu.Unlock()
+	rec = do(http.MethodGet, path)
+	var got models.Backup
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.State != models.BackupCompleted || got.SizeBytes != 42 || got.CompletedAt == nil {
+		t.Fatalf("get backup: %d %s", rec.Code, rec.Body.String())
+	}
+	rec = do(http.MethodGet, "/api/v1/instances/cache/backups")
+	var list []models.Backup
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list) != 1 || list[0].State != models.BackupCompleted {
+		t.Fatalf("list backups: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/api/v1/instances/other/backups/"+created.ID); rec.Code != http.StatusNotFound {
+		t.Fatalf("backup under another instance: got %d, want 404", rec.Code)
+	}
+
+	if rec := do(http.MethodDelete, path); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete backup: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+	if len(jobs.deleted) != 1 || jobs.deleted[0] != created.Location {
+		t.Fatalf("deleted objects %v", jobs.deleted)
+	}
+	if rec := do(http.MethodGet, path); rec.Code != http.StatusNotFound {
+		t.Fatalf("get deleted backup: got %d, want 404", rec.Code)
+	}
+
+	// A backup whose record cannot be stored is removed again.
+	app.Backups = failingBackupStore{app.Backups}
+	if rec := do(http.MethodPost, "/api/v1/instances/cache/backups"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("create backup without store: got %d, want 500", rec.Code)
+	}
+	if len(jobs.deleted) != 2 {
+		t.Fatalf("unrecorded backup not removed: deleted %v", jobs.deleted)
+	}
+}
+
+// failingBackupStore fails to record new backups.
+type failingBackupStore struct{ backupstore.Store }
+
+func (failingBackupStore) CreateBackup(context.Context, backupstore.Backup) error {
+	return errors.New("database unavailable")
+}
+
+func TestCreateInstance_Clone(t *testing.T) {
+	var got models.CreateRedisRequest
+	app := newTestApp(&mockStore{
+		CreateInstanceFn: func(ctx context.Context, req models.CreateRedisRequest) (*models.RedisInstance, error) {
+			got = req
+			return &models.RedisInstance{ID: req.Name, Name: req.Name, RestoredFrom: req.RestoreFrom.RDBURL}, nil
+		},
+	})
+	e, v1 := newTestEchoWithAuth(app)
+	v1.POST("/instances", app.CreateInstance)
+	bearer := getTestBearerToken(t, e)
+
+	do := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/instances", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", bearer)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	clone := `{"name":"staging","cloneFrom":{"instanceId":"cache"}}`
+	if rec := do(clone); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("backups not configured: got %d, want 503", rec.Code)
+	}
+	app.BackupJobs = &fakeBackupJobs{status: map[string]k8s.BackupStatus{}}
+	if rec := do(`{"name":"staging","cloneFrom":{"instanceId":"missing"}}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("clone of missing instance: got %d, want 400", rec.Code)
+	}
+	if rec := do(`{"name":"staging","cloneFrom":{"instanceId":"cache"},"restoreFrom":{"rdbUrl":"s3://backups/x.rdb"}}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("cloneFrom with restoreFrom: got %d, want 400", rec.Code)
+	}
+
+	// A create the store would reject does not take a backup of the source.
+	store := app.Store.(*mockStore)
+	store.ValidateCreateFn = func(ctx context.Context, req models.CreateRedisRequest) error {
+		return &k8s.QuotaExceededError{Resource: "instances", Used: "2", Limit: "2"}
+	}
+	if rec := do(clone); rec.Code != http.StatusConflict {
+		t.Fatalf("clone over quota: got %d, want 409", rec.Code)
+	}
+	if backups, _ := app.Backups.ListBackups(context.Background(), "kevin", "cache"); len(backups) != 0 {
+		t.Fatalf("backup taken for a rejected clone: %+v", backups)
+	}
+	store.ValidateCreateFn = nil
+
+	if rec := do(clone); rec.Code != http.StatusAccepted {
+		t.Fatalf("clone: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+	backups, err := app.Backups.ListBackups(context.Background(), "kevin", "cache")
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("backups of the source: %v, %v", backups, err)
+	}
+	if got.CloneFrom != nil || got.RestoreFrom == nil || got.RestoreFrom.RDBURL != backups[0].Location {
+		t.Fatalf("store request %+v, want a restore of %s", got, backups[0].Location)
+	}
+}
+
+// fakeRotator is a test double for k8s.PasswordRotator.
+type fakeRotator struct {
+	grace time.Duration
+	err   error
+}
+
+func (f *fakeRotator) RotatePassword(ctx context.Context, id string, grace time.Duration) (*models.CredentialsRotation, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.grace = grace
+	return &models.CredentialsRotation{InstanceID: id, Password: "new", RotatedAt: time.Now().UTC()}, nil
+}
+
+func TestRotateCredentials(t *testing.T) {
+	app := newTestApp(&mockStore{})
+	e, v1 := newTestEchoWithAuth(app)
+	v1.POST("/instances/:id/credentials/rotate", app.RotateCredentials)
+	bearer := getTestBearerToken(t, e)
+
+	do := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/instances/cache/credentials/rotate", strings.NewReader(body))
+		if body != "" {
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		}
+		req.Header.Set("Authorization", bearer)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(""); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("without rotator: got %d, want 503", rec.Code)
+	}
+	rotator := &fakeRotator{}
+	app.Passwords = rotator
+	rec := do("")
+	if rec.Code != http.StatusOK || rotator.grace != defaultPasswordGracePeriod {
+		t.Fatalf("default grace: got %d, grace %s; body=%s", rec.Code, rotator.grace, rec.Body.String())
+	}
+	var out models.CredentialsRotation
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil || out.Password != "new" {
+		t.Fatalf("response %s: %v", rec.Body.String(), err)
+	}
+	if rec := do(`{"gracePeriodSeconds":0}`); rec.Code != http.StatusOK || rotator.grace != 0 {
+		t.Fatalf("no grace: got %d, grace %s", rec.Code, rotator.grace)
+	}
+	for _, body := range []string{`{"gracePeriodSeconds":-1}`, `{"gracePeriodSeconds":86401}`} {
+		if rec := do(body); rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: got %d, want 400", body, rec.Code)
+		}
+	}
+
+	rotator.err = fmt.Errorf("%w: cache", k8s.ErrNotFound)
+	if rec := do(""); rec.Code != http.StatusNotFound {
+		t.Fatalf("missing instance: got %d, want 404", rec.Code)
+	}
+	rotator.err = fmt.Errorf("%w: not all pods of cache are running", k8s.ErrRotationUnavailable)
+	if rec := do(""); rec.Code != http.StatusConflict {
+		t.Fatalf("pods not running: got %d, want 409", rec.Code)
+	}
+}
+
+func TestGetCredentials_Handler(t *testing.T) {
+	store := &mockStore{
+		GetInstanceFn: func(ctx context.Context, id string) (*models.RedisInstance, error) {
+			if id == "missing" {
+				return nil, k8s.ErrNotFound
+			}
+			return &models.RedisInstance{ID: id, Name: id, RevealCredentialsOnce: id == "once"}, nil
+		},
+		GetCredentialsFn: func(ctx context.Context, id string) (*models.InstanceCredentials, error) {
+			if id == "once" {
+				t.Error("credentials of a reveal-once instance were read")
+			}
+			return &models.InstanceCredentials{InstanceID: id, Endpoint: "rfrm-" + id + ".tenant-kevin.svc.cluster.local:6379", Password: "secret"}, nil
+		},
+	}
+	app := newTestApp(store)
+	e, v1 := newTestEchoWithAuth(app)
+	v1.GET("/instances/:id/credentials", app.GetCredentials)
+	bearer := getTestBearerToken(t, e)
+	do := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/instances/"+id+"/credentials", nil)
+		req.Header.Set("Authorization", bearer)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("cache")
+	var creds models.InstanceCredentials
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &creds) != nil || creds.Password != "secret" {
+		t.Fatalf("credentials: got %d; body=%s", rec.Code, rec.Body.String())
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Fatalf("Cache-Control %q", cc)
+	}
+	if rec := do("missing"); rec.Code != http.StatusNotFound {
+		t.Fatalf("missing instance: got %d, want 404", rec.Code)
+	}
+	if rec := do("once"); rec.Code != http.StatusGone {
+		t.Fatalf("reveal-once instance: got %d, want 410", rec.Code)
+	}
+}
@@ -1,14 +1,23 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strings"
 
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/authstore"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v5"
 )
 
-func JWTMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+// errAuthUnavailable marks token validation failures caused by the auth store rather than the token.
+var errAuthUnavailable = errors.New("auth store unavailable")
+
+// JWTMiddleware validates the bearer token against the application's key set (by "kid") or, if enabled,
+// the OIDC provider's JWKS, rejects tokens whose "jti" has been revoked (logout) and stores the caller as
+// Principal: the subject is the tenant, the role comes from the "role" claim (viewer if missing or unknown).
+func (a *Application) JWTMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c *echo.Context) error {
 		// Get Token from Header
 		authHeader := c.Request().Header.Get("Authorization")
@@ -16,27 +25,97 @@ func JWTMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "missing or invalid token"})
 		}
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		ctx := c.Request().Context()
 
-		// Parse and validate token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, echo.ErrUnauthorized
-			}
-			// TODO: Load secret from config/env
-			return []byte("kevins-super-secret-key"), nil
-		})
-
-		if err != nil || !token.Valid {
+		var p *Principal
+		var err error
+		if a.OIDC != nil && a.OIDCAcceptAccessTokens && unverifiedIssuer(tokenString) == a.OIDC.Issuer() {
+			p, err = a.verifyOIDCAccessToken(ctx, tokenString)
+		} else {
+			p, err = a.verifyAccessToken(tokenString)
+		}
+		if errors.Is(err, errAuthUnavailable) {
+			a.Logger.Error("token validation failed", "error", err)
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "failed to validate token"})
+		}
+		if err != nil || p.Subject == "" {
 			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid token"})
 		}
 
-		// Extract claims and set user
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			if sub, ok := claims["sub"].(string); ok {
-				c.Request().Header.Set("X-User", sub)
+		if p.TokenID != "" {
+			revoked, err := a.Auth.IsAccessTokenRevoked(ctx, p.TokenID)
+			if err != nil {
+				a.Logger.Error("token revocation check failed", "error", err)
+				return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "failed to validate token"})
+			}
+			if revoked {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "token revoked"})
 			}
 		}
+		p.Tenant = p.Subject
+		p.AuthMethod = authMethodJWT
+		setPrincipal(c, p)
 
 		return next(c)
 	}
 }
+
+// verifyAccessToken validates a token issued by this API; only algorithms of configured keys are accepted.
+func (a *Application) verifyAccessToken(raw string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(raw, claims, a.Keys.Keyfunc,
+		jwt.WithValidMethods(a.Keys.Methods()),
+		jwt.WithIssuer(a.JWTIssuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	p := &Principal{}
+	p.Subject, _ = claims["sub"].(string)
+	p.orgClaim, _ = claims["org"].(string)
+	p.TokenID, _ = claims["jti"].(string)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		p.ExpiresAt = exp.Time
+	}
+	p.Role, _ = claims["role"].(string)
+	if !authstore.ValidRole(p.Role) {
+		p.Role = authstore.RoleViewer
+	}
+	return p, nil
+}
+
+// verifyOIDCAccessToken validates an access token issued by the OIDC provider and maps it onto the local
+// user linked to the account (provisioned on first use, see oidcUser), whose role and disabled flag apply.
+func (a *Application) verifyOIDCAccessToken(ctx context.Context, raw string) (*Principal, error) {
+	claims, err := a.OIDC.VerifyAccessToken(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.oidcUser(ctx, claims)
+	if errors.Is(err, errOIDCUsername) || errors.Is(err, errOIDCUsernameTaken) || errors.Is(err, authstore.ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Join(errAuthUnavailable, err)
+	}
+	if user.Disabled {
+		return nil, errors.New("user disabled")
+	}
+	p := &Principal{Subject: user.Username, Role: roleOrOwner(user.Role)}
+	p.TokenID, _ = claims["jti"].(string)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		p.ExpiresAt = exp.Time
+	}
+	return p, nil
+}
+
+// unverifiedIssuer returns the "iss" claim without validating the token; only used to pick the verifier.
+func unverifiedIssuer(raw string) string {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(raw, claims); err != nil {
+		return ""
+	}
+	iss, _ := claims["iss"].(string)
+	return iss
+}
@@ -0,0 +1,324 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/authstore"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	// oidcCookie carries state, nonce and PKCE verifier from /api/oidc/login to the callback.
+	oidcCookie       = "paas_oidc"
+	oidcCookiePath   = "/api/oidc"
+	oidcCookieMaxAge = 600 // seconds to complete the login at the provider
+)
+
+// OIDCLogin starts the authorization-code flow by redirecting to the identity provider (GET /api/oidc/login).
+func (a *Application) OIDCLogin(c *echo.Context) error {
+	if a.OIDC == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "oidc login is not configured"})
+	}
+	authURL, err := a.startOIDCFlow(c, "")
+	if err != nil {
+		a.Logger.Error("failed to generate oidc state", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to start login"})
+	}
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCLink starts linking an SSO account to the caller's user (POST /api/v1/oidc/link). It responds with the
+// provider URL to open in the browser; the callback then links the account that signs in there to the
+// caller instead of logging in as the user the account maps to. This is the only way an SSO account gets
+// access to an existing user besides an admin linking it (LinkUserIdentity).
+func (a *Application) OIDCLink(c *echo.Context) error {
+	if a.OIDC == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "oidc login is not configured"})
+	}
+	authURL, err := a.startOIDCFlow(c, subjectOf(c))
+	if err != nil {
+		a.Logger.Error("failed to start oidc link", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to start link"})
+	}
+	return c.JSON(http.StatusOK, models.OIDCLinkResponse{URL: authURL})
+}
+
+// startOIDCFlow sets the login cookie and returns the provider's authorization URL. With linkUser set the
+// cookie also carries a link token for that user (see oidcLinkUser).
+func (a *Application) startOIDCFlow(c *echo.Context, linkUser string) (string, error) {
+	parts := make([]string, 3, 4) // state, nonce, code verifier[, link token]
+	for i := range parts {
+		v, err := randomToken(32)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = v
+	}
+	if linkUser != "" {
+		link, err := a.Keys.Sign(jwt.MapClaims{
+			"iss":   a.JWTIssuer + oidcLinkIssuerSuffix,
+			"sub":   linkUser,
+			"state": parts[0],
+			"exp":   time.Now().Add(oidcCookieMaxAge * time.Second).Unix(),
+		})
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, link)
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     oidcCookie,
+		Value:    strings.Join(parts, "."),
+		Path:     oidcCookiePath,
+		MaxAge:   oidcCookieMaxAge,
+		HttpOnly: true,
+		Secure:   isHTTPS(c.Request()),
+		SameSite: http.SameSiteLaxMode, // sent on the top-level redirect back from the provider
+	})
+	return a.OIDC.AuthCodeURL(parts[0], parts[1], parts[2]), nil
+}
+
+// OIDCCallback completes the flow (GET /api/oidc/callback): it checks state, redeems the code, validates
+// the ID token, looks up the local user linked to the account (created on first login, see oidcUser, or
+// linked now when the flow was started by OIDCLink) and issues our own tokens. With OIDCPostLoginRedirect set it redirects there with the tokens in the URL fragment,
+// otherwise it responds with the LoginResponse JSON.
+func (a *Application) OIDCCallback(c *echo.Context) error {
+	if a.OIDC == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "oidc login is not configured"})
+	}
+	q := c.QueryParams()
+	if e := q.Get("error"); e != "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "identity provider: " + e + " " + q.Get("error_description")})
+	}
+	cookie, err := c.Cookie(oidcCookie)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "login session expired, please retry"})
+	}
+	// Single use: clear the cookie whatever the outcome.
+	c.SetCookie(&http.Cookie{Name: oidcCookie, Path: oidcCookiePath, MaxAge: -1, HttpOnly: true, Secure: isHTTPS(c.Request())})
+	parts := strings.SplitN(cookie.Value, ".", 4) // the link token is a JWT and contains dots itself
+	if len(parts) < 3 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(q.Get("state"))) != 1 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid login state"})
+	}
+	nonce, verifier := parts[1], parts[2]
+	var linkUser string
+	if len(parts) == 4 {
+		if linkUser, err = a.oidcLinkUser(parts[3], parts[0]); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid login state"})
+		}
+	}
+
+	ctx := c.Request().Context()
+	tokens, err := a.OIDC.Exchange(ctx, q.Get("code"), verifier)
+	if err != nil {
+		a.Logger.Error("oidc code exchange failed", "error", err)
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "login failed"})
+	}
+	claims, err := a.OIDC.VerifyIDToken(ctx, tokens.IDToken, nonce)
+	if err != nil {
+		a.Logger.Error("oidc id token rejected", "error", err)
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "login failed"})
+	}
+	var user *authstore.User
+	if linkUser != "" {
+		user, err = a.linkOIDCIdentity(ctx, claims, linkUser)
+	} else {
+		user, err = a.oidcUser(ctx, claims)
+	}
+	switch {
+	case errors.Is(err, errOIDCUsername):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, errOIDCUsernameTaken), errors.Is(err, errOIDCLinkedElsewhere):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, authstore.ErrNotFound):
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "login failed"})
+	case err != nil:
+		a.Logger.Error("failed to map oidc account", "link", linkUser, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "login failed"})
+	}
+	if user.Disabled {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "user is disabled"})
+	}
+
+	resp, refreshTokenID, err := a.issueTokens(ctx, user, "")
+	if err != nil {
+		a.Logger.Error("failed to issue tokens", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to sign token"})
+	}
+	subject, _ := claims["sub"].(string)
+	a.writeAuditLog(withActor(ctx, user.Username), user.Username, "", "oidc_login", map[string]any{"issuer": a.OIDC.Issuer(), "subject": subject, "refreshTokenId": refreshTokenID})
+
+	if a.OIDCPostLoginRedirect == "" {
+		return c.JSON(http.StatusOK, resp)
+	}
+	fragment := url.Values{
+		"token":        {resp.Token},
+		"refreshToken": {resp.RefreshToken},
+		"expiresIn":    {strconv.Itoa(resp.ExpiresIn)},
+		"username":     {user.Username},
+	}
+	return c.Redirect(http.StatusFound, a.OIDCPostLoginRedirect+"#"+fragment.Encode())
+}
+
+// oidcLinkIssuerSuffix is appended to JWTIssuer in link tokens, so verifyAccessToken never accepts one as
+// an access token.
+const oidcLinkIssuerSuffix = "#oidc-link"
+
+// Errors mapping an SSO account onto a local user.
+var (
+	errOIDCUsername        = errors.New("the username claim does not map to a valid username")
+	errOIDCUsernameTaken   = errors.New("the username is taken by an existing user: sign in to that user and link this account (POST /api/v1/oidc/link)")
+	errOIDCLinkedElsewhere = errors.New("this account is linked to another user")
+)
+
+// oidcLinkUser returns the user a link token (see startOIDCFlow) was issued to for the flow with state.
+func (a *Application) oidcLinkUser(raw, state string) (string, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(raw, claims, a.Keys.Keyfunc,
+		jwt.WithValidMethods(a.Keys.Methods()),
+		jwt.WithIssuer(a.JWTIssuer+oidcLinkIssuerSuffix),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return "", errors.New("invalid link token")
+	}
+	user, _ := claims["sub"].(string)
+	if got, _ := claims["state"].(string); got != state || user == "" {
+		return "", errors.New("invalid link token")
+	}
+	return user, nil
+}
+
+// oidcUser returns the local user linked to the SSO account (issuer and "sub") of claims. The first login of
+// an unlinked account creates a user without a password named by oidcUsername. An existing user of that
+// name is never reused (errOIDCUsernameTaken): the claim does not prove the account owns it.
+func (a *Application) oidcUser(ctx context.Context, claims jwt.MapClaims) (*authstore.User, error) {
+	issuer := a.OIDC.Issuer()
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", authstore.ErrNotFound)
+	}
+	id, err := a.Auth.GetIdentity(ctx, issuer, subject)
+	if err == nil {
+		return a.Auth.GetUser(ctx, id.Username)
+	}
+	if !errors.Is(err, authstore.ErrNotFound) {
+		return nil, err
+	}
+	username, err := a.oidcUsername(claims)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.Auth.CreateIdentityUser(ctx, authstore.Identity{Issuer: issuer, Subject: subject, Username: username})
+	if errors.Is(err, authstore.ErrAlreadyExists) {
+		// Either a concurrent first login of the same account, or the name belongs to another user.
+		if id, err := a.Auth.GetIdentity(ctx, issuer, subject); err == nil {
+			return a.Auth.GetUser(ctx, id.Username)
+		}
+		return nil, errOIDCUsernameTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.writeAuditLog(withActor(ctx, username), username, "", "user_create", map[string]any{"username": username, "by": "oidc", "issuer": issuer, "subject": subject})
+	return user, nil
+}
+
+// oidcUsername derives the name of a new SSO user from the configured username claim: lowercased, with
+// every character other than a-z, 0-9 and '-' replaced by '-', so "olga@example.com" becomes
+// "olga-example-com". The domain is kept; the result must be a valid, non-reserved username.
+func (a *Application) oidcUsername(claims jwt.MapClaims) (string, error) {
+	v, _ := claims[a.OIDCUsernameClaim].(string)
+	v = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(strings.TrimSpace(v)))
+	if validateUsername(v) != nil {
+		return "", fmt.Errorf("%w (claim %q)", errOIDCUsername, a.OIDCUsernameClaim)
+	}
+	return v, nil
+}
+
+// linkOIDCIdentity links the SSO account of claims to username, who started the link with OIDCLink, and
+// returns that user. Linking an account to the user it is already linked to is a no-op.
+func (a *Application) linkOIDCIdentity(ctx context.Context, claims jwt.MapClaims, username string) (*authstore.User, error) {
+	issuer := a.OIDC.Issuer()
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", authstore.ErrNotFound)
+	}
+	if err := a.createIdentity(withActor(ctx, username), issuer, subject, username); err != nil {
+		return nil, err
+	}
+	return a.Auth.GetUser(ctx, username)
+}
+
+// createIdentity links the account (issuer, subject) to username and audits it. Returns errOIDCLinkedElsewhere
+// if the account is linked to another user.
+func (a *Application) createIdentity(ctx context.Context, issuer, subject, username string) error {
+	err := a.Auth.CreateIdentity(ctx, authstore.Identity{Issuer: issuer, Subject: subject, Username: username})
+	if errors.Is(err, authstore.ErrAlreadyExists) {
+		id, err := a.Auth.GetIdentity(ctx, issuer, subject)
+		if err != nil {
+			return err
+		}
+		if id.Username != username {
+			return errOIDCLinkedElsewhere
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	a.writeAuditLog(ctx, username, "", "oidc_link", map[string]any{"username": username, "issuer": issuer, "subject": subject})
+	return nil
+}
+
+// LinkUserIdentity links an SSO account of the configured provider to a user (POST
+// /api/v1/users/:username/identities). Admin only; for users whose owner cannot sign in to start OIDCLink,
+// e.g. users created by SSO logins before accounts were linked by subject.
+func (a *Application) LinkUserIdentity(c *echo.Context) error {
+	if !a.isAdmin(c) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "admin privileges required"})
+	}
+	if a.OIDC == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "oidc login is not configured"})
+	}
+	var req models.LinkIdentityRequest
+	if err := c.Bind(&req); err != nil {
+		a.Logger.Error("failed to bind request", "error", err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if req.Subject == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "subject is required"})
+	}
+	username := c.Param("username")
+	err := a.createIdentity(c.Request().Context(), a.OIDC.Issuer(), req.Subject, username)
+	switch {
+	case errors.Is(err, authstore.ErrNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	case errors.Is(err, errOIDCLinkedElsewhere):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case err != nil:
+		a.Logger.Error("failed to link identity", "username", username, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to link identity"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// isHTTPS reports whether the client connection is TLS, directly or via a TLS-terminating proxy.
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/k8s"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/opstore"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	defaultOperationTimeout      = 15 * time.Minute
+	defaultOperationPollInterval = 5 * time.Second
+	// operationRetention is how long finished operations stay readable via GET /api/v1/operations/:id.
+	operationRetention = time.Hour
+	// defaultWaitTimeout and maxWaitTimeout bound ?wait=true; the operation keeps running afterwards.
+	defaultWaitTimeout = time.Minute
+	maxWaitTimeout     = 10 * time.Minute
+)
+
+// startOperation stores an operation for a call that was accepted by the store and follows the instance's
+// rollout in the background (see pollOperation). Any replica can report and advance it (see GetOperation).
+func (a *Application) startOperation(ctx context.Context, tenant, opType, instanceID string, inst *models.RedisInstance) (*models.Operation, error) {
+	// The request context ends with the response; poll with a detached one for the same tenant.
+	pollCtx, err := k8s.WithTenant(withActor(context.Background(), actorFromContext(ctx)), tenant)
+	if err != nil {
+		return nil, err
+	}
+	id, err := randomToken(12)
+	if err != nil {
+		return nil, fmt.Errorf("generate operation id: %w", err)
+	}
+	now := time.Now().UTC()
+	op := models.Operation{
+		ID:         id,
+		Type:       opType,
+		InstanceID: instanceID,
+		State:      models.OperationPending,
+		Instance:   inst,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := a.Operations.DeleteCompletedBefore(ctx, now.Add(-operationRetention)); err != nil {
+		a.Logger.Warn("failed to prune operations", "error", err)
+	}
+	if err := a.Operations.CreateOperation(ctx, tenant, op); err != nil {
+		return nil, fmt.Errorf("store operation: %w", err)
+	}
+	go a.pollOperation(pollCtx, tenant, op)
+	return &op, nil
+}
+
+// pollOperation advances op every OperationPollInterval (first check immediately) until it is done. If
+// this replica goes away first, the next GET /api/v1/operations/:id on any replica advances it instead.
+func (a *Application) pollOperation(ctx context.Context, tenant string, op models.Operation) {
+	ticker := time.NewTicker(a.OperationPollInterval)
+	defer ticker.Stop()
+	deadline := time.NewTimer(time.Until(op.CreatedAt.Add(a.OperationTimeout)))
+	defer deadline.Stop()
+	for {
+		next, err := a.advanceOperation(ctx, tenant, op)
+		if err != nil {
+			a.Logger.Warn("failed to update operation", "operationId", op.ID, "error", err)
+			// Give up once the operation is overdue; a later GET records the timeout.
+			if time.Since(op.CreatedAt) >= a.OperationTimeout {
+				return
+			}
+		} else if op = *next; op.Done() {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+		}
+	}
+}
+
+// advanceOperation checks the instance's progress, or fails op once OperationTimeout has passed since it
+// was created, and stores the result. The caller whose update finishes the operation writes its final
+// service log; if another replica finished it first, the stored operation is returned.
+func (a *Application) advanceOperation(ctx context.Context, tenant string, op models.Operation) (*models.Operation, error) {
+	if op.Done() {
+		return &op, nil
+	}
+	next := op
+	deadline := op.CreatedAt.Add(a.OperationTimeout)
+	if time.Now().Before(deadline) {
+		checkCtx, cancel := context.WithDeadline(ctx, deadline)
+		a.checkOperation(checkCtx, &next)
+		cancel()
+	} else {
+		next.State, next.Error = models.OperationFailed, fmt.Sprintf("timed out after %s", a.OperationTimeout)
+	}
+	if next.State == op.State && next.Message == op.Message && next.Error == op.Error {
+		return &op, nil
+	}
+	now := time.Now().UTC()
+	next.UpdatedAt = now
+	if next.Done() {
+		next.CompletedAt = &now
+	}
+	if err := a.Operations.UpdateOperation(ctx, tenant, next); errors.Is(err, opstore.ErrNotFound) {
+		return a.Operations.GetOperation(ctx, tenant, op.ID)
+	} else if err != nil {
+		return nil, err
+	}
+	if next.Done() {
+		// ctx may be a request that has ended; the final log must still be written.
+		a.writeServiceLog(context.WithoutCancel(ctx), tenant, next.InstanceID, "operation_"+next.State, next.Type+" "+next.State, map[string]any{
+			"operationId": next.ID,
+			"message":     next.Message,
+			"error":       next.Error,
+		})
+	}
+	return &next, nil
+}
+
+// checkOperation maps the instance's progress onto op: create and update succeed once the spec is rolled
+// out (see models.InstanceProgress.RolledOut) and all expected pods exist and are ready, delete once the
+// instance and all of its pods are gone; a failed pod fails the operation. Transient errors leave op
+// unchanged until the timeout.
+func (a *Application) checkOperation(ctx context.Context, op *models.Operation) {
+	set := func(state, message, errMsg string) {
+		op.State, op.Message, op.Error = state, message, errMsg
+	}
+	p, err := a.Store.InstanceProgress(ctx, op.InstanceID)
+	switch {
+	case err != nil:
+		a.Logger.Warn("operation progress check failed", "operationId", op.ID, "error", err)
+	case op.Type == "delete" && p.Deleted && p.Pods == 0:
+		set(models.OperationSucceeded, "instance deleted", "")
+	case op.Type == "delete":
+		set(models.OperationRunning, fmt.Sprintf("deleting, %d pods left", p.Pods), "")
+	case p.Deleted:
+		set(models.OperationFailed, "", "instance was deleted")
+	case p.Status == "failed":
+		set(models.OperationFailed, readyMessage(p), "instance pods failed")
+	case p.ExpectedPods > 0 && p.ReadyPods == p.ExpectedPods && p.Pods == p.ExpectedPods && p.RolledOut:
+		set(models.OperationSucceeded, readyMessage(p), "")
+	case !p.RolledOut:
+		set(models.OperationRunning, "rolling out, "+readyMessage(p), "")
+	default:
+		set(models.OperationRunning, readyMessage(p), "")
+	}
+}
+
+func readyMessage(p *models.InstanceProgress) string {
+	return fmt.Sprintf("%d/%d pods ready", p.ReadyPods, p.ExpectedPods)
+}
+
+// waitParams parses ?wait=true&timeout=<duration>. Without wait the timeout is 0.
+func waitParams(c *echo.Context) (time.Duration, error) {
+	wait, _ := strconv.ParseBool(c.QueryParam("wait"))
+	if !wait {
+		return 0, nil
+	}
+	raw := c.QueryParam("timeout")
+	if raw == "" {
+		return defaultWaitTimeout, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 || d > maxWaitTimeout {
+		return 0, fmt.Errorf("timeout must be a positive duration up to %s", maxWaitTimeout)
+	}
+	return d, nil
+}
+
+// awaitOperation waits up to wait for op to finish, or until the client goes away, advancing it every
+// OperationPollInterval, and returns its latest state. ctx carries the tenant.
+func (a *Application) awaitOperation(c *echo.Context, ctx context.Context, tenant string, op *models.Operation, wait time.Duration) *models.Operation {
+	if wait <= 0 || op.Done() {
+		return op
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	ticker := time.NewTicker(a.OperationPollInterval)
+	defer ticker.Stop()
+	for !op.Done() {
+		select {
+		case <-timer.C:
+			return op
+		case <-c.Request().Context().Done():
+			return op
+		case <-ticker.C:
+			next, err := a.advanceOperation(ctx, tenant, *op)
+			if err != nil {
+				a.Logger.Warn("failed to update operation", "operationId", op.ID, "error", err)
+				continue
+			}
+			op = next
+		}
+	}
+	return op
+}
+
+// respondOperation answers a call that started op: 200 if it finished within wait, otherwise 202 with a
+// Location header to poll. A non-nil inst is returned as the operation's instance in this response only.
+func (a *Application) respondOperation(c *echo.Context, ctx context.Context, tenant string, op *models.Operation, wait time.Duration, inst *models.RedisInstance) error {
+	op = a.awaitOperation(c, ctx, tenant, op, wait)
+	if inst != nil {
+		withInstance := *op
+		withInstance.Instance = inst
+		op = &withInstance
+	}
+	if op.Done() {
+		return c.JSON(http.StatusOK, op)
+	}
+	c.Response().Header().Set(echo.HeaderLocation, "/api/v1/operations/"+op.ID)
+	return c.JSON(http.StatusAccepted, op)
+}
+
+// GetOperation returns an operation of the caller's tenant (GET /api/v1/operations/:id), after checking
+// the instance's progress so that it also advances when the replica that started it is gone. Supports
+// ?wait=true&timeout= like the calls that start operations.
+func (a *Application) GetOperation(c *echo.Context) error {
+	wait, err := waitParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	tenant := tenantOf(c)
+	ctx, err := k8s.WithTenant(c.Request().Context(), tenant)
+	if err != nil {
+		return tenantError(c, err)
+	}
+	op, err := a.Operations.GetOperation(ctx, tenant, c.Param("id"))
+	if errors.Is(err, opstore.ErrNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "operation not found"})
+	}
+	if err != nil {
+		a.Logger.Error("failed to get operation", "id", c.Param("id"), "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get operation"})
+	}
+	if next, err := a.advanceOperation(ctx, tenant, *op); err != nil {
+		a.Logger.Warn("failed to update operation", "operationId", op.ID, "error", err)
+	} else {
+		op = next
+	}
+	return c.JSON(http.StatusOK, a.awaitOperation(c, ctx, tenant, op, wait))
+}
@@ -0,0 +1,384 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/authstore"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	// orgTenantPrefix marks organization tenants: org "acme" is tenant "org-acme" (namespace
+	// "tenant-org-acme"). Usernames with this prefix are reserved.
+	orgTenantPrefix = "org-"
+
+	// invitationTTL is how long an invitation can be accepted.
+	invitationTTL = 7 * 24 * time.Hour
+)
+
+// orgTenant returns the tenant key (Principal.Tenant) of an organization.
+func orgTenant(org string) string {
+	return orgTenantPrefix + org
+}
+
+// selectOrg switches the request to an organization tenant when the X-Org header (or, if absent, the
+// token's "org" claim) names one: the principal's tenant becomes the org tenant and its role the caller's
+// membership role there. Non-members get 403. The subject stays the individual user.
+func (a *Application) selectOrg(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c *echo.Context) error {
+		p := principalOf(c)
+		if p == nil {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthenticated"})
+		}
+		org := c.Request().Header.Get("X-Org")
+		if org == "" {
+			org = p.orgClaim
+		}
+		if org == "" {
+			return next(c)
+		}
+		ctx := c.Request().Context()
+		m, err := a.Auth.GetMembership(ctx, org, p.Subject)
+		if err != nil {
+			if errors.Is(err, authstore.ErrNotFound) {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "not a member of organization " + org})
+			}
+			a.Logger.Error("membership lookup failed", "org", org, "error", err)
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "failed to resolve organization"})
+		}
+		p.Org = org
+		p.Tenant = orgTenant(org)
+		p.Role = m.Role
+		return next(c)
+	}
+}
+
+// CreateOrg creates an organization with the caller as owner (POST /api/v1/orgs).
+func (a *Application) CreateOrg(c *echo.Context) error {
+	var req models.CreateOrgRequest
+	if err := c.Bind(&req); err != nil {
+		a.Logger.Error("failed to bind request", "error", err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if !validName(req.Name) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "name " + nameRules})
+	}
+	ctx := c.Request().Context()
+	actor := subjectOf(c)
+	org, err := a.Auth.CreateOrg(ctx, req.Name, actor)
+	if err != nil {
+		if errors.Is(err, authstore.ErrAlreadyExists) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "organization name already taken"})
+		}
+		a.Logger.Error("failed to create org", "org", req.Name, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create organization"})
+	}
+	a.writeAuditLog(ctx, orgTenant(org.Name), "", "org_create", map[string]any{"org": org.Name})
+	return c.JSON(http.StatusCreated, models.OrgMember{Org: org.Name, Username: actor, Role: authstore.RoleOwner, CreatedAt: org.CreatedAt})
+}
+
+// ListOrgs returns the caller's organization memberships (GET /api/v1/orgs).
+func (a *Application) ListOrgs(c *echo.Context) error {
+	ctx := c.Request().Context()
+	actor := subjectOf(c)
+	memberships, err := a.Auth.ListUserMemberships(ctx, actor)
+	if err != nil {
+		a.Logger.Error("failed to list orgs", "user", actor, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list organizations"})
+	}
+	return c.JSON(http.StatusOK, membersToModel(memberships))
+}
+
+// ListOrgMembers returns the members of an organization (GET /api/v1/orgs/:org/members). Members only.
+func (a *Application) ListOrgMembers(c *echo.Context) error {
+	org := c.Param("org")
+	if _, ok := a.requireMembership(c, org, authstore.RoleViewer); !ok {
+		return nil
+	}
+	members, err := a.Auth.ListMembers(c.Request().Context(), org)
+	if err != nil {
+		a.Logger.Error("failed to list members", "org", org, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list members"})
+	}
+	return c.JSON(http.StatusOK, membersToModel(members))
+}
+
+// SetOrgMemberRole changes a member's role (PUT /api/v1/orgs/:org/members/:username). Org owners only.
+func (a *Application) SetOrgMemberRole(c *echo.Context) error {
+	org, username := c.Param("org"), c.Param("username")
+	if _, ok := a.requireMembership(c, org, authstore.RoleOwner); !ok {
+		return nil
+	}
+	var req models.SetUserRoleRequest
+	if err := c.Bind(&req); err != nil {
+		a.Logger.Error("failed to bind request", "error", err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if !authstore.ValidRole(req.Role) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "role must be one of viewer, operator, owner"})
+	}
+	ctx := c.Request().Context()
+	if req.Role != authstore.RoleOwner {
+		if ok := a.keepsAnOwner(c, org, username); !ok {
+			return nil
+		}
+	}
+	if err := a.Auth.SetMemberRole(ctx, org, username, req.Role); err != nil {
+		if errors.Is(err, authstore.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "member not found"})
+		}
+		a.Logger.Error("failed to update member", "org", org, "username", username, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update member"})
+	}
+	a.writeAuditLog(ctx, orgTenant(org), "", "org_member_role_change", map[string]any{"org": org, "username": username, "role": req.Role})
+	m, err := a.Auth.GetMembership(ctx, org, username)
+	if err != nil {
+		a.Logger.Error("failed to look up member", "org", org, "username", username, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update member"})
+	}
+	return c.JSON(http.StatusOK, memberToModel(m))
+}
+
+// RemoveOrgMember removes a member (DELETE /api/v1/orgs/:org/members/:username).
+// Org owners may remove anyone; every member may remove themselves. The last owner cannot leave.
+func (a *Application) RemoveOrgMember(c *echo.Context) error {
+	org, username := c.Param("org"), c.Param("username")
+	ctx := c.Request().Context()
+	min := authstore.RoleOwner
+	if username == subjectOf(c) {
+		min = authstore.RoleViewer
+	}
+	if _, ok := a.requireMembership(c, org, min); !ok {
+		return nil
+	}
+	if ok := a.keepsAnOwner(c, org, username); !ok {
+		return nil
+	}
+	if err := a.Auth.RemoveMember(ctx, org, username); err != nil {
+		if errors.Is(err, authstore.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "member not found"})
+		}
+		a.Logger.Error("failed to remove member", "org", org, "username", username, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to remove member"})
+	}
+	a.writeAuditLog(ctx, orgTenant(org), "", "org_member_remove", map[string]any{"org": org, "username": username})
+	return c.NoContent(http.StatusNoContent)
+}
+
+// InviteOrgMember invites an existing user to an organization (POST /api/v1/orgs/:org/invitations). Org owners only.
+func (a *Application) InviteOrgMember(c *echo.Context) error {
+	org := c.Param("org")
+	if _, ok := a.requireMembership(c, org, authstore.RoleOwner); !ok {
+		return nil
+	}
+	var req models.InviteRequest
+	if err := c.Bind(&req); err != nil {
+		a.Logger.Error("failed to bind request", "error", err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if !authstore.ValidRole(req.Role) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "role must be one of viewer, operator, owner"})
+	}
+	ctx := c.Request().Context()
+	if _, err := a.Auth.GetUser(ctx, req.Username); err != nil {
+		if errors.Is(err, authstore.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+		}
+		a.Logger.Error("failed to look up user", "username", req.Username, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create invitation"})
+	}
+	if _, err := a.Auth.GetMembership(ctx, org, req.Username); err == nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "user is already a member"})
+	}
+
+	id, err := randomToken(16)
+	if err != nil {
+		a.Logger.Error("failed to generate invitation id", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create invitation"})
+	}
+	now := time.Now().UTC()
+	inv := authstore.Invitation{
+		ID:        id,
+		Org:       org,
+		Username:  req.Username,
+		Role:      req.Role,
+		InvitedBy: subjectOf(c),
+		ExpiresAt: now.Add(invitationTTL),
+		CreatedAt: now,
+	}
+	if err := a.Auth.CreateInvitation(ctx, inv); err != nil {
+		if errors.Is(err, authstore.ErrAlreadyExists) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "user already has a pending invitation"})
+		}
+		a.Logger.Error("failed to create invitation", "org", org, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create invitation"})
+	}
+	a.writeAuditLog(ctx, orgTenant(org), "", "org_invite", map[string]any{"org": org, "username": inv.Username, "role": inv.Role})
+	return c.JSON(http.StatusCreated, invitationToModel(&inv))
+}
+
+// ListOrgInvitations returns the pending invitations of an organization (GET /api/v1/orgs/:org/invitations). Org owners only.
+func (a *Application) ListOrgInvitations(c *echo.Context) error {
+	org := c.Param("org")
+	if _, ok := a.requireMembership(c, org, authstore.RoleOwner); !ok {
+		return nil
+	}
+	return a.listInvitations(c, org, "")
+}
+
+// ListMyInvitations returns the invitations addressed to the caller (GET /api/v1/invitations).
+func (a *Application) ListMyInvitations(c *echo.Context) error {
+	return a.listInvitations(c, "", subjectOf(c))
+}
+
+// AcceptInvitation makes the caller a member of the inviting organization (POST /api/v1/invitations/:id/accept).
+func (a *Application) AcceptInvitation(c *echo.Context) error {
+	ctx := c.Request().Context()
+	inv, ok := a.lookupInvitation(c)
+	if !ok {
+		return nil
+	}
+	if inv.Username != subjectOf(c) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "invitation not found"})
+	}
+	if time.Now().After(inv.ExpiresAt) {
+		return c.JSON(http.StatusGone, map[string]string{"error": "invitation expired"})
+	}
+	m, err := a.Auth.AcceptInvitation(ctx, inv.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, authstore.ErrNotFound):
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "invitation not found"})
+		case errors.Is(err, authstore.ErrAlreadyExists):
+			return c.JSON(http.StatusConflict, map[string]string{"error": "already a member"})
+		}
+		a.Logger.Error("failed to accept invitation", "id", inv.ID, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to accept invitation"})
+	}
+	a.writeAuditLog(ctx, orgTenant(m.Org), "", "org_join", map[string]any{"org": m.Org, "username": m.Username, "role": m.Role, "invitedBy": inv.InvitedBy})
+	return c.JSON(http.StatusOK, memberToModel(m))
+}
+
+// DeleteInvitation declines (invitee) or withdraws (org owner) an invitation (DELETE /api/v1/invitations/:id).
+func (a *Application) DeleteInvitation(c *echo.Context) error {
+	ctx := c.Request().Context()
+	inv, ok := a.lookupInvitation(c)
+	if !ok {
+		return nil
+	}
+	actor := subjectOf(c)
+	if inv.Username != actor {
+		m, err := a.Auth.GetMembership(ctx, inv.Org, actor)
+		if err != nil || m.Role != authstore.RoleOwner {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "invitation not found"})
+		}
+	}
+	if err := a.Auth.DeleteInvitation(ctx, inv.ID); err != nil {
+		if errors.Is(err, authstore.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "invitation not found"})
+		}
+		a.Logger.Error("failed to delete invitation", "id", inv.ID, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to delete invitation"})
+	}
+	a.writeAuditLog(ctx, orgTenant(inv.Org), "", "org_invite_delete", map[string]any{"org": inv.Org, "username": inv.Username})
+	return c.NoContent(http.StatusNoContent)
+}
+
+// requireMembership checks that the caller is a member of org with at least role min. On failure it
+// writes the response (404 for non-members, so org names are not disclosed; 403 otherwise) and returns false.
+func (a *Application) requireMembership(c *echo.Context, org, min string) (*authstore.Membership, bool) {
+	ctx := c.Request().Context()
+	m, err := a.Auth.GetMembership(ctx, org, subjectOf(c))
+	if err != nil {
+		if errors.Is(err, authstore.ErrNotFound) {
+			_ = c.JSON(http.StatusNotFound, map[string]string{"error": "organization not found"})
+			return nil, false
+		}
+		a.Logger.Error("membership lookup failed", "org", org, "error", err)
+		_ = c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to resolve organization"})
+		return nil, false
+	}
+	if roleRank[m.Role] < roleRank[min] {
+		_ = c.JSON(http.StatusForbidden, map[string]string{"error": "requires role " + min + " in organization " + org})
+		return nil, false
+	}
+	return m, true
+}
+
+// keepsAnOwner rejects (409) removing or demoting username if they are the org's last owner.
+func (a *Application) keepsAnOwner(c *echo.Context, org, username string) bool {
+	members, err := a.Auth.ListMembers(c.Request().Context(), org)
+	if err != nil {
+		a.Logger.Error("failed to list members", "org", org, "error", err)
+		_ = c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update member"})
+		return false
+	}
+	owners, target := 0, false
+	for _, m := range members {
+		if m.Role == authstore.RoleOwner {
+			owners++
+			target = target || m.Username == username
+		}
+	}
+	if target && owners == 1 {
+		_ = c.JSON(http.StatusConflict, map[string]string{"error": "an organization needs at least one owner"})
+		return false
+	}
+	return true
+}
+
+func (a *Application) listInvitations(c *echo.Context, org, username string) error {
+	invs, err := a.Auth.ListInvitations(c.Request().Context(), org, username)
+	if err != nil {
+		a.Logger.Error("failed to list invitations", "org", org, "username", username, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list invitations"})
+	}
+	out := make([]models.Invitation, 0, len(invs))
+	for i := range invs {
+		out = append(out, invitationToModel(&invs[i]))
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+// lookupInvitation loads the invitation named by :id. On failure it writes the response and returns false.
+func (a *Application) lookupInvitation(c *echo.Context) (*authstore.Invitation, bool) {
+	id := c.Param("id")
+	inv, err := a.Auth.GetInvitation(c.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, authstore.ErrNotFound) {
+			_ = c.JSON(http.StatusNotFound, map[string]string{"error": "invitation not found"})
+			return nil, false
+		}
+		a.Logger.Error("failed to look up invitation", "id", id, "error", err)
+		_ = c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to look up invitation"})
+		return nil, false
+	}
+	return inv, true
+}
+
+func memberToModel(m *authstore.Membership) models.OrgMember {
+	return models.OrgMember{Org: m.Org, Username: m.Username, Role: m.Role, CreatedAt: m.CreatedAt}
+}
+
+func membersToModel(ms []authstore.Membership) []models.OrgMember {
+	out := make([]models.OrgMember, 0, len(ms))
+	for i := range ms {
+		out = append(out, memberToModel(&ms[i]))
+	}
+	return out
+}
+
+func invitationToModel(inv *authstore.Invitation) models.Invitation {
+	return models.Invitation{
+		ID:        inv.ID,
+		Org:       inv.Org,
+		Username:  inv.Username,
+		Role:      inv.Role,
+		InvitedBy: inv.InvitedBy,
+		ExpiresAt: inv.ExpiresAt,
+		CreatedAt: inv.CreatedAt,
+	}
+}
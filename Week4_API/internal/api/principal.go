@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/authstore"
+	"github.com/labstack/echo/v5"
+)
+
+// ctxKeyPrincipal is the Echo context key of the authenticated *Principal.
+const ctxKeyPrincipal = "principal"
+
+// Principal is the authenticated caller of a request. Only the auth middleware (JWTMiddleware,
+// APIKeyMiddleware, selectOrg) creates or changes it; handlers read identity from here and never
+// from request headers.
+type Principal struct {
+	Subject    string    // the individual user; for API keys the key's creator
+	Tenant     string    // tenant the request acts in: Subject, or "org-<name>" (see orgTenant)
+	Org        string    // organization the request acts in, "" for the personal tenant
+	Role       string    // effective role in Tenant (viewer, operator, owner)
+	TokenID    string    // "jti" of the access token, if any
+	ExpiresAt  time.Time // expiry of the access token, if any
+	AuthMethod string    // authMethodJWT or authMethodAPIKey
+	APIKeyID   string    // API keys only
+	Scopes     []string  // API keys only
+
+	orgClaim string // "org" claim of the access token, resolved by selectOrg
+}
+
+// setPrincipal stores p on the request and records p.Subject as the audit actor.
+func setPrincipal(c *echo.Context, p *Principal) {
+	c.Set(ctxKeyPrincipal, p)
+	c.SetRequest(c.Request().WithContext(withActor(c.Request().Context(), p.Subject)))
+}
+
+// principalOf returns the authenticated caller, or nil on routes without auth middleware.
+func principalOf(c *echo.Context) *Principal {
+	p, _ := c.Get(ctxKeyPrincipal).(*Principal)
+	return p
+}
+
+// tenantOf returns the tenant of the authenticated caller, or "" if the request is unauthenticated.
+func tenantOf(c *echo.Context) string {
+	if p := principalOf(c); p != nil {
+		return p.Tenant
+	}
+	return ""
+}
+
+// subjectOf returns the authenticated individual user, or "" if the request is unauthenticated.
+func subjectOf(c *echo.Context) string {
+	if p := principalOf(c); p != nil {
+		return p.Subject
+	}
+	return ""
+}
+
+// apiKeyCreator returns whose API keys of p.Tenant p may list and revoke: p.Subject for organization
+// members below owner, who only manage the keys they created, and "" (all keys) otherwise.
+func (p *Principal) apiKeyCreator() string {
+	if p.Org != "" && roleRank[p.Role] < roleRank[authstore.RoleOwner] {
+		return p.Subject
+	}
+	return ""
+}
+
+// stripIdentityHeaders removes identity headers a client might send to impersonate a tenant. It runs
+// before routing (Echo#Pre), so no route, protected or not, can observe them.
+func stripIdentityHeaders(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c *echo.Context) error {
+		c.Request().Header.Del("X-User")
+		return next(c)
+	}
+}
+
+// actorKey is the context key for the authenticated individual user.
+type actorKey struct{}
+
+// withActor returns a context carrying the authenticated user for audit entries written from code that
+// only has a context.Context. Set by setPrincipal; unlike Principal.Tenant it stays the individual user
+// when acting within an organization.
+func withActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorFromContext returns the user set by withActor, or "" if none.
+func actorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
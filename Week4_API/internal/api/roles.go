@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/authstore"
+	"github.com/labstack/echo/v5"
+)
+
+// roleRank orders roles by privilege; unknown roles rank below viewer.
+var roleRank = map[string]int{
+	authstore.RoleViewer:   1,
+	authstore.RoleOperator: 2,
+	authstore.RoleOwner:    3,
+}
+
+// requireRole rejects callers whose role ranks below min with 403 and records the attempt in the audit log.
+func (a *Application) requireRole(min string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			role := currentRole(c)
+			if roleRank[role] >= roleRank[min] {
+				return next(c)
+			}
+			a.writeAuditLog(c.Request().Context(), tenantOf(c), c.Param("id"), "access_denied", map[string]any{
+				"role":     role,
+				"required": min,
+				"method":   c.Request().Method,
+				"route":    c.Path(),
+			})
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "role " + role + " is not allowed to perform this action (requires " + min + ")"})
+		}
+	}
+}
+
+// currentRole returns the principal's role, or "" if the request is unauthenticated.
+func currentRole(c *echo.Context) string {
+	if p := principalOf(c); p != nil {
+		return p.Role
+	}
+	return ""
+}
+
+// roleOrOwner maps an unset role (accounts and keys created before roles existed) to owner.
+func roleOrOwner(role string) string {
+	if role == "" {
+		return authstore.RoleOwner
+	}
+	return role
+}
@@ -1,28 +1,81 @@
 package api
 
 import (
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/authstore"
 	"github.com/labstack/echo/v5"
 )
 
 func RegisterRoutes(e *echo.Echo, app *Application) {
+	// Identity comes only from the auth middleware, never from client headers.
+	e.Pre(stripIdentityHeaders)
+
 	// Public Routes
 	e.POST("/api/login", app.Login)
+	e.POST("/api/register", app.Register)
+	e.POST("/api/refresh", app.Refresh)
+	e.POST("/api/logout", app.Logout, app.JWTMiddleware)
+	e.GET("/.well-known/jwks.json", app.JWKS)
+	e.GET("/readyz", app.Readyz)
+	e.GET("/api/oidc/login", app.OIDCLogin)
+	e.GET("/api/oidc/callback", app.OIDCCallback)
 
-	// Protected Routes
+	// Protected Routes: bearer JWT or API key. Instance routes declare the minimum tenant role
+	// (viewer < operator < owner) and, for API keys, the scope they need.
 	v1 := e.Group("/api/v1")
-	v1.Use(JWTMiddleware)
+	v1.Use(app.AuthMiddleware)
+
+	// User management (admin only)
+	v1.POST("/users", app.CreateUser, requireSession)
+	v1.POST("/users/:username/disable", app.DisableUser, requireSession)
+	v1.POST("/users/:username/enable", app.EnableUser, requireSession)
+	v1.PUT("/users/:username/role", app.SetUserRole, requireSession)
+	v1.POST("/users/:username/identities", app.LinkUserIdentity, requireSession)
+
+	// Single sign-on: link an SSO account to the caller (the callback completes it)
+	v1.POST("/oidc/link", app.OIDCLink, requireSession)
+
+	// API keys can only be managed from a login session
+	v1.GET("/apikeys", app.ListAPIKeys, requireSession)
+	v1.POST("/apikeys", app.CreateAPIKey, requireSession)
+	v1.DELETE("/apikeys/:id", app.RevokeAPIKey, requireSession)
 
-	v1.GET("/logs", app.ListLogsAll)
-	v1.GET("/instances", app.ListInstances)
-	v1.GET("/instances/:id", app.GetInstance)
-	v1.POST("/instances", app.CreateInstance)
-	v1.PATCH("/instances/:id", app.PatchInstance)
-	v1.DELETE("/instances/:id", app.DeleteInstance)
+	// Organizations: shared tenants. Select one per request with X-Org (or the "org" login claim).
+	v1.GET("/orgs", app.ListOrgs, requireSession)
+	v1.POST("/orgs", app.CreateOrg, requireSession)
+	v1.GET("/orgs/:org/members", app.ListOrgMembers, requireSession)
+	v1.PUT("/orgs/:org/members/:username", app.SetOrgMemberRole, requireSession)
+	v1.DELETE("/orgs/:org/members/:username", app.RemoveOrgMember, requireSession)
+	v1.GET("/orgs/:org/invitations", app.ListOrgInvitations, requireSession)
+	v1.POST("/orgs/:org/invitations", app.InviteOrgMember, requireSession)
+	v1.GET("/invitations", app.ListMyInvitations, requireSession)
+	v1.POST("/invitations/:id/accept", app.AcceptInvitation, requireSession)
+	v1.DELETE("/invitations/:id", app.DeleteInvitation, requireSession)
+
+	v1.GET("/logs", app.ListLogsAll, app.requireRole(authstore.RoleViewer), requireScope(scopeLogsRead))
+	v1.GET("/operations/:id", app.GetOperation, app.requireRole(authstore.RoleViewer), requireScope(scopeInstancesRead))
+	v1.GET("/plans", app.ListPlans, app.requireRole(authstore.RoleViewer), requireScope(scopeInstancesRead))
+	v1.GET("/storage-classes", app.ListStorageClasses, app.requireRole(authstore.RoleViewer), requireScope(scopeInstancesRead))
+	v1.GET("/instances", app.ListInstances, app.requireRole(authstore.RoleViewer), requireScope(scopeInstancesRead))
+	v1.GET("/instances/:id", app.GetInstance, app.requireRole(authstore.RoleViewer), requireScope(scopeInstancesRead))
+	v1.POST("/instances", app.CreateInstance, app.requireRole(authstore.RoleOwner), requireScope(scopeInstancesWrite))
+	v1.PATCH("/instances/:id", app.PatchInstance, app.requireRole(authstore.RoleOperator), requireScope(scopeInstancesWrite))
+	v1.DELETE("/instances/:id", app.DeleteInstance, app.requireRole(authstore.RoleOwner), requireScope(scopeInstancesWrite))
 
 	// Logs: instance-scoped audit and service logs (more specific than :id so "logs" is not captured as id)
-	v1.GET("/instances/:id/logs", app.ListLogs)
+	v1.GET("/instances/:id/logs", app.ListLogs, app.requireRole(authstore.RoleViewer), requireScope(scopeLogsRead))
+
+	// Backups: RDB snapshots in object storage; they outlive the instance
+	v1.GET("/instances/:id/backups", app.ListBackups, app.requireRole(authstore.RoleViewer), requireScope(scopeInstancesRead))
+	v1.GET("/instances/:id/backups/:backupId", app.GetBackup, app.requireRole(authstore.RoleViewer), requireScope(scopeInstancesRead))
+	v1.POST("/instances/:id/backups", app.CreateBackup, app.requireRole(authstore.RoleOperator), requireScope(scopeInstancesWrite))
+	v1.DELETE("/instances/:id/backups/:backupId", app.DeleteBackup, app.requireRole(authstore.RoleOwner), requireScope(scopeInstancesWrite))
+
+	// Credentials: reading needs its own scope (instances:read does not reveal passwords); rotating the
+	// password disconnects clients that do not pick up the new one
+	v1.GET("/instances/:id/credentials", app.GetCredentials, app.requireRole(authstore.RoleOperator), requireScope(scopeCredentialsRead))
+	v1.POST("/instances/:id/credentials/rotate", app.RotateCredentials, app.requireRole(authstore.RoleOwner), requireScope(scopeInstancesWrite))
 
 	// Cache: more specific route first so :id does not capture "cache"
-	v1.GET("/instances/:id/cache/:key", app.GetCache)
-	v1.POST("/instances/:id/cache", app.SetCache)
+	v1.GET("/instances/:id/cache/:key", app.GetCache, app.requireRole(authstore.RoleOperator), requireScope(scopeCacheRead))
+	v1.POST("/instances/:id/cache", app.SetCache, app.requireRole(authstore.RoleOperator), requireScope(scopeCacheWrite))
 }
@@ -1,18 +1,58 @@
 package api
 
 import (
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/auth"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/authstore"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/backupstore"
 	"github.com/Fearcon14/level3-cloud/Week4_API/internal/k8s"
 	"github.com/Fearcon14/level3-cloud/Week4_API/internal/logstore"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/opstore"
 	"github.com/labstack/echo/v5"
 	"github.com/labstack/echo/v5/middleware"
 )
 
-func NewServer(cfg *Config, store k8s.InstanceStore, logStore logstore.Store) *echo.Echo {
+// NewServer builds the Echo server. oidc may be nil when OpenID Connect login is not configured; nil
+// plans keeps the default catalog and a nil backupStore or opStore keeps backup metadata or operations in
+// memory (operations are then only visible on the replica that started them). Backups are enabled when
+// cfg names a bucket and store implements k8s.BackupJobs; password rotation needs a store implementing
+// k8s.PasswordRotator.
+func NewServer(cfg *Config, store k8s.InstanceStore, logStore logstore.Store, authStore authstore.Store, backupStore backupstore.Store, opStore opstore.Store, keys *auth.KeySet, oidc *auth.OIDCProvider, plans *k8s.PlanCatalog) (*echo.Echo, error) {
 	e := echo.New()
 	e.Use(middleware.RequestLogger())
 	e.Use(middleware.Recover())
 
-	app := NewApplication(store, nil, logStore, e.Logger)
+	app, err := NewApplication(store, nil, logStore, authStore, e.Logger)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range cfg.AdminUsers {
+		app.AdminUsers[u] = true
+	}
+	app.AllowRegistration = cfg.AllowRegistration
+	app.Keys = keys
+	app.JWTIssuer = cfg.JWTIssuer
+	app.AccessTokenTTL = cfg.AccessTokenTTL
+	app.RefreshTokenTTL = cfg.RefreshTokenTTL
+	app.OIDC = oidc
+	app.OIDCUsernameClaim = cfg.OIDCUsernameClaim
+	app.OIDCAcceptAccessTokens = cfg.OIDCAcceptAccessTokens
+	app.OIDCPostLoginRedirect = cfg.OIDCPostLoginRedirect
+	app.OperationTimeout = cfg.OperationTimeout
+	if plans != nil {
+		app.Plans = plans
+	}
+	if backupStore != nil {
+		app.Backups = backupStore
+	}
+	if opStore != nil {
+		app.Operations = opStore
+	}
+	if jobs, ok := store.(k8s.BackupJobs); ok && cfg.Backup.Bucket != "" {
+		app.BackupJobs = jobs
+	}
+	if passwords, ok := store.(k8s.PasswordRotator); ok {
+		app.Passwords = passwords
+	}
 	RegisterRoutes(e, app)
-	return e
+	return e, nil
 }
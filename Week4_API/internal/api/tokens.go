@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/authstore"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// issueTokens signs a short-lived access token carrying the user's role (and, if set, the selected
+// organization as "org" claim) and creates a server-side refresh token, whose ID it returns for audit
+// entries. The role is re-read on every refresh, so role changes apply within AccessTokenTTL.
+func (a *Application) issueTokens(ctx context.Context, user *authstore.User, org string) (*models.LoginResponse, string, error) {
+	username := user.Username
+	now := time.Now()
+	jti, err := randomToken(16)
+	if err != nil {
+		return nil, "", err
+	}
+	claims := jwt.MapClaims{
+		"iss":  a.JWTIssuer,
+		"sub":  username,
+		"role": roleOrOwner(user.Role),
+		"jti":  jti,
+		"iat":  now.Unix(),
+		"exp":  now.Add(a.AccessTokenTTL).Unix(),
+	}
+	if org != "" {
+		claims["org"] = org
+	}
+	access, err := a.Keys.Sign(claims)
+	if err != nil {
+		return nil, "", err
+	}
+
+	refresh, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := a.Auth.CreateRefreshToken(ctx, authstore.RefreshToken{
+		ID:        id,
+		Username:  username,
+		Org:       org,
+		TokenHash: hashToken(refresh),
+		ExpiresAt: now.Add(a.RefreshTokenTTL).UTC(),
+	}); err != nil {
+		return nil, "", err
+	}
+
+	return &models.LoginResponse{
+		Token:        access,
+		RefreshToken: refresh,
+		ExpiresIn:    int(a.AccessTokenTTL.Seconds()),
+	}, id, nil
+}
+
+// Refresh exchanges a refresh token for a new access/refresh token pair (POST /api/refresh).
+// The presented refresh token is revoked (rotation) and a token_refresh audit entry links it to its
+// successor. Presenting an already revoked token is treated as theft: all refresh tokens of that user are
+// revoked.
+func (a *Application) Refresh(c *echo.Context) error {
+	var req models.RefreshRequest
+	if err := c.Bind(&req); err != nil || req.RefreshToken == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "refreshToken is required"})
+	}
+	ctx := c.Request().Context()
+
+	rt, err := a.Auth.GetRefreshToken(ctx, hashToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, authstore.ErrNotFound) {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid refresh token"})
+		}
+		a.Logger.Error("failed to look up refresh token", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to refresh token"})
+	}
+	if rt.RevokedAt != nil {
+		if err := a.Auth.RevokeUserRefreshTokens(ctx, rt.Username); err != nil {
+			a.Logger.Error("failed to revoke refresh tokens", "username", rt.Username, "error", err)
+		}
+		a.writeAuditLog(ctx, rt.Username, "", "refresh_token_reuse", map[string]any{"refreshTokenId": rt.ID})
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid refresh token"})
+	}
+	if time.Now().After(rt.ExpiresAt) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "refresh token expired"})
+	}
+	user, err := a.Auth.GetUser(ctx, rt.Username)
+	if err != nil || user.Disabled {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid refresh token"})
+	}
+	if err := a.Auth.RevokeRefreshToken(ctx, rt.ID); err != nil {
+		// Lost a race with a concurrent refresh using the same token.
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid refresh token"})
+	}
+
+	resp, id, err := a.issueTokens(ctx, user, rt.Org)
+	if err != nil {
+		a.Logger.Error("failed to issue tokens", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to refresh token"})
+	}
+	a.writeAuditLog(withActor(ctx, user.Username), user.Username, "", "token_refresh", map[string]any{"refreshTokenId": rt.ID, "newRefreshTokenId": id})
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Logout revokes the presented access token (by jti) and, if given, the refresh token (POST /api/logout).
+func (a *Application) Logout(c *echo.Context) error {
+	p := principalOf(c)
+	if p == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthenticated"})
+	}
+	user := p.Subject
+	ctx := c.Request().Context()
+
+	var req models.RefreshRequest
+	_ = c.Bind(&req) // body is optional
+
+	details := map[string]any{}
+	if jti := p.TokenID; jti != "" {
+		if err := a.Auth.RevokeAccessToken(ctx, jti, user, p.ExpiresAt); err != nil {
+			a.Logger.Error("failed to revoke access token", "error", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to log out"})
+		}
+		details["jti"] = jti
+	}
+	if req.RefreshToken != "" {
+		rt, err := a.Auth.GetRefreshToken(ctx, hashToken(req.RefreshToken))
+		if err == nil && rt.Username == user && rt.RevokedAt == nil {
+			if err := a.Auth.RevokeRefreshToken(ctx, rt.ID); err != nil && !errors.Is(err, authstore.ErrNotFound) {
+				a.Logger.Error("failed to revoke refresh token", "error", err)
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to log out"})
+			}
+			details["refreshTokenId"] = rt.ID
+		}
+	}
+	a.writeAuditLog(ctx, user, "", "logout", details)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// randomToken returns n random bytes encoded as unpadded base64url.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex SHA-256 of a token value, used as its storage key.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
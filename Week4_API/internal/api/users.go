@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/authstore"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/k8s"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+	"github.com/labstack/echo/v5"
+)
+
+// minPasswordLength is the minimum length accepted for new local passwords.
+const minPasswordLength = 8
+
+// usernamePattern restricts usernames to characters that map cleanly onto a tenant namespace.
+var usernamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,38}[a-z0-9])?$`)
+
+// nameRules describes validName for error messages.
+const nameRules = "must be 1-40 lowercase letters, digits or single '-', starting and ending with a letter or digit, and not reserved"
+
+// validName reports whether name is acceptable as a username or organization name: it matches
+// usernamePattern and is a valid tenant (see k8s.ValidateTenant).
+func validName(name string) bool {
+	return usernamePattern.MatchString(name) && k8s.ValidateTenant(name) == nil
+}
+
+// validateUsername returns an error unless name is a valid name (see validName) that does not collide with
+// organization tenants.
+func validateUsername(name string) error {
+	if !validName(name) {
+		return errors.New("username " + nameRules)
+	}
+	if strings.HasPrefix(name, orgTenantPrefix) {
+		return errors.New("usernames starting with \"" + orgTenantPrefix + "\" are reserved for organizations")
+	}
+	return nil
+}
+
+// EnsureBootstrapUser creates the configured bootstrap user (PAAS_BOOTSTRAP_USER) unless it exists. The
+// name must pass the same checks as registration.
+func EnsureBootstrapUser(ctx context.Context, s authstore.Store, username, password string) error {
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+	return authstore.EnsureUser(ctx, s, username, password)
+}
+
+// Register creates a local user via public sign-up (POST /api/register). Returns 403 unless AllowRegistration is set.
+func (a *Application) Register(c *echo.Context) error {
+	if !a.AllowRegistration {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "registration is disabled"})
+	}
+	return a.createUser(c)
+}
+
+// CreateUser creates a local user on behalf of an admin (POST /api/v1/users).
+func (a *Application) CreateUser(c *echo.Context) error {
+	if !a.isAdmin(c) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "admin privileges required"})
+	}
+	return a.createUser(c)
+}
+
+// DisableUser blocks further logins for a user (POST /api/v1/users/:username/disable). Admin only.
+func (a *Application) DisableUser(c *echo.Context) error {
+	return a.setUserDisabled(c, true)
+}
+
+// EnableUser re-allows logins for a disabled user (POST /api/v1/users/:username/enable). Admin only.
+func (a *Application) EnableUser(c *echo.Context) error {
+	return a.setUserDisabled(c, false)
+}
+
+// SetUserRole changes a user's role (PUT /api/v1/users/:username/role). Admin only.
+// The new role takes effect on the user's next login or token refresh.
+func (a *Application) SetUserRole(c *echo.Context) error {
+	if !a.isAdmin(c) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "admin privileges required"})
+	}
+	var req models.SetUserRoleRequest
+	if err := c.Bind(&req); err != nil {
+		a.Logger.Error("failed to bind request", "error", err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if !authstore.ValidRole(req.Role) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "role must be one of viewer, operator, owner"})
+	}
+	username := c.Param("username")
+	ctx := c.Request().Context()
+	if err := a.Auth.SetUserRole(ctx, username, req.Role); err != nil {
+		if errors.Is(err, authstore.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+		}
+		a.Logger.Error("failed to update user", "username", username, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update user"})
+	}
+	a.writeAuditLog(ctx, username, "", "user_role_change", map[string]any{"username": username, "role": req.Role, "by": subjectOf(c)})
+	user, err := a.Auth.GetUser(ctx, username)
+	if err != nil {
+		a.Logger.Error("failed to look up user", "username", username, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update user"})
+	}
+	return c.JSON(http.StatusOK, userToModel(user))
+}
+
+// createUser validates the request body, hashes the password and stores the user.
+func (a *Application) createUser(c *echo.Context) error {
+	var req models.RegisterUserRequest
+	if err := c.Bind(&req); err != nil {
+		a.Logger.Error("failed to bind request", "error", err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if err := validateUsername(req.Username); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if len(req.Password) < minPasswordLength {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "password must be at least 8 characters"})
+	}
+
+	hash, err := authstore.HashPassword(req.Password)
+	if err != nil {
+		a.Logger.Error("failed to hash password", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create user"})
+	}
+	ctx := c.Request().Context()
+	user, err := a.Auth.CreateUser(ctx, req.Username, hash)
+	if err != nil {
+		if errors.Is(err, authstore.ErrAlreadyExists) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "username already taken"})
+		}
+		a.Logger.Error("failed to create user", "username", req.Username, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create user"})
+	}
+	actor := subjectOf(c)
+	if actor == "" {
+		actor = user.Username
+	}
+	a.writeAuditLog(ctx, user.Username, "", "user_create", map[string]any{"username": user.Username, "by": actor})
+	return c.JSON(http.StatusCreated, userToModel(user))
+}
+
+func (a *Application) setUserDisabled(c *echo.Context, disabled bool) error {
+	if !a.isAdmin(c) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "admin privileges required"})
+	}
+	username := c.Param("username")
+	ctx := c.Request().Context()
+	if err := a.Auth.SetUserDisabled(ctx, username, disabled); err != nil {
+		if errors.Is(err, authstore.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+		}
+		a.Logger.Error("failed to update user", "username", username, "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update user"})
+	}
+	action := "user_enable"
+	if disabled {
+		action = "user_disable"
+		// Outstanding access tokens expire within AccessTokenTTL; refresh tokens are cut off now.
+		if err := a.Auth.RevokeUserRefreshTokens(ctx, username); err != nil {
+			a.Logger.Error("failed to revoke refresh tokens", "username", username, "error", err)
+		}
+	}
+	a.writeAuditLog(ctx, username, "", action, map[string]any{"username": username, "by": subjectOf(c)})
+	return c.NoContent(http.StatusNoContent)
+}
+
+// isAdmin reports whether the authenticated user (the actor, not an organization tenant) is listed in AdminUsers.
+func (a *Application) isAdmin(c *echo.Context) bool {
+	user := subjectOf(c)
+	return user != "" && a.AdminUsers[user]
+}
+
+// userToModel maps a stored user to the API model.
+func userToModel(u *authstore.User) models.User {
+	return models.User{Username: u.Username, Role: roleOrOwner(u.Role), Disabled: u.Disabled, CreatedAt: u.CreatedAt}
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// JWK is a single JSON Web Key (RFC 7517) holding a public RSA or EC key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set (active and previous) so other services can verify our tokens.
+// HMAC keys are shared secrets and are never included.
+func (ks *KeySet) JWKS() JWKS {
+	out := JWKS{Keys: []JWK{}}
+	for _, k := range ks.keys {
+		if jwk, ok := publicJWK(k); ok {
+			out.Keys = append(out.Keys, jwk)
+		}
+	}
+	sort.Slice(out.Keys, func(i, j int) bool { return out.Keys[i].Kid < out.Keys[j].Kid })
+	return out
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of the key's public part (base64url).
+func Thumbprint(k *Key) (string, error) {
+	jwk, ok := publicJWK(k)
+	if !ok {
+		return "", fmt.Errorf("thumbprint requires an rsa or ec key")
+	}
+	// Required members only, in lexicographic order (RFC 7638 section 3.2).
+	var canonical []byte
+	var err error
+	switch jwk.Kty {
+	case "RSA":
+		canonical, err = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N})
+	default:
+		canonical, err = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y})
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// publicJWK converts an RSA or EC key to its public JWK; ok is false for HMAC keys.
+func publicJWK(k *Key) (JWK, bool) {
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA", Kid: k.ID, Use: "sig", Alg: k.Method.Alg(),
+			N: b64(pub.N.Bytes()),
+			E: b64(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return JWK{
+			Kty: "EC", Kid: k.ID, Use: "sig", Alg: k.Method.Alg(),
+			Crv: pub.Curve.Params().Name,
+			X:   b64(pub.X.FillBytes(make([]byte, size))),
+			Y:   b64(pub.Y.FillBytes(make([]byte, size))),
+		}, true
+	}
+	return JWK{}, false
+}
+
+// PublicKey decodes the JWK into an *rsa.PublicKey or *ecdsa.PublicKey.
+func (j JWK) PublicKey() (any, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("jwk %q: invalid n: %w", j.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("jwk %q: invalid e", j.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("jwk %q: unsupported curve %q", j.Kid, j.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, fmt.Errorf("jwk %q: invalid x: %w", j.Kid, err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(j.Y)
+		if err != nil {
+			return nil, fmt.Errorf("jwk %q: invalid y: %w", j.Kid, err)
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if _, err := pub.ECDH(); err != nil {
+			return nil, fmt.Errorf("jwk %q: point is not on curve %s", j.Kid, j.Crv)
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("jwk %q: unsupported key type %q", j.Kid, j.Kty)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrUnknownKey is returned when a token references a kid that is not in the key set.
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Key is a single JWT key identified by its kid. Verify-only keys (e.g. the previous key during rotation)
+// have no signing material.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   any // *rsa.PrivateKey, *ecdsa.PrivateKey or []byte (HMAC); nil for verify-only keys
+	verifyKey any // *rsa.PublicKey, *ecdsa.PublicKey or []byte (HMAC)
+}
+
+// CanSign reports whether the key holds private (or shared) signing material.
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// KeySet holds the active signing key plus every key still accepted for verification.
+// Tokens carry the signing key's id in the "kid" header so old tokens keep validating after rotation.
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+// NewKeySet returns a key set that signs with active and verifies with active and all previous keys.
+func NewKeySet(active *Key, previous ...*Key) (*KeySet, error) {
+	if active == nil || !active.CanSign() {
+		return nil, fmt.Errorf("active key must be able to sign")
+	}
+	ks := &KeySet{active: active, keys: map[string]*Key{active.ID: active}}
+	for _, k := range previous {
+		if _, dup := ks.keys[k.ID]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+	return ks, nil
+}
+
+// ActiveKeyID returns the kid of the key used for signing new tokens.
+func (ks *KeySet) ActiveKeyID() string {
+	return ks.active.ID
+}
+
+// Sign signs claims with the active key and sets the "kid" header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.signKey)
+}
+
+// Keyfunc resolves the verification key for a parsed token by its "kid" header.
+// The token's algorithm must match the key's algorithm, so an RSA public key can never be used as an HMAC secret.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q for key %q", token.Method.Alg(), kid)
+	}
+	return key.verifyKey, nil
+}
+
+// Methods returns the algorithms of all keys in the set, for jwt.WithValidMethods.
+func (ks *KeySet) Methods() []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, k := range ks.keys {
+		if alg := k.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			out = append(out, alg)
+		}
+	}
+	return out
+}
+
+// NewHMACKey returns an HS256 key for a shared secret. HMAC keys are never published in the JWKS.
+func NewHMACKey(id string, secret []byte) (*Key, error) {
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("hmac secret must be at least 32 bytes")
+	}
+	return &Key{ID: id, Method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}, nil
+}
+
+// GenerateKey creates a new random ES256 key. Used when no key is configured (single replica / tests only).
+func GenerateKey(id string) (*Key, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newPrivateKey(id, priv)
+}
+
+// ParsePrivateKeyPEM parses an RSA or EC private key (PKCS#8, PKCS#1 or SEC1) into a signing key.
+// RSA keys sign with RS256; EC keys with ES256/ES384/ES512 depending on the curve.
+// If id is empty the RFC 7638 thumbprint of the public key is used.
+func ParsePrivateKeyPEM(id string, pemBytes []byte) (*Key, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	var priv any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		priv, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		priv, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		priv, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", block.Type, err)
+	}
+	return newPrivateKey(id, priv)
+}
+
+// ParsePublicKeyPEM parses a verify-only key. It accepts a PKIX public key or any private key
+// ParsePrivateKeyPEM understands (the private part is dropped).
+func ParsePublicKeyPEM(id string, pemBytes []byte) (*Key, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	if block.Type != "PUBLIC KEY" {
+		k, err := ParsePrivateKeyPEM(id, pemBytes)
+		if err != nil {
+			return nil, err
+		}
+		k.signKey = nil
+		return k, nil
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+	return newPublicKey(id, pub)
+}
+
+// newPrivateKey builds a signing key from a parsed RSA or EC private key.
+func newPrivateKey(id string, priv any) (*Key, error) {
+	var pub any
+	switch p := priv.(type) {
+	case *rsa.PrivateKey:
+		pub = &p.PublicKey
+	case *ecdsa.PrivateKey:
+		pub = &p.PublicKey
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", priv)
+	}
+	k, err := newPublicKey(id, pub)
+	if err != nil {
+		return nil, err
+	}
+	k.signKey = priv
+	return k, nil
+}
+
+// newPublicKey builds a verify-only key and picks the JWS algorithm from the key type.
+func newPublicKey(id string, pub any) (*Key, error) {
+	var method jwt.SigningMethod
+	switch p := pub.(type) {
+	case *rsa.PublicKey:
+		if p.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("rsa key must be at least 2048 bits")
+		}
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch p.Curve {
+		case elliptic.P256():
+			method = jwt.SigningMethodES256
+		case elliptic.P384():
+			method = jwt.SigningMethodES384
+		case elliptic.P521():
+			method = jwt.SigningMethodES512
+		default:
+			return nil, fmt.Errorf("unsupported ec curve")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+	k := &Key{Method: method, verifyKey: pub}
+	if id == "" {
+		var err error
+		if id, err = Thumbprint(k); err != nil {
+			return nil, err
+		}
+	}
+	k.ID = id
+	return k, nil
+}
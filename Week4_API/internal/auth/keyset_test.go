@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func rsaPEM(t *testing.T) []byte {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+}
+
+func ecPEM(t *testing.T) []byte {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ec key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("marshal ec key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func parse(ks *KeySet, token string) error {
+	_, err := jwt.Parse(token, ks.Keyfunc, jwt.WithValidMethods(ks.Methods()))
+	return err
+}
+
+func TestKeySet_SignAndVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		pem     []byte
+		wantAlg string
+	}{
+		{name: "rsa", pem: rsaPEM(t), wantAlg: "RS256"},
+		{name: "ec", pem: ecPEM(t), wantAlg: "ES256"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParsePrivateKeyPEM("", tt.pem)
+			if err != nil {
+				t.Fatalf("parse key: %v", err)
+			}
+			if key.Method.Alg() != tt.wantAlg {
+				t.Fatalf("alg: got %s, want %s", key.Method.Alg(), tt.wantAlg)
+			}
+			ks, err := NewKeySet(key)
+			if err != nil {
+				t.Fatalf("new key set: %v", err)
+			}
+			token, err := ks.Sign(jwt.MapClaims{"sub": "kevin", "exp": time.Now().Add(time.Minute).Unix()})
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			if err := parse(ks, token); err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			jwks := ks.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != key.ID || jwks.Keys[0].Alg != tt.wantAlg {
+				t.Fatalf("unexpected jwks: %+v", jwks)
+			}
+		})
+	}
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	oldKey, err := ParsePrivateKeyPEM("old", rsaPEM(t))
+	if err != nil {
+		t.Fatalf("parse old key: %v", err)
+	}
+	newKey, err := ParsePrivateKeyPEM("new", ecPEM(t))
+	if err != nil {
+		t.Fatalf("parse new key: %v", err)
+	}
+	before, _ := NewKeySet(oldKey)
+	oldToken, err := before.Sign(jwt.MapClaims{"sub": "kevin"})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	// After rotation the old key is verify-only; old tokens still validate.
+	verifyOnly, err := ParsePublicKeyPEM("old", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: mustPKIX(t, oldKey)}))
+	if err != nil {
+		t.Fatalf("parse verify key: %v", err)
+	}
+	after, err := NewKeySet(newKey, verifyOnly)
+	if err != nil {
+		t.Fatalf("new key set: %v", err)
+	}
+	if err := parse(after, oldToken); err != nil {
+		t.Fatalf("old token after rotation: %v", err)
+	}
+	if got := len(after.JWKS().Keys); got != 2 {
+		t.Fatalf("jwks keys: got %d, want 2", got)
+	}
+
+	// Once the old key is dropped, old tokens are rejected.
+	dropped, _ := NewKeySet(newKey)
+	if _, err := jwt.Parse(oldToken, dropped.Keyfunc); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+}
+
+func TestKeySet_HMACNotPublished(t *testing.T) {
+	key, err := NewHMACKey("hs256", []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("hmac key: %v", err)
+	}
+	ks, _ := NewKeySet(key)
+	if got := len(ks.JWKS().Keys); got != 0 {
+		t.Fatalf("hmac key must not be in jwks, got %d keys", got)
+	}
+}
+
+func mustPKIX(t *testing.T, k *Key) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(k.verifyKey)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	return der
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeySetConfig describes where JWT keys come from. Exactly one signing source is used, in this order:
+// SigningKeyPEM, SigningKeyFile, HMACSecret. If none is set a random ES256 key is generated.
+type KeySetConfig struct {
+	SigningKeyPEM  string // PEM private key (RSA or EC), e.g. injected from a Secret as env
+	SigningKeyFile string // path to a PEM private key, e.g. a mounted Secret
+	KeyID          string // kid of the signing key; defaults to its RFC 7638 thumbprint ("hs256" for HMAC)
+	HMACSecret     string // legacy HS256 shared secret (at least 32 bytes)
+	// VerifyKeys lists previous keys that are still accepted during rotation, as "kid=path" or "path".
+	VerifyKeys []string
+}
+
+// LoadKeySet builds the key set from cfg. generated is true when no signing key was configured and an
+// ephemeral key was created; tokens then do not survive restarts and are not valid across replicas.
+func LoadKeySet(cfg KeySetConfig) (ks *KeySet, generated bool, err error) {
+	var active *Key
+	switch {
+	case cfg.SigningKeyPEM != "":
+		active, err = ParsePrivateKeyPEM(cfg.KeyID, []byte(cfg.SigningKeyPEM))
+	case cfg.SigningKeyFile != "":
+		var pemBytes []byte
+		if pemBytes, err = os.ReadFile(cfg.SigningKeyFile); err == nil {
+			active, err = ParsePrivateKeyPEM(cfg.KeyID, pemBytes)
+		}
+	case cfg.HMACSecret != "":
+		id := cfg.KeyID
+		if id == "" {
+			id = "hs256"
+		}
+		active, err = NewHMACKey(id, []byte(cfg.HMACSecret))
+	default:
+		generated = true
+		active, err = GenerateKey(cfg.KeyID)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("signing key: %w", err)
+	}
+
+	var previous []*Key
+	for _, entry := range cfg.VerifyKeys {
+		kid, path := "", entry
+		if i := strings.Index(entry, "="); i >= 0 {
+			kid, path = entry[:i], entry[i+1:]
+		}
+		pemBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, false, fmt.Errorf("verify key %q: %w", path, err)
+		}
+		k, err := ParsePublicKeyPEM(kid, pemBytes)
+		if err != nil {
+			return nil, false, fmt.Errorf("verify key %q: %w", path, err)
+		}
+		previous = append(previous, k)
+	}
+
+	ks, err = NewKeySet(active, previous...)
+	if err != nil {
+		return nil, false, err
+	}
+	return ks, generated, nil
+}
@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oidcMethods are the signature algorithms accepted from an identity provider. Symmetric algorithms are
+// never accepted because the provider's keys come from a public JWKS.
+var oidcMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// jwksMinRefresh limits how often an unknown kid triggers a JWKS refetch.
+const jwksMinRefresh = time.Minute
+
+// OIDCConfig configures an OpenID Connect relying party (authorization-code flow).
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // our callback URL registered at the provider
+	Scopes       []string // default: openid, profile, email
+	// Audience, if set, is required in the "aud" claim of provider access tokens accepted as bearer tokens.
+	// If empty, access tokens must be issued for ClientID.
+	Audience   string
+	HTTPClient *http.Client // default: http.Client with a 10s timeout
+}
+
+// OIDCProvider is a discovered identity provider.
+type OIDCProvider struct {
+	cfg      OIDCConfig
+	client   *http.Client
+	metadata providerMetadata
+	keys     *remoteKeySet
+}
+
+// providerMetadata is the subset of the discovery document (/.well-known/openid-configuration) we use.
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCTokens is the token endpoint response of the authorization-code exchange.
+type OIDCTokens struct {
+	IDToken     string `json:"id_token"`
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// DiscoverOIDC loads the provider's discovery document. The advertised issuer must equal IssuerURL.
+func DiscoverOIDC(ctx context.Context, cfg OIDCConfig) (*OIDCProvider, error) {
+	if cfg.IssuerURL == "" || cfg.ClientID == "" {
+		return nil, fmt.Errorf("oidc: issuer url and client id are required")
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	issuer := strings.TrimSuffix(cfg.IssuerURL, "/")
+	var meta providerMetadata
+	if err := getJSON(ctx, client, issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match configured %q", meta.Issuer, cfg.IssuerURL)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery: document lacks authorization_endpoint, token_endpoint or jwks_uri")
+	}
+	return &OIDCProvider{
+		cfg:      cfg,
+		client:   client,
+		metadata: meta,
+		keys:     &remoteKeySet{url: meta.JWKSURI, client: client},
+	}, nil
+}
+
+// Issuer returns the provider's issuer identifier ("iss" of its tokens).
+func (p *OIDCProvider) Issuer() string {
+	return p.metadata.Issuer
+}
+
+// AuthCodeURL returns the provider URL that starts the login. state and nonce must be random per login;
+// codeVerifier enables PKCE (S256) and must be passed to Exchange.
+func (p *OIDCProvider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {b64(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.metadata.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.metadata.AuthorizationEndpoint + sep + q.Encode()
+}
+
+// Exchange redeems an authorization code at the token endpoint (client_secret_basic).
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier string) (*OIDCTokens, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc token exchange: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("oidc token exchange: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc token exchange: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var tokens OIDCTokens
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("oidc token exchange: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("oidc token exchange: response has no id_token")
+	}
+	return &tokens, nil
+}
+
+// VerifyIDToken validates an ID token's signature against the provider JWKS, its issuer, audience (ClientID),
+// expiry and nonce, and returns its claims.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, raw, nonce string) (jwt.MapClaims, error) {
+	claims, err := p.verify(ctx, raw, p.cfg.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, fmt.Errorf("oidc: id token nonce mismatch")
+	}
+	return claims, nil
+}
+
+// VerifyAccessToken validates a JWT access token issued by the provider (issuer, expiry and audience,
+// which is Audience or, if unset, ClientID) and returns its claims.
+func (p *OIDCProvider) VerifyAccessToken(ctx context.Context, raw string) (jwt.MapClaims, error) {
+	aud := p.cfg.Audience
+	if aud == "" {
+		aud = p.cfg.ClientID
+	}
+	return p.verify(ctx, raw, aud)
+}
+
+func (p *OIDCProvider) verify(ctx context.Context, raw, audience string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims,
+		func(t *jwt.Token) (any, error) {
+			kid, _ := t.Header["kid"].(string)
+			key, err := p.keys.get(ctx, kid)
+			if err != nil {
+				return nil, err
+			}
+			if !methodMatchesKey(t.Method, key) {
+				return nil, fmt.Errorf("signing method %q does not match key %q", t.Method.Alg(), kid)
+			}
+			return key, nil
+		},
+		jwt.WithValidMethods(oidcMethods),
+		jwt.WithIssuer(p.metadata.Issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: %w", err)
+	}
+	return claims, nil
+}
+
+// methodMatchesKey reports whether the algorithm family fits the key type.
+func methodMatchesKey(m jwt.SigningMethod, key any) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(m.Alg(), "RS") || strings.HasPrefix(m.Alg(), "PS")
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(m.Alg(), "ES")
+	}
+	return false
+}
+
+// remoteKeySet caches the provider's JWKS and refetches it (at most every jwksMinRefresh) when a token
+// names an unknown kid, so provider key rotation is picked up without restart.
+type remoteKeySet struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]any
+	fetchedAt time.Time
+}
+
+func (r *remoteKeySet) get(ctx context.Context, kid string) (any, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if key, ok := r.lookup(kid); ok {
+		return key, nil
+	}
+	if !r.fetchedAt.IsZero() && time.Since(r.fetchedAt) < jwksMinRefresh {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	if err := r.refresh(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := r.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+}
+
+// lookup finds kid; a token without kid matches only if the set holds exactly one key.
+func (r *remoteKeySet) lookup(kid string) (any, bool) {
+	if kid == "" && len(r.keys) == 1 {
+		for _, k := range r.keys {
+			return k, true
+		}
+	}
+	key, ok := r.keys[kid]
+	return key, ok
+}
+
+func (r *remoteKeySet) refresh(ctx context.Context) error {
+	var set JWKS
+	if err := getJSON(ctx, r.client, r.url, &set); err != nil {
+		return fmt.Errorf("oidc jwks: %w", err)
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		pub, err := jwk.PublicKey()
+		if err != nil {
+			continue // skip key types we do not support rather than failing the whole set
+		}
+		keys[jwk.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return errors.New("oidc jwks: no usable signing keys")
+	}
+	r.keys = keys
+	r.fetchedAt = time.Now()
+	return nil
+}
+
+// getJSON fetches url and decodes a JSON response body into v.
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
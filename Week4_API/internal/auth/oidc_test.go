@@ -0,0 +1,110 @@
+// External test package: oidctest imports auth.
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/auth"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/auth/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestOIDC_AuthorizationCodeFlow(t *testing.T) {
+	idp := oidctest.New("paas", "s3cret")
+	defer idp.Close()
+	ctx := context.Background()
+
+	p, err := auth.DiscoverOIDC(ctx, auth.OIDCConfig{
+		IssuerURL:    idp.Issuer(),
+		ClientID:     "paas",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://paas.local/api/oidc/callback",
+	})
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	// Follow the authorize redirect manually to read code and state.
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(p.AuthCodeURL("st4te", "n0nce", "verifier-verifier-verifier-verifier-123"))
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || loc.Query().Get("state") != "st4te" {
+		t.Fatalf("authorize redirect: %q", resp.Header.Get("Location"))
+	}
+	code := loc.Query().Get("code")
+
+	if _, err := p.Exchange(ctx, code, "wrong-verifier"); err == nil {
+		t.Fatal("exchange with wrong PKCE verifier succeeded")
+	}
+	resp, _ = noRedirect.Get(p.AuthCodeURL("st4te", "n0nce", "verifier-verifier-verifier-verifier-123"))
+	resp.Body.Close()
+	loc, _ = url.Parse(resp.Header.Get("Location"))
+	tokens, err := p.Exchange(ctx, loc.Query().Get("code"), "verifier-verifier-verifier-verifier-123")
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+
+	if _, err := p.VerifyIDToken(ctx, tokens.IDToken, "other-nonce"); err == nil {
+		t.Fatal("id token accepted with wrong nonce")
+	}
+	claims, err := p.VerifyIDToken(ctx, tokens.IDToken, "n0nce")
+	if err != nil {
+		t.Fatalf("verify id token: %v", err)
+	}
+	if claims["preferred_username"] != "alice" {
+		t.Fatalf("unexpected claims %v", claims)
+	}
+	if _, err := p.VerifyAccessToken(ctx, tokens.AccessToken); err != nil {
+		t.Fatalf("verify access token: %v", err)
+	}
+}
+
+func TestOIDC_RejectsForeignTokens(t *testing.T) {
+	idp := oidctest.New("paas", "s3cret")
+	defer idp.Close()
+	ctx := context.Background()
+	p, err := auth.DiscoverOIDC(ctx, auth.OIDCConfig{IssuerURL: idp.Issuer(), ClientID: "paas", RedirectURL: "http://x/cb"})
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	// Wrong audience and expired tokens from the right issuer.
+	if _, err := p.VerifyAccessToken(ctx, idp.SignToken(jwt.MapClaims{"sub": "a", "aud": "other-client"})); err == nil {
+		t.Fatal("accepted token for another audience")
+	}
+	if _, err := p.VerifyAccessToken(ctx, idp.SignToken(jwt.MapClaims{"sub": "a", "aud": "paas", "exp": time.Now().Add(-time.Hour).Unix()})); err == nil {
+		t.Fatal("accepted expired token")
+	}
+
+	// A token signed by a different provider's key is rejected even if it claims the same issuer.
+	other := oidctest.New("paas", "s3cret")
+	defer other.Close()
+	forged := other.SignToken(jwt.MapClaims{"iss": idp.Issuer(), "sub": "a", "aud": "paas"})
+	if _, err := p.VerifyAccessToken(ctx, forged); err == nil {
+		t.Fatal("accepted token signed by another key")
+	}
+
+	// HS256 tokens are never accepted from a provider.
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": idp.Issuer(), "sub": "a", "aud": "paas", "exp": time.Now().Add(time.Hour).Unix()})
+	raw, _ := hs.SignedString([]byte("0123456789abcdef0123456789abcdef"))
+	if _, err := p.VerifyAccessToken(ctx, raw); err == nil {
+		t.Fatal("accepted HS256 token")
+	}
+}
+
+func TestOIDC_DiscoveryIssuerMismatch(t *testing.T) {
+	idp := oidctest.New("paas", "s3cret")
+	defer idp.Close()
+	_, err := auth.DiscoverOIDC(context.Background(), auth.OIDCConfig{IssuerURL: idp.Issuer() + "/tenant", ClientID: "paas"})
+	if err == nil {
+		t.Fatal("discovery accepted a document for a different issuer")
+	}
+}
@@ -0,0 +1,177 @@
+// Package oidctest provides a minimal OpenID Connect provider served from httptest, for tests of the
+// authorization-code flow and of provider-issued bearer tokens.
+package oidctest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IdP is a stand-in identity provider. It signs ID tokens with a generated ES256 key published at /jwks,
+// accepts every /authorize request (as if the user had logged in) and enforces client credentials and
+// PKCE at /token.
+type IdP struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	keys *auth.KeySet
+
+	mu     sync.Mutex
+	claims jwt.MapClaims
+	codes  map[string]authRequest
+}
+
+type authRequest struct {
+	nonce         string
+	redirectURI   string
+	codeChallenge string
+}
+
+// New starts an IdP for one client. Close it when done.
+func New(clientID, clientSecret string) *IdP {
+	key, err := auth.GenerateKey("test-idp-key")
+	if err != nil {
+		panic(err)
+	}
+	keys, err := auth.NewKeySet(key)
+	if err != nil {
+		panic(err)
+	}
+	i := &IdP{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		keys:         keys,
+		claims:       jwt.MapClaims{"sub": "00u1", "preferred_username": "alice", "email": "alice@example.com"},
+		codes:        make(map[string]authRequest),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", i.discovery)
+	mux.HandleFunc("GET /jwks", i.jwks)
+	mux.HandleFunc("GET /authorize", i.authorize)
+	mux.HandleFunc("POST /token", i.token)
+	i.Server = httptest.NewServer(mux)
+	return i
+}
+
+// Issuer returns the issuer URL (the server URL).
+func (i *IdP) Issuer() string {
+	return i.URL
+}
+
+// SetUserClaims replaces the user claims (e.g. "sub", "preferred_username") of subsequently issued tokens.
+func (i *IdP) SetUserClaims(claims jwt.MapClaims) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.claims = claims
+}
+
+// SignToken signs a token with the IdP key, adding iss, iat and (unless present) exp. Use it to build
+// access tokens or deliberately broken ID tokens.
+func (i *IdP) SignToken(claims jwt.MapClaims) string {
+	out := jwt.MapClaims{"iss": i.Issuer(), "iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix()}
+	for k, v := range claims {
+		out[k] = v
+	}
+	token, err := i.keys.Sign(out)
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
+
+func (i *IdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                 i.Issuer(),
+		"authorization_endpoint": i.URL + "/authorize",
+		"token_endpoint":         i.URL + "/token",
+		"jwks_uri":               i.URL + "/jwks",
+	})
+}
+
+func (i *IdP) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, i.keys.JWKS())
+}
+
+// authorize immediately redirects back with a code, as if the user had authenticated.
+func (i *IdP) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != i.ClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	i.mu.Lock()
+	code := "code-" + strconv.Itoa(len(i.codes)+1)
+	i.codes[code] = authRequest{nonce: q.Get("nonce"), redirectURI: q.Get("redirect_uri"), codeChallenge: q.Get("code_challenge")}
+	i.mu.Unlock()
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	rq := redirect.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token redeems a code once, checking client credentials, redirect_uri and the PKCE verifier.
+func (i *IdP) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	id, _ = url.QueryUnescape(id) // RFC 6749 section 2.3.1: form-encoded before basic auth
+	secret, _ = url.QueryUnescape(secret)
+	if !ok || id != i.ClientID || secret != i.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	i.mu.Lock()
+	req, found := i.codes[r.PostForm.Get("code")]
+	delete(i.codes, r.PostForm.Get("code"))
+	claims := jwt.MapClaims{}
+	for k, v := range i.claims {
+		claims[k] = v
+	}
+	i.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !found || req.redirectURI != r.PostForm.Get("redirect_uri") || base64.RawURLEncoding.EncodeToString(sum[:]) != req.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	claims["aud"] = i.ClientID
+	claims["nonce"] = req.nonce
+	access := jwt.MapClaims{"aud": i.ClientID}
+	for _, k := range []string{"sub", "preferred_username", "email"} {
+		if v, ok := claims[k]; ok {
+			access[k] = v
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     i.SignToken(claims),
+		"access_token": i.SignToken(access),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
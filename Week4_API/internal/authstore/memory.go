@@ -0,0 +1,437 @@
+package authstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore implements Store in process memory. Data is lost on restart and not shared between replicas.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	users         map[string]User
+	identities    map[identityKey]Identity
+	refreshTokens map[string]RefreshToken // key: token hash
+	revokedJTIs   map[string]time.Time    // key: jti, value: token expiry
+	apiKeys       map[string]APIKey       // key: id
+	orgs          map[string]Org
+	members       map[string]map[string]Membership // key: org, username
+	invitations   map[string]Invitation            // key: id
+}
+
+// Ensure MemoryStore implements Store.
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:         make(map[string]User),
+		identities:    make(map[identityKey]Identity),
+		refreshTokens: make(map[string]RefreshToken),
+		revokedJTIs:   make(map[string]time.Time),
+		apiKeys:       make(map[string]APIKey),
+		orgs:          make(map[string]Org),
+		members:       make(map[string]map[string]Membership),
+		invitations:   make(map[string]Invitation),
+	}
+}
+
+// GetUser returns a copy of the stored user.
+func (s *MemoryStore) GetUser(ctx context.Context, username string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[username]
+	if !ok {
+		return nil, fmt.Errorf("%w: user %s", ErrNotFound, username)
+	}
+	return &u, nil
+}
+
+// CreateUser stores a new user.
+func (s *MemoryStore) CreateUser(ctx context.Context, username, passwordHash string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[username]; ok {
+		return nil, fmt.Errorf("%w: user %s", ErrAlreadyExists, username)
+	}
+	u := User{Username: username, PasswordHash: passwordHash, Role: RoleOwner, CreatedAt: time.Now().UTC()}
+	s.users[username] = u
+	return &u, nil
+}
+
+// SetUserDisabled updates the disabled flag.
+func (s *MemoryStore) SetUserDisabled(ctx context.Context, username string, disabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[username]
+	if !ok {
+		return fmt.Errorf("%w: user %s", ErrNotFound, username)
+	}
+	u.Disabled = disabled
+	s.users[username] = u
+	return nil
+}
+
+// SetUserRole updates the role.
+func (s *MemoryStore) SetUserRole(ctx context.Context, username, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[username]
+	if !ok {
+		return fmt.Errorf("%w: user %s", ErrNotFound, username)
+	}
+	u.Role = role
+	s.users[username] = u
+	return nil
+}
+
+// identityKey identifies an SSO account.
+type identityKey struct{ issuer, subject string }
+
+// GetIdentity returns a copy of the stored link.
+func (s *MemoryStore) GetIdentity(ctx context.Context, issuer, subject string) (*Identity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, ok := s.identities[identityKey{issuer, subject}]
+	if !ok {
+		return nil, fmt.Errorf("%w: identity %s at %s", ErrNotFound, subject, issuer)
+	}
+	return &id, nil
+}
+
+// CreateIdentity stores the link of an existing user.
+func (s *MemoryStore) CreateIdentity(ctx context.Context, id Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[id.Username]; !ok {
+		return fmt.Errorf("%w: user %s", ErrNotFound, id.Username)
+	}
+	return s.createIdentity(id)
+}
+
+// CreateIdentityUser stores a new user without a password and its link.
+func (s *MemoryStore) CreateIdentityUser(ctx context.Context, id Identity) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[id.Username]; ok {
+		return nil, fmt.Errorf("%w: user %s", ErrAlreadyExists, id.Username)
+	}
+	if err := s.createIdentity(id); err != nil {
+		return nil, err
+	}
+	u := User{Username: id.Username, Role: RoleOwner, CreatedAt: time.Now().UTC()}
+	s.users[id.Username] = u
+	return &u, nil
+}
+
+// createIdentity stores the link unless the account is linked already. Callers hold s.mu.
+func (s *MemoryStore) createIdentity(id Identity) error {
+	key := identityKey{id.Issuer, id.Subject}
+	if _, ok := s.identities[key]; ok {
+		return fmt.Errorf("%w: identity %s at %s", ErrAlreadyExists, id.Subject, id.Issuer)
+	}
+	if id.CreatedAt.IsZero() {
+		id.CreatedAt = time.Now().UTC()
+	}
+	s.identities[key] = id
+	return nil
+}
+
+// CreateRefreshToken stores the token record keyed by its hash.
+func (s *MemoryStore) CreateRefreshToken(ctx context.Context, rt RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rt.CreatedAt.IsZero() {
+		rt.CreatedAt = time.Now().UTC()
+	}
+	s.refreshTokens[rt.TokenHash] = rt
+	return nil
+}
+
+// GetRefreshToken returns a copy of the token record.
+func (s *MemoryStore) GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rt, ok := s.refreshTokens[tokenHash]
+	if !ok {
+		return nil, fmt.Errorf("%w: refresh token", ErrNotFound)
+	}
+	return &rt, nil
+}
+
+// RevokeRefreshToken marks the token with the given id revoked.
+func (s *MemoryStore) RevokeRefreshToken(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, rt := range s.refreshTokens {
+		if rt.ID == id && rt.RevokedAt == nil {
+			now := time.Now().UTC()
+			rt.RevokedAt = &now
+			s.refreshTokens[hash] = rt
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: refresh token %s", ErrNotFound, id)
+}
+
+// RevokeUserRefreshTokens revokes all active refresh tokens of the user.
+func (s *MemoryStore) RevokeUserRefreshTokens(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	for hash, rt := range s.refreshTokens {
+		if rt.Username == username && rt.RevokedAt == nil {
+			rt.RevokedAt = &now
+			s.refreshTokens[hash] = rt
+		}
+	}
+	return nil
+}
+
+// RevokeAccessToken records the jti as revoked and drops entries whose tokens have expired.
+func (s *MemoryStore) RevokeAccessToken(ctx context.Context, jti, username string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, exp := range s.revokedJTIs {
+		if exp.Before(now) {
+			delete(s.revokedJTIs, id)
+		}
+	}
+	s.revokedJTIs[jti] = expiresAt
+	return nil
+}
+
+// IsAccessTokenRevoked reports whether the jti was revoked.
+func (s *MemoryStore) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.revokedJTIs[jti]
+	return ok, nil
+}
+
+// CreateAPIKey stores the key by id.
+func (s *MemoryStore) CreateAPIKey(ctx context.Context, k APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.apiKeys[k.ID]; ok {
+		return fmt.Errorf("%w: api key %s", ErrAlreadyExists, k.ID)
+	}
+	if k.CreatedAt.IsZero() {
+		k.CreatedAt = time.Now().UTC()
+	}
+	s.apiKeys[k.ID] = k
+	return nil
+}
+
+// GetAPIKey returns a copy of the key.
+func (s *MemoryStore) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.apiKeys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: api key %s", ErrNotFound, id)
+	}
+	return &k, nil
+}
+
+// ListAPIKeys returns the tenant's keys, optionally only those of createdBy, newest first.
+func (s *MemoryStore) ListAPIKeys(ctx context.Context, tenant, createdBy string) ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []APIKey
+	for _, k := range s.apiKeys {
+		if k.Tenant == tenant && (createdBy == "" || k.CreatedBy == createdBy) {
+			out = append(out, k)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// RevokeAPIKey marks the tenant's key revoked.
+func (s *MemoryStore) RevokeAPIKey(ctx context.Context, tenant, createdBy, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.apiKeys[id]
+	if !ok || k.Tenant != tenant || (createdBy != "" && k.CreatedBy != createdBy) || k.RevokedAt != nil {
+		return fmt.Errorf("%w: api key %s", ErrNotFound, id)
+	}
+	now := time.Now().UTC()
+	k.RevokedAt = &now
+	s.apiKeys[id] = k
+	return nil
+}
+
+// TouchAPIKey updates the last-used timestamp.
+func (s *MemoryStore) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.apiKeys[id]
+	if !ok {
+		return fmt.Errorf("%w: api key %s", ErrNotFound, id)
+	}
+	k.LastUsedAt = &usedAt
+	s.apiKeys[id] = k
+	return nil
+}
+
+// CreateOrg stores the org and its owner membership.
+func (s *MemoryStore) CreateOrg(ctx context.Context, name, owner string) (*Org, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.orgs[name]; ok {
+		return nil, fmt.Errorf("%w: org %s", ErrAlreadyExists, name)
+	}
+	now := time.Now().UTC()
+	o := Org{Name: name, CreatedBy: owner, CreatedAt: now}
+	s.orgs[name] = o
+	s.members[name] = map[string]Membership{owner: {Org: name, Username: owner, Role: RoleOwner, CreatedAt: now}}
+	return &o, nil
+}
+
+// GetOrg returns a copy of the org.
+func (s *MemoryStore) GetOrg(ctx context.Context, name string) (*Org, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o, ok := s.orgs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: org %s", ErrNotFound, name)
+	}
+	return &o, nil
+}
+
+// GetMembership returns a copy of the membership.
+func (s *MemoryStore) GetMembership(ctx context.Context, org, username string) (*Membership, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.members[org][username]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not a member of %s", ErrNotFound, username, org)
+	}
+	return &m, nil
+}
+
+// ListMembers returns the org's members ordered by username.
+func (s *MemoryStore) ListMembers(ctx context.Context, org string) ([]Membership, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Membership
+	for _, m := range s.members[org] {
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Username < out[j].Username })
+	return out, nil
+}
+
+// ListUserMemberships returns the user's memberships ordered by org.
+func (s *MemoryStore) ListUserMemberships(ctx context.Context, username string) ([]Membership, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Membership
+	for _, members := range s.members {
+		if m, ok := members[username]; ok {
+			out = append(out, m)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Org < out[j].Org })
+	return out, nil
+}
+
+// SetMemberRole updates the member's role.
+func (s *MemoryStore) SetMemberRole(ctx context.Context, org, username, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.members[org][username]
+	if !ok {
+		return fmt.Errorf("%w: %s is not a member of %s", ErrNotFound, username, org)
+	}
+	m.Role = role
+	s.members[org][username] = m
+	return nil
+}
+
+// RemoveMember deletes the membership.
+func (s *MemoryStore) RemoveMember(ctx context.Context, org, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.members[org][username]; !ok {
+		return fmt.Errorf("%w: %s is not a member of %s", ErrNotFound, username, org)
+	}
+	delete(s.members[org], username)
+	return nil
+}
+
+// CreateInvitation stores the invitation by id.
+func (s *MemoryStore) CreateInvitation(ctx context.Context, inv Invitation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.invitations {
+		if other.Org == inv.Org && other.Username == inv.Username {
+			return fmt.Errorf("%w: invitation for %s to %s", ErrAlreadyExists, inv.Username, inv.Org)
+		}
+	}
+	if inv.CreatedAt.IsZero() {
+		inv.CreatedAt = time.Now().UTC()
+	}
+	s.invitations[inv.ID] = inv
+	return nil
+}
+
+// GetInvitation returns a copy of the invitation.
+func (s *MemoryStore) GetInvitation(ctx context.Context, id string) (*Invitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	inv, ok := s.invitations[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: invitation %s", ErrNotFound, id)
+	}
+	return &inv, nil
+}
+
+// ListInvitations returns invitations matching org or username, newest first.
+func (s *MemoryStore) ListInvitations(ctx context.Context, org, username string) ([]Invitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Invitation
+	for _, inv := range s.invitations {
+		if (org == "" || inv.Org == org) && (username == "" || inv.Username == username) {
+			out = append(out, inv)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// AcceptInvitation converts the invitation into a membership.
+func (s *MemoryStore) AcceptInvitation(ctx context.Context, id string) (*Membership, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.invitations[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: invitation %s", ErrNotFound, id)
+	}
+	if _, ok := s.members[inv.Org][inv.Username]; ok {
+		return nil, fmt.Errorf("%w: %s is already a member of %s", ErrAlreadyExists, inv.Username, inv.Org)
+	}
+	if s.members[inv.Org] == nil {
+		s.members[inv.Org] = make(map[string]Membership)
+	}
+	m := Membership{Org: inv.Org, Username: inv.Username, Role: inv.Role, CreatedAt: time.Now().UTC()}
+	s.members[inv.Org][inv.Username] = m
+	delete(s.invitations, id)
+	return &m, nil
+}
+
+// DeleteInvitation removes the invitation.
+func (s *MemoryStore) DeleteInvitation(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.invitations[id]; !ok {
+		return fmt.Errorf("%w: invitation %s", ErrNotFound, id)
+	}
+	delete(s.invitations, id)
+	return nil
+}
@@ -0,0 +1,48 @@
+package authstore
+
+import (
+	"context"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyHash is compared against when a user does not exist, so unknown usernames take as long as wrong passwords.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("paas-dummy-password"), bcrypt.DefaultCost)
+
+// HashPassword returns a bcrypt hash of password for storage.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// VerifyPassword reports whether password matches the user's stored hash.
+// A nil user is checked against a dummy hash and always returns false.
+func VerifyPassword(user *User, password string) bool {
+	if user == nil {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
+
+// EnsureUser creates username with password if it does not exist yet. Existing users are left untouched.
+// The name is not validated; see api.EnsureBootstrapUser.
+func EnsureUser(ctx context.Context, s Store, username, password string) error {
+	if _, err := s.GetUser(ctx, username); err == nil {
+		return nil
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if _, err := s.CreateUser(ctx, username, hash); err != nil && !errors.Is(err, ErrAlreadyExists) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package authstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PostgreSQL error codes for unique and foreign key constraint violations.
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+// PostgresStore implements Store using PostgreSQL (users, user_identities, refresh_tokens, revoked_tokens and api_keys tables).
+// It shares the *sql.DB opened by logstore.NewPostgresStore; closing is left to the owner of the connection.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// Ensure PostgresStore implements Store.
+var _ Store = (*PostgresStore)(nil)
+
+// NewPostgresStore returns a store backed by an existing database connection.
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// GetUser returns the user by username.
+func (s *PostgresStore) GetUser(ctx context.Context, username string) (*User, error) {
+	var u User
+	err := s.db.QueryRowContext(ctx,
+		`SELECT username, password_hash, role, disabled, created_at FROM users WHERE username = $1`,
+		username).Scan(&u.Username, &u.PasswordHash, &u.Role, &u.Disabled, &u.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: user %s", ErrNotFound, username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// CreateUser inserts a new user row.
+func (s *PostgresStore) CreateUser(ctx context.Context, username, passwordHash string) (*User, error) {
+	u := User{Username: username, PasswordHash: passwordHash}
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO users (username, password_hash) VALUES ($1, $2) RETURNING role, created_at`,
+		username, passwordHash).Scan(&u.Role, &u.CreatedAt)
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("%w: user %s", ErrAlreadyExists, username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// SetUserDisabled updates the disabled flag.
+func (s *PostgresStore) SetUserDisabled(ctx context.Context, username string, disabled bool) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE users SET disabled = $2, updated_at = now() WHERE username = $1`,
+		username, disabled)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: user %s", ErrNotFound, username)
+	}
+	return nil
+}
+
+// SetUserRole updates the role column.
+func (s *PostgresStore) SetUserRole(ctx context.Context, username, role string) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE users SET role = $2, updated_at = now() WHERE username = $1`,
+		username, role)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: user %s", ErrNotFound, username)
+	}
+	return nil
+}
+
+// GetIdentity returns the user_identities row.
+func (s *PostgresStore) GetIdentity(ctx context.Context, issuer, subject string) (*Identity, error) {
+	id := Identity{Issuer: issuer, Subject: subject}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT username, created_at FROM user_identities WHERE issuer = $1 AND subject = $2`,
+		issuer, subject).Scan(&id.Username, &id.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: identity %s at %s", ErrNotFound, subject, issuer)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// CreateIdentity inserts a user_identities row for an existing user.
+func (s *PostgresStore) CreateIdentity(ctx context.Context, id Identity) error {
+	return insertIdentity(ctx, s.db, id)
+}
+
+// CreateIdentityUser inserts the user and its user_identities row in one transaction.
+func (s *PostgresStore) CreateIdentityUser(ctx context.Context, id Identity) (*User, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	u := User{Username: id.Username}
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO users (username, password_hash) VALUES ($1, '') RETURNING role, created_at`,
+		id.Username).Scan(&u.Role, &u.CreatedAt)
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("%w: user %s", ErrAlreadyExists, id.Username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := insertIdentity(ctx, tx, id); err != nil {
+		return nil, err
+	}
+	return &u, tx.Commit()
+}
+
+// insertIdentity inserts a user_identities row with db or a transaction.
+func insertIdentity(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}, id Identity) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO user_identities (issuer, subject, username) VALUES ($1, $2, $3)`,
+		id.Issuer, id.Subject, id.Username)
+	var pgErr *pgconn.PgError
+	switch {
+	case isUniqueViolation(err):
+		return fmt.Errorf("%w: identity %s at %s", ErrAlreadyExists, id.Subject, id.Issuer)
+	case errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation:
+		return fmt.Errorf("%w: user %s", ErrNotFound, id.Username)
+	}
+	return err
+}
+
+// CreateRefreshToken inserts a refresh token row.
+func (s *PostgresStore) CreateRefreshToken(ctx context.Context, rt RefreshToken) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (id, username, org, token_hash, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+		rt.ID, rt.Username, rt.Org, rt.TokenHash, rt.ExpiresAt)
+	return err
+}
+
+// GetRefreshToken returns the refresh token row by hash.
+func (s *PostgresStore) GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	var rt RefreshToken
+	var revokedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, username, org, token_hash, expires_at, revoked_at, created_at FROM refresh_tokens WHERE token_hash = $1`,
+		tokenHash).Scan(&rt.ID, &rt.Username, &rt.Org, &rt.TokenHash, &rt.ExpiresAt, &revokedAt, &rt.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: refresh token", ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rt.RevokedAt = nullTimePtr(revokedAt)
+	return &rt, nil
+}
+
+// RevokeRefreshToken sets revoked_at if the token is still active.
+func (s *PostgresStore) RevokeRefreshToken(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: refresh token %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes all active refresh tokens of the user.
+func (s *PostgresStore) RevokeUserRefreshTokens(ctx context.Context, username string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = now() WHERE username = $1 AND revoked_at IS NULL`, username)
+	return err
+}
+
+// RevokeAccessToken inserts the jti into revoked_tokens and prunes rows of already expired tokens.
+func (s *PostgresStore) RevokeAccessToken(ctx context.Context, jti, username string, expiresAt time.Time) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < now()`); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO revoked_tokens (jti, username, expires_at) VALUES ($1, $2, $3) ON CONFLICT (jti) DO NOTHING`,
+		jti, username, expiresAt)
+	return err
+}
+
+// IsAccessTokenRevoked reports whether the jti is in revoked_tokens.
+func (s *PostgresStore) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`, jti).Scan(&exists)
+	return exists, err
+}
+
+// CreateAPIKey inserts an api_keys row; scopes are stored as a JSONB array.
+func (s *PostgresStore) CreateAPIKey(ctx context.Context, k APIKey) error {
+	scopes, err := json.Marshal(k.Scopes)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO api_keys (id, tenant, name, key_hash, scopes, role, created_by, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		k.ID, k.Tenant, k.Name, k.KeyHash, scopes, k.Role, k.CreatedBy, k.ExpiresAt)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: api key %s", ErrAlreadyExists, k.ID)
+	}
+	return err
+}
+
+const apiKeyColumns = `id, tenant, name, key_hash, scopes::text, role, created_by, expires_at, last_used_at, revoked_at, created_at`
+
+// GetAPIKey returns the api_keys row by id.
+func (s *PostgresStore) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id)
+	k, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: api key %s", ErrNotFound, id)
+	}
+	return k, err
+}
+
+// ListAPIKeys returns the tenant's keys, optionally only those of createdBy, newest first.
+func (s *PostgresStore) ListAPIKeys(ctx context.Context, tenant, createdBy string) ([]APIKey, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE tenant = $1 AND ($2 = '' OR created_by = $2) ORDER BY created_at DESC`,
+		tenant, createdBy)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *k)
+	}
+	return out, rows.Err()
+}
+
+// RevokeAPIKey sets revoked_at if the key belongs to the tenant (and createdBy, unless empty) and is still
+// active.
+func (s *PostgresStore) RevokeAPIKey(ctx context.Context, tenant, createdBy, id string) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND tenant = $2 AND ($3 = '' OR created_by = $3) AND revoked_at IS NULL`,
+		id, tenant, createdBy)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: api key %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+// TouchAPIKey updates last_used_at.
+func (s *PostgresStore) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = $2 WHERE id = $1`, id, usedAt)
+	return err
+}
+
+// scanAPIKey scans one row selected with apiKeyColumns.
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (*APIKey, error) {
+	var k APIKey
+	var scopes string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	if err := row.Scan(&k.ID, &k.Tenant, &k.Name, &k.KeyHash, &scopes, &k.Role, &k.CreatedBy, &expiresAt, &lastUsedAt, &revokedAt, &k.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &k.Scopes); err != nil {
+		return nil, fmt.Errorf("decode scopes: %w", err)
+	}
+	k.ExpiresAt = nullTimePtr(expiresAt)
+	k.LastUsedAt = nullTimePtr(lastUsedAt)
+	k.RevokedAt = nullTimePtr(revokedAt)
+	return &k, nil
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation
+}
@@ -0,0 +1,209 @@
+package authstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// CreateOrg inserts the organization and its owner membership in one transaction.
+func (s *PostgresStore) CreateOrg(ctx context.Context, name, owner string) (*Org, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	o := Org{Name: name, CreatedBy: owner}
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO orgs (name, created_by) VALUES ($1, $2) RETURNING created_at`,
+		name, owner).Scan(&o.CreatedAt)
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("%w: org %s", ErrAlreadyExists, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO org_members (org, username, role) VALUES ($1, $2, $3)`,
+		name, owner, RoleOwner); err != nil {
+		return nil, err
+	}
+	return &o, tx.Commit()
+}
+
+// GetOrg returns the orgs row.
+func (s *PostgresStore) GetOrg(ctx context.Context, name string) (*Org, error) {
+	var o Org
+	err := s.db.QueryRowContext(ctx,
+		`SELECT name, created_by, created_at FROM orgs WHERE name = $1`,
+		name).Scan(&o.Name, &o.CreatedBy, &o.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: org %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// GetMembership returns the org_members row.
+func (s *PostgresStore) GetMembership(ctx context.Context, org, username string) (*Membership, error) {
+	var m Membership
+	err := s.db.QueryRowContext(ctx,
+		`SELECT org, username, role, created_at FROM org_members WHERE org = $1 AND username = $2`,
+		org, username).Scan(&m.Org, &m.Username, &m.Role, &m.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s is not a member of %s", ErrNotFound, username, org)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ListMembers returns the org's members ordered by username.
+func (s *PostgresStore) ListMembers(ctx context.Context, org string) ([]Membership, error) {
+	return s.queryMemberships(ctx,
+		`SELECT org, username, role, created_at FROM org_members WHERE org = $1 ORDER BY username`, org)
+}
+
+// ListUserMemberships returns the user's memberships ordered by org.
+func (s *PostgresStore) ListUserMemberships(ctx context.Context, username string) ([]Membership, error) {
+	return s.queryMemberships(ctx,
+		`SELECT org, username, role, created_at FROM org_members WHERE username = $1 ORDER BY org`, username)
+}
+
+func (s *PostgresStore) queryMemberships(ctx context.Context, query string, arg string) ([]Membership, error) {
+	rows, err := s.db.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Membership
+	for rows.Next() {
+		var m Membership
+		if err := rows.Scan(&m.Org, &m.Username, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// SetMemberRole updates the member's role.
+func (s *PostgresStore) SetMemberRole(ctx context.Context, org, username, role string) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE org_members SET role = $3 WHERE org = $1 AND username = $2`, org, username, role)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s is not a member of %s", ErrNotFound, username, org)
+	}
+	return nil
+}
+
+// RemoveMember deletes the membership.
+func (s *PostgresStore) RemoveMember(ctx context.Context, org, username string) error {
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM org_members WHERE org = $1 AND username = $2`, org, username)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s is not a member of %s", ErrNotFound, username, org)
+	}
+	return nil
+}
+
+// CreateInvitation inserts an org_invitations row; (org, username) is unique.
+func (s *PostgresStore) CreateInvitation(ctx context.Context, inv Invitation) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO org_invitations (id, org, username, role, invited_by, expires_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		inv.ID, inv.Org, inv.Username, inv.Role, inv.InvitedBy, inv.ExpiresAt)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: invitation for %s to %s", ErrAlreadyExists, inv.Username, inv.Org)
+	}
+	return err
+}
+
+const invitationColumns = `id, org, username, role, invited_by, expires_at, created_at`
+
+// GetInvitation returns the invitation by id.
+func (s *PostgresStore) GetInvitation(ctx context.Context, id string) (*Invitation, error) {
+	var inv Invitation
+	err := s.db.QueryRowContext(ctx, `SELECT `+invitationColumns+` FROM org_invitations WHERE id = $1`, id).
+		Scan(&inv.ID, &inv.Org, &inv.Username, &inv.Role, &inv.InvitedBy, &inv.ExpiresAt, &inv.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: invitation %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// ListInvitations returns invitations matching org or username (empty matches all), newest first.
+func (s *PostgresStore) ListInvitations(ctx context.Context, org, username string) ([]Invitation, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+invitationColumns+` FROM org_invitations
+		 WHERE ($1 = '' OR org = $1) AND ($2 = '' OR username = $2) ORDER BY created_at DESC`,
+		org, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Invitation
+	for rows.Next() {
+		var inv Invitation
+		if err := rows.Scan(&inv.ID, &inv.Org, &inv.Username, &inv.Role, &inv.InvitedBy, &inv.ExpiresAt, &inv.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, inv)
+	}
+	return out, rows.Err()
+}
+
+// AcceptInvitation deletes the invitation and inserts the membership in one transaction.
+func (s *PostgresStore) AcceptInvitation(ctx context.Context, id string) (*Membership, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var m Membership
+	err = tx.QueryRowContext(ctx,
+		`DELETE FROM org_invitations WHERE id = $1 RETURNING org, username, role`, id).
+		Scan(&m.Org, &m.Username, &m.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: invitation %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO org_members (org, username, role) VALUES ($1, $2, $3) RETURNING created_at`,
+		m.Org, m.Username, m.Role).Scan(&m.CreatedAt)
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("%w: %s is already a member of %s", ErrAlreadyExists, m.Username, m.Org)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, tx.Commit()
+}
+
+// DeleteInvitation removes the invitation.
+func (s *PostgresStore) DeleteInvitation(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM org_invitations WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: invitation %s", ErrNotFound, id)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package authstore
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when the requested user, token, API key, organization, membership or invitation does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrAlreadyExists is returned when creating a user whose username is already taken.
+var ErrAlreadyExists = errors.New("already exists")
+
+// Store persists identity data: local user accounts and server-side token state.
+// PostgresStore is used when DATABASE_URL is set; MemoryStore otherwise (and in tests).
+type Store interface {
+	UserStore
+	IdentityStore
+	TokenStore
+	APIKeyStore
+	OrgStore
+}
+
+// UserStore persists local user accounts used by the Login handler.
+type UserStore interface {
+	// GetUser returns the user by username. Returns ErrNotFound if it does not exist.
+	GetUser(ctx context.Context, username string) (*User, error)
+	// CreateUser stores a new user with an already hashed password. Returns ErrAlreadyExists if the username is taken.
+	CreateUser(ctx context.Context, username, passwordHash string) (*User, error)
+	// SetUserDisabled enables or disables login for the user. Returns ErrNotFound if it does not exist.
+	SetUserDisabled(ctx context.Context, username string, disabled bool) error
+	// SetUserRole changes the user's role within their tenant. Returns ErrNotFound if it does not exist.
+	SetUserRole(ctx context.Context, username, role string) error
+}
+
+// Roles within a tenant, from least to most privileged. New users are owners of their own tenant.
+const (
+	RoleViewer   = "viewer"   // list and read instances and logs
+	RoleOperator = "operator" // viewer, plus patch instances and read/write cache
+	RoleOwner    = "owner"    // operator, plus create and delete instances
+)
+
+// ValidRole reports whether role is one of RoleViewer, RoleOperator or RoleOwner.
+func ValidRole(role string) bool {
+	return role == RoleViewer || role == RoleOperator || role == RoleOwner
+}
+
+// User is a local account. Each user owns the tenant namespace derived from Username.
+type User struct {
+	Username     string
+	PasswordHash string
+	Role         string
+	Disabled     bool
+	CreatedAt    time.Time
+}
+
+// IdentityStore persists SSO accounts linked to local users. An account is identified by the OIDC issuer
+// and subject; claims such as the e-mail address can change or be reused and never select a user.
+type IdentityStore interface {
+	// GetIdentity returns the link of the account (issuer, subject). Returns ErrNotFound if it is not linked.
+	GetIdentity(ctx context.Context, issuer, subject string) (*Identity, error)
+	// CreateIdentity links the account to an existing user. Returns ErrAlreadyExists if the account is
+	// already linked, ErrNotFound if the user does not exist.
+	CreateIdentity(ctx context.Context, id Identity) error
+	// CreateIdentityUser creates a user without a password (no local login) linked to the account, in one
+	// step. Returns ErrAlreadyExists if the username is taken or the account is already linked.
+	CreateIdentityUser(ctx context.Context, id Identity) (*User, error)
+}
+
+// Identity links the SSO account Subject at Issuer to the local user Username.
+type Identity struct {
+	Issuer    string
+	Subject   string
+	Username  string
+	CreatedAt time.Time
+}
+
+// TokenStore persists refresh tokens and revoked access token ids (jti).
+type TokenStore interface {
+	// CreateRefreshToken stores a new refresh token record.
+	CreateRefreshToken(ctx context.Context, rt RefreshToken) error
+	// GetRefreshToken looks up a refresh token by the SHA-256 hash of its value. Returns ErrNotFound if unknown.
+	GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	// RevokeRefreshToken marks the token revoked. Returns ErrNotFound if it is unknown or already revoked,
+	// so concurrent refreshes with the same token cannot both succeed.
+	RevokeRefreshToken(ctx context.Context, id string) error
+	// RevokeUserRefreshTokens revokes all active refresh tokens of a user (e.g. on disable or token reuse).
+	RevokeUserRefreshTokens(ctx context.Context, username string) error
+	// RevokeAccessToken records an access token id as revoked until the token would have expired anyway.
+	RevokeAccessToken(ctx context.Context, jti, username string, expiresAt time.Time) error
+	// IsAccessTokenRevoked reports whether the access token id has been revoked.
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// RefreshToken is a server-side refresh token. Only the SHA-256 hash of the token value is stored.
+type RefreshToken struct {
+	ID        string
+	Username  string
+	Org       string // organization selected at login; carried into refreshed access tokens
+	TokenHash string
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// APIKeyStore persists tenant-scoped API keys. Only the SHA-256 hash of the key value is stored.
+type APIKeyStore interface {
+	// CreateAPIKey stores a new API key.
+	CreateAPIKey(ctx context.Context, k APIKey) error
+	// GetAPIKey returns the key by id (the public part embedded in the key value). Returns ErrNotFound if unknown.
+	GetAPIKey(ctx context.Context, id string) (*APIKey, error)
+	// ListAPIKeys returns the keys of a tenant (including revoked and expired ones), newest first; only
+	// those created by createdBy unless it is empty.
+	ListAPIKeys(ctx context.Context, tenant, createdBy string) ([]APIKey, error)
+	// RevokeAPIKey revokes a tenant's key. Returns ErrNotFound if it does not exist, belongs to another
+	// tenant, was not created by createdBy (unless it is empty) or is already revoked.
+	RevokeAPIKey(ctx context.Context, tenant, createdBy, id string) error
+	// TouchAPIKey records the last time the key was used.
+	TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error
+}
+
+// APIKey is a long-lived credential for CI pipelines and service accounts acting on behalf of Tenant.
+type APIKey struct {
+	ID         string
+	Tenant     string
+	Name       string
+	KeyHash    string
+	Scopes     []string
+	Role       string // role of the creator; the key never has more rights than this
+	CreatedBy  string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+// OrgStore persists organizations, their memberships and pending invitations. An organization is a
+// tenant shared by its members; each member has their own role in it.
+type OrgStore interface {
+	// CreateOrg stores a new organization with owner as its first member (RoleOwner).
+	// Returns ErrAlreadyExists if the name is taken.
+	CreateOrg(ctx context.Context, name, owner string) (*Org, error)
+	// GetOrg returns the organization. Returns ErrNotFound if it does not exist.
+	GetOrg(ctx context.Context, name string) (*Org, error)
+	// GetMembership returns username's membership in org. Returns ErrNotFound if username is not a member.
+	GetMembership(ctx context.Context, org, username string) (*Membership, error)
+	// ListMembers returns all members of org, ordered by username.
+	ListMembers(ctx context.Context, org string) ([]Membership, error)
+	// ListUserMemberships returns all memberships of username, ordered by org.
+	ListUserMemberships(ctx context.Context, username string) ([]Membership, error)
+	// SetMemberRole changes a member's role. Returns ErrNotFound if username is not a member.
+	SetMemberRole(ctx context.Context, org, username, role string) error
+	// RemoveMember removes username from org. Returns ErrNotFound if username is not a member.
+	RemoveMember(ctx context.Context, org, username string) error
+	// CreateInvitation stores a pending invitation. Returns ErrAlreadyExists if the user already has a
+	// pending invitation to org.
+	CreateInvitation(ctx context.Context, inv Invitation) error
+	// GetInvitation returns the invitation by id. Returns ErrNotFound if it does not exist.
+	GetInvitation(ctx context.Context, id string) (*Invitation, error)
+	// ListInvitations returns pending invitations addressed to username (org == "") or of org (username == "").
+	ListInvitations(ctx context.Context, org, username string) ([]Invitation, error)
+	// AcceptInvitation adds the invitee to the org with the invited role and deletes the invitation.
+	// Returns ErrNotFound if the invitation does not exist, ErrAlreadyExists if the invitee is already a member.
+	AcceptInvitation(ctx context.Context, id string) (*Membership, error)
+	// DeleteInvitation removes an invitation (declined or withdrawn). Returns ErrNotFound if it does not exist.
+	DeleteInvitation(ctx context.Context, id string) error
+}
+
+// Org is an organization (team) owning one shared tenant namespace.
+type Org struct {
+	Name      string
+	CreatedBy string
+	CreatedAt time.Time
+}
+
+// Membership grants Username the Role within Org.
+type Membership struct {
+	Org       string
+	Username  string
+	Role      string
+	CreatedAt time.Time
+}
+
+// Invitation asks Username to join Org with Role. It is deleted once accepted or declined.
+type Invitation struct {
+	ID        string
+	Org       string
+	Username  string
+	Role      string
+	InvitedBy string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
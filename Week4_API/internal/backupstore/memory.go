@@ -0,0 +1,97 @@
+package backupstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore implements Store in process memory. Data is lost on restart and not shared between replicas.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	backups map[string]Backup // key: id
+}
+
+// Ensure MemoryStore implements Store.
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{backups: make(map[string]Backup)}
+}
+
+// CreateBackup stores the backup by id.
+func (s *MemoryStore) CreateBackup(ctx context.Context, b Backup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now().UTC()
+	}
+	s.backups[b.ID] = b
+	return nil
+}
+
+// GetBackup returns a copy of the tenant's backup.
+func (s *MemoryStore) GetBackup(ctx context.Context, tenant, id string) (*Backup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.backups[id]
+	if !ok || b.Tenant != tenant {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return &b, nil
+}
+
+// ListBackups returns the tenant's backups of the instance, newest first.
+func (s *MemoryStore) ListBackups(ctx context.Context, tenant, instanceID string) ([]Backup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Backup
+	for _, b := range s.backups {
+		if b.Tenant == tenant && b.InstanceID == instanceID {
+			out = append(out, b)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// ListRunningBackups returns the backups that have not completed, oldest first.
+func (s *MemoryStore) ListRunningBackups(ctx context.Context) ([]Backup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Backup
+	for _, b := range s.backups {
+		if b.CompletedAt == nil {
+			out = append(out, b)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+// UpdateBackup replaces the mutable fields of the stored backup unless it has completed.
+func (s *MemoryStore) UpdateBackup(ctx context.Context, b Backup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.backups[b.ID]
+	if !ok || cur.Tenant != b.Tenant || cur.CompletedAt != nil {
+		return fmt.Errorf("%w: %s", ErrNotFound, b.ID)
+	}
+	cur.State, cur.SizeBytes, cur.Error, cur.CompletedAt = b.State, b.SizeBytes, b.Error, b.CompletedAt
+	s.backups[b.ID] = cur
+	return nil
+}
+
+// DeleteBackup removes the tenant's backup.
+func (s *MemoryStore) DeleteBackup(ctx context.Context, tenant, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b, ok := s.backups[id]; !ok || b.Tenant != tenant {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	delete(s.backups, id)
+	return nil
+}
@@ -0,0 +1,119 @@
+package backupstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// PostgresStore implements Store using the PostgreSQL backups table. It shares the *sql.DB opened by
+// logstore.NewPostgresStore; closing is left to the owner of the connection.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// Ensure PostgresStore implements Store.
+var _ Store = (*PostgresStore)(nil)
+
+// NewPostgresStore returns a store backed by an existing database connection.
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+const backupColumns = `id, tenant_user, instance_id, state, location, size_bytes, error, created_by, scheduled, created_at, completed_at`
+
+// CreateBackup inserts a backups row.
+func (s *PostgresStore) CreateBackup(ctx context.Context, b Backup) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO backups (id, tenant_user, instance_id, state, location, size_bytes, error, created_by, scheduled, completed_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		b.ID, b.Tenant, b.InstanceID, b.State, b.Location, b.SizeBytes, b.Error, b.CreatedBy, b.Scheduled, b.CompletedAt)
+	return err
+}
+
+// GetBackup returns the backups row by tenant and id.
+func (s *PostgresStore) GetBackup(ctx context.Context, tenant, id string) (*Backup, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+backupColumns+` FROM backups WHERE tenant_user = $1 AND id = $2`, tenant, id)
+	b, err := scanBackup(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return b, err
+}
+
+// ListBackups returns the instance's backups, newest first.
+func (s *PostgresStore) ListBackups(ctx context.Context, tenant, instanceID string) ([]Backup, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+backupColumns+` FROM backups WHERE tenant_user = $1 AND instance_id = $2 ORDER BY created_at DESC`,
+		tenant, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Backup
+	for rows.Next() {
+		b, err := scanBackup(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *b)
+	}
+	return out, rows.Err()
+}
+
+// ListRunningBackups returns the rows not yet completed, oldest first.
+func (s *PostgresStore) ListRunningBackups(ctx context.Context) ([]Backup, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+backupColumns+` FROM backups WHERE completed_at IS NULL ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Backup
+	for rows.Next() {
+		b, err := scanBackup(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *b)
+	}
+	return out, rows.Err()
+}
+
+// UpdateBackup updates state, size_bytes, error and completed_at of a row not yet completed.
+func (s *PostgresStore) UpdateBackup(ctx context.Context, b Backup) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE backups SET state = $3, size_bytes = $4, error = $5, completed_at = $6 WHERE tenant_user = $1 AND id = $2 AND completed_at IS NULL`,
+		b.Tenant, b.ID, b.State, b.SizeBytes, b.Error, b.CompletedAt)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, b.ID)
+	}
+	return nil
+}
+
+// DeleteBackup deletes the backups row.
+func (s *PostgresStore) DeleteBackup(ctx context.Context, tenant, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM backups WHERE tenant_user = $1 AND id = $2`, tenant, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+func scanBackup(row interface{ Scan(dest ...any) error }) (*Backup, error) {
+	var b Backup
+	var completedAt sql.NullTime
+	if err := row.Scan(&b.ID, &b.Tenant, &b.InstanceID, &b.State, &b.Location, &b.SizeBytes, &b.Error, &b.CreatedBy, &b.Scheduled, &b.CreatedAt, &completedAt); err != nil {
+		return nil, err
+	}
+	if completedAt.Valid {
+		t := completedAt.Time
+		b.CompletedAt = &t
+	}
+	return &b, nil
+}
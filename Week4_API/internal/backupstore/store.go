@@ -0,0 +1,56 @@
+// Package backupstore persists the metadata of instance backups; the RDB files themselves live in object
+// storage and are written and deleted by Kubernetes Jobs (see k8s.BackupJobs).
+package backupstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when the requested backup does not exist or belongs to another tenant.
+var ErrNotFound = errors.New("backup not found")
+
+// NewID returns a random backup id usable in Kubernetes object names (lowercase hex).
+func NewID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Store persists backup metadata. PostgresStore is used when DATABASE_URL is set; MemoryStore otherwise
+// (and in tests).
+type Store interface {
+	// CreateBackup stores a new backup record.
+	CreateBackup(ctx context.Context, b Backup) error
+	// GetBackup returns the tenant's backup by id. Returns ErrNotFound if it does not exist.
+	GetBackup(ctx context.Context, tenant, id string) (*Backup, error)
+	// ListBackups returns the tenant's backups of an instance, newest first.
+	ListBackups(ctx context.Context, tenant, instanceID string) ([]Backup, error)
+	// ListRunningBackups returns the backups of all tenants that have not completed, oldest first.
+	ListRunningBackups(ctx context.Context) ([]Backup, error)
+	// UpdateBackup stores the state, size, error and completion time of b. Returns ErrNotFound if it
+	// does not exist or has already been completed, so that only one caller records the outcome.
+	UpdateBackup(ctx context.Context, b Backup) error
+	// DeleteBackup removes the tenant's backup record. Returns ErrNotFound if it does not exist.
+	DeleteBackup(ctx context.Context, tenant, id string) error
+}
+
+// Backup is the metadata of one RDB snapshot; State takes the values of models.Backup.
+type Backup struct {
+	ID          string
+	Tenant      string
+	InstanceID  string
+	State       string
+	Location    string
+	SizeBytes   int64
+	Error       string
+	CreatedBy   string
+	Scheduled   bool // taken by the instance's backup schedule
+	CreatedAt   time.Time
+	CompletedAt *time.Time
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// AdminInterface changes the password of Redis and Sentinel servers; used for password rotation.
+type AdminInterface interface {
+	// AddPassword makes newPassword valid on the Redis server at addr next to its current passwords and
+	// uses it to authenticate to the master (masterauth).
+	AddPassword(ctx context.Context, addr, password, newPassword string) error
+	// RemovePassword makes oldPassword invalid on the Redis server at addr. Removing a password the
+	// server does not accept is not an error.
+	RemovePassword(ctx context.Context, addr, password, oldPassword string) error
+	// SetSentinelAuthPass makes the Sentinel at addr authenticate to the Redis servers of master with
+	// password.
+	SetSentinelAuthPass(ctx context.Context, addr, master, password string) error
+}
+
+// Ensure Client implements AdminInterface.
+var _ AdminInterface = (*Client)(nil)
+
+// AddPassword implements AdminInterface. The default user keeps its other passwords, so clients and
+// replicas using them stay connected and can still authenticate.
+func (c *Client) AddPassword(ctx context.Context, addr, password, newPassword string) error {
+	rdb := redis.NewClient(&redis.Options{Addr: addr, Password: password})
+	defer rdb.Close()
+
+	if err := rdb.Do(ctx, "ACL", "SETUSER", "default", "on", ">"+newPassword).Err(); err != nil {
+		return fmt.Errorf("redis acl setuser: %w", err)
+	}
+	if err := rdb.ConfigSet(ctx, "masterauth", newPassword).Err(); err != nil {
+		return fmt.Errorf("redis config set masterauth: %w", err)
+	}
+	return nil
+}
+
+// RemovePassword implements AdminInterface.
+func (c *Client) RemovePassword(ctx context.Context, addr, password, oldPassword string) error {
+	rdb := redis.NewClient(&redis.Options{Addr: addr, Password: password})
+	defer rdb.Close()
+
+	err := rdb.Do(ctx, "ACL", "SETUSER", "default", "<"+oldPassword).Err()
+	if err != nil && !strings.Contains(err.Error(), "does not exist") {
+		return fmt.Errorf("redis acl setuser: %w", err)
+	}
+	return nil
+}
+
+// SetSentinelAuthPass implements AdminInterface.
+func (c *Client) SetSentinelAuthPass(ctx context.Context, addr, master, password string) error {
+	rdb := redis.NewSentinelClient(&redis.Options{Addr: addr})
+	defer rdb.Close()
+
+	if err := rdb.Set(ctx, master, "auth-pass", password).Err(); err != nil {
+		return fmt.Errorf("sentinel set auth-pass: %w", err)
+	}
+	return nil
+}
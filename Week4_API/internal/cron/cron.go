@@ -0,0 +1,170 @@
+// Package cron parses standard five-field cron expressions (minute hour day-of-month month day-of-week)
+// for backup schedules.
+package cron
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression. Each field is a bit set of the values it matches.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// Like Vixie cron, a day matches either day field when both are restricted.
+	domStar, dowStar bool
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = [5]field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 and 7 are Sunday
+}
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression: five fields of "*", values, ranges ("1-5"), steps ("*/15", "0-30/10")
+// and lists thereof ("0,30"), or one of @yearly, @monthly, @weekly, @daily and @hourly. Month and weekday
+// names are not supported.
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if m, ok := macros[expr]; ok {
+		expr = m
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return Schedule{}, fmt.Errorf("cron expression %q: want %d fields, got %d", expr, len(fields), len(parts))
+	}
+	var sets [5]uint64
+	for i, p := range parts {
+		set, err := parseField(p, fields[i])
+		if err != nil {
+			return Schedule{}, fmt.Errorf("cron expression %q: %w", expr, err)
+		}
+		sets[i] = set
+	}
+	dow := sets[4]
+	if dow&(1<<7) != 0 {
+		dow = dow&^(1<<7) | 1
+	}
+	return Schedule{
+		minute:  sets[0],
+		hour:    sets[1],
+		dom:     sets[2],
+		month:   sets[3],
+		dow:     dow,
+		domStar: strings.HasPrefix(parts[2], "*"),
+		dowStar: strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+func parseField(s string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("%s: invalid step %q", f.name, stepStr)
+			}
+			step = n
+		}
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseValue(a, f); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(b, f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s: invalid range %q", f.name, rng)
+			}
+		default:
+			v, err := parseValue(rng, f)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			if hasStep {
+				hi = f.max
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s: %q is not between %d and %d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first time after t, truncated to the minute, that matches the schedule, in t's
+// location. It returns the zero time if there is none within five years (e.g. "0 0 30 2 *").
+func (s Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			// Jump to the next matching minute of this hour, or to the next hour.
+			rest := s.minute >> uint(t.Minute())
+			if rest == 0 {
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			} else {
+				t = t.Add(time.Duration(bits.TrailingZeros64(rest)) * time.Minute)
+			}
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,46 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// Wednesday.
+	from := time.Date(2024, 5, 1, 12, 34, 56, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"* * * * *", "2024-05-01T12:35:00Z"},
+		{"*/15 * * * *", "2024-05-01T12:45:00Z"},
+		{"0 3 * * *", "2024-05-02T03:00:00Z"},
+		{"@daily", "2024-05-02T00:00:00Z"},
+		{"@hourly", "2024-05-01T13:00:00Z"},
+		{"30 1 * * 0", "2024-05-05T01:30:00Z"},
+		{"30 1 * * 7", "2024-05-05T01:30:00Z"},
+		{"0 0 1 * *", "2024-06-01T00:00:00Z"},
+		{"0 0 15 * 1", "2024-05-06T00:00:00Z"}, // day of month or Monday
+		{"0 8-10/2 * * 1-5", "2024-05-02T08:00:00Z"},
+		{"5,40 12 * * *", "2024-05-01T12:40:00Z"},
+		{"0 0 29 2 *", "2028-02-29T00:00:00Z"},
+		{"0 0 30 2 *", "0001-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.expr, err)
+		}
+		if got := s.Next(from).Format(time.RFC3339); got != tt.want {
+			t.Errorf("%q: next %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *", "@every 5m"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("%q: want error", expr)
+		}
+	}
+}
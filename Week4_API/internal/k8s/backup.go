@@ -0,0 +1,512 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/cron"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// gvrJobs is used to run backup Jobs in tenant namespaces.
+var gvrJobs = schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}
+
+const (
+	defaultBackupRedisImage    = "redis:7.2-alpine"
+	defaultBackupUploaderImage = "amazon/aws-cli:2.17.0"
+	defaultBackupRegion        = "us-east-1"
+
+	// backupCredentialsSecret holds the object storage credentials in each tenant namespace that ran a
+	// backup Job; it is kept in sync with BackupConfig.
+	backupCredentialsSecret = "paas-backup-credentials"
+	// LabelBackup marks backup Jobs and their pods with the backup id.
+	LabelBackup = "paas.io/backup"
+	// labelBackupInstance marks backup Jobs with their instance. It is not app.kubernetes.io/instance so
+	// that Job pods are not counted as instance pods.
+	labelBackupInstance = "paas.io/backup-instance"
+	// AnnotationRestoredFrom records on a RedisFailover the RDB file its data was seeded from.
+	AnnotationRestoredFrom = "paas.io/restored-from"
+	// AnnotationBackupSchedule holds the JSON-encoded models.BackupSchedule of a RedisFailover.
+	AnnotationBackupSchedule = "paas.io/backup-schedule"
+
+	maxBackupKeepLast = 100
+
+	backupJobBackoffLimit = 1
+	backupJobDeadline     = 3600  // seconds
+	backupJobTTL          = 86400 // seconds finished Jobs are kept for BackupStatus
+)
+
+// ErrBackupsDisabled is returned by BackupJobs when no backup bucket is configured.
+var ErrBackupsDisabled = errors.New("backups are not configured")
+
+// ErrInvalidRestore is returned when a create request's cloneFrom or restoreFrom cannot be used.
+var ErrInvalidRestore = errors.New("invalid restore source")
+
+// ErrInvalidSchedule is returned when a backup schedule cannot be parsed.
+var ErrInvalidSchedule = errors.New("invalid backup schedule")
+
+// restoreKeyPattern limits restorable object keys to the characters of backup locations.
+var restoreKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+(/[A-Za-z0-9._-]+)*$`)
+
+// BackupConfig selects the S3-compatible bucket instance backups are written to (MinIO works as well).
+// Backups are disabled while Bucket is empty.
+type BackupConfig struct {
+	Endpoint      string // e.g. "http://minio.minio.svc:9000"; empty uses AWS S3
+	Region        string // default "us-east-1"
+	Bucket        string
+	AccessKey     string
+	SecretKey     string
+	RedisImage    string // runs redis-cli for the snapshot; default redis:7.2-alpine
+	UploaderImage string // runs the aws CLI; default amazon/aws-cli
+}
+
+// BackupJobs runs the Jobs that write instance backups to object storage and remove them again;
+// implemented by RedisFailoverStore.
+type BackupJobs interface {
+	// StartBackup starts a Job that snapshots the instance's master into an RDB file and uploads it, and
+	// returns the location ("s3://<bucket>/<key>") it is written to. Returns ErrNotFound if the instance
+	// does not exist and ErrBackupsDisabled without a bucket.
+	StartBackup(ctx context.Context, instanceID, backupID string) (string, error)
+	// BackupStatus reports the progress of the backup's Job; location is where StartBackup writes the
+	// RDB file to.
+	BackupStatus(ctx context.Context, backupID, location string) (*BackupStatus, error)
+	// DeleteBackupObject starts a Job that removes the RDB file at location and removes the backup's Jobs.
+	DeleteBackupObject(ctx context.Context, backupID, location string) error
+}
+
+// BackupStatus is the state of a backup Job; State takes the values of models.Backup.
+type BackupStatus struct {
+	State     string
+	SizeBytes int64  // size of the uploaded RDB file, once completed
+	Error     string // why the Job failed
+}
+
+// Ensure RedisFailoverStore implements BackupJobs.
+var _ BackupJobs = (*RedisFailoverStore)(nil)
+
+func backupJobName(backupID string) string       { return "backup-" + backupID }
+func backupDeleteJobName(backupID string) string { return "backup-delete-" + backupID }
+func backupVerifyJobName(backupID string) string { return "backup-verify-" + backupID }
+
+// StartBackup implements BackupJobs. The Job's init container triggers BGSAVE on the master, waits for it
+// to finish and streams a fresh RDB with redis-cli --rdb; the main container uploads it with the aws CLI
+// and reports the file size in its termination message. The Job fails if BGSAVE is refused or the save
+// fails (rdb_last_bgsave_status), e.g. when the master is out of disk or memory for the fork.
+func (s *RedisFailoverStore) StartBackup(ctx context.Context, instanceID, backupID string) (string, error) {
+	if s.backup.Bucket == "" {
+		return "", ErrBackupsDisabled
+	}
+	ns := namespaceFromContext(ctx, s.namespace)
+	if _, err := s.getFailover(ctx, ns, instanceID); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return "", fmt.Errorf("%w: %s", ErrNotFound, instanceID)
+		}
+		return "", fmt.Errorf("get redisfailover %q: %w", instanceID, err)
+	}
+	if err := s.ensureBackupCredentials(ctx, ns); err != nil {
+		return "", fmt.Errorf("backup credentials: %w", err)
+	}
+	location := fmt.Sprintf("s3://%s/%s/%s/%s.rdb", s.backup.Bucket, ns, instanceID, backupID)
+
+	snapshot := map[string]interface{}{
+		"name":    "snapshot",
+		"image":   orDefault(s.backup.RedisImage, defaultBackupRedisImage),
+		"command": []interface{}{"sh", "-c", backupSnapshotScript},
+		"env": []interface{}{
+			map[string]interface{}{"name": "REDIS_HOST", "value": "rfrm-" + instanceID},
+			secretEnv("REDISCLI_AUTH", instanceID+"-auth", "password"),
+		},
+		"volumeMounts":             []interface{}{map[string]interface{}{"name": "backup", "mountPath": "/backup"}},
+		"resources":                backupJobResources(),
+		"terminationMessagePolicy": "FallbackToLogsOnError",
+	}
+	upload := s.s3Container("upload", location, `aws $ENDPOINT_ARGS s3 cp /backup/dump.rdb "$TARGET"
+stat -c %s /backup/dump.rdb > /dev/termination-log`)
+	upload["volumeMounts"] = []interface{}{map[string]interface{}{"name": "backup", "mountPath": "/backup", "readOnly": true}}
+
+	job := backupJob(ns, backupJobName(backupID), instanceID, backupID, map[string]interface{}{
+		"restartPolicy":  "Never",
+		"initContainers": []interface{}{snapshot},
+		"containers":     []interface{}{upload},
+		"volumes":        []interface{}{map[string]interface{}{"name": "backup", "emptyDir": map[string]interface{}{}}},
+	})
+	if _, err := s.client.Resource(gvrJobs).Namespace(ns).Create(ctx, job, metav1.CreateOptions{}); err != nil {
+		return "", fmt.Errorf("create backup job: %w", err)
+	}
+	return location, nil
+}
+
+// backupSnapshotScript saves a fresh RDB on the master $REDIS_HOST and copies it to /backup/dump.rdb.
+// LASTSAVE only changes on a successful save; once the save we waited for is no longer in progress,
+// rdb_last_bgsave_status:err means it failed. A save that is already in progress is waited for like our
+// own; a scheduled one (after an AOF rewrite) only once it has started.
+const backupSnapshotScript = `set -e
+persistence() { redis-cli -h "$REDIS_HOST" INFO persistence | tr -d '\r' | sed -n "s/^$1://p"; }
+before=$(redis-cli -h "$REDIS_HOST" LASTSAVE)
+reply=$(redis-cli -h "$REDIS_HOST" BGSAVE SCHEDULE 2>&1)
+case "$reply" in
+  "Background saving started"|*"already in progress"*) started=1 ;;
+  "Background saving scheduled") started= ;;
+  *) echo "BGSAVE failed: $reply" >&2; exit 1 ;;
+esac
+while [ "$(redis-cli -h "$REDIS_HOST" LASTSAVE)" = "$before" ]; do
+  if [ "$(persistence rdb_bgsave_in_progress)" = 1 ]; then
+    started=1
+  elif [ -n "$started" ] && [ "$(persistence rdb_last_bgsave_status)" = err ]; then
+    echo "BGSAVE failed: rdb_last_bgsave_status:err" >&2
+    exit 1
+  fi
+  sleep 1
+done
+redis-cli -h "$REDIS_HOST" --rdb /backup/dump.rdb`
+
+// BackupStatus implements BackupJobs. A Job that no longer exists (e.g. removed after backupJobTTL before
+// anyone recorded its outcome) does not tell whether the upload finished; a verify Job then looks the RDB
+// file up in the bucket, and the backup completed if it exists.
+func (s *RedisFailoverStore) BackupStatus(ctx context.Context, backupID, location string) (*BackupStatus, error) {
+	ns := namespaceFromContext(ctx, s.namespace)
+	st, err := s.jobStatus(ctx, ns, backupJobName(backupID), "upload")
+	if k8serrors.IsNotFound(err) {
+		return s.verifyBackupObject(ctx, ns, backupID, location)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get backup job: %w", err)
+	}
+	return st, nil
+}
+
+// verifyBackupObject reports the backup as running while its verify Job (started on the first call) looks
+// up the RDB file at location, and as completed with the file's size or failed once it finished.
+func (s *RedisFailoverStore) verifyBackupObject(ctx context.Context, ns, backupID, location string) (*BackupStatus, error) {
+	if location == "" || s.backup.Bucket == "" {
+		return &BackupStatus{State: models.BackupFailed, Error: "backup job no longer exists"}, nil
+	}
+	name := backupVerifyJobName(backupID)
+	st, err := s.jobStatus(ctx, ns, name, "verify")
+	if k8serrors.IsNotFound(err) {
+		if err := s.ensureBackupCredentials(ctx, ns); err != nil {
+			return nil, fmt.Errorf("backup credentials: %w", err)
+		}
+		// aws s3 ls prints "<date> <time> <size> <key>" and fails if there is no such object.
+		job := backupJob(ns, name, "", backupID, map[string]interface{}{
+			"restartPolicy": "Never",
+			"containers": []interface{}{s.s3Container("verify", location, `listing=$(aws $ENDPOINT_ARGS s3 ls "$TARGET")
+echo "$listing" | awk '{print $3}' > /dev/termination-log`)},
+		})
+		if _, err := s.client.Resource(gvrJobs).Namespace(ns).Create(ctx, job, metav1.CreateOptions{}); err != nil && !k8serrors.IsAlreadyExists(err) {
+			return nil, fmt.Errorf("create backup verify job: %w", err)
+		}
+		return &BackupStatus{State: models.BackupRunning}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get backup verify job: %w", err)
+	}
+	if st.State == models.BackupFailed {
+		st.Error = "backup job no longer exists and its RDB file was not found: " + st.Error
+	}
+	return st, nil
+}
+
+// jobStatus maps the conditions of the Job ns/name onto a BackupStatus. A completed Job reports the size
+// written to the termination message of its container sizeContainer. Returns a Kubernetes NotFound error
+// if the Job does not exist.
+func (s *RedisFailoverStore) jobStatus(ctx context.Context, ns, name, sizeContainer string) (*BackupStatus, error) {
+	job, err := s.client.Resource(gvrJobs).Namespace(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	conditions, _, _ := unstructured.NestedSlice(job.Object, "status", "conditions")
+	for _, c := range conditions {
+		m, ok := c.(map[string]interface{})
+		if !ok || m["status"] != "True" {
+			continue
+		}
+		switch m["type"] {
+		case "Complete":
+			st := &BackupStatus{State: models.BackupCompleted}
+			if msg, _ := s.jobTerminationMessage(ctx, ns, name, sizeContainer, true); msg != "" {
+				st.SizeBytes, _ = strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+			}
+			return st, nil
+		case "Failed":
+			reason, _ := m["message"].(string)
+			if msg, _ := s.jobTerminationMessage(ctx, ns, name, "", false); msg != "" {
+				reason = msg
+			}
+			return &BackupStatus{State: models.BackupFailed, Error: reason}, nil
+		}
+	}
+	return &BackupStatus{State: models.BackupRunning}, nil
+}
+
+// DeleteBackupObject implements BackupJobs.
+func (s *RedisFailoverStore) DeleteBackupObject(ctx context.Context, backupID, location string) error {
+	if s.backup.Bucket == "" {
+		return ErrBackupsDisabled
+	}
+	ns := namespaceFromContext(ctx, s.namespace)
+	background := metav1.DeletePropagationBackground
+	for _, name := range []string{backupJobName(backupID), backupVerifyJobName(backupID)} {
+		err := s.client.Resource(gvrJobs).Namespace(ns).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &background})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("delete backup job %s: %w", name, err)
+		}
+	}
+	if location == "" {
+		return nil
+	}
+	if err := s.ensureBackupCredentials(ctx, ns); err != nil {
+		return fmt.Errorf("backup credentials: %w", err)
+	}
+	job := backupJob(ns, backupDeleteJobName(backupID), "", backupID, map[string]interface{}{
+		"restartPolicy": "Never",
+		"containers":    []interface{}{s.s3Container("delete", location, `aws $ENDPOINT_ARGS s3 rm "$TARGET"`)},
+	})
+	if _, err := s.client.Resource(gvrJobs).Namespace(ns).Create(ctx, job, metav1.CreateOptions{}); err != nil && !k8serrors.IsAlreadyExists(err) {
+		return fmt.Errorf("create backup delete job: %w", err)
+	}
+	return nil
+}
+
+// ValidateBackupSchedule checks the cron expression and retention of a backup schedule.
+func ValidateBackupSchedule(s models.BackupSchedule) error {
+	if _, err := cron.Parse(s.Cron); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	if s.KeepLast < 0 || s.KeepLast > maxBackupKeepLast {
+		return fmt.Errorf("%w: keepLast must be between 0 and %d, got %d", ErrInvalidSchedule, maxBackupKeepLast, s.KeepLast)
+	}
+	if s.MaxAge != "" {
+		if d, err := time.ParseDuration(s.MaxAge); err != nil || d < time.Hour {
+			return fmt.Errorf("%w: maxAge must be a duration of at least 1h, got %q", ErrInvalidSchedule, s.MaxAge)
+		}
+	}
+	return nil
+}
+
+// checkBackupSchedules returns ErrBackupsDisabled unless backup schedules are taken (see
+// StoreConfig.BackupSchedules): without the BackupScheduler an accepted schedule would never run.
+func (s *RedisFailoverStore) checkBackupSchedules() error {
+	if s.backup.Bucket == "" || !s.backupSchedules {
+		return fmt.Errorf("%w: backup schedules need a backup bucket and DATABASE_URL", ErrBackupsDisabled)
+	}
+	return nil
+}
+
+// backupScheduleOf returns the backup schedule of a RedisFailover, or nil if it has none (or an
+// unreadable one).
+func backupScheduleOf(obj *unstructured.Unstructured) *models.BackupSchedule {
+	raw := obj.GetAnnotations()[AnnotationBackupSchedule]
+	if raw == "" {
+		return nil
+	}
+	var s models.BackupSchedule
+	if err := json.Unmarshal([]byte(raw), &s); err != nil || s.Cron == "" {
+		return nil
+	}
+	return &s
+}
+
+// ScheduledBackup is an instance with a backup schedule.
+type ScheduledBackup struct {
+	InstanceKey
+	Schedule  models.BackupSchedule
+	CreatedAt time.Time // of the RedisFailover
+}
+
+// BackupSchedules returns the instances with a backup schedule in all namespaces, from the informer cache
+// once it has synced.
+func (s *RedisFailoverStore) BackupSchedules(ctx context.Context) ([]ScheduledBackup, error) {
+	objs, err := s.listFailovers(ctx, metav1.NamespaceAll)
+	if err != nil {
+		return nil, fmt.Errorf("list redisfailovers: %w", err)
+	}
+	var out []ScheduledBackup
+	for _, obj := range objs {
+		if sched := backupScheduleOf(obj); sched != nil {
+			out = append(out, ScheduledBackup{
+				InstanceKey: InstanceKey{Namespace: obj.GetNamespace(), Name: obj.GetName()},
+				Schedule:    *sched,
+				CreatedAt:   obj.GetCreationTimestamp().Time,
+			})
+		}
+	}
+	return out, nil
+}
+
+// restoreData validates rdbURL and fills in the restore init container of data. Tenants can only restore
+// files below their namespace in the backup bucket, i.e. their own backups.
+func (s *RedisFailoverStore) restoreData(ctx context.Context, ns, rdbURL string, data *RedisFailoverTemplateData) error {
+	if s.backup.Bucket == "" {
+		return ErrBackupsDisabled
+	}
+	prefix := fmt.Sprintf("s3://%s/%s/", s.backup.Bucket, ns)
+	key, ok := strings.CutPrefix(rdbURL, prefix)
+	if !ok || !restoreKeyPattern.MatchString(key) {
+		return fmt.Errorf("%w: restoreFrom.rdbUrl must be an object below %s", ErrInvalidRestore, prefix)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "." || segment == ".." {
+			return fmt.Errorf("%w: restoreFrom.rdbUrl must be an object below %s", ErrInvalidRestore, prefix)
+		}
+	}
+	if err := s.ensureBackupCredentials(ctx, ns); err != nil {
+		return fmt.Errorf("backup credentials: %w", err)
+	}
+	data.RestoreFrom = rdbURL
+	data.RestoreImage = orDefault(s.backup.UploaderImage, defaultBackupUploaderImage)
+	data.RestoreEndpoint = s.backup.Endpoint
+	data.RestoreRegion = orDefault(s.backup.Region, defaultBackupRegion)
+	data.RestoreSecret = backupCredentialsSecret
+	return nil
+}
+
+// ensureBackupCredentials creates or updates the object storage credentials Secret in ns.
+func (s *RedisFailoverStore) ensureBackupCredentials(ctx context.Context, ns string) error {
+	stringData := map[string]interface{}{
+		"AWS_ACCESS_KEY_ID":     s.backup.AccessKey,
+		"AWS_SECRET_ACCESS_KEY": s.backup.SecretKey,
+	}
+	secrets := s.client.Resource(gvrSecrets).Namespace(ns)
+	existing, err := secrets.Get(ctx, backupCredentialsSecret, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata": map[string]interface{}{
+				"name":      backupCredentialsSecret,
+				"namespace": ns,
+				"labels":    map[string]interface{}{LabelManagedBy: managedByValue},
+			},
+			"stringData": stringData,
+			"type":       "Opaque",
+		}}
+		_, err = secrets.Create(ctx, obj, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	existing.Object["stringData"] = stringData
+	_, err = secrets.Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}
+
+// s3Container returns a container running script with the aws CLI against the backup bucket. The script
+// sees the object as $TARGET and the endpoint flags as $ENDPOINT_ARGS; custom endpoints use path-style
+// addressing, as MinIO expects.
+func (s *RedisFailoverStore) s3Container(name, location, script string) map[string]interface{} {
+	prelude := "set -e\nENDPOINT_ARGS=\n"
+	if s.backup.Endpoint != "" {
+		prelude += `aws configure set default.s3.addressing_style path
+ENDPOINT_ARGS="--endpoint-url $S3_ENDPOINT"
+`
+	}
+	return map[string]interface{}{
+		"name":    name,
+		"image":   orDefault(s.backup.UploaderImage, defaultBackupUploaderImage),
+		"command": []interface{}{"sh", "-c", prelude + script},
+		"env": []interface{}{
+			map[string]interface{}{"name": "TARGET", "value": location},
+			map[string]interface{}{"name": "S3_ENDPOINT", "value": s.backup.Endpoint},
+			map[string]interface{}{"name": "AWS_DEFAULT_REGION", "value": orDefault(s.backup.Region, defaultBackupRegion)},
+			secretEnv("AWS_ACCESS_KEY_ID", backupCredentialsSecret, "AWS_ACCESS_KEY_ID"),
+			secretEnv("AWS_SECRET_ACCESS_KEY", backupCredentialsSecret, "AWS_SECRET_ACCESS_KEY"),
+		},
+		"resources":                backupJobResources(),
+		"terminationMessagePolicy": "FallbackToLogsOnError",
+	}
+}
+
+// backupJob returns a Job labelled with the backup (and instance, if set) running podSpec once.
+func backupJob(ns, name, instanceID, backupID string, podSpec map[string]interface{}) *unstructured.Unstructured {
+	labels := map[string]interface{}{LabelManagedBy: managedByValue, LabelBackup: backupID}
+	if instanceID != "" {
+		labels[labelBackupInstance] = instanceID
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": ns,
+			"labels":    labels,
+		},
+		"spec": map[string]interface{}{
+			"backoffLimit":            int64(backupJobBackoffLimit),
+			"activeDeadlineSeconds":   int64(backupJobDeadline),
+			"ttlSecondsAfterFinished": int64(backupJobTTL),
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": labels},
+				"spec":     podSpec,
+			},
+		},
+	}}
+}
+
+// backupJobResources keeps backup Jobs within the tenant quota (see Quota).
+func backupJobResources() map[string]interface{} {
+	return map[string]interface{}{
+		"requests": map[string]interface{}{"cpu": "50m", "memory": "64Mi"},
+		"limits":   map[string]interface{}{"cpu": "500m", "memory": "512Mi"},
+	}
+}
+
+func secretEnv(name, secret, key string) map[string]interface{} {
+	return map[string]interface{}{
+		"name": name,
+		"valueFrom": map[string]interface{}{
+			"secretKeyRef": map[string]interface{}{"name": secret, "key": key},
+		},
+	}
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+// jobTerminationMessage returns the termination message of a container of the Job's pods: of the named
+// container that exited successfully, or (container "", succeeded false) of the first one that failed.
+func (s *RedisFailoverStore) jobTerminationMessage(ctx context.Context, ns, job, container string, succeeded bool) (string, error) {
+	pods, err := s.client.Resource(gvrPods).Namespace(ns).List(ctx, metav1.ListOptions{LabelSelector: "job-name=" + job})
+	if err != nil {
+		return "", err
+	}
+	for _, pod := range pods.Items {
+		for _, field := range []string{"initContainerStatuses", "containerStatuses"} {
+			statuses, _, _ := unstructured.NestedSlice(pod.Object, "status", field)
+			for _, cs := range statuses {
+				m, ok := cs.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				name, _, _ := unstructured.NestedString(m, "name")
+				exitCode, found, _ := unstructured.NestedInt64(m, "state", "terminated", "exitCode")
+				if !found || (container != "" && name != container) || (exitCode == 0) != succeeded {
+					continue
+				}
+				msg, _, _ := unstructured.NestedString(m, "state", "terminated", "message")
+				if !succeeded && msg == "" {
+					reason, _, _ := unstructured.NestedString(m, "state", "terminated", "reason")
+					msg = fmt.Sprintf("container %s: %s (exit code %d)", name, reason, exitCode)
+				}
+				return msg, nil
+			}
+		}
+	}
+	return "", nil
+}
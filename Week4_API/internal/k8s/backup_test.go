@@ -0,0 +1,234 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestBackupJobs(t *testing.T) {
+	const ns = "tenant-alice"
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		gvrRedisFailover: "RedisFailoverList",
+		gvrPods:          "PodList",
+		gvrSecrets:       "SecretList",
+		gvrJobs:          "JobList",
+	},
+		testObject("databases.spotahome.com/v1", "RedisFailover", ns, "cache", nil, nil),
+	)
+	ctx := WithNamespace(context.Background(), ns)
+
+	disabled := NewRedisFailoverStore(client, StoreConfig{})
+	if _, err := disabled.StartBackup(ctx, "cache", "b1"); !errors.Is(err, ErrBackupsDisabled) {
+		t.Fatalf("without bucket: %v", err)
+	}
+
+	store := NewRedisFailoverStore(client, StoreConfig{Backup: BackupConfig{Bucket: "backups", Endpoint: "http://minio:9000", AccessKey: "k", SecretKey: "s"}})
+	if _, err := store.StartBackup(ctx, "missing", "b1"); err == nil {
+		t.Fatal("backup of missing instance: want error")
+	}
+	location, err := store.StartBackup(ctx, "cache", "b1")
+	if err != nil {
+		t.Fatalf("start backup: %v", err)
+	}
+	if location != "s3://backups/tenant-alice/cache/b1.rdb" {
+		t.Fatalf("location %q", location)
+	}
+	job, err := client.Resource(gvrJobs).Namespace(ns).Get(ctx, "backup-b1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("backup job: %v", err)
+	}
+	if job.GetLabels()[LabelBackup] != "b1" || job.GetLabels()[labelBackupInstance] != "cache" {
+		t.Fatalf("job labels %v", job.GetLabels())
+	}
+	if _, err := client.Resource(gvrSecrets).Namespace(ns).Get(ctx, backupCredentialsSecret, metav1.GetOptions{}); err != nil {
+		t.Fatalf("credentials secret: %v", err)
+	}
+
+	if st, err := store.BackupStatus(ctx, "b1", location); err != nil || st.State != models.BackupRunning {
+		t.Fatalf("running: %+v, %v", st, err)
+	}
+	_ = unstructured.SetNestedSlice(job.Object, []interface{}{map[string]interface{}{"type": "Complete", "status": "True"}}, "status", "conditions")
+	if _, err := client.Resource(gvrJobs).Namespace(ns).Update(ctx, job, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	pod := testObject("v1", "Pod", ns, "backup-b1-x", map[string]interface{}{"job-name": "backup-b1"}, map[string]interface{}{
+		"status": map[string]interface{}{"containerStatuses": []interface{}{map[string]interface{}{
+			"name":  "upload",
+			"state": map[string]interface{}{"terminated": map[string]interface{}{"exitCode": int64(0), "message": "1024\n"}},
+		}}},
+	})
+	if _, err := client.Resource(gvrPods).Namespace(ns).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := store.BackupStatus(ctx, "b1", location); err != nil || st.State != models.BackupCompleted || st.SizeBytes != 1024 {
+		t.Fatalf("completed: %+v, %v", st, err)
+	}
+
+	if err := store.DeleteBackupObject(ctx, "b1", location); err != nil {
+		t.Fatalf("delete backup: %v", err)
+	}
+	if _, err := client.Resource(gvrJobs).Namespace(ns).Get(ctx, "backup-delete-b1", metav1.GetOptions{}); err != nil {
+		t.Fatalf("delete job: %v", err)
+	}
+
+	// Once the Job is gone, a verify Job decides whether the RDB file was uploaded.
+	if st, err := store.BackupStatus(ctx, "b1", location); err != nil || st.State != models.BackupRunning {
+		t.Fatalf("after job removal: %+v, %v", st, err)
+	}
+	verify, err := client.Resource(gvrJobs).Namespace(ns).Get(ctx, "backup-verify-b1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("verify job: %v", err)
+	}
+	_ = unstructured.SetNestedSlice(verify.Object, []interface{}{map[string]interface{}{"type": "Failed", "status": "True", "message": "BackoffLimitExceeded"}}, "status", "conditions")
+	if _, err := client.Resource(gvrJobs).Namespace(ns).Update(ctx, verify, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := store.BackupStatus(ctx, "b1", location); err != nil || st.State != models.BackupFailed || !strings.Contains(st.Error, "not found") {
+		t.Fatalf("missing RDB file: %+v, %v", st, err)
+	}
+	_ = unstructured.SetNestedSlice(verify.Object, []interface{}{map[string]interface{}{"type": "Complete", "status": "True"}}, "status", "conditions")
+	if _, err := client.Resource(gvrJobs).Namespace(ns).Update(ctx, verify, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	verifyPod := testObject("v1", "Pod", ns, "backup-verify-b1-x", map[string]interface{}{"job-name": "backup-verify-b1"}, map[string]interface{}{
+		"status": map[string]interface{}{"containerStatuses": []interface{}{map[string]interface{}{
+			"name":  "verify",
+			"state": map[string]interface{}{"terminated": map[string]interface{}{"exitCode": int64(0), "message": "2048\n"}},
+		}}},
+	})
+	if _, err := client.Resource(gvrPods).Namespace(ns).Create(ctx, verifyPod, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := store.BackupStatus(ctx, "b1", location); err != nil || st.State != models.BackupCompleted || st.SizeBytes != 2048 {
+		t.Fatalf("uploaded RDB file: %+v, %v", st, err)
+	}
+}
+
+func TestCreateInstance_RestoreFrom(t *testing.T) {
+	store := newFakeStore(Quota{})
+	ctx, err := WithTenant(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("tenant: %v", err)
+	}
+	restore := func(name, rdbURL string) (*models.RedisInstance, error) {
+		return store.CreateInstance(ctx, models.CreateRedisRequest{Name: name, RestoreFrom: &models.RestoreSource{RDBURL: rdbURL}})
+	}
+	const location = "s3://backups/tenant-alice/cache/b1.rdb"
+	if _, err := restore("a", location); !errors.Is(err, ErrBackupsDisabled) {
+		t.Fatalf("without bucket: %v", err)
+	}
+	store.backup = BackupConfig{Bucket: "backups", Endpoint: "http://minio:9000"}
+	for _, rdbURL := range []string{
+		"s3://backups/tenant-bob/cache/b1.rdb",
+		"s3://other/tenant-alice/cache/b1.rdb",
+		"s3://backups/tenant-alice/../tenant-bob/b1.rdb",
+		"s3://backups/tenant-alice/",
+	} {
+		if _, err := restore("a", rdbURL); !errors.Is(err, ErrInvalidRestore) {
+			t.Fatalf("restore from %q: %v, want ErrInvalidRestore", rdbURL, err)
+		}
+	}
+	req := models.CreateRedisRequest{Name: "a", CloneFrom: &models.CloneSource{InstanceID: "cache"}, RestoreFrom: &models.RestoreSource{RDBURL: location}}
+	if _, err := store.CreateInstance(ctx, req); !errors.Is(err, ErrInvalidRestore) {
+		t.Fatalf("cloneFrom with restoreFrom: %v", err)
+	}
+
+	inst, err := restore("a", location)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if inst.RestoredFrom != location {
+		t.Fatalf("restoredFrom %q", inst.RestoredFrom)
+	}
+	obj, err := store.client.Resource(gvrRedisFailover).Namespace("tenant-alice").Get(ctx, "a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	initContainers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "redis", "initContainers")
+	if len(initContainers) != 1 {
+		t.Fatalf("init containers %v", initContainers)
+	}
+	c := initContainers[0].(map[string]interface{})
+	env := map[string]interface{}{}
+	for _, e := range c["env"].([]interface{}) {
+		m := e.(map[string]interface{})
+		env[m["name"].(string)] = m["value"]
+	}
+	mounts, _, _ := unstructured.NestedSlice(c, "volumeMounts")
+	if env["SOURCE"] != location || env["S3_ENDPOINT"] != "http://minio:9000" || len(mounts) != 1 || mounts[0].(map[string]interface{})["name"] != "a-data" {
+		t.Fatalf("restore container %v", c)
+	}
+
+	// Instances without a restore source have no init container.
+	if _, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	obj, _ = store.client.Resource(gvrRedisFailover).Namespace("tenant-alice").Get(ctx, "b", metav1.GetOptions{})
+	if _, found, _ := unstructured.NestedSlice(obj.Object, "spec", "redis", "initContainers"); found || obj.GetAnnotations()[AnnotationRestoredFrom] != "" {
+		t.Fatalf("instance b: %v", obj.Object)
+	}
+}
+
+func TestBackupSchedule_CreateAndPatch(t *testing.T) {
+	store := newFakeStore(Quota{})
+	ctx, err := WithTenant(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("tenant: %v", err)
+	}
+	schedule := &models.BackupSchedule{Cron: "0 3 * * *", KeepLast: 3}
+	if _, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: "a", BackupSchedule: schedule}); !errors.Is(err, ErrBackupsDisabled) {
+		t.Fatalf("without bucket: %v", err)
+	}
+	// Without the BackupScheduler (no DATABASE_URL) schedules would never run.
+	store.backup = BackupConfig{Bucket: "backups"}
+	if _, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: "a", BackupSchedule: schedule}); !errors.Is(err, ErrBackupsDisabled) {
+		t.Fatalf("without scheduler: %v", err)
+	}
+	store.backupSchedules = true
+	for _, invalid := range []models.BackupSchedule{{Cron: "every day"}, {Cron: "@daily", KeepLast: -1}, {Cron: "@daily", MaxAge: "10m"}} {
+		if _, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: "a", BackupSchedule: &invalid}); !errors.Is(err, ErrInvalidSchedule) {
+			t.Fatalf("schedule %+v: %v, want ErrInvalidSchedule", invalid, err)
+		}
+	}
+	inst, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: "a", BackupSchedule: schedule})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if inst.BackupSchedule == nil || *inst.BackupSchedule != *schedule {
+		t.Fatalf("schedule %+v", inst.BackupSchedule)
+	}
+	if _, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	scheduled, err := store.BackupSchedules(context.Background())
+	if err != nil || len(scheduled) != 1 || scheduled[0].Name != "a" || scheduled[0].Namespace != "tenant-alice" {
+		t.Fatalf("schedules %+v, %v", scheduled, err)
+	}
+
+	// Name and schedule on an instance without annotations; then change and remove the schedule.
+	name := "B"
+	inst, err = store.PatchInstance(ctx, "b", models.PatchInstanceRequest{Name: &name, BackupSchedule: &models.BackupSchedule{Cron: "@hourly", MaxAge: "24h"}})
+	if err != nil || inst.Name != "B" || inst.BackupSchedule == nil || inst.BackupSchedule.MaxAge != "24h" {
+		t.Fatalf("patch b: %+v, %v", inst, err)
+	}
+	if inst, err = store.PatchInstance(ctx, "a", models.PatchInstanceRequest{BackupSchedule: &models.BackupSchedule{Cron: "@weekly"}}); err != nil || inst.BackupSchedule.Cron != "@weekly" {
+		t.Fatalf("change schedule: %+v, %v", inst, err)
+	}
+	for i := 0; i < 2; i++ { // removing twice is fine
+		if inst, err = store.PatchInstance(ctx, "a", models.PatchInstanceRequest{BackupSchedule: &models.BackupSchedule{}}); err != nil || inst.BackupSchedule != nil {
+			t.Fatalf("remove schedule: %+v, %v", inst, err)
+		}
+	}
+	if scheduled, _ := store.BackupSchedules(context.Background()); len(scheduled) != 1 || scheduled[0].Name != "b" {
+		t.Fatalf("schedules after patch %+v", scheduled)
+	}
+}
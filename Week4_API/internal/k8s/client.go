@@ -8,11 +8,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
 
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -38,8 +40,12 @@ type InstanceStore interface {
 	ListInstances(ctx context.Context) ([]models.RedisInstance, error)
 	GetInstance(ctx context.Context, id string) (*models.RedisInstance, error)
 	CreateInstance(ctx context.Context, req models.CreateRedisRequest) (*models.RedisInstance, error)
+	ValidateCreate(ctx context.Context, req models.CreateRedisRequest) error
 	PatchInstance(ctx context.Context, id string, req models.PatchInstanceRequest) (*models.RedisInstance, error)
 	DeleteInstance(ctx context.Context, id string) error
+	InstanceProgress(ctx context.Context, id string) (*models.InstanceProgress, error)
+	GetCredentials(ctx context.Context, id string) (*models.InstanceCredentials, error)
+	ListStorageClasses(ctx context.Context) ([]models.StorageClass, error)
 }
 
 // namespaceKey is used to store the target namespace in the context for multi-tenant operation.
@@ -94,51 +100,105 @@ func NewDynamicClient(kubeConfigPath string) (dynamic.Interface, error) {
 }
 
 // RedisFailoverStore implements InstanceStore using RedisFailover CRs (Spotahome Redis operator).
-// All instance operations go through the dynamic client; the operator handles the actual Redis/Sentinel workloads.
+// All writes go through the dynamic client; reads use shared informers once StartInformers was called and
+// they have synced. The operator handles the actual Redis/Sentinel workloads.
 type RedisFailoverStore struct {
 	client              dynamic.Interface
 	namespace           string
 	templatePath        string
 	defaultStorageClass string
+	storageClasses      []string
+	quota               Quota
+	plans               *PlanCatalog
+	backup              BackupConfig
+	backupSchedules     bool
+	admin               RedisAdmin
+	cache               *instanceCache // nil until StartInformers
+}
+
+// StoreConfig configures a RedisFailoverStore.
+type StoreConfig struct {
+	Namespace           string       // used when the context carries no namespace (see WithNamespace)
+	TemplatePath        string       // RedisFailover template
+	DefaultStorageClass string       // used when CreateRedisRequest.StorageClass is empty
+	StorageClasses      []string     // StorageClasses instances may use; empty allows all
+	Quota               Quota        // per-tenant quota; the zero Quota disables it
+	Plans               *PlanCatalog // plan catalog; nil uses DefaultPlans
+	Backup              BackupConfig // object storage for backups; the zero value disables them
+	RedisAdmin          RedisAdmin   // reconfigures passwords on the pods; nil disables password rotation
+	BackupSchedules     bool         // the BackupScheduler runs (bucket and DATABASE_URL); false rejects backup schedules
 }
 
 // NewRedisFailoverStore returns a store that lists/creates/updates/deletes RedisFailover CRs.
-// defaultStorageClass is used when CreateRedisRequest.StorageClass is empty (e.g. from config).
-func NewRedisFailoverStore(client dynamic.Interface, namespace, templatePath, defaultStorageClass string) *RedisFailoverStore {
+func NewRedisFailoverStore(client dynamic.Interface, cfg StoreConfig) *RedisFailoverStore {
+	plans := cfg.Plans
+	if plans == nil {
+		plans, _ = NewPlanCatalog(DefaultPlans())
+	}
 	return &RedisFailoverStore{
 		client:              client,
-		namespace:           namespace,
-		templatePath:        templatePath,
-		defaultStorageClass: defaultStorageClass,
+		namespace:           cfg.Namespace,
+		templatePath:        cfg.TemplatePath,
+		defaultStorageClass: cfg.DefaultStorageClass,
+		storageClasses:      cfg.StorageClasses,
+		quota:               cfg.Quota,
+		plans:               plans,
+		backup:              cfg.Backup,
+		backupSchedules:     cfg.BackupSchedules,
+		admin:               cfg.RedisAdmin,
 	}
 }
 
-// EnsureNamespace creates the namespace if it does not exist (for per-user tenant namespaces).
+// EnsureNamespace creates the namespace if it does not exist (for per-user tenant namespaces) and installs
+// the tenant ResourceQuota and LimitRange in new namespaces. Under a WithTenant context the namespace is
+// labelled with the tenant, and an existing namespace annotated for a different tenant is refused with
+// ErrNamespaceConflict.
 func (s *RedisFailoverStore) EnsureNamespace(ctx context.Context, ns string) error {
 	if ns == "" {
 		return fmt.Errorf("namespace is required")
 	}
+	tenant := tenantFromContext(ctx)
 	nsClient := s.client.Resource(gvrNamespaces)
-	_, err := nsClient.Get(ctx, ns, metav1.GetOptions{})
+	var err error
+	existing := s.cachedNamespace(ns)
+	if existing == nil {
+		existing, err = nsClient.Get(ctx, ns, metav1.GetOptions{})
+	}
 	if err == nil {
+		if owner := existing.GetAnnotations()[AnnotationTenant]; tenant != "" && owner != "" && owner != tenant {
+			return fmt.Errorf("%w: %q", ErrNamespaceConflict, ns)
+		}
 		return nil
 	}
 	if !k8serrors.IsNotFound(err) {
 		return fmt.Errorf("get namespace %q: %w", ns, err)
 	}
+	metadata := map[string]interface{}{
+		"name": ns,
+	}
+	if tenant != "" {
+		metadata["labels"] = map[string]interface{}{
+			LabelTenant:    shortenName(tenant, 63),
+			LabelManagedBy: managedByValue,
+		}
+		metadata["annotations"] = map[string]interface{}{
+			AnnotationTenant: tenant,
+		}
+	}
 	obj := &unstructured.Unstructured{
 		Object: map[string]interface{}{
 			"apiVersion": "v1",
 			"kind":       "Namespace",
-			"metadata": map[string]interface{}{
-				"name": ns,
-			},
+			"metadata":   metadata,
 		},
 	}
 	_, err = nsClient.Create(ctx, obj, metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("create namespace %q: %w", ns, err)
 	}
+	if err := s.ensureQuota(ctx, ns); err != nil {
+		return fmt.Errorf("namespace %q: %w", ns, err)
+	}
 	return nil
 }
 
@@ -149,18 +209,19 @@ func (s *RedisFailoverStore) ListInstances(ctx context.Context) ([]models.RedisI
 	if err := s.EnsureNamespace(ctx, ns); err != nil {
 		return nil, fmt.Errorf("ensure namespace: %w", err)
 	}
-	list, err := s.client.Resource(gvrRedisFailover).Namespace(ns).List(ctx, metav1.ListOptions{})
+	list, err := s.listFailovers(ctx, ns)
 	if err != nil {
 		return nil, fmt.Errorf("list redisfailovers: %w", err)
 	}
 	var instances []models.RedisInstance
-	for i := range list.Items {
-		inst := redisfailoverToModel(&list.Items[i])
+	for _, obj := range list {
+		inst := redisfailoverToModel(obj)
 		if inst != nil {
 			if inst.Status == "unknown" {
 				inst.Status = s.inferStatusFromPods(ctx, inst.Name)
 			}
 			s.attachConnectionInfo(ctx, inst)
+			s.attachStorageResize(ctx, inst)
 			instances = append(instances, *inst)
 		}
 	}
@@ -168,10 +229,11 @@ func (s *RedisFailoverStore) ListInstances(ctx context.Context) ([]models.RedisI
 }
 
 // GetInstance returns a single RedisFailover by name (id). Returns ErrNotFound if the CR does not exist.
-// If the CR has no status (e.g. Spotahome operator), status is inferred from the instance's pods.
+// If the CR has no status (e.g. Spotahome operator), status is inferred from the instance's pods; volumes
+// still growing to the capacity are reported in StorageResize.
 func (s *RedisFailoverStore) GetInstance(ctx context.Context, id string) (*models.RedisInstance, error) {
 	ns := namespaceFromContext(ctx, s.namespace)
-	obj, err := s.client.Resource(gvrRedisFailover).Namespace(ns).Get(ctx, id, metav1.GetOptions{})
+	obj, err := s.getFailover(ctx, ns, id)
 	if err != nil {
 		if k8serrors.IsNotFound(err) {
 			return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
@@ -183,24 +245,18 @@ func (s *RedisFailoverStore) GetInstance(ctx context.Context, id string) (*model
 		inst.Status = s.inferStatusFromPods(ctx, id)
 	}
 	s.attachConnectionInfo(ctx, inst)
+	s.attachStorageResize(ctx, inst)
+	return inst, nil
+}
 
-	// Fetch password from secret
-	secretName := id + "-auth"
-	secretObj, err := s.client.Resource(gvrSecrets).Namespace(ns).Get(ctx, secretName, metav1.GetOptions{})
-	if err == nil {
-		if data, found, _ := unstructured.NestedStringMap(secretObj.Object, "data"); found {
-			if encoded, ok := data["password"]; ok {
-				decoded, _ := base64.StdEncoding.DecodeString(encoded)
-				inst.Password = string(decoded)
-			}
-		} else if stringData, found, _ := unstructured.NestedStringMap(secretObj.Object, "stringData"); found {
-			if pwd, ok := stringData["password"]; ok {
-				inst.Password = pwd
-			}
-		}
+// secretValue returns the decoded value of key in the Secret's data or, if it has no data, its stringData.
+func secretValue(secret *unstructured.Unstructured, key string) string {
+	if data, found, _ := unstructured.NestedStringMap(secret.Object, "data"); found {
+		decoded, _ := base64.StdEncoding.DecodeString(data[key])
+		return string(decoded)
 	}
-
-	return inst, nil
+	stringData, _, _ := unstructured.NestedStringMap(secret.Object, "stringData")
+	return stringData[key]
 }
 
 // generatePassword generates a random hex string for the password.
@@ -212,7 +268,8 @@ func generatePassword() (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
-// createSecret creates a Secret with the given password in stringData.
+// createSecret creates a Secret with the given password in stringData. It is labelled managed-by paas-api
+// so the secrets informer picks it up.
 func (s *RedisFailoverStore) createSecret(ctx context.Context, ns, name, password string) error {
 	obj := &unstructured.Unstructured{
 		Object: map[string]interface{}{
@@ -221,9 +278,10 @@ func (s *RedisFailoverStore) createSecret(ctx context.Context, ns, name, passwor
 			"metadata": map[string]interface{}{
 				"name":      name,
 				"namespace": ns,
+				"labels":    map[string]interface{}{LabelManagedBy: managedByValue},
 			},
 			"stringData": map[string]interface{}{
-				"password": password,
+				secretKeyPassword: password,
 			},
 			"type": "Opaque",
 		},
@@ -232,32 +290,89 @@ func (s *RedisFailoverStore) createSecret(ctx context.Context, ns, name, passwor
 	return err
 }
 
-// CreateInstance implements template → create: validate request, render RedisFailover from template, decode YAML, then create CR via dynamic client.
-func (s *RedisFailoverStore) CreateInstance(ctx context.Context, req models.CreateRedisRequest) (*models.RedisInstance, error) {
+// ValidateCreate runs the checks of CreateInstance without creating the instance: the request, its plan,
+// the name, the StorageClass, the tenant quota and, for a backup schedule, the backup bucket. The API
+// calls it before it starts the backup a clone is seeded from.
+func (s *RedisFailoverStore) ValidateCreate(ctx context.Context, req models.CreateRedisRequest) error {
+	_, err := s.prepareCreate(ctx, req)
+	return err
+}
+
+// prepareCreate validates req, ensures the tenant namespace and quota and returns the template data of
+// the new instance.
+func (s *RedisFailoverStore) prepareCreate(ctx context.Context, req models.CreateRedisRequest) (RedisFailoverTemplateData, error) {
 	if req.Name == "" {
-		return nil, fmt.Errorf("name is required")
-	}
-	if req.Capacity == "" {
-		return nil, fmt.Errorf("capacity is required")
+		return RedisFailoverTemplateData{}, fmt.Errorf("name is required")
 	}
 	if err := ValidateCreateRedisRequest(req); err != nil {
-		return nil, fmt.Errorf("validation: %w", err)
+		return RedisFailoverTemplateData{}, fmt.Errorf("validation: %w", err)
+	}
+	plan, planLabel, err := s.plans.resolvePlan(req)
+	if err != nil {
+		return RedisFailoverTemplateData{}, err
 	}
 	ns := namespaceFromContext(ctx, s.namespace)
 	if err := s.EnsureNamespace(ctx, ns); err != nil {
-		return nil, fmt.Errorf("ensure namespace: %w", err)
+		return RedisFailoverTemplateData{}, fmt.Errorf("ensure namespace: %w", err)
 	}
 	// If the instance CR already exists, do not touch the secret (it may be in use).
-	_, err := s.client.Resource(gvrRedisFailover).Namespace(ns).Get(ctx, req.Name, metav1.GetOptions{})
+	_, err = s.client.Resource(gvrRedisFailover).Namespace(ns).Get(ctx, req.Name, metav1.GetOptions{})
 	if err == nil {
-		return nil, fmt.Errorf("instance %q already exists", req.Name)
+		return RedisFailoverTemplateData{}, fmt.Errorf("instance %q already exists", req.Name)
 	}
 	if !k8serrors.IsNotFound(err) {
-		return nil, fmt.Errorf("get redisfailover: %w", err)
+		return RedisFailoverTemplateData{}, fmt.Errorf("get redisfailover: %w", err)
+	}
+	data := BuildRedisFailoverTemplateData(req, plan, planLabel, ns, s.defaultStorageClass, authSecretName(req.Name))
+	if err := validateResources(data); err != nil {
+		// Requests of the request above limits of the plan, or the other way round.
+		return RedisFailoverTemplateData{}, fmt.Errorf("validation: %w", err)
 	}
+	if err := validateMaxmemory(data); err != nil {
+		return RedisFailoverTemplateData{}, fmt.Errorf("validation: %w", err)
+	}
+	if data.StorageClass != "" {
+		if err := s.checkStorageClass(ctx, data.StorageClass); err != nil {
+			return RedisFailoverTemplateData{}, err
+		}
+	}
+	if err := s.checkQuota(ctx, ns, "", Usage{}, data); err != nil {
+		return RedisFailoverTemplateData{}, err
+	}
+	if req.BackupSchedule != nil {
+		if err := s.checkBackupSchedules(); err != nil {
+			return RedisFailoverTemplateData{}, err
+		}
+	}
+	return data, nil
+}
+
+// CreateInstance implements template → create: validate request, render RedisFailover from template, decode YAML, then create CR via dynamic client.
+// With RestoreFrom, an init container seeds the Redis data volumes with the RDB file before Redis starts.
+func (s *RedisFailoverStore) CreateInstance(ctx context.Context, req models.CreateRedisRequest) (*models.RedisInstance, error) {
+	data, err := s.prepareCreate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	ns, secretName := data.Namespace, data.SecretName
+	if req.CloneFrom != nil {
+		// The API turns clones into a restore of a fresh backup of the source instance.
+		return nil, fmt.Errorf("%w: cloneFrom is not supported by the store, use restoreFrom", ErrInvalidRestore)
+	}
+	if req.RestoreFrom != nil {
+		if err := s.restoreData(ctx, ns, req.RestoreFrom.RDBURL, &data); err != nil {
+			return nil, err
+		}
+	}
+	var schedule []byte
+	if req.BackupSchedule != nil {
+		if schedule, err = json.Marshal(req.BackupSchedule); err != nil {
+			return nil, fmt.Errorf("encode backup schedule: %w", err)
+		}
+	}
+
 	// Generate and create password secret. Delete if it already exists (e.g. leftover from a
 	// previous run or failed create) so create is idempotent for E2E and retries.
-	secretName := req.Name + "-auth"
 	_ = s.client.Resource(gvrSecrets).Namespace(ns).Delete(ctx, secretName, metav1.DeleteOptions{})
 	password, err := generatePassword()
 	if err != nil {
@@ -267,7 +382,6 @@ func (s *RedisFailoverStore) CreateInstance(ctx context.Context, req models.Crea
 		return nil, fmt.Errorf("create secret: %w", err)
 	}
 
-	data := BuildRedisFailoverTemplateData(req, ns, s.defaultStorageClass, secretName)
 	yamlBytes, err := RenderRedisFailoverTemplate(s.templatePath, data)
 	if err != nil {
 		return nil, fmt.Errorf("render template: %w", err)
@@ -277,6 +391,19 @@ func (s *RedisFailoverStore) CreateInstance(ctx context.Context, req models.Crea
 		return nil, fmt.Errorf("decode yaml: %w", err)
 	}
 	obj.SetNamespace(ns)
+	if schedule != nil || req.RevealCredentialsOnce {
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		if schedule != nil {
+			annotations[AnnotationBackupSchedule] = string(schedule)
+		}
+		if req.RevealCredentialsOnce {
+			annotations[AnnotationRevealCredentialsOnce] = "true"
+		}
+		obj.SetAnnotations(annotations)
+	}
 	gv := schema.GroupVersion{Group: gvrRedisFailover.Group, Version: gvrRedisFailover.Version}
 	obj.SetAPIVersion(gv.String())
 	obj.SetKind("RedisFailover")
@@ -298,59 +425,214 @@ type jsonPatchOp struct {
 	Value interface{} `json:"value,omitempty"`
 }
 
+// patchValue sets *field to *value if value is set.
+func patchValue(field, value *string) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+// resourcesValue returns the resources of a container with the requests and limits that are set, or nil if
+// none is.
+func resourcesValue(cpuRequest, memoryRequest, cpuLimit, memoryLimit string) map[string]interface{} {
+	resources := map[string]interface{}{}
+	for kind, values := range map[string]map[string]string{
+		"requests": {"cpu": cpuRequest, "memory": memoryRequest},
+		"limits":   {"cpu": cpuLimit, "memory": memoryLimit},
+	} {
+		set := map[string]interface{}{}
+		for name, v := range values {
+			if v != "" {
+				set[name] = v
+			}
+		}
+		if len(set) > 0 {
+			resources[kind] = set
+		}
+	}
+	if len(resources) == 0 {
+		return nil
+	}
+	return resources
+}
+
+// jsonPointerEscape escapes a map key for use in a JSON Pointer: / in keys must be encoded as ~1.
+func jsonPointerEscape(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
 // PatchInstance performs a partial update on the RedisFailover CR using the Kubernetes API server's
 // JSON Patch (RFC 6902). Only the requested fields are sent; the server applies the patch on the
 // current resource version, avoiding read-modify-write races and accidental overwrite of other fields.
-// It can update the display name (annotation), replicas, and capacity (PVC size).
-// Returns ErrNotFound if the CR does not exist.
+// It can update the display name and backup schedule (annotations), replicas, capacity (PVC size), Redis
+// and Sentinel resources, Redis config parameters (spec.redis.customConfig) and the plan, which replaces
+// replicas and Redis resources with the plan's and never reduces storage. Changing replicas or Redis
+// resources directly marks the instance as "custom". Capacity cannot shrink (ErrCapacityShrink) and
+// only grows on StorageClasses that allow expansion (ErrVolumeExpansionUnsupported); the instance's
+// PVCs are then expanded as well. Returns ErrNotFound if the CR does not exist.
 func (s *RedisFailoverStore) PatchInstance(ctx context.Context, id string, req models.PatchInstanceRequest) (*models.RedisInstance, error) {
 	if err := ValidatePatchInstanceRequest(req); err != nil {
 		return nil, fmt.Errorf("validation: %w", err)
 	}
+	if req.Plan != nil && (req.Capacity != nil || req.RedisReplicas != nil || req.SentinelReplicas != nil || patchesRedisResources(req)) {
+		return nil, fmt.Errorf("%w: plan cannot be combined with capacity, replica or resource changes", ErrInvalidPlan)
+	}
 	ns := namespaceFromContext(ctx, s.namespace)
 
+	existing, err := s.client.Resource(gvrRedisFailover).Namespace(ns).Get(ctx, id, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		return nil, fmt.Errorf("get redisfailover %q: %w", id, err)
+	}
+
 	var ops []jsonPatchOp
 
-	// Display name: patch annotation. We may need current annotations so we don't wipe them when the map is missing.
+	// Display name and backup schedule: patch annotations. Add the whole map if the CR has no annotations yet.
 	const displayNameKey = "app.kubernetes.io/display-name"
+	annotations := map[string]string{}
 	if req.Name != nil {
-		var existingAnnotations map[string]string
-		existing, err := s.client.Resource(gvrRedisFailover).Namespace(ns).Get(ctx, id, metav1.GetOptions{})
-		if err != nil {
-			if k8serrors.IsNotFound(err) {
-				return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+		annotations[displayNameKey] = *req.Name
+	}
+	if req.BackupSchedule != nil {
+		if req.BackupSchedule.Cron == "" {
+			if _, ok := existing.GetAnnotations()[AnnotationBackupSchedule]; ok {
+				ops = append(ops, jsonPatchOp{Op: "remove", Path: "/metadata/annotations/" + jsonPointerEscape(AnnotationBackupSchedule)})
 			}
-			return nil, fmt.Errorf("get redisfailover for annotation patch: %w", err)
-		}
-		existingAnnotations, _, _ = unstructured.NestedStringMap(existing.Object, "metadata", "annotations")
-		merged := map[string]string{}
-		for k, v := range existingAnnotations {
-			merged[k] = v
-		}
-		merged[displayNameKey] = *req.Name
-		if existingAnnotations == nil {
-			ops = append(ops, jsonPatchOp{Op: "add", Path: "/metadata/annotations", Value: merged})
 		} else {
-			// JSON Pointer: / in key must be encoded as ~1
-			ops = append(ops, jsonPatchOp{Op: "add", Path: "/metadata/annotations/app.kubernetes.io~1display-name", Value: *req.Name})
+			if err := s.checkBackupSchedules(); err != nil {
+				return nil, err
+			}
+			schedule, err := json.Marshal(req.BackupSchedule)
+			if err != nil {
+				return nil, fmt.Errorf("encode backup schedule: %w", err)
+			}
+			annotations[AnnotationBackupSchedule] = string(schedule)
+		}
+	}
+	if len(annotations) > 0 && existing.GetAnnotations() == nil {
+		ops = append(ops, jsonPatchOp{Op: "add", Path: "/metadata/annotations", Value: annotations})
+	} else {
+		for _, key := range []string{displayNameKey, AnnotationBackupSchedule} {
+			if v, ok := annotations[key]; ok {
+				ops = append(ops, jsonPatchOp{Op: "add", Path: "/metadata/annotations/" + jsonPointerEscape(key), Value: v})
+			}
 		}
 	}
 
+	const storagePath = "/spec/redis/storage/persistentVolumeClaim/spec/resources/requests/storage"
+	data := specTemplateData(existing)
+	planLabel := ""
+	if req.Plan != nil {
+		plan, ok := s.plans.Get(*req.Plan)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown plan %q", ErrInvalidPlan, *req.Plan)
+		}
+		if err := s.plans.checkChange(existing.GetLabels()[LabelPlan], plan.Name); err != nil {
+			return nil, err
+		}
+		// Downgrades keep the current volume: PVCs cannot shrink. Instances without persistence have none.
+		planStorage := resource.MustParse(plan.Storage)
+		if data.Persistence != PersistenceNone {
+			if current, err := resource.ParseQuantity(data.StorageSize); err != nil || planStorage.Cmp(current) > 0 {
+				if err := s.checkCapacityChange(ctx, existing, data.StorageSize, plan.Storage); err != nil {
+					return nil, err
+				}
+				data.StorageSize = plan.Storage
+				ops = append(ops, jsonPatchOp{Op: "replace", Path: storagePath, Value: plan.Storage})
+			}
+		}
+		data.RedisReplicas, data.SentinelReplicas = plan.RedisReplicas, plan.SentinelReplicas
+		data.CPURequest, data.MemoryRequest, data.CPULimit, data.MemoryLimit = plan.CPURequest, plan.MemoryRequest, plan.CPULimit, plan.MemoryLimit
+		ops = append(ops,
+			jsonPatchOp{Op: "replace", Path: "/spec/redis/replicas", Value: int64(plan.RedisReplicas)},
+			jsonPatchOp{Op: "replace", Path: "/spec/sentinel/replicas", Value: int64(plan.SentinelReplicas)},
+			jsonPatchOp{Op: "add", Path: "/spec/redis/resources", Value: resourcesValue(plan.CPURequest, plan.MemoryRequest, plan.CPULimit, plan.MemoryLimit)},
+		)
+		planLabel = plan.Name
+	}
 	if req.Capacity != nil {
-		ops = append(ops, jsonPatchOp{
-			Op: "replace", Path: "/spec/redis/storage/persistentVolumeClaim/spec/resources/requests/storage", Value: *req.Capacity,
-		})
+		if data.Persistence == PersistenceNone {
+			return nil, fmt.Errorf("%w: instance %q has no persistent storage", ErrInvalidPersistence, id)
+		}
+		if err := s.checkCapacityChange(ctx, existing, data.StorageSize, *req.Capacity); err != nil {
+			return nil, err
+		}
+		data.StorageSize = *req.Capacity
+		ops = append(ops, jsonPatchOp{Op: "replace", Path: storagePath, Value: *req.Capacity})
 	}
 	if req.RedisReplicas != nil {
+		data.RedisReplicas = *req.RedisReplicas
 		ops = append(ops, jsonPatchOp{Op: "replace", Path: "/spec/redis/replicas", Value: int64(*req.RedisReplicas)})
+		planLabel = customPlan
 	}
 	if req.SentinelReplicas != nil {
+		data.SentinelReplicas = *req.SentinelReplicas
 		ops = append(ops, jsonPatchOp{Op: "replace", Path: "/spec/sentinel/replicas", Value: int64(*req.SentinelReplicas)})
+		planLabel = customPlan
+	}
+	if patchesRedisResources(req) {
+		patchValue(&data.CPURequest, req.CPURequest)
+		patchValue(&data.MemoryRequest, req.MemoryRequest)
+		patchValue(&data.CPULimit, req.CPULimit)
+		patchValue(&data.MemoryLimit, req.MemoryLimit)
+		resources := resourcesValue(data.CPURequest, data.MemoryRequest, data.CPULimit, data.MemoryLimit)
+		ops = append(ops, jsonPatchOp{Op: "add", Path: "/spec/redis/resources", Value: resources})
+		// The restore init container of restored instances has Redis' resources (see the template).
+		if initContainers, _, _ := unstructured.NestedSlice(existing.Object, "spec", "redis", "initContainers"); len(initContainers) > 0 {
+			ops = append(ops, jsonPatchOp{Op: "add", Path: "/spec/redis/initContainers/0/resources", Value: resources})
+		}
+		planLabel = customPlan
+	}
+	if patchesSentinelResources(req) {
+		patchValue(&data.SentinelCPURequest, req.SentinelCPURequest)
+		patchValue(&data.SentinelMemoryRequest, req.SentinelMemoryRequest)
+		patchValue(&data.SentinelCPULimit, req.SentinelCPULimit)
+		patchValue(&data.SentinelMemoryLimit, req.SentinelMemoryLimit)
+		resources := resourcesValue(data.SentinelCPURequest, data.SentinelMemoryRequest, data.SentinelCPULimit, data.SentinelMemoryLimit)
+		if _, found, _ := unstructured.NestedFieldNoCopy(existing.Object, "spec", "sentinel", "resources"); resources == nil && found {
+			ops = append(ops, jsonPatchOp{Op: "remove", Path: "/spec/sentinel/resources"})
+		} else if resources != nil {
+			ops = append(ops, jsonPatchOp{Op: "add", Path: "/spec/sentinel/resources", Value: resources})
+		}
+	}
+	if err := validateResources(data); err != nil {
+		return nil, fmt.Errorf("validation: %w", err)
+	}
+	// Parameters not in the request keep their values; the operator applies the list with CONFIG SET.
+	current := customConfigOf(existing)
+	data.CustomConfig = mergeCustomConfig(current, req.Config)
+	if req.Config != nil || req.Plan != nil || req.MemoryLimit != nil {
+		if err := validateMaxmemory(data); err != nil {
+			return nil, fmt.Errorf("validation: %w", err)
+		}
+	}
+	if req.Config != nil && !slices.Equal(current, data.CustomConfig) {
+		ops = append(ops, jsonPatchOp{Op: "add", Path: "/spec/redis/customConfig", Value: data.CustomConfig})
+	}
+	if planLabel != "" && existing.GetLabels()[LabelPlan] != planLabel {
+		if existing.GetLabels() == nil {
+			ops = append(ops, jsonPatchOp{Op: "add", Path: "/metadata/labels", Value: map[string]string{LabelPlan: planLabel}})
+		} else {
+			ops = append(ops, jsonPatchOp{Op: "add", Path: "/metadata/labels/" + jsonPointerEscape(LabelPlan), Value: planLabel})
+		}
 	}
 
 	if len(ops) == 0 {
+		if req.BackupSchedule != nil || req.Config != nil || patchesSentinelResources(req) {
+			// Removing a schedule, parameters or Sentinel resources the instance does not have.
+			inst := redisfailoverToModel(existing)
+			s.attachConnectionInfo(ctx, inst)
+			return inst, nil
+		}
 		return nil, fmt.Errorf("validation: at least one field must be provided")
 	}
+	if req.Plan != nil || req.Capacity != nil || req.RedisReplicas != nil || req.SentinelReplicas != nil || patchesRedisResources(req) || patchesSentinelResources(req) {
+		if err := s.checkQuota(ctx, ns, id, specUsage(existing), data); err != nil {
+			return nil, err
+		}
+	}
 
 	patchBytes, err := json.Marshal(ops)
 	if err != nil {
@@ -364,6 +646,12 @@ func (s *RedisFailoverStore) PatchInstance(ctx context.Context, id string, req m
 		}
 		return nil, fmt.Errorf("patch redisfailover %q: %w", id, err)
 	}
+	if data.StorageSize != specTemplateData(existing).StorageSize {
+		// Repeating the patch retries the PVCs that failed.
+		if err := s.expandVolumes(ctx, ns, id, data.StorageSize); err != nil {
+			return nil, fmt.Errorf("expand volumes of %q: %w", id, err)
+		}
+	}
 	inst := redisfailoverToModel(updated)
 	s.attachConnectionInfo(ctx, inst)
 	return inst, nil
@@ -425,13 +713,19 @@ func redisfailoverToModel(obj *unstructured.Unstructured) *models.RedisInstance
 	}
 
 	return &models.RedisInstance{
-		ID:               name,
-		Name:             displayName,
-		Namespace:        ns,
-		Status:           status,
-		Capacity:         capacity,
-		RedisReplicas:    int(redisReplicas),
-		SentinelReplicas: int(sentinelReplicas),
+		ID:                    name,
+		Name:                  displayName,
+		Namespace:             ns,
+		Status:                status,
+		Capacity:              capacity,
+		Plan:                  obj.GetLabels()[LabelPlan],
+		RedisReplicas:         int(redisReplicas),
+		SentinelReplicas:      int(sentinelReplicas),
+		RestoredFrom:          obj.GetAnnotations()[AnnotationRestoredFrom],
+		BackupSchedule:        backupScheduleOf(obj),
+		RevealCredentialsOnce: obj.GetAnnotations()[AnnotationRevealCredentialsOnce] == "true",
+		Persistence:           persistenceOf(obj),
+		Config:                redisConfigOf(obj),
 	}
 }
 
@@ -487,27 +781,24 @@ func podContainersReady(obj map[string]interface{}) bool {
 
 // inferStatusFromPods infers instance status from pod phases when the RedisFailover CR has no status.
 // Returns "running" only when ALL pods are Running and all their containers are ready (1/1).
-// Lists pods with label app.kubernetes.io/instance=<name> (Spotahome operator convention).
+// Pods are selected by the RedisFailover name label, falling back to app.kubernetes.io/instance=<name>.
 func (s *RedisFailoverStore) inferStatusFromPods(ctx context.Context, name string) string {
-	ns := namespaceFromContext(ctx, s.namespace)
-
-	list, err := s.client.Resource(gvrPods).Namespace(ns).List(ctx, metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("redisfailovers.databases.spotahome.com/name=%s", name),
-	})
-
-	// If no pods found
-	if err != nil || len(list.Items) == 0 {
-		list, err = s.client.Resource(gvrPods).Namespace(ns).List(ctx, metav1.ListOptions{
-			LabelSelector: "app.kubernetes.io/instance=" + name,
-		})
-	}
+	status, _, _ := s.podReadiness(ctx, name)
+	return status
+}
 
-	if err != nil || len(list.Items) == 0 {
-		return "unknown"
+// podReadiness lists the pods of an instance and returns the status inferred from them (see
+// inferStatusFromPods) together with the number of ready pods and of all pods.
+func (s *RedisFailoverStore) podReadiness(ctx context.Context, name string) (status string, ready, total int) {
+	ns := namespaceFromContext(ctx, s.namespace)
+	pods, err := s.listInstancePods(ctx, ns, name)
+	if err != nil || len(pods) == 0 {
+		return "unknown", 0, 0
 	}
 	allRunningAndReady := true
-	for i := range list.Items {
-		obj := list.Items[i].Object
+	failed := false
+	for _, pod := range pods {
+		obj := pod.Object
 		// status.phase is top-level for pods
 		phase, _, _ := unstructured.NestedString(obj, "status", "phase")
 
@@ -528,19 +819,54 @@ func (s *RedisFailoverStore) inferStatusFromPods(ctx context.Context, name strin
 
 		switch phase {
 		case "Failed":
-			return "failed"
+			failed = true
 		case "Pending":
 			allRunningAndReady = false
 		case "Running":
-			if !podContainersReady(obj) {
+			if podContainersReady(obj) {
+				ready++
+			} else {
 				allRunningAndReady = false // pod is 0/1, not ready yet
 			}
 		default:
 			allRunningAndReady = false
 		}
 	}
-	if allRunningAndReady {
-		return "running"
+	total = len(pods)
+	switch {
+	case failed:
+		return "failed", ready, total
+	case allRunningAndReady:
+		return "running", ready, total
 	}
-	return "pending"
+	return "pending", ready, total
+}
+
+// InstanceProgress reports how far the instance's pods are from its spec: the status as returned by
+// GetInstance, the ready, existing and expected (Redis plus Sentinel replicas) pod counts and whether the
+// workloads have rolled out the current spec (see rolledOut). Once the CR is gone it reports Deleted with
+// the pods that are still terminating. The CR is read from the API server: operations check progress
+// right after their write, when the cache may still hold the previous spec or a deleted instance.
+func (s *RedisFailoverStore) InstanceProgress(ctx context.Context, id string) (*models.InstanceProgress, error) {
+	ns := namespaceFromContext(ctx, s.namespace)
+	obj, err := s.getFailoverLive(ctx, ns, id)
+	if k8serrors.IsNotFound(err) {
+		_, _, total := s.podReadiness(ctx, id)
+		return &models.InstanceProgress{Status: "deleted", Pods: total, Deleted: true}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get redisfailover %q: %w", id, err)
+	}
+	inst := redisfailoverToModel(obj)
+	podStatus, ready, total := s.podReadiness(ctx, id)
+	if inst.Status == "unknown" {
+		inst.Status = podStatus
+	}
+	return &models.InstanceProgress{
+		Status:       inst.Status,
+		ReadyPods:    ready,
+		Pods:         total,
+		ExpectedPods: inst.RedisReplicas + inst.SentinelReplicas,
+		RolledOut:    s.rolledOut(ctx, ns, obj),
+	}, nil
 }
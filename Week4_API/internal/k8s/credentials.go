@@ -0,0 +1,317 @@
+package k8s
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	redisPort          = 6379
+	sentinelPort       = 26379
+	sentinelMasterName = "mymaster" // the Spotahome operator monitors every RedisFailover under this name
+
+	secretKeyPassword = "password"
+	// secretKeyPreviousPassword holds the password replaced by the last rotation while it still works.
+	secretKeyPreviousPassword = "previous-password"
+	// AnnotationPasswordGraceUntil records on the auth Secret (RFC 3339) when the previous password is
+	// removed from the instance.
+	AnnotationPasswordGraceUntil = "paas.io/password-grace-until"
+
+	// AnnotationRevealCredentialsOnce marks RedisFailovers whose password is only returned by the calls
+	// that set it (create, rotate), never by GET /instances/:id/credentials.
+	AnnotationRevealCredentialsOnce = "paas.io/reveal-credentials-once"
+
+	// MaxPasswordGracePeriod bounds how long a rotated password keeps working.
+	MaxPasswordGracePeriod = 24 * time.Hour
+)
+
+// ErrRotationUnavailable is returned when an instance's password cannot be rotated right now, e.g.
+// because not all of its pods are running.
+var ErrRotationUnavailable = errors.New("password rotation unavailable")
+
+// RedisAdmin reconfigures the passwords of Redis and Sentinel servers; implemented by cache.Client.
+type RedisAdmin interface {
+	AddPassword(ctx context.Context, addr, password, newPassword string) error
+	RemovePassword(ctx context.Context, addr, password, oldPassword string) error
+	SetSentinelAuthPass(ctx context.Context, addr, master, password string) error
+}
+
+// PasswordRotator rotates instance passwords; implemented by RedisFailoverStore.
+type PasswordRotator interface {
+	// RotatePassword gives the instance a new password. The previous password keeps working for grace
+	// (at most MaxPasswordGracePeriod). Returns ErrNotFound if the instance does not exist and
+	// ErrRotationUnavailable if its pods cannot be reconfigured.
+	RotatePassword(ctx context.Context, id string, grace time.Duration) (*models.CredentialsRotation, error)
+}
+
+// Ensure RedisFailoverStore implements PasswordRotator.
+var _ PasswordRotator = (*RedisFailoverStore)(nil)
+
+func authSecretName(id string) string { return id + "-auth" }
+
+// GetCredentials returns the endpoint and current password of an instance. Returns ErrNotFound if the CR
+// does not exist.
+func (s *RedisFailoverStore) GetCredentials(ctx context.Context, id string) (*models.InstanceCredentials, error) {
+	ns := namespaceFromContext(ctx, s.namespace)
+	obj, err := s.getFailover(ctx, ns, id)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		return nil, fmt.Errorf("get redisfailover %q: %w", id, err)
+	}
+	secret, err := s.getSecret(ctx, ns, authSecretName(id))
+	if err != nil {
+		return nil, fmt.Errorf("get secret %q: %w", authSecretName(id), err)
+	}
+	password := secretValue(secret, secretKeyPassword)
+	if password == "" {
+		return nil, fmt.Errorf("secret %q has no password", authSecretName(id))
+	}
+	inst := redisfailoverToModel(obj)
+	s.attachConnectionInfo(ctx, inst)
+	return &models.InstanceCredentials{InstanceID: id, Endpoint: inst.PublicEndpoint, Password: password}, nil
+}
+
+// RotatePassword implements PasswordRotator without restarting pods: the new password is added to every
+// Redis pod (which also authenticates to the master with it) and set on the Sentinels before it is
+// written to the auth Secret, which pods read when they start; if any step fails, the pods and Sentinels
+// are set back to the current password. The replaced password stays in the Secret until
+// RetirePreviousPassword removes it from the pods after the grace period; a previous password still
+// pending from an earlier rotation is removed first, so at most two passwords work at a time.
+func (s *RedisFailoverStore) RotatePassword(ctx context.Context, id string, grace time.Duration) (*models.CredentialsRotation, error) {
+	if s.admin == nil {
+		return nil, fmt.Errorf("%w: no Redis admin client configured", ErrRotationUnavailable)
+	}
+	if grace < 0 || grace > MaxPasswordGracePeriod {
+		return nil, fmt.Errorf("grace period must be between 0 and %s", MaxPasswordGracePeriod)
+	}
+	ns := namespaceFromContext(ctx, s.namespace)
+	if _, err := s.getFailover(ctx, ns, id); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		return nil, fmt.Errorf("get redisfailover %q: %w", id, err)
+	}
+	// Read the Secret from the API server: its resourceVersion guards against concurrent rotations.
+	secret, err := s.client.Resource(gvrSecrets).Namespace(ns).Get(ctx, authSecretName(id), metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get secret %q: %w", authSecretName(id), err)
+	}
+	current := secretValue(secret, secretKeyPassword)
+	if current == "" {
+		return nil, fmt.Errorf("secret %q has no password", authSecretName(id))
+	}
+	redisAddrs, sentinelAddrs, allRunning, err := s.instanceAddrs(ctx, ns, id)
+	if err != nil {
+		return nil, fmt.Errorf("list pods: %w", err)
+	}
+	if !allRunning || len(redisAddrs) == 0 {
+		return nil, fmt.Errorf("%w: not all pods of %s are running", ErrRotationUnavailable, id)
+	}
+
+	if previous := secretValue(secret, secretKeyPreviousPassword); previous != "" {
+		if err := s.removePassword(ctx, redisAddrs, current, previous); err != nil {
+			return nil, err
+		}
+	}
+	next, err := generatePassword()
+	if err != nil {
+		return nil, fmt.Errorf("generate password: %w", err)
+	}
+	// Until the Secret is updated nobody knows the new password: if the rotation fails, it is taken back
+	// from the pods that accepted it (including one that failed half-way).
+	for i, addr := range redisAddrs {
+		if err := s.admin.AddPassword(ctx, addr, current, next); err != nil {
+			s.undoAddPassword(ctx, redisAddrs[:i+1], nil, current, next)
+			return nil, fmt.Errorf("%w: %s: %v", ErrRotationUnavailable, addr, err)
+		}
+	}
+	for i, addr := range sentinelAddrs {
+		if err := s.admin.SetSentinelAuthPass(ctx, addr, sentinelMasterName, next); err != nil {
+			s.undoAddPassword(ctx, redisAddrs, sentinelAddrs[:i+1], current, next)
+			return nil, fmt.Errorf("%w: sentinel %s: %v", ErrRotationUnavailable, addr, err)
+		}
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	until := now.Add(grace)
+	data, _, _ := unstructured.NestedStringMap(secret.Object, "data")
+	if data == nil {
+		data = map[string]string{}
+	}
+	data[secretKeyPassword] = base64.StdEncoding.EncodeToString([]byte(next))
+	data[secretKeyPreviousPassword] = base64.StdEncoding.EncodeToString([]byte(current))
+	if err := unstructured.SetNestedStringMap(secret.Object, data, "data"); err != nil {
+		return nil, err
+	}
+	unstructured.RemoveNestedField(secret.Object, "stringData")
+	annotations := secret.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[AnnotationPasswordGraceUntil] = until.Format(time.RFC3339)
+	secret.SetAnnotations(annotations)
+	updated, err := s.client.Resource(gvrSecrets).Namespace(ns).Update(ctx, secret, metav1.UpdateOptions{})
+	if err != nil {
+		s.undoAddPassword(ctx, redisAddrs, sentinelAddrs, current, next)
+		if k8serrors.IsConflict(err) {
+			return nil, fmt.Errorf("%w: %s is being rotated concurrently", ErrRotationUnavailable, id)
+		}
+		return nil, fmt.Errorf("update secret %q: %w", authSecretName(id), err)
+	}
+
+	out := &models.CredentialsRotation{InstanceID: id, Password: next, RotatedAt: now}
+	if grace > 0 {
+		out.PreviousPasswordExpiresAt = &until
+	} else {
+		// Without grace period the old password goes now; should that fail, the retirer tries again.
+		_ = s.retirePreviousPassword(ctx, ns, id, updated, now)
+	}
+	return out, nil
+}
+
+// ExpiredPasswordGrace returns the instances whose previous password's grace period ended at or before
+// now.
+func (s *RedisFailoverStore) ExpiredPasswordGrace(ctx context.Context, now time.Time) ([]InstanceKey, error) {
+	var secrets []*unstructured.Unstructured
+	if c := s.cached(); c != nil {
+		objs, err := c.secrets.Lister().List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		if secrets, err = asUnstructuredList(objs); err != nil {
+			return nil, err
+		}
+	} else {
+		list, err := s.client.Resource(gvrSecrets).Namespace(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+			LabelSelector: LabelManagedBy + "=" + managedByValue,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			secrets = append(secrets, &list.Items[i])
+		}
+	}
+	var out []InstanceKey
+	for _, secret := range secrets {
+		id, ok := strings.CutSuffix(secret.GetName(), "-auth")
+		if ok && graceExpired(secret, now) {
+			out = append(out, InstanceKey{Namespace: secret.GetNamespace(), Name: id})
+		}
+	}
+	return out, nil
+}
+
+// RetirePreviousPassword removes the instance's previous password from its Redis pods and from its auth
+// Secret once the grace period ended; it does nothing before that or if there is none.
+func (s *RedisFailoverStore) RetirePreviousPassword(ctx context.Context, key InstanceKey) error {
+	if s.admin == nil {
+		return fmt.Errorf("%w: no Redis admin client configured", ErrRotationUnavailable)
+	}
+	secret, err := s.client.Resource(gvrSecrets).Namespace(key.Namespace).Get(ctx, authSecretName(key.Name), metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("get secret %q: %w", authSecretName(key.Name), err)
+	}
+	return s.retirePreviousPassword(ctx, key.Namespace, key.Name, secret, time.Now().UTC())
+}
+
+func (s *RedisFailoverStore) retirePreviousPassword(ctx context.Context, ns, id string, secret *unstructured.Unstructured, now time.Time) error {
+	if !graceExpired(secret, now) {
+		return nil
+	}
+	if previous := secretValue(secret, secretKeyPreviousPassword); previous != "" {
+		// Pods that are not running start with the password from the Secret only, so they are skipped.
+		redisAddrs, _, _, err := s.instanceAddrs(ctx, ns, id)
+		if err != nil {
+			return fmt.Errorf("list pods: %w", err)
+		}
+		if err := s.removePassword(ctx, redisAddrs, secretValue(secret, secretKeyPassword), previous); err != nil {
+			return err
+		}
+	}
+	unstructured.RemoveNestedField(secret.Object, "data", secretKeyPreviousPassword)
+	annotations := secret.GetAnnotations()
+	delete(annotations, AnnotationPasswordGraceUntil)
+	secret.SetAnnotations(annotations)
+	if _, err := s.client.Resource(gvrSecrets).Namespace(ns).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("update secret %q: %w", secret.GetName(), err)
+	}
+	return nil
+}
+
+// graceExpired reports whether the Secret has a grace period annotation that ended at or before now.
+func graceExpired(secret *unstructured.Unstructured, now time.Time) bool {
+	v, ok := secret.GetAnnotations()[AnnotationPasswordGraceUntil]
+	if !ok {
+		return false
+	}
+	until, err := time.Parse(time.RFC3339, v)
+	return err != nil || !until.After(now)
+}
+
+// undoAddPassword reverts a failed rotation: the Sentinels at sentinelAddrs authenticate with current
+// again and the Redis pods at redisAddrs use current as masterauth and no longer accept next. Errors are
+// ignored; the rotation already failed and reports why.
+func (s *RedisFailoverStore) undoAddPassword(ctx context.Context, redisAddrs, sentinelAddrs []string, current, next string) {
+	ctx = context.WithoutCancel(ctx)
+	for _, addr := range sentinelAddrs {
+		_ = s.admin.SetSentinelAuthPass(ctx, addr, sentinelMasterName, current)
+	}
+	for _, addr := range redisAddrs {
+		// Adding the current password again (it is still accepted) points masterauth back to it.
+		_ = s.admin.AddPassword(ctx, addr, current, current)
+		_ = s.admin.RemovePassword(ctx, addr, current, next)
+	}
+}
+
+func (s *RedisFailoverStore) removePassword(ctx context.Context, addrs []string, password, old string) error {
+	for _, addr := range addrs {
+		if err := s.admin.RemovePassword(ctx, addr, password, old); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrRotationUnavailable, addr, err)
+		}
+	}
+	return nil
+}
+
+// instanceAddrs returns the addresses of the running Redis (rfr-*) and Sentinel (rfs-*) pods of the
+// instance, and whether all of its pods are running.
+func (s *RedisFailoverStore) instanceAddrs(ctx context.Context, ns, id string) (redisAddrs, sentinelAddrs []string, allRunning bool, err error) {
+	pods, err := s.listInstancePods(ctx, ns, id)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	allRunning = true
+	for _, pod := range pods {
+		phase, _, _ := unstructured.NestedString(pod.Object, "status", "phase")
+		ip, _, _ := unstructured.NestedString(pod.Object, "status", "podIP")
+		if phase != "Running" || ip == "" {
+			allRunning = false
+			continue
+		}
+		switch name := pod.GetName(); {
+		case strings.HasPrefix(name, "rfr-"):
+			redisAddrs = append(redisAddrs, net.JoinHostPort(ip, strconv.Itoa(redisPort)))
+		case strings.HasPrefix(name, "rfs-"):
+			sentinelAddrs = append(sentinelAddrs, net.JoinHostPort(ip, strconv.Itoa(sentinelPort)))
+		}
+	}
+	return redisAddrs, sentinelAddrs, allRunning, nil
+}
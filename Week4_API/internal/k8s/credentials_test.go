@@ -0,0 +1,220 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeRedisAdmin is a test double for RedisAdmin; passwords maps Redis addresses to the passwords they
+// accept, masterauth to the password they authenticate to the master with and sentinels maps Sentinel
+// addresses to their auth-pass. The Sentinel at brokenSentinel refuses to change its auth-pass.
+type fakeRedisAdmin struct {
+	passwords      map[string]map[string]bool
+	masterauth     map[string]string
+	sentinels      map[string]string
+	brokenSentinel string
+}
+
+func (f *fakeRedisAdmin) auth(addr, password string) error {
+	if !f.passwords[addr][password] {
+		return fmt.Errorf("%s: WRONGPASS", addr)
+	}
+	return nil
+}
+
+func (f *fakeRedisAdmin) AddPassword(ctx context.Context, addr, password, newPassword string) error {
+	if err := f.auth(addr, password); err != nil {
+		return err
+	}
+	f.passwords[addr][newPassword] = true
+	f.masterauth[addr] = newPassword
+	return nil
+}
+
+func (f *fakeRedisAdmin) RemovePassword(ctx context.Context, addr, password, oldPassword string) error {
+	if err := f.auth(addr, password); err != nil {
+		return err
+	}
+	delete(f.passwords[addr], oldPassword)
+	return nil
+}
+
+func (f *fakeRedisAdmin) SetSentinelAuthPass(ctx context.Context, addr, master, password string) error {
+	if addr == f.brokenSentinel && password != f.sentinels[addr] {
+		return fmt.Errorf("%s: connection refused", addr)
+	}
+	f.sentinels[addr] = password
+	return nil
+}
+
+func runningPod(ns, name, instance, ip string) *unstructured.Unstructured {
+	return testObject("v1", "Pod", ns, name, map[string]interface{}{labelFailoverName: instance}, map[string]interface{}{
+		"status": map[string]interface{}{"phase": "Running", "podIP": ip},
+	})
+}
+
+func TestRotatePassword(t *testing.T) {
+	const ns = "tenant-alice"
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		gvrRedisFailover: "RedisFailoverList",
+		gvrPods:          "PodList",
+		gvrSecrets:       "SecretList",
+	},
+		testObject("databases.spotahome.com/v1", "RedisFailover", ns, "cache", nil, nil),
+		testObject("v1", "Secret", ns, "cache-auth", map[string]interface{}{LabelManagedBy: managedByValue}, map[string]interface{}{
+			"stringData": map[string]interface{}{"password": "old"},
+		}),
+		runningPod(ns, "rfr-cache-0", "cache", "10.0.0.1"),
+		runningPod(ns, "rfr-cache-1", "cache", "10.0.0.2"),
+		runningPod(ns, "rfs-cache-5d8f", "cache", "10.0.0.3"),
+		runningPod(ns, "rfs-cache-7b2c", "cache", "10.0.0.4"),
+	)
+	ctx := WithNamespace(context.Background(), ns)
+	accepts := func(passwords ...string) map[string]bool {
+		m := map[string]bool{}
+		for _, p := range passwords {
+			m[p] = true
+		}
+		return m
+	}
+	admin := &fakeRedisAdmin{
+		passwords:  map[string]map[string]bool{"10.0.0.1:6379": accepts("old"), "10.0.0.2:6379": accepts("old")},
+		masterauth: map[string]string{},
+		sentinels:  map[string]string{},
+	}
+
+	if _, err := NewRedisFailoverStore(client, StoreConfig{}).RotatePassword(ctx, "cache", time.Minute); !errors.Is(err, ErrRotationUnavailable) {
+		t.Fatalf("without admin: %v", err)
+	}
+	store := NewRedisFailoverStore(client, StoreConfig{RedisAdmin: admin})
+	if _, err := store.RotatePassword(ctx, "missing", time.Minute); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing instance: %v", err)
+	}
+
+	rotation, err := store.RotatePassword(ctx, "cache", time.Hour)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	first := rotation.Password
+	if first == "" || first == "old" || rotation.PreviousPasswordExpiresAt == nil {
+		t.Fatalf("rotation %+v", rotation)
+	}
+	for addr, passwords := range admin.passwords {
+		if !passwords["old"] || !passwords[first] {
+			t.Fatalf("%s accepts %v during grace period", addr, passwords)
+		}
+	}
+	if admin.sentinels["10.0.0.3:26379"] != first || admin.sentinels["10.0.0.4:26379"] != first {
+		t.Fatalf("sentinel auth-pass %v", admin.sentinels)
+	}
+	secret, _ := client.Resource(gvrSecrets).Namespace(ns).Get(ctx, "cache-auth", metav1.GetOptions{})
+	if secretValue(secret, secretKeyPassword) != first || secretValue(secret, secretKeyPreviousPassword) != "old" {
+		t.Fatalf("secret %v", secret.Object)
+	}
+	if keys, err := store.ExpiredPasswordGrace(ctx, time.Now()); err != nil || len(keys) != 0 {
+		t.Fatalf("expired before grace period end: %v, %v", keys, err)
+	}
+	if keys, _ := store.ExpiredPasswordGrace(ctx, time.Now().Add(2*time.Hour)); len(keys) != 1 || keys[0] != (InstanceKey{Namespace: ns, Name: "cache"}) {
+		t.Fatalf("expired after grace period end: %v", keys)
+	}
+	if err := store.RetirePreviousPassword(ctx, InstanceKey{Namespace: ns, Name: "cache"}); err != nil || !admin.passwords["10.0.0.1:6379"]["old"] {
+		t.Fatalf("retire during grace period: %v", err)
+	}
+
+	// Rotating again drops the pending previous password first; without grace period the replaced one
+	// goes as well.
+	rotation, err = store.RotatePassword(ctx, "cache", 0)
+	if err != nil || rotation.PreviousPasswordExpiresAt != nil {
+		t.Fatalf("rotate without grace: %+v, %v", rotation, err)
+	}
+	for addr, passwords := range admin.passwords {
+		if passwords["old"] || passwords[first] || !passwords[rotation.Password] {
+			t.Fatalf("%s accepts %v after second rotation", addr, passwords)
+		}
+	}
+	secret, _ = client.Resource(gvrSecrets).Namespace(ns).Get(ctx, "cache-auth", metav1.GetOptions{})
+	if secretValue(secret, secretKeyPreviousPassword) != "" || secret.GetAnnotations()[AnnotationPasswordGraceUntil] != "" {
+		t.Fatalf("secret after retirement %v", secret.Object)
+	}
+
+	// A failed rotation is undone on every pod: only the current password works and is used for masterauth
+	// and by the Sentinels.
+	current := rotation.Password
+	unchanged := func(step string) {
+		t.Helper()
+		for addr, passwords := range admin.passwords {
+			if len(passwords) != 1 || !passwords[current] || admin.masterauth[addr] != current {
+				t.Fatalf("%s: %s accepts %v, masterauth %q", step, addr, passwords, admin.masterauth[addr])
+			}
+		}
+		if admin.sentinels["10.0.0.3:26379"] != current || admin.sentinels["10.0.0.4:26379"] != current {
+			t.Fatalf("%s: sentinel auth-pass %v", step, admin.sentinels)
+		}
+		secret, _ := client.Resource(gvrSecrets).Namespace(ns).Get(ctx, "cache-auth", metav1.GetOptions{})
+		if secretValue(secret, secretKeyPassword) != current {
+			t.Fatalf("%s: secret %v", step, secret.Object)
+		}
+	}
+	admin.brokenSentinel = "10.0.0.4:26379"
+	if _, err := store.RotatePassword(ctx, "cache", time.Minute); !errors.Is(err, ErrRotationUnavailable) {
+		t.Fatalf("with failing sentinel: %v", err)
+	}
+	unchanged("failing sentinel")
+	admin.brokenSentinel = ""
+	client.PrependReactor("update", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("etcd unavailable")
+	})
+	if _, err := store.RotatePassword(ctx, "cache", time.Minute); err == nil {
+		t.Fatal("rotation with failing secret update succeeded")
+	}
+	unchanged("failing secret update")
+	client.ReactionChain = client.ReactionChain[1:]
+
+	pending := testObject("v1", "Pod", ns, "rfr-cache-2", map[string]interface{}{labelFailoverName: "cache"}, map[string]interface{}{
+		"status": map[string]interface{}{"phase": "Pending"},
+	})
+	if _, err := client.Resource(gvrPods).Namespace(ns).Create(ctx, pending, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.RotatePassword(ctx, "cache", time.Minute); !errors.Is(err, ErrRotationUnavailable) {
+		t.Fatalf("with pending pod: %v", err)
+	}
+}
+
+func TestGetCredentials(t *testing.T) {
+	store := newFakeStore(Quota{})
+	ctx, err := WithTenant(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("tenant: %v", err)
+	}
+	created, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: "a", RevealCredentialsOnce: true})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if created.Password == "" || !created.RevealCredentialsOnce {
+		t.Fatalf("created %+v", created)
+	}
+	inst, err := store.GetInstance(ctx, "a")
+	if err != nil || inst.Password != "" || !inst.RevealCredentialsOnce {
+		t.Fatalf("get: %+v, %v", inst, err)
+	}
+	creds, err := store.GetCredentials(ctx, "a")
+	if err != nil || creds.Password != created.Password || creds.Endpoint != created.PublicEndpoint {
+		t.Fatalf("credentials %+v, %v", creds, err)
+	}
+	if _, err := store.GetCredentials(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing instance: %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// Pod indexes of the instance cache, keyed "<namespace>/<instance>". The Spotahome operator labels pods
+	// with the RedisFailover name; app.kubernetes.io/instance is the fallback podReadiness has always used.
+	podFailoverIndex = "failover"
+	podInstanceIndex = "instance"
+
+	labelFailoverName = "redisfailovers.databases.spotahome.com/name"
+	labelInstance     = "app.kubernetes.io/instance"
+)
+
+// instanceCache holds the shared informers behind the store's read path. Writes always go through the
+// dynamic client; reads fall back to it until every informer has synced.
+type instanceCache struct {
+	factory        dynamicinformer.DynamicSharedInformerFactory
+	secretsFactory dynamicinformer.DynamicSharedInformerFactory
+	failovers      informers.GenericInformer
+	pods           informers.GenericInformer
+	namespaces     informers.GenericInformer
+	volumes        informers.GenericInformer // PVCs, for resize progress (see attachStorageResize)
+	statefulSets   informers.GenericInformer // Redis workloads, for operation progress (see rolledOut)
+	deployments    informers.GenericInformer // Sentinel workloads, for operation progress
+	secrets        informers.GenericInformer // only secrets labelled managed-by paas-api (see createSecret)
+}
+
+// StartInformers starts cluster-wide informers for RedisFailovers, pods, namespaces, PVCs, StatefulSets,
+// Deployments and the store's secrets and switches ListInstances, GetInstance, InstanceProgress and EnsureNamespace to read from them
+// once they have synced (see Ready). Must be called before the store serves requests; the informers stop
+// with ctx. resync is the informers' resync period (0 disables resyncs).
+func (s *RedisFailoverStore) StartInformers(ctx context.Context, resync time.Duration) error {
+	if s.cache != nil {
+		return fmt.Errorf("informers already started")
+	}
+	c := &instanceCache{
+		factory: dynamicinformer.NewDynamicSharedInformerFactory(s.client, resync),
+		secretsFactory: dynamicinformer.NewFilteredDynamicSharedInformerFactory(s.client, resync, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+			o.LabelSelector = LabelManagedBy + "=" + managedByValue
+		}),
+	}
+	c.failovers = c.factory.ForResource(gvrRedisFailover)
+	c.pods = c.factory.ForResource(gvrPods)
+	c.namespaces = c.factory.ForResource(gvrNamespaces)
+	c.volumes = c.factory.ForResource(gvrPVCs)
+	c.statefulSets = c.factory.ForResource(gvrStatefulSets)
+	c.deployments = c.factory.ForResource(gvrDeployments)
+	c.secrets = c.secretsFactory.ForResource(gvrSecrets)
+	if err := c.pods.Informer().AddIndexers(cache.Indexers{
+		podFailoverIndex: podLabelIndexFunc(labelFailoverName),
+		podInstanceIndex: podLabelIndexFunc(labelInstance),
+	}); err != nil {
+		return fmt.Errorf("pod indexers: %w", err)
+	}
+	for _, inf := range []informers.GenericInformer{c.failovers, c.pods, c.namespaces, c.volumes, c.statefulSets, c.deployments, c.secrets} {
+		if err := inf.Informer().SetTransform(stripManagedFields); err != nil {
+			return fmt.Errorf("informer transform: %w", err)
+		}
+	}
+	c.factory.Start(ctx.Done())
+	c.secretsFactory.Start(ctx.Done())
+	s.cache = c
+	return nil
+}
+
+// WaitForCacheSync blocks until the informers have synced or ctx ends and reports whether they synced.
+// It returns true right away if StartInformers was not called.
+func (s *RedisFailoverStore) WaitForCacheSync(ctx context.Context) bool {
+	if s.cache == nil {
+		return true
+	}
+	return cache.WaitForCacheSync(ctx.Done(), s.cache.hasSynced)
+}
+
+// Ready reports whether the store can serve reads: true without informers, otherwise once they have synced.
+func (s *RedisFailoverStore) Ready() bool {
+	return s.cache == nil || s.cache.hasSynced()
+}
+
+// cached returns the instance cache if reads can be served from it, or nil.
+func (s *RedisFailoverStore) cached() *instanceCache {
+	if s.cache == nil || !s.cache.hasSynced() {
+		return nil
+	}
+	return s.cache
+}
+
+func (c *instanceCache) hasSynced() bool {
+	return c.failovers.Informer().HasSynced() && c.pods.Informer().HasSynced() &&
+		c.namespaces.Informer().HasSynced() && c.volumes.Informer().HasSynced() && c.statefulSets.Informer().HasSynced() &&
+		c.deployments.Informer().HasSynced() && c.secrets.Informer().HasSynced()
+}
+
+// podLabelIndexFunc indexes pods by "<namespace>/<value of label>".
+func podLabelIndexFunc(label string) cache.IndexFunc {
+	return func(obj interface{}) ([]string, error) {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil, nil
+		}
+		v := u.GetLabels()[label]
+		if v == "" {
+			return nil, nil
+		}
+		return []string{u.GetNamespace() + "/" + v}, nil
+	}
+}
+
+// stripManagedFields drops server-side apply bookkeeping, which the store never reads, to keep the
+// cluster-wide caches small.
+func stripManagedFields(obj interface{}) (interface{}, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		u.SetManagedFields(nil)
+	}
+	return obj, nil
+}
+
+// getFailover returns the RedisFailover ns/name from the cache or the API server. A cache miss is
+// retried against the API server, since an instance created a moment ago may not have reached the cache
+// yet. Objects from the cache are shared and must not be modified. Returns a Kubernetes NotFound error if
+// it does not exist. Callers that need the spec of a write they just made use getFailoverLive.
+func (s *RedisFailoverStore) getFailover(ctx context.Context, ns, name string) (*unstructured.Unstructured, error) {
+	if c := s.cached(); c != nil {
+		obj, err := c.failovers.Lister().ByNamespace(ns).Get(name)
+		if err == nil {
+			return asUnstructured(obj)
+		}
+		if !k8serrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	return s.getFailoverLive(ctx, ns, name)
+}
+
+// getFailoverLive returns the RedisFailover ns/name from the API server, bypassing the cache, which may
+// still hold the spec from before a create, PATCH or delete.
+func (s *RedisFailoverStore) getFailoverLive(ctx context.Context, ns, name string) (*unstructured.Unstructured, error) {
+	return s.client.Resource(gvrRedisFailover).Namespace(ns).Get(ctx, name, metav1.GetOptions{})
+}
+
+// listFailovers returns the RedisFailovers in ns from the cache or the API server (see getFailover).
+func (s *RedisFailoverStore) listFailovers(ctx context.Context, ns string) ([]*unstructured.Unstructured, error) {
+	if c := s.cached(); c != nil {
+		objs, err := c.failovers.Lister().ByNamespace(ns).List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		return asUnstructuredList(objs)
+	}
+	list, err := s.client.Resource(gvrRedisFailover).Namespace(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*unstructured.Unstructured, len(list.Items))
+	for i := range list.Items {
+		out[i] = &list.Items[i]
+	}
+	return out, nil
+}
+
+// listInstancePods returns the pods of instance name in ns, selected by the RedisFailover name label or,
+// if no pod carries it, by app.kubernetes.io/instance.
+func (s *RedisFailoverStore) listInstancePods(ctx context.Context, ns, name string) ([]*unstructured.Unstructured, error) {
+	if c := s.cached(); c != nil {
+		indexer := c.pods.Informer().GetIndexer()
+		objs, err := indexer.ByIndex(podFailoverIndex, ns+"/"+name)
+		if err == nil && len(objs) == 0 {
+			objs, err = indexer.ByIndex(podInstanceIndex, ns+"/"+name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		out := make([]*unstructured.Unstructured, 0, len(objs))
+		for _, obj := range objs {
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				out = append(out, u)
+			}
+		}
+		return out, nil
+	}
+	list, err := s.client.Resource(gvrPods).Namespace(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: labelFailoverName + "=" + name,
+	})
+	if err != nil || len(list.Items) == 0 {
+		list, err = s.client.Resource(gvrPods).Namespace(ns).List(ctx, metav1.ListOptions{
+			LabelSelector: labelInstance + "=" + name,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*unstructured.Unstructured, len(list.Items))
+	for i := range list.Items {
+		out[i] = &list.Items[i]
+	}
+	return out, nil
+}
+
+// listVolumes returns the PVCs in ns from the cache or the API server (see getFailover).
+func (s *RedisFailoverStore) listVolumes(ctx context.Context, ns string) ([]*unstructured.Unstructured, error) {
+	if c := s.cached(); c != nil {
+		objs, err := c.volumes.Lister().ByNamespace(ns).List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		return asUnstructuredList(objs)
+	}
+	list, err := s.client.Resource(gvrPVCs).Namespace(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*unstructured.Unstructured, len(list.Items))
+	for i := range list.Items {
+		out[i] = &list.Items[i]
+	}
+	return out, nil
+}
+
+// getSecret returns the secret ns/name. The cache only holds secrets created by this API, so misses
+// (e.g. secrets from before they were labelled) are looked up on the API server.
+func (s *RedisFailoverStore) getSecret(ctx context.Context, ns, name string) (*unstructured.Unstructured, error) {
+	if c := s.cached(); c != nil {
+		obj, err := c.secrets.Lister().ByNamespace(ns).Get(name)
+		if err == nil {
+			return asUnstructured(obj)
+		}
+		if !k8serrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	return s.client.Resource(gvrSecrets).Namespace(ns).Get(ctx, name, metav1.GetOptions{})
+}
+
+// cachedNamespace returns the namespace from the cache, or nil if there is no synced cache or the
+// namespace is not in it (it may have been created a moment ago).
+func (s *RedisFailoverStore) cachedNamespace(ns string) *unstructured.Unstructured {
+	c := s.cached()
+	if c == nil {
+		return nil
+	}
+	obj, err := c.namespaces.Lister().Get(ns)
+	if err != nil {
+		return nil
+	}
+	u, _ := asUnstructured(obj)
+	return u
+}
+
+func asUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object type %T in cache", obj)
+	}
+	return u, nil
+}
+
+func asUnstructuredList(objs []runtime.Object) ([]*unstructured.Unstructured, error) {
+	out := make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		u, err := asUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, nil
+}
@@ -0,0 +1,120 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func testObject(apiVersion, kind, ns, name string, labels map[string]interface{}, extra map[string]interface{}) *unstructured.Unstructured {
+	metadata := map[string]interface{}{"name": name}
+	if ns != "" {
+		metadata["namespace"] = ns
+	}
+	if labels != nil {
+		metadata["labels"] = labels
+	}
+	obj := map[string]interface{}{"apiVersion": apiVersion, "kind": kind, "metadata": metadata}
+	for k, v := range extra {
+		obj[k] = v
+	}
+	return &unstructured.Unstructured{Object: obj}
+}
+
+func readyPod(ns, name, instance string) *unstructured.Unstructured {
+	return testObject("v1", "Pod", ns, name, map[string]interface{}{labelFailoverName: instance}, map[string]interface{}{
+		"status": map[string]interface{}{
+			"phase":             "Running",
+			"containerStatuses": []interface{}{map[string]interface{}{"name": "redis", "ready": true, "restartCount": int64(0)}},
+		},
+	})
+}
+
+func TestInformers_ReadsServedFromCache(t *testing.T) {
+	const ns = "tenant-alice"
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		gvrRedisFailover: "RedisFailoverList",
+		gvrPods:          "PodList",
+		gvrNamespaces:    "NamespaceList",
+		gvrPVCs:          "PersistentVolumeClaimList",
+		gvrStatefulSets:  "StatefulSetList",
+		gvrDeployments:   "DeploymentList",
+		gvrSecrets:       "SecretList",
+	},
+		testObject("v1", "Namespace", "", ns, nil, nil),
+		testObject("databases.spotahome.com/v1", "RedisFailover", ns, "cache", nil, map[string]interface{}{
+			"spec": map[string]interface{}{
+				"redis":    map[string]interface{}{"replicas": int64(1)},
+				"sentinel": map[string]interface{}{"replicas": int64(1)},
+			},
+		}),
+		readyPod(ns, "rfr-cache-0", "cache"),
+		readyPod(ns, "rfs-cache-0", "cache"),
+		testObject("v1", "Secret", ns, "cache-auth", map[string]interface{}{LabelManagedBy: managedByValue}, map[string]interface{}{
+			"stringData": map[string]interface{}{"password": "secret"},
+		}),
+	)
+	store := NewRedisFailoverStore(client, StoreConfig{Namespace: "default"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := store.StartInformers(ctx, 0); err != nil {
+		t.Fatalf("start informers: %v", err)
+	}
+	syncCtx, syncCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer syncCancel()
+	if !store.WaitForCacheSync(syncCtx) || !store.Ready() {
+		t.Fatal("informers did not sync")
+	}
+	client.ClearActions()
+
+	tctx, err := WithTenant(ctx, "alice")
+	if err != nil {
+		t.Fatalf("tenant: %v", err)
+	}
+	list, err := store.ListInstances(tctx)
+	if err != nil || len(list) != 1 || list[0].Status != "running" {
+		t.Fatalf("list: %+v, %v", list, err)
+	}
+	inst, err := store.GetInstance(tctx, "cache")
+	if err != nil || inst.Password != "" {
+		t.Fatalf("get: %+v, %v", inst, err)
+	}
+	if creds, err := store.GetCredentials(tctx, "cache"); err != nil || creds.Password != "secret" {
+		t.Fatalf("credentials: %+v, %v", creds, err)
+	}
+	state, err := store.InstanceState(ctx, InstanceKey{Namespace: ns, Name: "cache"})
+	if err != nil || state.Status != "running" || len(state.Containers) != 2 {
+		t.Fatalf("state: %+v, %v", state, err)
+	}
+	if tenant := store.NamespaceTenant(ctx, ns); tenant != "alice" {
+		t.Fatalf("tenant of %s: %q", ns, tenant)
+	}
+	if actions := client.Actions(); len(actions) != 0 {
+		t.Fatalf("reads hit the API server: %v", actions)
+	}
+
+	// A cache miss may be an instance created a moment ago, and operation progress must see the spec of
+	// the write it follows: both read the RedisFailover from the API server.
+	if _, err := store.GetInstance(tctx, "missing"); err == nil {
+		t.Fatal("get missing: want error")
+	}
+	p, err := store.InstanceProgress(tctx, "cache")
+	if err != nil || p.ReadyPods != 2 || p.ExpectedPods != 2 {
+		t.Fatalf("progress: %+v, %v", p, err)
+	}
+	actions := client.Actions()
+	if len(actions) != 2 {
+		t.Fatalf("want 2 API reads, got %v", actions)
+	}
+	for _, a := range actions {
+		if a.GetVerb() != "get" || a.GetResource() != gvrRedisFailover {
+			t.Fatalf("unexpected API call %v", a)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Leader election timings (client-go defaults for controllers).
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// LeaderConfig selects the Lease that API replicas compete for.
+type LeaderConfig struct {
+	KubeConfigPath string // see NewDynamicClient
+	Namespace      string // namespace of the Lease
+	LeaseName      string
+	Identity       string // unique per replica, e.g. the pod name
+}
+
+// RunWhileLeader campaigns for the Lease and calls run whenever this replica holds it. The context passed
+// to run is cancelled when leadership is lost, after which RunWhileLeader campaigns again. It returns when
+// ctx ends.
+func RunWhileLeader(ctx context.Context, cfg LeaderConfig, logger *slog.Logger, run func(ctx context.Context)) error {
+	restConfig, err := buildRestConfig(cfg.KubeConfigPath)
+	if err != nil {
+		return err
+	}
+	lock, err := resourcelock.NewFromKubeconfig(resourcelock.LeasesResourceLock, cfg.Namespace, cfg.LeaseName,
+		resourcelock.ResourceLockConfig{Identity: cfg.Identity}, restConfig, renewDeadline)
+	if err != nil {
+		return fmt.Errorf("lease lock: %w", err)
+	}
+	// run may still be winding down when the elector returns and leadership is regained; the lock keeps
+	// two runs from overlapping on this replica.
+	var running sync.Mutex
+	for ctx.Err() == nil {
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   renewDeadline,
+			RetryPeriod:     retryPeriod,
+			ReleaseOnCancel: true,
+			Name:            cfg.LeaseName,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					running.Lock()
+					defer running.Unlock()
+					if ctx.Err() == nil {
+						run(ctx)
+					}
+				},
+				OnStoppedLeading: func() {},
+				OnNewLeader: func(identity string) {
+					logger.Info("leader elected", "lease", cfg.LeaseName, "leader", identity)
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("leader election %q: %w", cfg.LeaseName, err)
+		}
+		elector.Run(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package k8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// tenantNamespacePrefix is prepended to every tenant namespace ("alice" -> "tenant-alice").
+	tenantNamespacePrefix = "tenant-"
+	// maxTenantLength bounds accepted tenant names; longer ones are shortened in names and labels, never rejected below this.
+	maxTenantLength = 253
+	// tenantHashLength is the number of hex digits of SHA-256 kept when a name has to be shortened.
+	tenantHashLength = 10
+
+	// LabelTenant and AnnotationTenant mark namespaces created for a tenant. The label value is
+	// shortened like the namespace name if needed; the annotation always holds the full tenant.
+	LabelTenant      = "paas.io/tenant"
+	AnnotationTenant = "paas.io/tenant"
+	// LabelManagedBy marks objects created by this API.
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+	managedByValue = "paas-api"
+)
+
+// ErrInvalidTenant is returned for tenant names that cannot be mapped onto a namespace.
+var ErrInvalidTenant = errors.New("invalid tenant name")
+
+// ErrNamespaceConflict is returned when a tenant's namespace exists but belongs to another tenant.
+var ErrNamespaceConflict = errors.New("namespace belongs to another tenant")
+
+// tenantPattern is the DNS-1123 label charset. Consecutive hyphens are rejected separately: they are
+// reserved for the hash separator of shortened names, so a shortened name never equals a verbatim one.
+var tenantPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// reservedTenants would produce namespaces easily mistaken for cluster namespaces.
+var reservedTenants = map[string]bool{
+	"default":         true,
+	"kube-system":     true,
+	"kube-public":     true,
+	"kube-node-lease": true,
+}
+
+// ValidateTenant reports whether tenant can be mapped onto a namespace: lowercase letters, digits and
+// single '-' (not at either end), at most 253 characters, not reserved and not starting with "kube-".
+func ValidateTenant(tenant string) error {
+	switch {
+	case tenant == "":
+		return fmt.Errorf("%w: empty", ErrInvalidTenant)
+	case len(tenant) > maxTenantLength:
+		return fmt.Errorf("%w: longer than %d characters", ErrInvalidTenant, maxTenantLength)
+	case !tenantPattern.MatchString(tenant) || strings.Contains(tenant, "--"):
+		return fmt.Errorf("%w: %q must consist of lowercase letters, digits and single '-', starting and ending with a letter or digit", ErrInvalidTenant, tenant)
+	case reservedTenants[tenant] || strings.HasPrefix(tenant, "kube-"):
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidTenant, tenant)
+	}
+	return nil
+}
+
+// TenantNamespace maps a tenant onto its namespace, "tenant-<tenant>". Names that would exceed the
+// 63-character DNS-1123 label limit are truncated and suffixed with "--" and a hash of the full tenant,
+// so the mapping stays deterministic and distinct tenants never share a namespace.
+func TenantNamespace(tenant string) (string, error) {
+	if err := ValidateTenant(tenant); err != nil {
+		return "", err
+	}
+	return tenantNamespacePrefix + shortenName(tenant, 63-len(tenantNamespacePrefix)), nil
+}
+
+// shortenName returns name if it fits max, otherwise a prefix of name, "--" and a hash of name.
+func shortenName(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	prefix := strings.TrimRight(name[:max-tenantHashLength-2], "-")
+	return prefix + "--" + hex.EncodeToString(sum[:])[:tenantHashLength]
+}
+
+// tenantKey is used to store the tenant the request acts for in the context.
+type tenantKey struct{}
+
+// WithTenant returns a derived context that carries the tenant and its namespace (see TenantNamespace).
+// Namespaces created by the store under this context are labelled with the tenant.
+func WithTenant(ctx context.Context, tenant string) (context.Context, error) {
+	ns, err := TenantNamespace(tenant)
+	if err != nil {
+		return ctx, err
+	}
+	return WithNamespace(context.WithValue(ctx, tenantKey{}, tenant), ns), nil
+}
+
+// tenantFromContext returns the tenant set by WithTenant, or "".
+func tenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
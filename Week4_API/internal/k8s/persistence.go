@@ -0,0 +1,62 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Persistence modes of an instance (models.CreateRedisRequest.Persistence). They are set on create: the
+// operator cannot move the data of a running instance between an emptyDir and PVCs.
+const (
+	PersistenceNone   = "none"    // emptyDir, no snapshots or append-only file: a cache that starts empty
+	PersistenceRDB    = "rdb"     // PVC with RDB snapshots on Redis' default schedule
+	PersistenceAOF    = "aof"     // PVC with an append-only file and no snapshots
+	PersistenceRDBAOF = "rdb+aof" // PVC with both
+
+	defaultPersistence = PersistenceRDB
+)
+
+// ErrInvalidPersistence is returned for unknown persistence modes and for storage settings of instances
+// without persistent storage.
+var ErrInvalidPersistence = errors.New("invalid persistence")
+
+// rdbSaveSchedule is Redis' default snapshot schedule ("after 3600s if 1 key changed", ...).
+const rdbSaveSchedule = "save 3600 1 300 100 60 10000"
+
+// persistenceConfig maps the persistence modes to their spec.redis.customConfig lines. Tenants cannot set
+// these parameters (see redisConfigParams), so patches of the config keep them.
+var persistenceConfig = map[string][]string{
+	PersistenceNone:   {`save ""`, "appendonly no"},
+	PersistenceRDB:    {rdbSaveSchedule, "appendonly no"},
+	PersistenceAOF:    {`save ""`, "appendonly yes"},
+	PersistenceRDBAOF: {rdbSaveSchedule, "appendonly yes"},
+}
+
+// ValidatePersistence checks that mode is a persistence mode; empty selects the default (rdb).
+func ValidatePersistence(mode string) error {
+	if _, ok := persistenceConfig[mode]; mode != "" && !ok {
+		return fmt.Errorf("%w: %q, want one of %s, %s, %s or %s", ErrInvalidPersistence, mode, PersistenceNone, PersistenceRDB, PersistenceAOF, PersistenceRDBAOF)
+	}
+	return nil
+}
+
+// persistenceOf returns the persistence mode of a RedisFailover: none if its Redis data is on an emptyDir,
+// otherwise the mode the appendonly and save lines of its customConfig stand for. Instances created before
+// persistence modes existed have no such lines and snapshot to their PVC (rdb).
+func persistenceOf(obj *unstructured.Unstructured) string {
+	if _, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "redis", "storage", "emptyDir"); found {
+		return PersistenceNone
+	}
+	lines := customConfigOf(obj)
+	snapshots := !slices.Contains(lines, `save ""`)
+	switch {
+	case slices.Contains(lines, "appendonly yes") && snapshots:
+		return PersistenceRDBAOF
+	case slices.Contains(lines, "appendonly yes"):
+		return PersistenceAOF
+	}
+	return PersistenceRDB
+}
@@ -0,0 +1,91 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestPersistence_CreateAndPatch(t *testing.T) {
+	store := newFakeStore(Quota{Storage: resource.MustParse("1Gi")})
+	ctx, err := WithTenant(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("tenant: %v", err)
+	}
+	ptr := func(s string) *string { return &s }
+	for _, invalid := range []models.CreateRedisRequest{
+		{Name: "a", Persistence: "disk"},
+		{Name: "a", Persistence: PersistenceNone, Capacity: "1Gi"},
+		{Name: "a", Persistence: PersistenceNone, StorageClass: "fast"},
+	} {
+		if _, err := store.CreateInstance(ctx, invalid); !errors.Is(err, ErrInvalidPersistence) {
+			t.Fatalf("create %+v: %v, want ErrInvalidPersistence", invalid, err)
+		}
+	}
+	// Redis would load the (empty) append-only file rather than the restored RDB file.
+	for _, mode := range []string{PersistenceAOF, PersistenceRDBAOF} {
+		for _, req := range []models.CreateRedisRequest{
+			{Name: "a", Persistence: mode, RestoreFrom: &models.RestoreSource{RDBURL: "s3://backups/tenant-alice/cache/1.rdb"}},
+			{Name: "a", Persistence: mode, CloneFrom: &models.CloneSource{InstanceID: "cache"}},
+		} {
+			if err := store.ValidateCreate(ctx, req); !errors.Is(err, ErrInvalidRestore) {
+				t.Fatalf("restore with %s: %v, want ErrInvalidRestore", mode, err)
+			}
+		}
+	}
+
+	// Without persistence the plan's storage is not used, so it does not count against the storage quota.
+	rf := store.client.Resource(gvrRedisFailover).Namespace("tenant-alice")
+	inst, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: "cache", Plan: "ha-large", Persistence: PersistenceNone, Config: map[string]string{"maxmemory-policy": "allkeys-lru"}})
+	if err != nil {
+		t.Fatalf("create cache: %v", err)
+	}
+	if inst.Persistence != PersistenceNone || inst.Capacity != "" || inst.Config["maxmemory-policy"] != "allkeys-lru" {
+		t.Fatalf("cache %+v", inst)
+	}
+	obj, _ := rf.Get(ctx, "cache", metav1.GetOptions{})
+	if _, found, _ := unstructured.NestedMap(obj.Object, "spec", "redis", "storage", "emptyDir"); !found {
+		t.Fatalf("cache storage: %v", obj.Object["spec"])
+	}
+	if _, found, _ := unstructured.NestedMap(obj.Object, "spec", "redis", "storage", "persistentVolumeClaim"); found {
+		t.Fatalf("cache has a PVC: %v", obj.Object["spec"])
+	}
+	if lines := customConfigOf(obj); !slices.Equal(lines, []string{`save ""`, "appendonly no", "maxmemory-policy allkeys-lru"}) {
+		t.Fatalf("cache customConfig %q", lines)
+	}
+	if _, err := store.PatchInstance(ctx, "cache", models.PatchInstanceRequest{Capacity: ptr("2Gi")}); !errors.Is(err, ErrInvalidPersistence) {
+		t.Fatalf("patch capacity of cache: %v, want ErrInvalidPersistence", err)
+	}
+	if inst, err = store.PatchInstance(ctx, "cache", models.PatchInstanceRequest{Plan: ptr("standard"), Config: map[string]string{"maxmemory-policy": ""}}); err != nil {
+		t.Fatalf("patch plan of cache: %v", err)
+	}
+	if inst.Persistence != PersistenceNone || inst.Capacity != "" || inst.Config["maxmemory-policy"] != "noeviction" {
+		t.Fatalf("patched cache %+v", inst)
+	}
+
+	for mode, want := range map[string][]string{
+		"":                {rdbSaveSchedule, "appendonly no"},
+		PersistenceAOF:    {`save ""`, "appendonly yes"},
+		PersistenceRDBAOF: {rdbSaveSchedule, "appendonly yes"},
+	} {
+		name := "db-" + map[string]string{"": "default", PersistenceAOF: "aof", PersistenceRDBAOF: "both"}[mode]
+		inst, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: name, Persistence: mode, Capacity: "100Mi"})
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		if wantMode := orDefault(mode, PersistenceRDB); inst.Persistence != wantMode || inst.Capacity != "100Mi" {
+			t.Fatalf("%s: %+v, want persistence %s", name, inst, wantMode)
+		}
+		obj, _ := rf.Get(ctx, name, metav1.GetOptions{})
+		if lines := customConfigOf(obj); !slices.Equal(lines, want) {
+			t.Fatalf("%s customConfig %q, want %q", name, lines, want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// LabelPlan records the plan of an instance on its RedisFailover CR.
+	LabelPlan = "paas.io/plan"
+	// customPlan labels instances created or resized with explicit replicas/resources.
+	customPlan = "custom"
+)
+
+// ErrInvalidPlan is returned for unknown plans and for requests mixing a plan with explicit resources.
+// Handlers should respond with HTTP 400.
+var ErrInvalidPlan = errors.New("invalid plan")
+
+// ErrPlanChangeNotAllowed is returned when PATCH asks for a plan not reachable from the current one.
+// Handlers should respond with HTTP 422.
+var ErrPlanChangeNotAllowed = errors.New("plan change not allowed")
+
+// DefaultPlans is the catalog used when no plans file is configured. "standard" matches the defaults
+// instances were created with before plans existed.
+func DefaultPlans() []models.Plan {
+	return []models.Plan{
+		{
+			Name: "dev", Description: "Single Redis node with one sentinel, for development",
+			RedisReplicas: 1, SentinelReplicas: 1,
+			CPURequest: "50m", MemoryRequest: "64Mi", CPULimit: "250m", MemoryLimit: "256Mi", Storage: "1Gi",
+			UpgradesTo: []string{"standard", "ha-large"},
+		},
+		{
+			Name: "standard", Description: "Three Redis nodes with three sentinels",
+			RedisReplicas: defaultRedisReplicas, SentinelReplicas: defaultSentinelReplicas,
+			CPURequest: defaultCPURequest, MemoryRequest: defaultMemoryRequest, CPULimit: defaultCPULimit, MemoryLimit: defaultMemoryLimit, Storage: defaultStorageSize,
+			UpgradesTo: []string{"ha-large"}, DowngradesTo: []string{"dev"},
+			Default: true,
+		},
+		{
+			Name: "ha-large", Description: "Five larger Redis nodes with three sentinels",
+			RedisReplicas: 5, SentinelReplicas: 3,
+			CPURequest: "250m", MemoryRequest: "512Mi", CPULimit: "1", MemoryLimit: "2Gi", Storage: "5Gi",
+			DowngradesTo: []string{"standard"},
+		},
+	}
+}
+
+// PlanCatalog is a validated, immutable set of plans.
+type PlanCatalog struct {
+	plans  []models.Plan
+	byName map[string]models.Plan
+	def    string
+}
+
+// NewPlanCatalog validates plans: names are unique DNS labels (they become label values), replicas and
+// quantities are valid, transitions name existing plans and at most one plan is the default (the first
+// plan if none is marked).
+func NewPlanCatalog(plans []models.Plan) (*PlanCatalog, error) {
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("plan catalog is empty")
+	}
+	c := &PlanCatalog{byName: make(map[string]models.Plan, len(plans))}
+	for _, p := range plans {
+		if !tenantPattern.MatchString(p.Name) || len(p.Name) > 63 || p.Name == customPlan {
+			return nil, fmt.Errorf("plan %q: name must be a DNS label other than %q", p.Name, customPlan)
+		}
+		if _, dup := c.byName[p.Name]; dup {
+			return nil, fmt.Errorf("plan %q: defined twice", p.Name)
+		}
+		if err := validatePlan(p); err != nil {
+			return nil, fmt.Errorf("plan %q: %w", p.Name, err)
+		}
+		if p.Default {
+			if c.def != "" {
+				return nil, fmt.Errorf("plans %q and %q are both marked default", c.def, p.Name)
+			}
+			c.def = p.Name
+		}
+		c.byName[p.Name] = p
+		c.plans = append(c.plans, p)
+	}
+	for _, p := range plans {
+		for _, next := range append(slices.Clone(p.UpgradesTo), p.DowngradesTo...) {
+			if _, ok := c.byName[next]; !ok {
+				return nil, fmt.Errorf("plan %q: unknown plan %q in upgrade/downgrade paths", p.Name, next)
+			}
+		}
+	}
+	if c.def == "" {
+		c.def = plans[0].Name
+		c.plans[0].Default = true
+		c.byName[c.def] = c.plans[0]
+	}
+	return c, nil
+}
+
+func validatePlan(p models.Plan) error {
+	req := models.CreateRedisRequest{
+		RedisReplicas: &p.RedisReplicas, SentinelReplicas: &p.SentinelReplicas, Capacity: p.Storage,
+		CPURequest: p.CPURequest, MemoryRequest: p.MemoryRequest, CPULimit: p.CPULimit, MemoryLimit: p.MemoryLimit,
+	}
+	if p.Storage == "" || p.CPURequest == "" || p.MemoryRequest == "" || p.CPULimit == "" || p.MemoryLimit == "" {
+		return fmt.Errorf("storage, cpuRequest, memoryRequest, cpuLimit and memoryLimit are required")
+	}
+	return ValidateCreateRedisRequest(req)
+}
+
+// plansFile is the format of the plans file: YAML (or JSON) with a "plans" list of models.Plan.
+type plansFile struct {
+	Plans []models.Plan `json:"plans"`
+}
+
+// LoadPlanCatalog reads the catalog from path, or returns DefaultPlans if path is empty.
+func LoadPlanCatalog(path string) (*PlanCatalog, error) {
+	if path == "" {
+		return NewPlanCatalog(DefaultPlans())
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read plans file: %w", err)
+	}
+	var f plansFile
+	if err := yaml.UnmarshalStrict(b, &f); err != nil {
+		return nil, fmt.Errorf("parse plans file %q: %w", path, err)
+	}
+	return NewPlanCatalog(f.Plans)
+}
+
+// Plans returns all plans in catalog order.
+func (c *PlanCatalog) Plans() []models.Plan {
+	return slices.Clone(c.plans)
+}
+
+// Get returns the named plan.
+func (c *PlanCatalog) Get(name string) (models.Plan, bool) {
+	p, ok := c.byName[name]
+	return p, ok
+}
+
+// Default returns the plan used for creates without plan or explicit resources.
+func (c *PlanCatalog) Default() models.Plan {
+	return c.byName[c.def]
+}
+
+// checkChange allows switching from the current plan to target along UpgradesTo/DowngradesTo. Instances
+// without a known plan (created before plans or with explicit resources) may adopt any plan.
+func (c *PlanCatalog) checkChange(current, target string) error {
+	if current == target {
+		return nil
+	}
+	from, ok := c.byName[current]
+	if !ok {
+		return nil
+	}
+	if slices.Contains(from.UpgradesTo, target) || slices.Contains(from.DowngradesTo, target) {
+		return nil
+	}
+	allowed := append(slices.Clone(from.UpgradesTo), from.DowngradesTo...)
+	return fmt.Errorf("%w: %q cannot change to %q (allowed: %v)", ErrPlanChangeNotAllowed, current, target, allowed)
+}
+
+// resolvePlan returns the plan a create request is based on and the label to record: the requested
+// plan, or the default plan whose values are overridden by explicit fields (labelled "custom" then).
+func (c *PlanCatalog) resolvePlan(req models.CreateRedisRequest) (models.Plan, string, error) {
+	explicit := req.RedisReplicas != nil || req.SentinelReplicas != nil ||
+		req.CPURequest != "" || req.MemoryRequest != "" || req.CPULimit != "" || req.MemoryLimit != ""
+	if req.Plan == "" {
+		if explicit {
+			return c.Default(), customPlan, nil
+		}
+		return c.Default(), c.def, nil
+	}
+	p, ok := c.byName[req.Plan]
+	if !ok {
+		return models.Plan{}, "", fmt.Errorf("%w: unknown plan %q", ErrInvalidPlan, req.Plan)
+	}
+	if explicit {
+		return models.Plan{}, "", fmt.Errorf("%w: plan cannot be combined with explicit replicas or resources", ErrInvalidPlan)
+	}
+	if req.Capacity != "" {
+		capacity, err := resource.ParseQuantity(req.Capacity)
+		if err == nil && capacity.Cmp(resource.MustParse(p.Storage)) < 0 {
+			return models.Plan{}, "", fmt.Errorf("%w: capacity %s is below the %s storage of plan %q", ErrInvalidPlan, req.Capacity, p.Storage, p.Name)
+		}
+	}
+	return p, p.Name, nil
+}
@@ -0,0 +1,107 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPlans_CreateAndChange(t *testing.T) {
+	store := newFakeStore(Quota{})
+	ctx, err := WithTenant(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("tenant: %v", err)
+	}
+	ptr := func(s string) *string { return &s }
+
+	inst, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: "a", Plan: "dev"})
+	if err != nil {
+		t.Fatalf("create with plan: %v", err)
+	}
+	if inst.Plan != "dev" || inst.RedisReplicas != 1 || inst.Capacity != "1Gi" {
+		t.Fatalf("create with plan: got plan %q, %d replicas, capacity %q", inst.Plan, inst.RedisReplicas, inst.Capacity)
+	}
+	if inst, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: "b"}); err != nil || inst.Plan != "standard" {
+		t.Fatalf("create without plan: plan %v, err %v", inst, err)
+	}
+	three := 3
+	if inst, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: "c", RedisReplicas: &three}); err != nil || inst.Plan != customPlan {
+		t.Fatalf("create with explicit replicas: plan %v, err %v", inst, err)
+	}
+	for name, req := range map[string]models.CreateRedisRequest{
+		"unknown plan":     {Name: "d", Plan: "gold"},
+		"plan and fields":  {Name: "d", Plan: "dev", RedisReplicas: &three},
+		"capacity too low": {Name: "d", Plan: "ha-large", Capacity: "1Gi"},
+	} {
+		if _, err := store.CreateInstance(ctx, req); !errors.Is(err, ErrInvalidPlan) {
+			t.Errorf("%s: want ErrInvalidPlan, got %v", name, err)
+		}
+	}
+
+	// dev -> ha-large is an upgrade path; ha-large -> dev skips standard.
+	inst, err = store.PatchInstance(ctx, "a", models.PatchInstanceRequest{Plan: ptr("ha-large")})
+	if err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+	if inst.Plan != "ha-large" || inst.RedisReplicas != 5 || inst.Capacity != "5Gi" {
+		t.Fatalf("upgrade: got plan %q, %d replicas, capacity %q", inst.Plan, inst.RedisReplicas, inst.Capacity)
+	}
+	if _, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{Plan: ptr("dev")}); !errors.Is(err, ErrPlanChangeNotAllowed) {
+		t.Fatalf("ha-large -> dev: want ErrPlanChangeNotAllowed, got %v", err)
+	}
+	// Downgrading keeps the larger volume.
+	inst, err = store.PatchInstance(ctx, "a", models.PatchInstanceRequest{Plan: ptr("standard")})
+	if err != nil {
+		t.Fatalf("downgrade: %v", err)
+	}
+	if inst.Plan != "standard" || inst.RedisReplicas != 3 || inst.Capacity != "5Gi" {
+		t.Fatalf("downgrade: got plan %q, %d replicas, capacity %q", inst.Plan, inst.RedisReplicas, inst.Capacity)
+	}
+
+	// Changing replicas directly leaves the plan; custom instances may adopt any plan.
+	one := 1
+	if inst, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{RedisReplicas: &one}); err != nil || inst.Plan != customPlan {
+		t.Fatalf("replica patch: plan %v, err %v", inst, err)
+	}
+	if inst, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{Plan: ptr("dev")}); err != nil || inst.Plan != "dev" {
+		t.Fatalf("custom -> dev: plan %v, err %v", inst, err)
+	}
+	if _, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{Plan: ptr("dev"), RedisReplicas: &one}); !errors.Is(err, ErrInvalidPlan) {
+		t.Fatalf("plan and replicas: want ErrInvalidPlan, got %v", err)
+	}
+
+	obj, err := store.client.Resource(gvrRedisFailover).Namespace("tenant-alice").Get(ctx, "a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if cpu := nestedStringOr(obj, "", "spec", "redis", "resources", "limits", "cpu"); cpu != "250m" {
+		t.Fatalf("dev plan resources not applied: cpu limit %q", cpu)
+	}
+}
+
+func TestPlanCatalog_Validation(t *testing.T) {
+	dev := DefaultPlans()[0]
+	dev.UpgradesTo = nil
+	for name, plans := range map[string][]models.Plan{
+		"empty":           nil,
+		"custom name":     {func() models.Plan { p := dev; p.Name = customPlan; return p }()},
+		"duplicate":       {dev, dev},
+		"unknown upgrade": {func() models.Plan { p := dev; p.UpgradesTo = []string{"gold"}; return p }()},
+		"bad quantity":    {func() models.Plan { p := dev; p.Storage = "lots"; return p }()},
+	} {
+		if _, err := NewPlanCatalog(plans); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+	c, err := NewPlanCatalog([]models.Plan{dev})
+	if err != nil {
+		t.Fatalf("single plan: %v", err)
+	}
+	if c.Default().Name != "dev" {
+		t.Fatalf("default: got %q, want dev", c.Default().Name)
+	}
+}
@@ -0,0 +1,318 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// tenantQuotaName names the ResourceQuota and LimitRange installed in every tenant namespace.
+	tenantQuotaName = "tenant-quota"
+
+	// Container defaults of the tenant LimitRange. Sentinel pods are created without resources by the
+	// operator, so these apply to them (and make them count against the quota's CPU/memory limits).
+	containerDefaultCPURequest    = "50m"
+	containerDefaultMemoryRequest = "64Mi"
+	containerDefaultCPULimit      = "100m"
+	containerDefaultMemoryLimit   = "128Mi"
+
+	// quotaInstancesResource counts RedisFailover CRs in a ResourceQuota (object count quota).
+	quotaInstancesResource = "count/redisfailovers.databases.spotahome.com"
+)
+
+var (
+	gvrResourceQuotas = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "resourcequotas"}
+	gvrLimitRanges    = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "limitranges"}
+)
+
+// Quota is the resource budget of one tenant. Zero values are unlimited; the zero Quota disables
+// quota objects and checks entirely.
+type Quota struct {
+	MaxInstances int               // RedisFailover instances
+	CPU          resource.Quantity // sum of CPU limits of all Redis and Sentinel pods
+	Memory       resource.Quantity // sum of memory limits of all Redis and Sentinel pods
+	Storage      resource.Quantity // sum of requested PVC storage
+}
+
+// IsZero reports whether no limit is set.
+func (q Quota) IsZero() bool {
+	return q.MaxInstances == 0 && q.CPU.IsZero() && q.Memory.IsZero() && q.Storage.IsZero()
+}
+
+// Usage is what one or more instances consume against a Quota.
+type Usage struct {
+	Instances int
+	CPU       resource.Quantity
+	Memory    resource.Quantity
+	Storage   resource.Quantity
+}
+
+func (u *Usage) add(o Usage) {
+	u.Instances += o.Instances
+	u.CPU.Add(o.CPU)
+	u.Memory.Add(o.Memory)
+	u.Storage.Add(o.Storage)
+}
+
+// QuotaExceededError reports which part of the tenant quota a create or patch would exceed.
+// Handlers should respond with 409 for Resource "instances" and 422 otherwise.
+type QuotaExceededError struct {
+	Resource  string // "instances", "cpu", "memory" or "storage"
+	Requested string // what the request adds
+	Used      string // already in use by other instances
+	Limit     string
+}
+
+func (e *QuotaExceededError) Error() string {
+	if e.Resource == "instances" {
+		return fmt.Sprintf("instance quota exceeded: %s of %s instances in use", e.Used, e.Limit)
+	}
+	return fmt.Sprintf("%s quota exceeded: request needs %s, %s of %s already in use", e.Resource, e.Requested, e.Used, e.Limit)
+}
+
+// check returns a *QuotaExceededError if used plus add exceeds q.
+func (q Quota) check(used, add Usage) error {
+	if q.MaxInstances > 0 && add.Instances > 0 && used.Instances+add.Instances > q.MaxInstances {
+		return &QuotaExceededError{Resource: "instances", Requested: fmt.Sprint(add.Instances), Used: fmt.Sprint(used.Instances), Limit: fmt.Sprint(q.MaxInstances)}
+	}
+	for _, r := range []struct {
+		name        string
+		limit, used resource.Quantity
+		add         resource.Quantity
+	}{
+		{"cpu", q.CPU, used.CPU, add.CPU},
+		{"memory", q.Memory, used.Memory, add.Memory},
+		{"storage", q.Storage, used.Storage, add.Storage},
+	} {
+		if r.limit.IsZero() || r.add.Sign() <= 0 {
+			continue
+		}
+		total := r.used.DeepCopy()
+		total.Add(r.add)
+		if total.Cmp(r.limit) > 0 {
+			return &QuotaExceededError{Resource: r.name, Requested: r.add.String(), Used: r.used.String(), Limit: r.limit.String()}
+		}
+	}
+	return nil
+}
+
+// instanceUsage computes what an instance with the spec d consumes: every Redis replica gets the CPU/memory
+// limits and a PVC of storage (none if StorageSize is empty), every Sentinel replica its limits or, where
+// unset, the LimitRange defaults.
+func instanceUsage(d RedisFailoverTemplateData) (Usage, error) {
+	cpu, err := resource.ParseQuantity(d.CPULimit)
+	if err != nil {
+		return Usage{}, fmt.Errorf("cpuLimit: %w", err)
+	}
+	mem, err := resource.ParseQuantity(d.MemoryLimit)
+	if err != nil {
+		return Usage{}, fmt.Errorf("memoryLimit: %w", err)
+	}
+	sentinelCPU, err := resource.ParseQuantity(orDefault(d.SentinelCPULimit, containerDefaultCPULimit))
+	if err != nil {
+		return Usage{}, fmt.Errorf("sentinelCpuLimit: %w", err)
+	}
+	sentinelMem, err := resource.ParseQuantity(orDefault(d.SentinelMemoryLimit, containerDefaultMemoryLimit))
+	if err != nil {
+		return Usage{}, fmt.Errorf("sentinelMemoryLimit: %w", err)
+	}
+	var size resource.Quantity
+	if d.StorageSize != "" {
+		if size, err = resource.ParseQuantity(d.StorageSize); err != nil {
+			return Usage{}, fmt.Errorf("capacity: %w", err)
+		}
+	}
+	u := Usage{Instances: 1}
+	u.CPU = multiply(cpu, d.RedisReplicas)
+	u.CPU.Add(multiply(sentinelCPU, d.SentinelReplicas))
+	u.Memory = multiply(mem, d.RedisReplicas)
+	u.Memory.Add(multiply(sentinelMem, d.SentinelReplicas))
+	u.Storage = multiply(size, d.RedisReplicas)
+	return u, nil
+}
+
+func multiply(q resource.Quantity, n int) resource.Quantity {
+	out := resource.Quantity{Format: q.Format}
+	for i := 0; i < n; i++ {
+		out.Add(q)
+	}
+	return out
+}
+
+// specUsage reads the usage of an existing RedisFailover CR from its spec (see specTemplateData).
+func specUsage(obj *unstructured.Unstructured) Usage {
+	u, err := instanceUsage(specTemplateData(obj))
+	if err != nil {
+		// Unparseable specs are not ours to judge; count the instance only.
+		return Usage{Instances: 1}
+	}
+	return u
+}
+
+// specTemplateData reads the quota- and patch-relevant fields of an existing RedisFailover CR, with the
+// template defaults for fields that are not set.
+func specTemplateData(obj *unstructured.Unstructured) RedisFailoverTemplateData {
+	data := RedisFailoverTemplateData{
+		RedisReplicas:    nestedIntOr(obj, defaultRedisReplicas, "spec", "redis", "replicas"),
+		SentinelReplicas: nestedIntOr(obj, defaultSentinelReplicas, "spec", "sentinel", "replicas"),
+		CPURequest:       nestedStringOr(obj, defaultCPURequest, "spec", "redis", "resources", "requests", "cpu"),
+		MemoryRequest:    nestedStringOr(obj, defaultMemoryRequest, "spec", "redis", "resources", "requests", "memory"),
+		CPULimit:         nestedStringOr(obj, defaultCPULimit, "spec", "redis", "resources", "limits", "cpu"),
+		MemoryLimit:      nestedStringOr(obj, defaultMemoryLimit, "spec", "redis", "resources", "limits", "memory"),
+		StorageSize:      nestedStringOr(obj, defaultStorageSize, "spec", "redis", "storage", "persistentVolumeClaim", "spec", "resources", "requests", "storage"),
+		Persistence:      persistenceOf(obj),
+
+		SentinelCPURequest:    nestedStringOr(obj, "", "spec", "sentinel", "resources", "requests", "cpu"),
+		SentinelMemoryRequest: nestedStringOr(obj, "", "spec", "sentinel", "resources", "requests", "memory"),
+		SentinelCPULimit:      nestedStringOr(obj, "", "spec", "sentinel", "resources", "limits", "cpu"),
+		SentinelMemoryLimit:   nestedStringOr(obj, "", "spec", "sentinel", "resources", "limits", "memory"),
+	}
+	if data.Persistence == PersistenceNone {
+		data.StorageSize = ""
+	}
+	return data
+}
+
+func nestedIntOr(obj *unstructured.Unstructured, def int, fields ...string) int {
+	if v, found, err := unstructured.NestedInt64(obj.Object, fields...); err == nil && found {
+		return int(v)
+	}
+	return def
+}
+
+func nestedStringOr(obj *unstructured.Unstructured, def string, fields ...string) string {
+	if v, found, err := unstructured.NestedFieldNoCopy(obj.Object, fields...); err == nil && found && v != nil {
+		return fmt.Sprint(v)
+	}
+	return def
+}
+
+// tenantUsage sums the usage of all instances in ns except the one named exclude.
+func (s *RedisFailoverStore) tenantUsage(ctx context.Context, ns, exclude string) (Usage, error) {
+	list, err := s.client.Resource(gvrRedisFailover).Namespace(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return Usage{}, fmt.Errorf("list redisfailovers: %w", err)
+	}
+	var used Usage
+	for i := range list.Items {
+		if list.Items[i].GetName() != exclude {
+			used.add(specUsage(&list.Items[i]))
+		}
+	}
+	return used, nil
+}
+
+// ensureQuota creates or updates the tenant ResourceQuota and LimitRange in ns. The ResourceQuota is the
+// cluster-side backstop (it also counts PVCs kept after an instance was deleted); CreateInstance and
+// PatchInstance check the same limits beforehand to return a clear error.
+func (s *RedisFailoverStore) ensureQuota(ctx context.Context, ns string) error {
+	if s.quota.IsZero() {
+		return nil
+	}
+	hard := map[string]interface{}{}
+	if s.quota.MaxInstances > 0 {
+		hard[quotaInstancesResource] = fmt.Sprint(s.quota.MaxInstances)
+	}
+	if !s.quota.CPU.IsZero() {
+		hard["limits.cpu"] = s.quota.CPU.String()
+	}
+	if !s.quota.Memory.IsZero() {
+		hard["limits.memory"] = s.quota.Memory.String()
+	}
+	if !s.quota.Storage.IsZero() {
+		hard["requests.storage"] = s.quota.Storage.String()
+	}
+	if err := s.applySpec(ctx, gvrResourceQuotas, ns, "ResourceQuota", map[string]interface{}{"hard": hard}); err != nil {
+		return err
+	}
+	limits := map[string]interface{}{
+		"limits": []interface{}{
+			map[string]interface{}{
+				"type": "Container",
+				"defaultRequest": map[string]interface{}{
+					"cpu":    containerDefaultCPURequest,
+					"memory": containerDefaultMemoryRequest,
+				},
+				"default": map[string]interface{}{
+					"cpu":    containerDefaultCPULimit,
+					"memory": containerDefaultMemoryLimit,
+				},
+			},
+		},
+	}
+	return s.applySpec(ctx, gvrLimitRanges, ns, "LimitRange", limits)
+}
+
+// applySpec creates the tenantQuotaName object of kind in ns, or updates its spec if it differs.
+func (s *RedisFailoverStore) applySpec(ctx context.Context, gvr schema.GroupVersionResource, ns, kind string, spec map[string]interface{}) error {
+	client := s.client.Resource(gvr).Namespace(ns)
+	existing, err := client.Get(ctx, tenantQuotaName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		obj := &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       kind,
+				"metadata": map[string]interface{}{
+					"name":      tenantQuotaName,
+					"namespace": ns,
+					"labels":    map[string]interface{}{LabelManagedBy: managedByValue},
+				},
+				"spec": spec,
+			},
+		}
+		if _, err := client.Create(ctx, obj, metav1.CreateOptions{}); err != nil && !k8serrors.IsAlreadyExists(err) {
+			return fmt.Errorf("create %s: %w", kind, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get %s: %w", kind, err)
+	}
+	current, _, _ := unstructured.NestedMap(existing.Object, "spec")
+	if reflect.DeepEqual(current, spec) {
+		return nil
+	}
+	existing.Object["spec"] = spec
+	if _, err := client.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("update %s: %w", kind, err)
+	}
+	return nil
+}
+
+// checkQuota ensures the quota objects in ns and rejects data if the instance would exceed the quota.
+// exclude and current describe the instance being replaced by a patch ("" and zero for a create); only
+// resources that grow beyond current are checked, so shrinking is always allowed.
+func (s *RedisFailoverStore) checkQuota(ctx context.Context, ns, exclude string, current Usage, data RedisFailoverTemplateData) error {
+	if s.quota.IsZero() {
+		return nil
+	}
+	if err := s.ensureQuota(ctx, ns); err != nil {
+		return err
+	}
+	want, err := instanceUsage(data)
+	if err != nil {
+		return fmt.Errorf("validation: %w", err)
+	}
+	used, err := s.tenantUsage(ctx, ns, exclude)
+	if err != nil {
+		return err
+	}
+	if exclude != "" {
+		want.Instances = 0
+		for _, r := range []struct{ want, current *resource.Quantity }{
+			{&want.CPU, &current.CPU}, {&want.Memory, &current.Memory}, {&want.Storage, &current.Storage},
+		} {
+			if r.want.Cmp(*r.current) <= 0 {
+				*r.want = resource.Quantity{}
+			}
+		}
+	}
+	return s.quota.check(used, want)
+}
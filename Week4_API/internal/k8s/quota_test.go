@@ -0,0 +1,206 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newFakeStore(quota Quota) *RedisFailoverStore {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		gvrRedisFailover:  "RedisFailoverList",
+		gvrPods:           "PodList",
+		gvrResourceQuotas: "ResourceQuotaList",
+		gvrLimitRanges:    "LimitRangeList",
+		gvrPVCs:           "PersistentVolumeClaimList",
+		gvrStatefulSets:   "StatefulSetList",
+		gvrDeployments:    "DeploymentList",
+		gvrStorageClasses: "StorageClassList",
+	}, testObject("storage.k8s.io/v1", "StorageClass", "", defaultStorageClass, nil, map[string]interface{}{"allowVolumeExpansion": true}))
+	return NewRedisFailoverStore(client, StoreConfig{
+		Namespace:    "default",
+		TemplatePath: "templates/redis-failover.yaml.tpl",
+		Quota:        quota,
+	})
+}
+
+func TestQuota_CreateAndPatch(t *testing.T) {
+	store := newFakeStore(Quota{MaxInstances: 2, Storage: resource.MustParse("5Gi")})
+	ctx, err := WithTenant(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("tenant: %v", err)
+	}
+	one := 1
+	create := func(name, capacity string, replicas *int) error {
+		_, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: name, Capacity: capacity, RedisReplicas: replicas})
+		return err
+	}
+	quotaResource := func(err error) string {
+		var qe *QuotaExceededError
+		if !errors.As(err, &qe) {
+			t.Fatalf("want QuotaExceededError, got %v", err)
+		}
+		return qe.Resource
+	}
+
+	// 3 replicas x 1Gi fits; another 3Gi does not, 1 replica x 1Gi does.
+	if err := create("a", "1Gi", nil); err != nil {
+		t.Fatalf("create a: %v", err)
+	}
+	if r := quotaResource(create("b", "1Gi", nil)); r != "storage" {
+		t.Fatalf("create b: exceeded %q, want storage", r)
+	}
+	// ValidateCreate checks the same without creating anything.
+	if r := quotaResource(store.ValidateCreate(ctx, models.CreateRedisRequest{Name: "b", Capacity: "1Gi"})); r != "storage" {
+		t.Fatalf("validate b: exceeded %q, want storage", r)
+	}
+	if err := store.ValidateCreate(ctx, models.CreateRedisRequest{Name: "b", Capacity: "1Gi", RedisReplicas: &one}); err != nil {
+		t.Fatalf("validate b with one replica: %v", err)
+	}
+	if err := create("b", "1Gi", &one); err != nil {
+		t.Fatalf("create b with one replica: %v", err)
+	}
+	if r := quotaResource(create("c", "1Mi", &one)); r != "instances" {
+		t.Fatalf("create c: exceeded %q, want instances", r)
+	}
+
+	// Growing a beyond the quota is refused, shrinking is fine.
+	capacity := "2Gi"
+	if r := quotaResource(func() error {
+		_, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{Capacity: &capacity})
+		return err
+	}()); r != "storage" {
+		t.Fatalf("patch a: exceeded %q, want storage", r)
+	}
+	if _, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{RedisReplicas: &one}); err != nil {
+		t.Fatalf("shrink a: %v", err)
+	}
+	if _, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{Capacity: &capacity}); err != nil {
+		t.Fatalf("grow a after shrinking: %v", err)
+	}
+
+	// The namespace carries the ResourceQuota backstop.
+	rq, err := store.client.Resource(gvrResourceQuotas).Namespace("tenant-alice").Get(ctx, tenantQuotaName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("resource quota: %v", err)
+	}
+	hard := rq.Object["spec"].(map[string]interface{})["hard"].(map[string]interface{})
+	if hard["requests.storage"] != "5Gi" || hard[quotaInstancesResource] != "2" {
+		t.Fatalf("resource quota hard: %v", hard)
+	}
+	if _, err := store.client.Resource(gvrLimitRanges).Namespace("tenant-alice").Get(ctx, tenantQuotaName, metav1.GetOptions{}); err != nil {
+		t.Fatalf("limit range: %v", err)
+	}
+}
+
+func TestQuota_ZeroDisablesChecks(t *testing.T) {
+	store := newFakeStore(Quota{})
+	ctx, _ := WithTenant(context.Background(), "bob")
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: name, Capacity: "100Gi"}); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+	if _, err := store.client.Resource(gvrResourceQuotas).Namespace("tenant-bob").Get(ctx, tenantQuotaName, metav1.GetOptions{}); err == nil {
+		t.Fatal("resource quota installed although quota is disabled")
+	}
+}
+
+func TestResources_CreateAndPatch(t *testing.T) {
+	store := newFakeStore(Quota{CPU: resource.MustParse("2")})
+	ctx, err := WithTenant(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("tenant: %v", err)
+	}
+	ptr := func(s string) *string { return &s }
+	for name, invalid := range map[string]models.CreateRedisRequest{
+		"request above limit":             {Name: "a", CPURequest: "1", CPULimit: "500m"},
+		"request above the default limit": {Name: "a", MemoryRequest: "1Gi"},
+		"sentinel request above limit":    {Name: "a", SentinelMemoryRequest: "256Mi", SentinelMemoryLimit: "128Mi"},
+		"sentinel quantity":               {Name: "a", SentinelCPULimit: "fast"},
+		// Unset Sentinel values are the LimitRange defaults (request 64Mi, limit 128Mi).
+		"sentinel request above the default limit": {Name: "a", SentinelMemoryRequest: "256Mi"},
+		"sentinel limit below the default request": {Name: "a", SentinelMemoryLimit: "32Mi"},
+	} {
+		if _, err := store.CreateInstance(ctx, invalid); !errors.Is(err, ErrInvalidResources) {
+			t.Fatalf("%s: %v, want ErrInvalidResources", name, err)
+		}
+	}
+
+	// Sentinel limits count against the quota instead of the LimitRange defaults: 3 x 500m + 3 x 200m > 2.
+	req := models.CreateRedisRequest{Name: "a", SentinelCPULimit: "200m", SentinelMemoryRequest: "32Mi"}
+	var qe *QuotaExceededError
+	if _, err := store.CreateInstance(ctx, req); !errors.As(err, &qe) || qe.Resource != "cpu" {
+		t.Fatalf("create with large sentinels: %v, want cpu quota exceeded", err)
+	}
+	req.SentinelCPULimit = "100m"
+	if _, err := store.CreateInstance(ctx, req); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	rf := store.client.Resource(gvrRedisFailover).Namespace("tenant-alice")
+	obj, _ := rf.Get(ctx, "a", metav1.GetOptions{})
+	sentinel, _, _ := unstructured.NestedMap(obj.Object, "spec", "sentinel", "resources")
+	if want := map[string]interface{}{"requests": map[string]interface{}{"memory": "32Mi"}, "limits": map[string]interface{}{"cpu": "100m"}}; !reflect.DeepEqual(sentinel, want) {
+		t.Fatalf("sentinel resources %v, want %v", sentinel, want)
+	}
+
+	// Patched requests are checked against the current limits, and the result against the quota.
+	if _, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{CPURequest: ptr("1")}); !errors.Is(err, ErrInvalidResources) {
+		t.Fatalf("patch request above current limit: %v, want ErrInvalidResources", err)
+	}
+	if _, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{CPULimit: ptr("")}); !errors.Is(err, ErrInvalidResources) {
+		t.Fatalf("patch empty limit: %v, want ErrInvalidResources", err)
+	}
+	if _, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{CPULimit: ptr("600m")}); !errors.As(err, &qe) || qe.Resource != "cpu" {
+		t.Fatalf("patch beyond quota: %v, want cpu quota exceeded", err)
+	}
+	if _, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{Plan: ptr("standard"), CPULimit: ptr("550m")}); !errors.Is(err, ErrInvalidPlan) {
+		t.Fatalf("patch plan and resources: %v, want ErrInvalidPlan", err)
+	}
+	inst, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{CPURequest: ptr("200m"), CPULimit: ptr("550m")})
+	if err != nil || inst.Plan != customPlan {
+		t.Fatalf("patch resources: %+v, %v", inst, err)
+	}
+	obj, _ = rf.Get(ctx, "a", metav1.GetOptions{})
+	redis, _, _ := unstructured.NestedMap(obj.Object, "spec", "redis", "resources")
+	if want := map[string]interface{}{
+		"requests": map[string]interface{}{"cpu": "200m", "memory": defaultMemoryRequest},
+		"limits":   map[string]interface{}{"cpu": "550m", "memory": defaultMemoryLimit},
+	}; !reflect.DeepEqual(redis, want) {
+		t.Fatalf("redis resources %v, want %v", redis, want)
+	}
+
+	// A Sentinel limit cannot be removed while the request exceeds the default limit, and a patched request
+	// is checked against the current limit rather than the default.
+	if _, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{SentinelMemoryLimit: ptr("512Mi"), SentinelMemoryRequest: ptr("256Mi")}); err != nil {
+		t.Fatalf("patch sentinel memory: %v", err)
+	}
+	if _, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{SentinelMemoryRequest: ptr("384Mi")}); err != nil {
+		t.Fatalf("patch sentinel memory request: %v", err)
+	}
+	if _, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{SentinelMemoryLimit: ptr("")}); !errors.Is(err, ErrInvalidResources) {
+		t.Fatalf("remove sentinel limit below request: %v, want ErrInvalidResources", err)
+	}
+
+	// Empty sentinel values remove the settings; removing them again is a no-op.
+	unset := models.PatchInstanceRequest{SentinelMemoryRequest: ptr(""), SentinelMemoryLimit: ptr(""), SentinelCPULimit: ptr("")}
+	for i := 0; i < 2; i++ {
+		if _, err := store.PatchInstance(ctx, "a", unset); err != nil {
+			t.Fatalf("clear sentinel resources: %v", err)
+		}
+	}
+	obj, _ = rf.Get(ctx, "a", metav1.GetOptions{})
+	if _, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "sentinel", "resources"); found {
+		t.Fatalf("sentinel resources left: %v", obj.Object["spec"])
+	}
+}
@@ -0,0 +1,216 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ErrInvalidConfig is returned when a Redis configuration parameter is not allowed or its value is invalid.
+var ErrInvalidConfig = errors.New("invalid redis config")
+
+// redisConfigCheck validates the value of a Redis configuration parameter.
+type redisConfigCheck func(value string) error
+
+// redisConfigParams are the Redis configuration parameters tenants may set (models.CreateRedisRequest.Config),
+// with their value checks. Values are written to spec.redis.customConfig, which the operator applies with
+// CONFIG SET, so parameters that need a restart or affect replication and persistence are not included.
+var redisConfigParams = map[string]redisConfigCheck{
+	"maxmemory":               memorySizeValue,
+	"maxmemory-policy":        oneOfValue("noeviction", "allkeys-lru", "allkeys-lfu", "allkeys-random", "volatile-lru", "volatile-lfu", "volatile-random", "volatile-ttl"),
+	"maxmemory-samples":       intValue(1, 64),
+	"timeout":                 intValue(0, math.MaxInt32),
+	"tcp-keepalive":           intValue(0, math.MaxInt32),
+	"notify-keyspace-events":  keyspaceEventsValue,
+	"hz":                      intValue(1, 500),
+	"lazyfree-lazy-eviction":  oneOfValue("yes", "no"),
+	"lazyfree-lazy-expire":    oneOfValue("yes", "no"),
+	"slowlog-log-slower-than": intValue(-1, math.MaxInt32),
+	"slowlog-max-len":         intValue(0, 100000),
+}
+
+// redisConfigDefaults are the Redis defaults of redisConfigParams. Resetting a parameter writes its
+// default: the operator only applies the lines in customConfig, so a removed line would keep its value on
+// running pods until they restart. `""` is an empty value, as in `save ""`.
+var redisConfigDefaults = map[string]string{
+	"maxmemory":               "0",
+	"maxmemory-policy":        "noeviction",
+	"maxmemory-samples":       "5",
+	"timeout":                 "0",
+	"tcp-keepalive":           "300",
+	"notify-keyspace-events":  `""`,
+	"hz":                      "10",
+	"lazyfree-lazy-eviction":  "no",
+	"lazyfree-lazy-expire":    "no",
+	"slowlog-log-slower-than": "10000",
+	"slowlog-max-len":         "128",
+}
+
+// memorySizePattern matches Redis memory sizes: bytes, or a number with a k/kb/m/mb/g/gb unit.
+var memorySizePattern = regexp.MustCompile(`^(?i)[0-9]+(b|k|kb|m|mb|g|gb)?$`)
+
+func memorySizeValue(v string) error {
+	if _, ok := memorySizeBytes(v); !ok {
+		return fmt.Errorf("want a memory size such as 100mb or 1gb")
+	}
+	return nil
+}
+
+// memorySizeBytes converts a Redis memory size to bytes: k, m and g are powers of 1000, kb, mb and gb
+// powers of 1024.
+func memorySizeBytes(v string) (int64, bool) {
+	if !memorySizePattern.MatchString(v) {
+		return 0, false
+	}
+	digits := strings.TrimRight(v, "bBkKmMgG")
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	unit := map[string]int64{"": 1, "b": 1, "k": 1e3, "kb": 1 << 10, "m": 1e6, "mb": 1 << 20, "g": 1e9, "gb": 1 << 30}[strings.ToLower(v[len(digits):])]
+	if n > math.MaxInt64/unit {
+		return 0, false
+	}
+	return n * unit, true
+}
+
+func oneOfValue(allowed ...string) redisConfigCheck {
+	return func(v string) error {
+		if !slices.Contains(allowed, v) {
+			return fmt.Errorf("want one of %s", strings.Join(allowed, ", "))
+		}
+		return nil
+	}
+}
+
+func intValue(min, max int) redisConfigCheck {
+	return func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < min || n > max {
+			return fmt.Errorf("want an integer between %d and %d", min, max)
+		}
+		return nil
+	}
+}
+
+// keyspaceEventsValue accepts the event class characters of notify-keyspace-events.
+func keyspaceEventsValue(v string) error {
+	if strings.Trim(v, "KEg$lshzxetmdnA") != "" {
+		return fmt.Errorf("want characters of KEg$lshzxetmdnA")
+	}
+	return nil
+}
+
+// ValidateRedisConfig checks that all parameters are allowed and their values valid. An empty value stands
+// for the Redis default: it is not written on create and on patch sets the parameter to its default (see
+// redisConfigDefaults), which running pods apply without a restart.
+func ValidateRedisConfig(config map[string]string) error {
+	for key, value := range config {
+		check, ok := redisConfigParams[key]
+		if !ok {
+			allowed := make([]string, 0, len(redisConfigParams))
+			for k := range redisConfigParams {
+				allowed = append(allowed, k)
+			}
+			slices.Sort(allowed)
+			return fmt.Errorf("%w: %q cannot be set (allowed: %s)", ErrInvalidConfig, key, strings.Join(allowed, ", "))
+		}
+		if value == "" {
+			continue
+		}
+		if err := check(value); err != nil {
+			return fmt.Errorf("%w: %s %q: %v", ErrInvalidConfig, key, value, err)
+		}
+	}
+	return nil
+}
+
+// validateMaxmemory checks that the maxmemory of the instance's customConfig fits into the memory limit
+// of its Redis containers: above it, the container is killed before Redis evicts keys or refuses writes.
+// maxmemory 0 (no limit, the Redis default) is allowed.
+func validateMaxmemory(d RedisFailoverTemplateData) error {
+	var maxmemory string
+	for _, line := range d.CustomConfig {
+		if key, value, _ := strings.Cut(line, " "); key == "maxmemory" {
+			maxmemory = value
+		}
+	}
+	n, ok := memorySizeBytes(maxmemory)
+	if !ok || n == 0 {
+		return nil
+	}
+	limit, err := resource.ParseQuantity(d.MemoryLimit)
+	if err != nil {
+		return nil // reported by validateResources
+	}
+	if limit.CmpInt64(n) < 0 {
+		return fmt.Errorf("%w: maxmemory %s exceeds the memory limit %s", ErrInvalidConfig, maxmemory, d.MemoryLimit)
+	}
+	return nil
+}
+
+// mergeCustomConfig applies config to customConfig lines ("<parameter> <value>"): a value replaces the
+// line of its parameter or is appended. An empty value replaces the line with the parameter's default
+// (redisConfigDefaults) and adds none if there is no line, as the parameter then has its default already.
+// Lines of other parameters are kept.
+func mergeCustomConfig(lines []string, config map[string]string) []string {
+	out := make([]string, 0, len(lines)+len(config))
+	seen := map[string]bool{}
+	for _, line := range lines {
+		key, _, _ := strings.Cut(line, " ")
+		value, ok := config[key]
+		switch {
+		case !ok:
+			out = append(out, line)
+		case value != "":
+			out = append(out, key+" "+value)
+		default:
+			out = append(out, key+" "+redisConfigDefaults[key])
+		}
+		seen[key] = true
+	}
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if !seen[key] && config[key] != "" {
+			out = append(out, key+" "+config[key])
+		}
+	}
+	return out
+}
+
+// customConfigOf returns the spec.redis.customConfig lines of a RedisFailover.
+func customConfigOf(obj *unstructured.Unstructured) []string {
+	lines, _, _ := unstructured.NestedStringSlice(obj.Object, "spec", "redis", "customConfig")
+	return lines
+}
+
+// redisConfigOf returns the tenant-settable parameters (see redisConfigParams) in the RedisFailover's
+// customConfig, or nil if there are none. `""` is returned as an empty value.
+func redisConfigOf(obj *unstructured.Unstructured) map[string]string {
+	var config map[string]string
+	for _, line := range customConfigOf(obj) {
+		key, value, _ := strings.Cut(line, " ")
+		if _, ok := redisConfigParams[key]; !ok {
+			continue
+		}
+		if config == nil {
+			config = map[string]string{}
+		}
+		if value == `""` {
+			value = ""
+		}
+		config[key] = value
+	}
+	return config
+}
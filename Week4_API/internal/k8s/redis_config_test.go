@@ -0,0 +1,115 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRedisConfig_CreateAndPatch(t *testing.T) {
+	store := newFakeStore(Quota{})
+	ctx, err := WithTenant(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("tenant: %v", err)
+	}
+	for _, invalid := range []map[string]string{
+		{"save": "900 1"},
+		{"maxmemory-policy": "lru"},
+		{"maxmemory": "1 gb"},
+		{"hz": "0"},
+		{"notify-keyspace-events": "Ex;"},
+		{"maxmemory": "1gb"},        // above the standard plan's 512Mi memory limit
+		{"maxmemory": "536870913b"}, // 512Mi + 1
+	} {
+		if _, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: "a", Config: invalid}); !errors.Is(err, ErrInvalidConfig) {
+			t.Fatalf("config %v: %v, want ErrInvalidConfig", invalid, err)
+		}
+	}
+
+	config := map[string]string{"maxmemory-policy": "allkeys-lru", "maxmemory": "256mb", "timeout": ""}
+	inst, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: "a", Config: config})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if want := map[string]string{"maxmemory": "256mb", "maxmemory-policy": "allkeys-lru"}; !maps.Equal(inst.Config, want) {
+		t.Fatalf("config %v, want %v", inst.Config, want)
+	}
+	rf := store.client.Resource(gvrRedisFailover).Namespace("tenant-alice")
+	obj, _ := rf.Get(ctx, "a", metav1.GetOptions{})
+	if lines := customConfigOf(obj); !slices.Equal(lines, []string{rdbSaveSchedule, "appendonly no", "maxmemory 256mb", "maxmemory-policy allkeys-lru"}) {
+		t.Fatalf("customConfig %q", lines)
+	}
+
+	// Lines of parameters tenants cannot set (e.g. from the operator's defaults) are kept by patches.
+	_ = unstructured.SetNestedStringSlice(obj.Object, append(customConfigOf(obj), "maxclients 1000"), "spec", "redis", "customConfig")
+	if _, err := rf.Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{Config: map[string]string{"appendonly": "no"}}); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("patch appendonly: %v, want ErrInvalidConfig", err)
+	}
+	inst, err = store.PatchInstance(ctx, "a", models.PatchInstanceRequest{Config: map[string]string{"maxmemory": "", "maxmemory-policy": "volatile-ttl", "hz": "20"}})
+	if err != nil {
+		t.Fatalf("patch: %v", err)
+	}
+	if want := map[string]string{"maxmemory": "0", "maxmemory-policy": "volatile-ttl", "hz": "20"}; !maps.Equal(inst.Config, want) {
+		t.Fatalf("patched config %v, want %v", inst.Config, want)
+	}
+	obj, _ = rf.Get(ctx, "a", metav1.GetOptions{})
+	if lines := customConfigOf(obj); !slices.Equal(lines, []string{rdbSaveSchedule, "appendonly no", "maxmemory 0", "maxmemory-policy volatile-ttl", "maxclients 1000", "hz 20"}) {
+		t.Fatalf("patched customConfig %q", lines)
+	}
+
+	// maxmemory must stay within the memory limit, also when the limit is lowered.
+	ptr := func(s string) *string { return &s }
+	if _, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{Config: map[string]string{"maxmemory": "600mb"}}); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("patch maxmemory above limit: %v, want ErrInvalidConfig", err)
+	}
+	if inst, err = store.PatchInstance(ctx, "a", models.PatchInstanceRequest{Config: map[string]string{"maxmemory": "512m"}}); err != nil || inst.Config["maxmemory"] != "512m" {
+		t.Fatalf("patch maxmemory: %+v, %v", inst, err)
+	}
+	if _, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{MemoryLimit: ptr("256Mi")}); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("lower memory limit below maxmemory: %v, want ErrInvalidConfig", err)
+	}
+	if inst, err = store.PatchInstance(ctx, "a", models.PatchInstanceRequest{MemoryLimit: ptr("256Mi"), Config: map[string]string{"maxmemory": "200mb"}}); err != nil || inst.Config["maxmemory"] != "200mb" {
+		t.Fatalf("lower memory limit and maxmemory: %+v, %v", inst, err)
+	}
+
+	// On an instance without customConfig (created before persistence modes), resetting parameters it does
+	// not have is a no-op; a reset parameter keeps its line with the default, so running pods apply it.
+	if _, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	obj, _ = rf.Get(ctx, "b", metav1.GetOptions{})
+	unstructured.RemoveNestedField(obj.Object, "spec", "redis", "customConfig")
+	if _, err := rf.Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if inst, err = store.PatchInstance(ctx, "b", models.PatchInstanceRequest{Config: map[string]string{"timeout": ""}}); err != nil || inst.Config != nil {
+		t.Fatalf("reset unset timeout: %+v, %v", inst, err)
+	}
+	obj, _ = rf.Get(ctx, "b", metav1.GetOptions{})
+	if _, found, _ := unstructured.NestedStringSlice(obj.Object, "spec", "redis", "customConfig"); found {
+		t.Fatalf("instance b: %v", obj.Object)
+	}
+	for i := 0; i < 2; i++ {
+		if inst, err = store.PatchInstance(ctx, "b", models.PatchInstanceRequest{Config: map[string]string{"hz": "50", "notify-keyspace-events": "Ex"}}); err != nil || inst.Config["hz"] != "50" {
+			t.Fatalf("set hz: %+v, %v", inst, err)
+		}
+		inst, err = store.PatchInstance(ctx, "b", models.PatchInstanceRequest{Config: map[string]string{"hz": "", "notify-keyspace-events": ""}})
+		if want := map[string]string{"hz": "10", "notify-keyspace-events": ""}; err != nil || !maps.Equal(inst.Config, want) {
+			t.Fatalf("reset hz: %+v, %v", inst, err)
+		}
+	}
+	obj, _ = rf.Get(ctx, "b", metav1.GetOptions{})
+	if lines := customConfigOf(obj); !slices.Equal(lines, []string{"hz 10", `notify-keyspace-events ""`}) {
+		t.Fatalf("instance b customConfig %q", lines)
+	}
+}
@@ -0,0 +1,104 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	gvrStatefulSets = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}
+	gvrDeployments  = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+)
+
+// rolledOut reports whether the Redis StatefulSet (rfr-<name>) and the Sentinel Deployment (rfs-<name>)
+// run the RedisFailover's current spec: the operator applied its replicas and resources, the controllers
+// observed that change and no pod of an older revision is left. It is false between a PATCH and the
+// operator's next reconcile, when the pods still match the previous spec.
+func (s *RedisFailoverStore) rolledOut(ctx context.Context, ns string, failover *unstructured.Unstructured) bool {
+	name := failover.GetName()
+	sts, err := s.getWorkload(ctx, gvrStatefulSets, ns, "rfr-"+name)
+	if err != nil || !workloadMatches(sts, failover, "redis") {
+		return false
+	}
+	current, _, _ := unstructured.NestedString(sts.Object, "status", "currentRevision")
+	update, _, _ := unstructured.NestedString(sts.Object, "status", "updateRevision")
+	if current != update {
+		return false
+	}
+	deploy, err := s.getWorkload(ctx, gvrDeployments, ns, "rfs-"+name)
+	if err != nil || !workloadMatches(deploy, failover, "sentinel") {
+		return false
+	}
+	// status.replicas also counts the pods of older ReplicaSets that are still terminating.
+	want, _, _ := unstructured.NestedInt64(failover.Object, "spec", "sentinel", "replicas")
+	replicas, _, _ := unstructured.NestedInt64(deploy.Object, "status", "replicas")
+	return replicas == want
+}
+
+// workloadMatches reports whether a StatefulSet or Deployment has the replicas and the container resources
+// that spec.<role> of the RedisFailover asks for, its controller observed its latest generation and all
+// replicas are updated. The operator names the container after the role ("redis", "sentinel").
+func workloadMatches(w, failover *unstructured.Unstructured, role string) bool {
+	want, _, _ := unstructured.NestedInt64(failover.Object, "spec", role, "replicas")
+	replicas, _, _ := unstructured.NestedInt64(w.Object, "spec", "replicas")
+	observed, _, _ := unstructured.NestedInt64(w.Object, "status", "observedGeneration")
+	updated, _, _ := unstructured.NestedInt64(w.Object, "status", "updatedReplicas")
+	if replicas != want || observed < w.GetGeneration() || updated != want {
+		return false
+	}
+	wantResources, _, _ := unstructured.NestedMap(failover.Object, "spec", role, "resources")
+	containers, _, _ := unstructured.NestedSlice(w.Object, "spec", "template", "spec", "containers")
+	for _, c := range containers {
+		if m, ok := c.(map[string]interface{}); ok && m["name"] == role {
+			got, _ := m["resources"].(map[string]interface{})
+			return resourcesEqual(wantResources, got)
+		}
+	}
+	return false
+}
+
+// resourcesEqual compares the limits and requests of two container resources by quantity, so that "0.5"
+// in the RedisFailover equals the "500m" the API server stores in the workload.
+func resourcesEqual(a, b map[string]interface{}) bool {
+	for _, kind := range []string{"limits", "requests"} {
+		x, _ := a[kind].(map[string]interface{})
+		y, _ := b[kind].(map[string]interface{})
+		if len(x) != len(y) {
+			return false
+		}
+		for name, v := range x {
+			w, ok := y[name]
+			if !ok {
+				return false
+			}
+			qx, errX := resource.ParseQuantity(fmt.Sprint(v))
+			qy, errY := resource.ParseQuantity(fmt.Sprint(w))
+			if errX != nil || errY != nil || qx.Cmp(qy) != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// getWorkload returns the StatefulSet or Deployment ns/name from the cache or the API server (see
+// getFailover).
+func (s *RedisFailoverStore) getWorkload(ctx context.Context, gvr schema.GroupVersionResource, ns, name string) (*unstructured.Unstructured, error) {
+	if c := s.cached(); c != nil {
+		inf := c.statefulSets
+		if gvr == gvrDeployments {
+			inf = c.deployments
+		}
+		obj, err := inf.Lister().ByNamespace(ns).Get(name)
+		if err != nil {
+			return nil, err
+		}
+		return asUnstructured(obj)
+	}
+	return s.client.Resource(gvr).Namespace(ns).Get(ctx, name, metav1.GetOptions{})
+}
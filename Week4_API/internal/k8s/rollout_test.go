@@ -0,0 +1,116 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// testWorkload returns a fully rolled out StatefulSet or Deployment at generation 1.
+func testWorkload(kind, ns, name, container string, replicas int64, resources map[string]interface{}) *unstructured.Unstructured {
+	w := testObject("apps/v1", kind, ns, name, nil, map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+			"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": []interface{}{map[string]interface{}{"name": container, "resources": resources}},
+			}},
+		},
+		"status": map[string]interface{}{
+			"observedGeneration": int64(1),
+			"replicas":           replicas,
+			"updatedReplicas":    replicas,
+			"currentRevision":    "rev-1",
+			"updateRevision":     "rev-1",
+		},
+	})
+	w.SetGeneration(1)
+	return w
+}
+
+func TestInstanceProgress_RolledOut(t *testing.T) {
+	const ns = "tenant-alice"
+	store := newFakeStore(Quota{})
+	ctx, err := WithTenant(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("tenant: %v", err)
+	}
+	if _, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: "a"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	rolledOut := func() bool {
+		t.Helper()
+		p, err := store.InstanceProgress(ctx, "a")
+		if err != nil {
+			t.Fatalf("progress: %v", err)
+		}
+		return p.RolledOut
+	}
+	if rolledOut() {
+		t.Fatal("rolled out before the operator created the workloads")
+	}
+
+	// The template's Redis resources, with the CPU limit as the API server might normalize it.
+	redisResources := map[string]interface{}{
+		"requests": map[string]interface{}{"cpu": "100m", "memory": "128Mi"},
+		"limits":   map[string]interface{}{"cpu": "0.5", "memory": "512Mi"},
+	}
+	sts := store.client.Resource(gvrStatefulSets).Namespace(ns)
+	deploys := store.client.Resource(gvrDeployments).Namespace(ns)
+	if _, err := sts.Create(ctx, testWorkload("StatefulSet", ns, "rfr-a", "redis", 3, redisResources), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := deploys.Create(ctx, testWorkload("Deployment", ns, "rfs-a", "sentinel", 3, nil), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !rolledOut() {
+		t.Fatal("not rolled out with matching workloads")
+	}
+
+	for name, change := range map[string]func(sts, deploy *unstructured.Unstructured){
+		"previous resources": func(sts, _ *unstructured.Unstructured) {
+			old := map[string]interface{}{"limits": map[string]interface{}{"cpu": "500m", "memory": "256Mi"}, "requests": redisResources["requests"]}
+			_ = unstructured.SetNestedSlice(sts.Object, []interface{}{map[string]interface{}{"name": "redis", "resources": old}}, "spec", "template", "spec", "containers")
+		},
+		"previous replicas": func(sts, _ *unstructured.Unstructured) {
+			_ = unstructured.SetNestedField(sts.Object, int64(2), "spec", "replicas")
+		},
+		"generation unseen": func(sts, _ *unstructured.Unstructured) { sts.SetGeneration(2) },
+		"revision rolling": func(sts, _ *unstructured.Unstructured) {
+			_ = unstructured.SetNestedField(sts.Object, "rev-2", "status", "updateRevision")
+		},
+		"pods not updated": func(_, d *unstructured.Unstructured) {
+			_ = unstructured.SetNestedField(d.Object, int64(1), "status", "updatedReplicas")
+		},
+		"old pod terminating": func(_, d *unstructured.Unstructured) {
+			_ = unstructured.SetNestedField(d.Object, int64(4), "status", "replicas")
+		},
+	} {
+		s := testWorkload("StatefulSet", ns, "rfr-a", "redis", 3, redisResources)
+		d := testWorkload("Deployment", ns, "rfs-a", "sentinel", 3, nil)
+		change(s, d)
+		if _, err := sts.Update(ctx, s, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := deploys.Update(ctx, d, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if rolledOut() {
+			t.Errorf("%s: reported as rolled out", name)
+		}
+	}
+
+	// After the CR is deleted the pods that are left are reported.
+	if _, err := store.client.Resource(gvrPods).Namespace(ns).Create(ctx, readyPod(ns, "rfr-a-0", "a"), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.client.Resource(gvrRedisFailover).Namespace(ns).Delete(ctx, "a", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := store.InstanceProgress(ctx, "a"); err != nil || !p.Deleted || p.Pods != 1 {
+		t.Fatalf("progress after delete: %+v, %v", p, err)
+	}
+}
@@ -0,0 +1,241 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var (
+	gvrPVCs           = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "persistentvolumeclaims"}
+	gvrStorageClasses = schema.GroupVersionResource{Group: "storage.k8s.io", Version: "v1", Resource: "storageclasses"}
+)
+
+// annotationDefaultStorageClass marks the StorageClass of PVCs without storageClassName.
+const annotationDefaultStorageClass = "storageclass.kubernetes.io/is-default-class"
+
+// ErrInvalidStorageClass is returned for create requests with a StorageClass that does not exist or is not
+// in the store's allowlist.
+var ErrInvalidStorageClass = errors.New("invalid storage class")
+
+// ErrCapacityShrink is returned for capacity changes below the current size: PVCs cannot shrink.
+var ErrCapacityShrink = errors.New("capacity cannot be reduced")
+
+// ErrVolumeExpansionUnsupported is returned for capacity increases on instances whose StorageClass does
+// not allow volume expansion.
+var ErrVolumeExpansionUnsupported = errors.New("volume expansion not supported")
+
+// Volume states in models.VolumeStatus besides the PVC resize conditions (Resizing,
+// FileSystemResizePending, ControllerResizeError, NodeResizeError).
+const (
+	volumePending  = "Pending"  // the PVC does not request the new size yet
+	volumeResizing = "Resizing" // requested, the resize controller has not reported progress yet
+)
+
+// checkCapacityChange returns ErrCapacityShrink if to is below the current size from, and
+// ErrVolumeExpansionUnsupported if it is above and the instance's StorageClass does not allow expansion.
+func (s *RedisFailoverStore) checkCapacityChange(ctx context.Context, obj *unstructured.Unstructured, from, to string) error {
+	want, err := resource.ParseQuantity(to)
+	if err != nil {
+		return fmt.Errorf("validation: capacity: invalid quantity %q: %w", to, err)
+	}
+	current, err := resource.ParseQuantity(from)
+	if err != nil {
+		// No usable size in the spec; the volumes themselves are still checked by Kubernetes.
+		return nil
+	}
+	switch want.Cmp(current) {
+	case 0:
+		return nil
+	case -1:
+		return fmt.Errorf("%w: %s is below the current %s", ErrCapacityShrink, to, from)
+	}
+	className, _, _ := unstructured.NestedString(obj.Object, "spec", "redis", "storage", "persistentVolumeClaim", "spec", "storageClassName")
+	class, err := s.storageClass(ctx, className)
+	if err != nil {
+		return err
+	}
+	if expandable, _, _ := unstructured.NestedBool(class.Object, "allowVolumeExpansion"); !expandable {
+		return fmt.Errorf("%w: storage class %q does not allow volume expansion", ErrVolumeExpansionUnsupported, class.GetName())
+	}
+	return nil
+}
+
+// storageClass returns the StorageClass name or, if name is empty, the cluster's default class.
+// Returns ErrVolumeExpansionUnsupported if there is no such class.
+func (s *RedisFailoverStore) storageClass(ctx context.Context, name string) (*unstructured.Unstructured, error) {
+	if name != "" {
+		class, err := s.client.Resource(gvrStorageClasses).Get(ctx, name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: storage class %q not found", ErrVolumeExpansionUnsupported, name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get storage class %q: %w", name, err)
+		}
+		return class, nil
+	}
+	list, err := s.client.Resource(gvrStorageClasses).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list storage classes: %w", err)
+	}
+	for i := range list.Items {
+		if list.Items[i].GetAnnotations()[annotationDefaultStorageClass] == "true" {
+			return &list.Items[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no default storage class", ErrVolumeExpansionUnsupported)
+}
+
+// storageClassAllowed reports whether instances may use the StorageClass name.
+func (s *RedisFailoverStore) storageClassAllowed(name string) bool {
+	return len(s.storageClasses) == 0 || slices.Contains(s.storageClasses, name)
+}
+
+// ListStorageClasses returns the cluster's StorageClasses that instances may use, sorted by name.
+func (s *RedisFailoverStore) ListStorageClasses(ctx context.Context) ([]models.StorageClass, error) {
+	list, err := s.client.Resource(gvrStorageClasses).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list storage classes: %w", err)
+	}
+	classes := []models.StorageClass{}
+	for i := range list.Items {
+		class := &list.Items[i]
+		if !s.storageClassAllowed(class.GetName()) {
+			continue
+		}
+		expandable, _, _ := unstructured.NestedBool(class.Object, "allowVolumeExpansion")
+		classes = append(classes, models.StorageClass{
+			Name:                 class.GetName(),
+			Provisioner:          nestedStringOr(class, "", "provisioner"),
+			AllowVolumeExpansion: expandable,
+			Default:              class.GetName() == orDefault(s.defaultStorageClass, defaultStorageClass),
+		})
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i].Name < classes[j].Name })
+	return classes, nil
+}
+
+// checkStorageClass returns ErrInvalidStorageClass if instances may not use the StorageClass name or it
+// does not exist: PVCs of a missing class stay Pending.
+func (s *RedisFailoverStore) checkStorageClass(ctx context.Context, name string) error {
+	if !s.storageClassAllowed(name) {
+		return fmt.Errorf("%w: %q is not allowed (allowed: %s)", ErrInvalidStorageClass, name, strings.Join(s.storageClasses, ", "))
+	}
+	_, err := s.client.Resource(gvrStorageClasses).Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return fmt.Errorf("%w: %q does not exist", ErrInvalidStorageClass, name)
+	}
+	if err != nil {
+		return fmt.Errorf("get storage class %q: %w", name, err)
+	}
+	return nil
+}
+
+// isInstanceVolume reports whether the PVC belongs to the Redis StatefulSet of instance name: the operator
+// names the StatefulSet rfr-<name>, whose PVCs are <claim>-rfr-<name>-<ordinal> with claim <name>-data.
+func isInstanceVolume(pvc *unstructured.Unstructured, name string) bool {
+	return strings.HasPrefix(pvc.GetName(), name+"-data-rfr-"+name+"-")
+}
+
+// expandVolumes requests size on the instance's PVCs that request less: Kubernetes does not resize the
+// PVCs of a StatefulSet when its claim template changes.
+func (s *RedisFailoverStore) expandVolumes(ctx context.Context, ns, name, size string) error {
+	want, err := resource.ParseQuantity(size)
+	if err != nil {
+		return err
+	}
+	list, err := s.client.Resource(gvrPVCs).Namespace(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list persistentvolumeclaims: %w", err)
+	}
+	patch, err := json.Marshal([]jsonPatchOp{{Op: "replace", Path: "/spec/resources/requests/storage", Value: size}})
+	if err != nil {
+		return err
+	}
+	for i := range list.Items {
+		pvc := &list.Items[i]
+		if !isInstanceVolume(pvc, name) {
+			continue
+		}
+		if requested, err := resource.ParseQuantity(nestedStringOr(pvc, "", "spec", "resources", "requests", "storage")); err == nil && requested.Cmp(want) >= 0 {
+			continue
+		}
+		if _, err := s.client.Resource(gvrPVCs).Namespace(ns).Patch(ctx, pvc.GetName(), types.JSONPatchType, patch, metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("patch persistentvolumeclaim %q: %w", pvc.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// attachStorageResize sets inst.StorageResize if any of the instance's bound PVCs is smaller than its
+// capacity. Errors reading the PVCs leave it unset.
+func (s *RedisFailoverStore) attachStorageResize(ctx context.Context, inst *models.RedisInstance) {
+	if inst == nil || inst.Capacity == "" {
+		return
+	}
+	want, err := resource.ParseQuantity(inst.Capacity)
+	if err != nil {
+		return
+	}
+	pvcs, err := s.listVolumes(ctx, inst.Namespace)
+	if err != nil {
+		return
+	}
+	var volumes []models.VolumeStatus
+	for _, pvc := range pvcs {
+		if !isInstanceVolume(pvc, inst.ID) {
+			continue
+		}
+		if v, resizing := volumeResize(pvc, want); resizing {
+			volumes = append(volumes, v)
+		}
+	}
+	if len(volumes) > 0 {
+		inst.StorageResize = &models.VolumeResize{Capacity: inst.Capacity, Volumes: volumes}
+	}
+}
+
+// volumeResize returns the resize state of a PVC that is bound with less than want.
+func volumeResize(pvc *unstructured.Unstructured, want resource.Quantity) (models.VolumeStatus, bool) {
+	capacity, found, _ := unstructured.NestedString(pvc.Object, "status", "capacity", "storage")
+	if !found {
+		return models.VolumeStatus{}, false // not bound yet
+	}
+	if size, err := resource.ParseQuantity(capacity); err != nil || size.Cmp(want) >= 0 {
+		return models.VolumeStatus{}, false
+	}
+	v := models.VolumeStatus{Name: pvc.GetName(), Capacity: capacity, State: volumeResizing}
+	if requested, err := resource.ParseQuantity(nestedStringOr(pvc, "", "spec", "resources", "requests", "storage")); err != nil || requested.Cmp(want) < 0 {
+		v.State = volumePending
+	}
+	if allocation, _, _ := unstructured.NestedString(pvc.Object, "status", "allocatedResourceStatuses", "storage"); allocation != "" {
+		v.State = allocation
+	}
+	// Conditions are more specific than the allocation status; errors win over progress.
+	conditions, _, _ := unstructured.NestedSlice(pvc.Object, "status", "conditions")
+	for _, c := range conditions {
+		m, ok := c.(map[string]interface{})
+		if !ok || m["status"] != "True" {
+			continue
+		}
+		condType, _ := m["type"].(string)
+		message, _ := m["message"].(string)
+		if strings.HasSuffix(condType, "Error") || !strings.HasSuffix(v.State, "Error") {
+			v.State, v.Message = condType, message
+		}
+	}
+	return v, true
+}
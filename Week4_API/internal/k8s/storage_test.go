@@ -0,0 +1,188 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testPVC(ns, name, requested, capacity string, conditions ...string) *unstructured.Unstructured {
+	status := map[string]interface{}{"capacity": map[string]interface{}{"storage": capacity}}
+	var conds []interface{}
+	for _, c := range conditions {
+		conds = append(conds, map[string]interface{}{"type": c, "status": "True", "message": c + " message"})
+	}
+	if conds != nil {
+		status["conditions"] = conds
+	}
+	return testObject("v1", "PersistentVolumeClaim", ns, name, nil, map[string]interface{}{
+		"spec":   map[string]interface{}{"resources": map[string]interface{}{"requests": map[string]interface{}{"storage": requested}}},
+		"status": status,
+	})
+}
+
+func TestCapacityChange(t *testing.T) {
+	const ns = "tenant-alice"
+	store := newFakeStore(Quota{})
+	ctx, err := WithTenant(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("tenant: %v", err)
+	}
+	ptr := func(s string) *string { return &s }
+	classes := store.client.Resource(gvrStorageClasses)
+	for _, name := range []string{"fixed", "gone"} {
+		if _, err := classes.Create(ctx, testObject("storage.k8s.io/v1", "StorageClass", "", name, nil, nil), metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, req := range []models.CreateRedisRequest{
+		{Name: "a", Capacity: "1Gi"},
+		{Name: "fixed", Capacity: "1Gi", StorageClass: "fixed"},
+		{Name: "gone", Capacity: "1Gi", StorageClass: "gone"},
+	} {
+		if _, err := store.CreateInstance(ctx, req); err != nil {
+			t.Fatalf("create %s: %v", req.Name, err)
+		}
+	}
+	if err := classes.Delete(ctx, "gone", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	pvcs := store.client.Resource(gvrPVCs).Namespace(ns)
+	for _, pvc := range []*unstructured.Unstructured{
+		testPVC(ns, "a-data-rfr-a-0", "1Gi", "1Gi"),
+		testPVC(ns, "a-data-rfr-a-1", "1Gi", "1Gi"),
+		testPVC(ns, "fixed-data-rfr-fixed-0", "1Gi", "1Gi"),
+	} {
+		if _, err := pvcs.Create(ctx, pvc, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for id, want := range map[string]error{"fixed": ErrVolumeExpansionUnsupported, "gone": ErrVolumeExpansionUnsupported, "a": ErrCapacityShrink} {
+		capacity := "2Gi"
+		if id == "a" {
+			capacity = "512Mi"
+		}
+		if _, err := store.PatchInstance(ctx, id, models.PatchInstanceRequest{Capacity: ptr(capacity)}); !errors.Is(err, want) {
+			t.Fatalf("patch %s to %s: %v, want %v", id, capacity, err, want)
+		}
+	}
+	// Keeping the size needs no expansion; plan upgrades that grow storage do.
+	if _, err := store.PatchInstance(ctx, "fixed", models.PatchInstanceRequest{Capacity: ptr("1Gi")}); err != nil {
+		t.Fatalf("patch fixed to its size: %v", err)
+	}
+	if _, err := store.PatchInstance(ctx, "fixed", models.PatchInstanceRequest{Plan: ptr("ha-large")}); !errors.Is(err, ErrVolumeExpansionUnsupported) {
+		t.Fatalf("upgrade fixed: %v, want ErrVolumeExpansionUnsupported", err)
+	}
+
+	// Growing requests the size on the PVCs; GET reports them until they have it.
+	if _, err := store.PatchInstance(ctx, "a", models.PatchInstanceRequest{Capacity: ptr("2Gi")}); err != nil {
+		t.Fatalf("patch a: %v", err)
+	}
+	for _, name := range []string{"a-data-rfr-a-0", "a-data-rfr-a-1"} {
+		pvc, _ := pvcs.Get(ctx, name, metav1.GetOptions{})
+		if got := nestedStringOr(pvc, "", "spec", "resources", "requests", "storage"); got != "2Gi" {
+			t.Fatalf("%s requests %s, want 2Gi", name, got)
+		}
+	}
+	if pvc, _ := pvcs.Get(ctx, "fixed-data-rfr-fixed-0", metav1.GetOptions{}); nestedStringOr(pvc, "", "spec", "resources", "requests", "storage") != "1Gi" {
+		t.Fatalf("volume of another instance changed: %v", pvc.Object)
+	}
+	if _, err := pvcs.Update(ctx, testPVC(ns, "a-data-rfr-a-0", "2Gi", "1Gi", "Resizing", "FileSystemResizePending"), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	inst, err := store.GetInstance(ctx, "a")
+	if err != nil || inst.StorageResize == nil || inst.StorageResize.Capacity != "2Gi" || len(inst.StorageResize.Volumes) != 2 {
+		t.Fatalf("get a while resizing: %+v, %v", inst, err)
+	}
+	for _, v := range inst.StorageResize.Volumes {
+		want := map[string]string{"a-data-rfr-a-0": "FileSystemResizePending", "a-data-rfr-a-1": volumeResizing}[v.Name]
+		if v.State != want || v.Capacity != "1Gi" {
+			t.Fatalf("volume %+v, want state %s", v, want)
+		}
+	}
+	for _, name := range []string{"a-data-rfr-a-0", "a-data-rfr-a-1"} {
+		if _, err := pvcs.Update(ctx, testPVC(ns, name, "2Gi", "2Gi"), metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if inst, err = store.GetInstance(ctx, "a"); err != nil || inst.StorageResize != nil {
+		t.Fatalf("get a after resize: %+v, %v", inst, err)
+	}
+}
+
+func TestVolumeResize_States(t *testing.T) {
+	want := resource.MustParse("2Gi")
+	for name, tc := range map[string]struct {
+		pvc   *unstructured.Unstructured
+		state string
+	}{
+		"not requested":  {testPVC("ns", "v", "1Gi", "1Gi"), volumePending},
+		"requested":      {testPVC("ns", "v", "2Gi", "1Gi"), volumeResizing},
+		"condition":      {testPVC("ns", "v", "2Gi", "1Gi", "Resizing"), "Resizing"},
+		"error wins":     {testPVC("ns", "v", "2Gi", "1Gi", "ControllerResizeError", "Resizing"), "ControllerResizeError"},
+		"done":           {testPVC("ns", "v", "2Gi", "2Gi"), ""},
+		"larger already": {testPVC("ns", "v", "5Gi", "5Gi"), ""},
+	} {
+		v, resizing := volumeResize(tc.pvc, want)
+		if resizing != (tc.state != "") || v.State != tc.state {
+			t.Errorf("%s: %+v (resizing %v), want state %q", name, v, resizing, tc.state)
+		}
+	}
+}
+
+func TestStorageClasses_ListAndCreate(t *testing.T) {
+	store := newFakeStore(Quota{})
+	ctx, err := WithTenant(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("tenant: %v", err)
+	}
+	classes := store.client.Resource(gvrStorageClasses)
+	for _, name := range []string{"fast", "internal"} {
+		if _, err := classes.Create(ctx, testObject("storage.k8s.io/v1", "StorageClass", "", name, nil, map[string]interface{}{"provisioner": "csi.example.com"}), metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := store.ListStorageClasses(ctx)
+	if err != nil || len(list) != 3 {
+		t.Fatalf("list without allowlist: %+v, %v", list, err)
+	}
+
+	store.storageClasses = []string{defaultStorageClass, "fast", "missing"}
+	list, err = store.ListStorageClasses(ctx)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	want := []models.StorageClass{
+		{Name: "fast", Provisioner: "csi.example.com"},
+		{Name: defaultStorageClass, AllowVolumeExpansion: true, Default: true},
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Fatalf("list %+v, want %+v", list, want)
+	}
+
+	for _, class := range []string{"internal", "missing", "typo"} {
+		if _, err := store.CreateInstance(ctx, models.CreateRedisRequest{Name: "a", StorageClass: class}); !errors.Is(err, ErrInvalidStorageClass) {
+			t.Fatalf("create on %s: %v, want ErrInvalidStorageClass", class, err)
+		}
+	}
+	if _, err := store.client.Resource(gvrRedisFailover).Namespace("tenant-alice").Get(ctx, "a", metav1.GetOptions{}); err == nil {
+		t.Fatal("instance created on an invalid storage class")
+	}
+	for _, req := range []models.CreateRedisRequest{
+		{Name: "a", StorageClass: "fast"},
+		{Name: "b"},
+		{Name: "c", Persistence: PersistenceNone},
+	} {
+		if _, err := store.CreateInstance(ctx, req); err != nil {
+			t.Fatalf("create %s: %v", req.Name, err)
+		}
+	}
+}
@@ -31,10 +31,15 @@ func RenderRedisFailoverTemplate(templatePath string, data RedisFailoverTemplate
 }
 
 // DecodeYAMLToUnstructured decodes YAML bytes into an unstructured Kubernetes object.
-// The result can be passed to the dynamic client for create/update.
+// The result can be passed to the dynamic client for create/update. Integers decode as int64, as in
+// objects returned by the API server.
 func DecodeYAMLToUnstructured(yamlBytes []byte) (*unstructured.Unstructured, error) {
+	jsonBytes, err := yaml.YAMLToJSON(yamlBytes)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal yaml to unstructured: %w", err)
+	}
 	obj := &unstructured.Unstructured{}
-	if err := yaml.Unmarshal(yamlBytes, &obj.Object); err != nil {
+	if err := obj.UnmarshalJSON(jsonBytes); err != nil {
 		return nil, fmt.Errorf("unmarshal yaml to unstructured: %w", err)
 	}
 	
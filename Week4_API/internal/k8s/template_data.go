@@ -1,6 +1,7 @@
 package k8s
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
@@ -18,8 +19,24 @@ type RedisFailoverTemplateData struct {
 	CPULimit         string
 	MemoryLimit      string
 	StorageClass     string
-	StorageSize      string
+	StorageSize      string // empty without persistent storage
+	Persistence      string // PersistenceNone renders an emptyDir instead of PVCs
 	SecretName       string
+	Plan             string   // value of the LabelPlan label
+	CustomConfig     []string // spec.redis.customConfig lines ("<parameter> <value>"), see ValidateRedisConfig
+
+	// Sentinel resources; empty values are not rendered, so the LimitRange defaults apply.
+	SentinelCPURequest    string
+	SentinelMemoryRequest string
+	SentinelCPULimit      string
+	SentinelMemoryLimit   string
+
+	// Restore init container (see RedisFailoverStore.restoreData); RestoreFrom is empty for empty instances.
+	RestoreFrom     string // s3://<bucket>/<key> of the RDB file seeding the data volume
+	RestoreImage    string // runs the aws CLI
+	RestoreEndpoint string
+	RestoreRegion   string
+	RestoreSecret   string // holds AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
 }
 
 const (
@@ -36,7 +53,11 @@ const (
 	maxReplicas = 9
 )
 
+// ErrInvalidResources is returned for CPU/memory values that are not quantities and for requests above limits.
+var ErrInvalidResources = errors.New("invalid resources")
+
 // ValidateCreateRedisRequest validates replicas, storage, and resource fields before rendering or calling the API.
+// Resource requests may not exceed the limits given with them (see validateResources).
 func ValidateCreateRedisRequest(req models.CreateRedisRequest) error {
 	if req.RedisReplicas != nil {
 		if n := *req.RedisReplicas; n < minReplicas || n > maxReplicas {
@@ -48,29 +69,85 @@ func ValidateCreateRedisRequest(req models.CreateRedisRequest) error {
 			return fmt.Errorf("sentinelReplicas must be between %d and %d, got %d", minReplicas, maxReplicas, n)
 		}
 	}
+	if req.CloneFrom != nil && req.RestoreFrom != nil {
+		return fmt.Errorf("%w: cloneFrom and restoreFrom cannot be combined", ErrInvalidRestore)
+	}
+	if req.CloneFrom != nil && req.CloneFrom.InstanceID == "" {
+		return fmt.Errorf("%w: cloneFrom.instanceId is required", ErrInvalidRestore)
+	}
+	if req.RestoreFrom != nil && req.RestoreFrom.RDBURL == "" {
+		return fmt.Errorf("%w: restoreFrom.rdbUrl is required", ErrInvalidRestore)
+	}
+	if req.BackupSchedule != nil {
+		if err := ValidateBackupSchedule(*req.BackupSchedule); err != nil {
+			return err
+		}
+	}
+	if err := ValidateRedisConfig(req.Config); err != nil {
+		return err
+	}
+	if err := ValidatePersistence(req.Persistence); err != nil {
+		return err
+	}
+	if req.Persistence == PersistenceNone && (req.Capacity != "" || req.StorageClass != "") {
+		return fmt.Errorf("%w: capacity and storageClass cannot be set without persistent storage", ErrInvalidPersistence)
+	}
+	// With an append-only file Redis loads it instead of the restored RDB file and starts empty.
+	if (req.CloneFrom != nil || req.RestoreFrom != nil) && (req.Persistence == PersistenceAOF || req.Persistence == PersistenceRDBAOF) {
+		return fmt.Errorf("%w: cloneFrom and restoreFrom need persistence %s or %s, Redis would not load the data with an append-only file", ErrInvalidRestore, PersistenceRDB, PersistenceNone)
+	}
 	if req.Capacity != "" {
 		if _, err := resource.ParseQuantity(req.Capacity); err != nil {
 			return fmt.Errorf("capacity: invalid quantity %q: %w", req.Capacity, err)
 		}
 	}
-	if req.CPURequest != "" {
-		if _, err := resource.ParseQuantity(req.CPURequest); err != nil {
-			return fmt.Errorf("cpuRequest: invalid quantity %q: %w", req.CPURequest, err)
+	return validateResources(RedisFailoverTemplateData{
+		CPURequest: req.CPURequest, MemoryRequest: req.MemoryRequest, CPULimit: req.CPULimit, MemoryLimit: req.MemoryLimit,
+		SentinelCPURequest: req.SentinelCPURequest, SentinelMemoryRequest: req.SentinelMemoryRequest,
+		SentinelCPULimit: req.SentinelCPULimit, SentinelMemoryLimit: req.SentinelMemoryLimit,
+	})
+}
+
+// validateResources checks the Redis and Sentinel resources of d: set values must be quantities, and
+// requests may not exceed the limits. Sentinel pods get the tenant LimitRange's container defaults for
+// an unset request or limit (see ensureQuota), so those are compared instead. Used for requests as well
+// as for the spec an instance gets from a plan or patch.
+func validateResources(d RedisFailoverTemplateData) error {
+	return checkResources(d, true)
+}
+
+// checkResources implements validateResources; without sentinelDefaults, unset Sentinel values are not
+// compared.
+func checkResources(d RedisFailoverTemplateData, sentinelDefaults bool) error {
+	for _, r := range []struct {
+		requestField, request, defaultRequest string
+		limitField, limit, defaultLimit       string
+	}{
+		{"cpuRequest", d.CPURequest, "", "cpuLimit", d.CPULimit, ""},
+		{"memoryRequest", d.MemoryRequest, "", "memoryLimit", d.MemoryLimit, ""},
+		{"sentinelCpuRequest", d.SentinelCPURequest, containerDefaultCPURequest, "sentinelCpuLimit", d.SentinelCPULimit, containerDefaultCPULimit},
+		{"sentinelMemoryRequest", d.SentinelMemoryRequest, containerDefaultMemoryRequest, "sentinelMemoryLimit", d.SentinelMemoryLimit, containerDefaultMemoryLimit},
+	} {
+		var request, limit resource.Quantity
+		var err error
+		if r.request != "" {
+			if request, err = resource.ParseQuantity(r.request); err != nil {
+				return fmt.Errorf("%w: %s: invalid quantity %q: %v", ErrInvalidResources, r.requestField, r.request, err)
+			}
 		}
-	}
-	if req.MemoryRequest != "" {
-		if _, err := resource.ParseQuantity(req.MemoryRequest); err != nil {
-			return fmt.Errorf("memoryRequest: invalid quantity %q: %w", req.MemoryRequest, err)
+		if r.limit != "" {
+			if limit, err = resource.ParseQuantity(r.limit); err != nil {
+				return fmt.Errorf("%w: %s: invalid quantity %q: %v", ErrInvalidResources, r.limitField, r.limit, err)
+			}
 		}
-	}
-	if req.CPULimit != "" {
-		if _, err := resource.ParseQuantity(req.CPULimit); err != nil {
-			return fmt.Errorf("cpuLimit: invalid quantity %q: %w", req.CPULimit, err)
+		if sentinelDefaults && r.request == "" && r.defaultRequest != "" {
+			r.requestField, r.request, request = "default "+r.requestField, r.defaultRequest, resource.MustParse(r.defaultRequest)
 		}
-	}
-	if req.MemoryLimit != "" {
-		if _, err := resource.ParseQuantity(req.MemoryLimit); err != nil {
-			return fmt.Errorf("memoryLimit: invalid quantity %q: %w", req.MemoryLimit, err)
+		if sentinelDefaults && r.limit == "" && r.defaultLimit != "" {
+			r.limitField, r.limit, limit = "default "+r.limitField, r.defaultLimit, resource.MustParse(r.defaultLimit)
+		}
+		if r.request != "" && r.limit != "" && request.Cmp(limit) > 0 {
+			return fmt.Errorf("%w: %s %s exceeds %s %s", ErrInvalidResources, r.requestField, r.request, r.limitField, r.limit)
 		}
 	}
 	return nil
@@ -79,10 +156,45 @@ func ValidateCreateRedisRequest(req models.CreateRedisRequest) error {
 // ValidatePatchInstanceRequest validates fields for a partial instance update.
 func ValidatePatchInstanceRequest(req models.PatchInstanceRequest) error {
 	// At least one field must be provided.
-	if req.Name == nil && req.Capacity == nil && req.RedisReplicas == nil && req.SentinelReplicas == nil {
+	if req.Name == nil && req.Capacity == nil && req.RedisReplicas == nil && req.SentinelReplicas == nil && req.Plan == nil && req.BackupSchedule == nil && req.Config == nil &&
+		!patchesRedisResources(req) && !patchesSentinelResources(req) {
 		return fmt.Errorf("at least one field must be provided")
 	}
 
+	// Redis resources cannot be removed; empty Sentinel resources remove the setting. Requests are checked
+	// against limits once merged with the current spec (see RedisFailoverStore.PatchInstance).
+	for _, f := range []struct {
+		name  string
+		value *string
+	}{{"cpuRequest", req.CPURequest}, {"memoryRequest", req.MemoryRequest}, {"cpuLimit", req.CPULimit}, {"memoryLimit", req.MemoryLimit}} {
+		if f.value != nil && *f.value == "" {
+			return fmt.Errorf("%w: %s cannot be empty", ErrInvalidResources, f.name)
+		}
+	}
+	// Unset values keep their current ones here, so the LimitRange defaults do not apply.
+	if err := checkResources(RedisFailoverTemplateData{
+		CPURequest: deref(req.CPURequest), MemoryRequest: deref(req.MemoryRequest), CPULimit: deref(req.CPULimit), MemoryLimit: deref(req.MemoryLimit),
+		SentinelCPURequest: deref(req.SentinelCPURequest), SentinelMemoryRequest: deref(req.SentinelMemoryRequest),
+		SentinelCPULimit: deref(req.SentinelCPULimit), SentinelMemoryLimit: deref(req.SentinelMemoryLimit),
+	}, false); err != nil {
+		return err
+	}
+
+	if err := ValidateRedisConfig(req.Config); err != nil {
+		return err
+	}
+
+	// An empty cron expression removes the schedule.
+	if req.BackupSchedule != nil && req.BackupSchedule.Cron != "" {
+		if err := ValidateBackupSchedule(*req.BackupSchedule); err != nil {
+			return err
+		}
+	}
+
+	if req.Plan != nil && *req.Plan == "" {
+		return fmt.Errorf("plan cannot be empty")
+	}
+
 	if req.Capacity != nil {
 		if *req.Capacity == "" {
 			return fmt.Errorf("capacity cannot be empty")
@@ -107,9 +219,27 @@ func ValidatePatchInstanceRequest(req models.PatchInstanceRequest) error {
 	return nil
 }
 
-// BuildRedisFailoverTemplateData builds template data from the API request, default namespace, and optional default storage class from config.
-// Optional request fields use defaults when not set. cfgDefaultStorageClass is used when req.StorageClass is empty; if empty, package default is used.
-func BuildRedisFailoverTemplateData(req models.CreateRedisRequest, defaultNamespace, cfgDefaultStorageClass, secretName string) RedisFailoverTemplateData {
+// patchesRedisResources reports whether req changes any Redis CPU/memory request or limit.
+func patchesRedisResources(req models.PatchInstanceRequest) bool {
+	return req.CPURequest != nil || req.MemoryRequest != nil || req.CPULimit != nil || req.MemoryLimit != nil
+}
+
+// patchesSentinelResources reports whether req changes any Sentinel CPU/memory request or limit.
+func patchesSentinelResources(req models.PatchInstanceRequest) bool {
+	return req.SentinelCPURequest != nil || req.SentinelMemoryRequest != nil || req.SentinelCPULimit != nil || req.SentinelMemoryLimit != nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// BuildRedisFailoverTemplateData builds template data from the API request, the plan it is based on, default namespace, and optional default storage class from config.
+// Optional request fields use the plan's values when not set; the plan's storage is not used without persistence. cfgDefaultStorageClass is used when req.StorageClass is empty; if empty, package default is used.
+// planLabel is recorded as LabelPlan.
+func BuildRedisFailoverTemplateData(req models.CreateRedisRequest, plan models.Plan, planLabel, defaultNamespace, cfgDefaultStorageClass, secretName string) RedisFailoverTemplateData {
 	storageClass := cfgDefaultStorageClass
 	if storageClass == "" {
 		storageClass = defaultStorageClass
@@ -121,15 +251,16 @@ func BuildRedisFailoverTemplateData(req models.CreateRedisRequest, defaultNamesp
 	data := RedisFailoverTemplateData{
 		Name:             req.Name,
 		Namespace:        defaultNamespace,
-		SentinelReplicas: defaultSentinelReplicas,
-		RedisReplicas:    defaultRedisReplicas,
-		CPURequest:      defaultCPURequest,
-		MemoryRequest:   defaultMemoryRequest,
-		CPULimit:         defaultCPULimit,
-		MemoryLimit:      defaultMemoryLimit,
+		SentinelReplicas: plan.SentinelReplicas,
+		RedisReplicas:    plan.RedisReplicas,
+		CPURequest:       plan.CPURequest,
+		MemoryRequest:    plan.MemoryRequest,
+		CPULimit:         plan.CPULimit,
+		MemoryLimit:      plan.MemoryLimit,
 		StorageClass:     storageClass,
-		StorageSize:      defaultStorageSize,
+		StorageSize:      plan.Storage,
 		SecretName:       secretName,
+		Plan:             planLabel,
 	}
 	if defaultNamespace == "" {
 		data.Namespace = "default"
@@ -155,5 +286,15 @@ func BuildRedisFailoverTemplateData(req models.CreateRedisRequest, defaultNamesp
 	if req.MemoryLimit != "" {
 		data.MemoryLimit = req.MemoryLimit
 	}
+	data.SentinelCPURequest, data.SentinelMemoryRequest = req.SentinelCPURequest, req.SentinelMemoryRequest
+	data.SentinelCPULimit, data.SentinelMemoryLimit = req.SentinelCPULimit, req.SentinelMemoryLimit
+	data.Persistence = req.Persistence
+	if data.Persistence == "" {
+		data.Persistence = defaultPersistence
+	}
+	if data.Persistence == PersistenceNone {
+		data.StorageClass, data.StorageSize = "", ""
+	}
+	data.CustomConfig = mergeCustomConfig(persistenceConfig[data.Persistence], req.Config)
 	return data
 }
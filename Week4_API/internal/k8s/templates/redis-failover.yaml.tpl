@@ -3,11 +3,40 @@ kind: RedisFailover
 metadata:
   name: {{ .Name }}
   namespace: {{ .Namespace }}
+  {{- if .Plan }}
+  labels:
+    paas.io/plan: {{ .Plan }}
+  {{- end }}
+  {{- if .RestoreFrom }}
+  annotations:
+    paas.io/restored-from: {{ printf "%q" .RestoreFrom }}
+  {{- end }}
 spec:
   auth:
     secretPath: {{ .SecretName }}
   sentinel:
     replicas: {{ or .SentinelReplicas 3 }}
+    {{- if or .SentinelCPURequest .SentinelMemoryRequest .SentinelCPULimit .SentinelMemoryLimit }}
+    resources:
+      {{- if or .SentinelCPURequest .SentinelMemoryRequest }}
+      requests:
+        {{- with .SentinelCPURequest }}
+        cpu: {{ . }}
+        {{- end }}
+        {{- with .SentinelMemoryRequest }}
+        memory: {{ . }}
+        {{- end }}
+      {{- end }}
+      {{- if or .SentinelCPULimit .SentinelMemoryLimit }}
+      limits:
+        {{- with .SentinelCPULimit }}
+        cpu: {{ . }}
+        {{- end }}
+        {{- with .SentinelMemoryLimit }}
+        memory: {{ . }}
+        {{- end }}
+      {{- end }}
+    {{- end }}
   redis:
     replicas: {{ or .RedisReplicas 3 }}
     resources:
@@ -17,7 +46,74 @@ spec:
       limits:
         cpu: {{ or .CPULimit "500m" }}
         memory: {{ or .MemoryLimit "512Mi" }}
+    {{- if .CustomConfig }}
+    customConfig:
+      {{- range .CustomConfig }}
+      - {{ printf "%q" . }}
+      {{- end }}
+    {{- end }}
+    {{- if .RestoreFrom }}
+    # Seeds an empty data volume with the RDB file before Redis starts. Waits for the file to appear, as
+    # the snapshot of a clone is still being uploaded when the instance is created.
+    initContainers:
+      - name: restore
+        image: {{ .RestoreImage }}
+        command:
+          - sh
+          - -c
+          - |
+            set -e
+            if [ -e /data/dump.rdb ] || [ -e /data/appendonlydir ]; then exit 0; fi
+            ENDPOINT_ARGS=
+            if [ -n "$S3_ENDPOINT" ]; then
+              aws configure set default.s3.addressing_style path
+              ENDPOINT_ARGS="--endpoint-url $S3_ENDPOINT"
+            fi
+            tries=0
+            until aws $ENDPOINT_ARGS s3 ls "$SOURCE" > /dev/null; do
+              tries=$((tries + 1))
+              if [ "$tries" -ge 360 ]; then echo "$SOURCE not found" > /dev/termination-log; exit 1; fi
+              sleep 10
+            done
+            aws $ENDPOINT_ARGS s3 cp "$SOURCE" /data/dump.rdb.part
+            mv /data/dump.rdb.part /data/dump.rdb
+        env:
+          - name: SOURCE
+            value: {{ printf "%q" .RestoreFrom }}
+          - name: S3_ENDPOINT
+            value: {{ printf "%q" .RestoreEndpoint }}
+          - name: AWS_DEFAULT_REGION
+            value: {{ printf "%q" .RestoreRegion }}
+          - name: AWS_ACCESS_KEY_ID
+            valueFrom:
+              secretKeyRef:
+                name: {{ .RestoreSecret }}
+                key: AWS_ACCESS_KEY_ID
+          - name: AWS_SECRET_ACCESS_KEY
+            valueFrom:
+              secretKeyRef:
+                name: {{ .RestoreSecret }}
+                key: AWS_SECRET_ACCESS_KEY
+          # Redis pods do not run as root; the aws CLI needs a writable home for its config.
+          - name: HOME
+            value: /tmp
+        # Same as Redis, so the init container does not change the pod's quota usage.
+        resources:
+          requests:
+            cpu: {{ or .CPURequest "100m" }}
+            memory: {{ or .MemoryRequest "128Mi" }}
+          limits:
+            cpu: {{ or .CPULimit "500m" }}
+            memory: {{ or .MemoryLimit "512Mi" }}
+        volumeMounts:
+          # The operator names the volume of an emptyDir redis-data.
+          - name: {{ if eq .Persistence "none" }}redis-data{{ else }}{{ .Name }}-data{{ end }}
+            mountPath: /data
+    {{- end }}
     storage:
+      {{- if eq .Persistence "none" }}
+      emptyDir: {}
+      {{- else }}
       keepAfterDeletion: true
       persistentVolumeClaim:
         metadata:
@@ -29,3 +125,4 @@ spec:
           resources:
             requests:
               storage: {{ or .StorageSize "1Gi" }}
+      {{- end }}
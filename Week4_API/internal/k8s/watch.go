@@ -0,0 +1,238 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// labelRedisRole is set by the Spotahome operator on Redis pods to "master" or "slave".
+const labelRedisRole = "redisfailovers-role"
+
+// InstanceKey identifies an instance in the cluster.
+type InstanceKey struct {
+	Namespace string
+	Name      string
+}
+
+// InstanceWatch is a set of event handlers registered by WatchInstances; Stop removes them.
+type InstanceWatch struct {
+	cache         *instanceCache
+	registrations []cache.ResourceEventHandlerRegistration
+}
+
+// Stop removes the handlers from the informers.
+func (w *InstanceWatch) Stop() {
+	for i, reg := range w.registrations {
+		inf := w.cache.failovers.Informer()
+		if i > 0 {
+			inf = w.cache.pods.Informer()
+		}
+		_ = inf.RemoveEventHandler(reg)
+	}
+}
+
+// WatchInstances calls fn with the instance whenever its RedisFailover or one of its pods is added,
+// updated or deleted, starting with an add for every existing object. fn must not block. Requires
+// StartInformers.
+func (s *RedisFailoverStore) WatchInstances(fn func(InstanceKey)) (*InstanceWatch, error) {
+	if s.cache == nil {
+		return nil, fmt.Errorf("informers not started")
+	}
+	handler := func(instanceOf func(*unstructured.Unstructured) string) cache.ResourceEventHandler {
+		notify := func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			u, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+			if name := instanceOf(u); name != "" {
+				fn(InstanceKey{Namespace: u.GetNamespace(), Name: name})
+			}
+		}
+		return cache.ResourceEventHandlerFuncs{
+			AddFunc:    notify,
+			UpdateFunc: func(_, obj interface{}) { notify(obj) },
+			DeleteFunc: notify,
+		}
+	}
+	w := &InstanceWatch{cache: s.cache}
+	reg, err := s.cache.failovers.Informer().AddEventHandler(handler((*unstructured.Unstructured).GetName))
+	if err != nil {
+		return nil, fmt.Errorf("watch redisfailovers: %w", err)
+	}
+	w.registrations = append(w.registrations, reg)
+	reg, err = s.cache.pods.Informer().AddEventHandler(handler(podInstance))
+	if err != nil {
+		w.Stop()
+		return nil, fmt.Errorf("watch pods: %w", err)
+	}
+	w.registrations = append(w.registrations, reg)
+	return w, nil
+}
+
+// podInstance returns the instance a pod belongs to, by the labels podReadiness selects on.
+func podInstance(pod *unstructured.Unstructured) string {
+	if name := pod.GetLabels()[labelFailoverName]; name != "" {
+		return name
+	}
+	return pod.GetLabels()[labelInstance]
+}
+
+// InstanceState returns the current state of an instance from the informer caches: its status as
+// returned by GetInstance, the master pod and the restarts of its pods' containers. Returns ErrNotFound
+// if the RedisFailover does not exist.
+func (s *RedisFailoverStore) InstanceState(ctx context.Context, key InstanceKey) (*models.InstanceState, error) {
+	ctx = WithNamespace(ctx, key.Namespace)
+	obj, err := s.getFailover(ctx, key.Namespace, key.Name)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key.Name)
+		}
+		return nil, fmt.Errorf("get redisfailover %q: %w", key.Name, err)
+	}
+	state := &models.InstanceState{Status: redisfailoverToModel(obj).Status}
+	if state.Status == "unknown" {
+		state.Status = s.inferStatusFromPods(ctx, key.Name)
+	}
+	pods, err := s.listInstancePods(ctx, key.Namespace, key.Name)
+	if err != nil {
+		return nil, fmt.Errorf("list pods of %q: %w", key.Name, err)
+	}
+	for _, pod := range pods {
+		if pod.GetLabels()[labelRedisRole] == "master" && pod.GetDeletionTimestamp() == nil {
+			state.Master = pod.GetName()
+		}
+		statuses, _, _ := unstructured.NestedSlice(pod.Object, "status", "containerStatuses")
+		for _, cs := range statuses {
+			m, ok := cs.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			container, _, _ := unstructured.NestedString(m, "name")
+			restarts, _, _ := unstructured.NestedInt64(m, "restartCount")
+			reason, _, _ := unstructured.NestedString(m, "lastState", "terminated", "reason")
+			if state.Containers == nil {
+				state.Containers = make(map[string]models.ContainerState)
+			}
+			state.Containers[pod.GetName()+"/"+container] = models.ContainerState{Restarts: int(restarts), LastReason: reason}
+		}
+	}
+	return state, nil
+}
+
+// NamespaceTenant returns the tenant a namespace was created for (see WithTenant), or "" if it is not a
+// tenant namespace. Namespaces created before they were annotated map back by their name.
+func (s *RedisFailoverStore) NamespaceTenant(ctx context.Context, ns string) string {
+	if obj := s.cachedNamespace(ns); obj != nil {
+		if tenant := obj.GetAnnotations()[AnnotationTenant]; tenant != "" {
+			return tenant
+		}
+	}
+	tenant, ok := strings.CutPrefix(ns, tenantNamespacePrefix)
+	if !ok || ValidateTenant(tenant) != nil || shortenName(tenant, 63-len(tenantNamespacePrefix)) != tenant {
+		return ""
+	}
+	return tenant
+}
+
+// gvrEvents is used to watch Kubernetes Events about instance objects.
+var gvrEvents = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "events"}
+
+// WatchWarningEvents starts an informer on Warning Events in all namespaces and calls fn for every Event
+// that is added or updated (repeated occurrences update the Event's count), starting with the existing
+// ones. The informer stops with ctx. fn must not block.
+func (s *RedisFailoverStore) WatchWarningEvents(ctx context.Context, fn func(*unstructured.Unstructured)) error {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(s.client, 0, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+		o.FieldSelector = "type=Warning"
+	})
+	inf := factory.ForResource(gvrEvents).Informer()
+	if err := inf.SetTransform(stripManagedFields); err != nil {
+		return fmt.Errorf("events informer: %w", err)
+	}
+	notify := func(obj interface{}) {
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			fn(u)
+		}
+	}
+	if _, err := inf.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    notify,
+		UpdateFunc: func(_, obj interface{}) { notify(obj) },
+	}); err != nil {
+		return fmt.Errorf("watch events: %w", err)
+	}
+	factory.Start(ctx.Done())
+	return nil
+}
+
+// workloadPrefixes start the names of the objects the Spotahome operator creates for an instance:
+// Redis StatefulSet and pods, Sentinel Deployment and pods, and the Redis PVCs ("<claim>-rfr-<name>-<n>").
+var workloadPrefixes = []string{"rfr-", "rfs-"}
+
+// EventInstance returns the instance an Event's involved object in ns belongs to, or "" if it cannot be
+// correlated with an existing RedisFailover. Pods are matched by their labels while they are cached;
+// other objects (and deleted pods) by the operator's naming scheme.
+func (s *RedisFailoverStore) EventInstance(ctx context.Context, ns, kind, name string) string {
+	exists := func(instance string) bool {
+		_, err := s.getFailover(ctx, ns, instance)
+		return err == nil
+	}
+	switch kind {
+	case "RedisFailover":
+		if exists(name) {
+			return name
+		}
+		return ""
+	case "Pod":
+		if c := s.cached(); c != nil {
+			if obj, err := c.pods.Lister().ByNamespace(ns).Get(name); err == nil {
+				if pod, ok := obj.(*unstructured.Unstructured); ok && podInstance(pod) != "" {
+					return podInstance(pod)
+				}
+			}
+		}
+	}
+	for _, candidate := range instanceNameCandidates(name) {
+		if exists(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// instanceNameCandidates returns the instance names an operator-created object name may stem from,
+// longest first: for "rfs-cache-7d9f-x2" these are "cache-7d9f-x2", "cache-7d9f" and "cache".
+func instanceNameCandidates(name string) []string {
+	var out []string
+	for i := 0; i < len(name); i++ {
+		if i > 0 && name[i-1] != '-' {
+			continue
+		}
+		for _, prefix := range workloadPrefixes {
+			if !strings.HasPrefix(name[i:], prefix) {
+				continue
+			}
+			rest := name[i+len(prefix):]
+			for rest != "" {
+				out = append(out, rest)
+				cut := strings.LastIndex(rest, "-")
+				if cut < 0 {
+					break
+				}
+				rest = rest[:cut]
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,23 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInstanceNameCandidates(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want []string
+	}{
+		{"rfr-cache-0", []string{"cache-0", "cache"}},
+		{"rfs-cache-7d9f-x2", []string{"cache-7d9f-x2", "cache-7d9f", "cache"}},
+		{"cache-data-rfr-cache-1", []string{"cache-1", "cache"}},
+		{"cache-0", nil},
+		{"xrfr-cache", nil},
+	} {
+		if got := instanceNameCandidates(tc.name); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -30,13 +30,18 @@ func NewPostgresStore(ctx context.Context, databaseURL string) (*PostgresStore,
 	return &PostgresStore{db: db}, nil
 }
 
+// DB returns the underlying connection so other Postgres-backed stores can share it.
+func (s *PostgresStore) DB() *sql.DB {
+	return s.db
+}
+
 // Close closes the database connection.
 func (s *PostgresStore) Close() error {
 	return s.db.Close()
 }
 
 // AppendAuditLog inserts one audit log row.
-func (s *PostgresStore) AppendAuditLog(ctx context.Context, tenantUser, instanceID, action string, details map[string]any) error {
+func (s *PostgresStore) AppendAuditLog(ctx context.Context, tenantUser, actor, instanceID, action string, details map[string]any) error {
 	var detailsJSON []byte
 	if details != nil {
 		var err error
@@ -46,8 +51,8 @@ func (s *PostgresStore) AppendAuditLog(ctx context.Context, tenantUser, instance
 		}
 	}
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO audit_logs (tenant_user, instance_id, action, details) VALUES ($1, $2, $3, $4)`,
-		tenantUser, instanceID, action, detailsJSON)
+		`INSERT INTO audit_logs (tenant_user, actor, instance_id, action, details) VALUES ($1, $2, $3, $4, $5)`,
+		tenantUser, actor, instanceID, action, detailsJSON)
 	return err
 }
 
@@ -110,11 +115,11 @@ func (s *PostgresStore) queryAuditLogs(ctx context.Context, tenantUser, instance
 	var err error
 	if since.IsZero() {
 		rows, err = s.db.QueryContext(ctx,
-			`SELECT id, created_at, action, COALESCE(details::text, 'null') FROM audit_logs WHERE tenant_user = $1 AND instance_id = $2 ORDER BY created_at DESC LIMIT $3`,
+			`SELECT id, created_at, action, COALESCE(actor, ''), COALESCE(details::text, 'null') FROM audit_logs WHERE tenant_user = $1 AND instance_id = $2 ORDER BY created_at DESC LIMIT $3`,
 			tenantUser, instanceID, limit)
 	} else {
 		rows, err = s.db.QueryContext(ctx,
-			`SELECT id, created_at, action, COALESCE(details::text, 'null') FROM audit_logs WHERE tenant_user = $1 AND instance_id = $2 AND created_at >= $3 ORDER BY created_at DESC LIMIT $4`,
+			`SELECT id, created_at, action, COALESCE(actor, ''), COALESCE(details::text, 'null') FROM audit_logs WHERE tenant_user = $1 AND instance_id = $2 AND created_at >= $3 ORDER BY created_at DESC LIMIT $4`,
 			tenantUser, instanceID, since, limit)
 	}
 	if err != nil {
@@ -126,9 +131,9 @@ func (s *PostgresStore) queryAuditLogs(ctx context.Context, tenantUser, instance
 	for rows.Next() {
 		var id string
 		var createdAt time.Time
-		var action string
+		var action, actor string
 		var detailsStr string
-		if err := rows.Scan(&id, &createdAt, &action, &detailsStr); err != nil {
+		if err := rows.Scan(&id, &createdAt, &action, &actor, &detailsStr); err != nil {
 			return nil, err
 		}
 		e := LogEntry{
@@ -137,6 +142,7 @@ func (s *PostgresStore) queryAuditLogs(ctx context.Context, tenantUser, instance
 			Timestamp:  createdAt,
 			Action:     action,
 			TenantUser: tenantUser,
+			Actor:      actor,
 			InstanceID: instanceID,
 			Details:    json.RawMessage(detailsStr),
 		}
@@ -305,21 +311,21 @@ func (s *PostgresStore) queryAuditLogsAll(ctx context.Context, tenantUser string
 	if instanceID != "" {
 		if since.IsZero() {
 			rows, err = s.db.QueryContext(ctx,
-				`SELECT id, instance_id, created_at, action, COALESCE(details::text, 'null') FROM audit_logs WHERE tenant_user = $1 AND instance_id = $2 ORDER BY created_at DESC LIMIT $3 OFFSET $4`,
+				`SELECT id, instance_id, created_at, action, COALESCE(actor, ''), COALESCE(details::text, 'null') FROM audit_logs WHERE tenant_user = $1 AND instance_id = $2 ORDER BY created_at DESC LIMIT $3 OFFSET $4`,
 				tenantUser, instanceID, limit, offset)
 		} else {
 			rows, err = s.db.QueryContext(ctx,
-				`SELECT id, instance_id, created_at, action, COALESCE(details::text, 'null') FROM audit_logs WHERE tenant_user = $1 AND instance_id = $2 AND created_at >= $3 ORDER BY created_at DESC LIMIT $4 OFFSET $5`,
+				`SELECT id, instance_id, created_at, action, COALESCE(actor, ''), COALESCE(details::text, 'null') FROM audit_logs WHERE tenant_user = $1 AND instance_id = $2 AND created_at >= $3 ORDER BY created_at DESC LIMIT $4 OFFSET $5`,
 				tenantUser, instanceID, since, limit, offset)
 		}
 	} else {
 		if since.IsZero() {
 			rows, err = s.db.QueryContext(ctx,
-				`SELECT id, instance_id, created_at, action, COALESCE(details::text, 'null') FROM audit_logs WHERE tenant_user = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`,
+				`SELECT id, instance_id, created_at, action, COALESCE(actor, ''), COALESCE(details::text, 'null') FROM audit_logs WHERE tenant_user = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`,
 				tenantUser, limit, offset)
 		} else {
 			rows, err = s.db.QueryContext(ctx,
-				`SELECT id, instance_id, created_at, action, COALESCE(details::text, 'null') FROM audit_logs WHERE tenant_user = $1 AND created_at >= $2 ORDER BY created_at DESC LIMIT $3 OFFSET $4`,
+				`SELECT id, instance_id, created_at, action, COALESCE(actor, ''), COALESCE(details::text, 'null') FROM audit_logs WHERE tenant_user = $1 AND created_at >= $2 ORDER BY created_at DESC LIMIT $3 OFFSET $4`,
 				tenantUser, since, limit, offset)
 		}
 	}
@@ -332,9 +338,9 @@ func (s *PostgresStore) queryAuditLogsAll(ctx context.Context, tenantUser string
 	for rows.Next() {
 		var id, instID string
 		var createdAt time.Time
-		var action string
+		var action, actor string
 		var detailsStr string
-		if err := rows.Scan(&id, &instID, &createdAt, &action, &detailsStr); err != nil {
+		if err := rows.Scan(&id, &instID, &createdAt, &action, &actor, &detailsStr); err != nil {
 			return nil, err
 		}
 		e := LogEntry{
@@ -343,6 +349,7 @@ func (s *PostgresStore) queryAuditLogsAll(ctx context.Context, tenantUser string
 			Timestamp:  createdAt,
 			Action:     action,
 			TenantUser: tenantUser,
+			Actor:      actor,
 			InstanceID: instID,
 			Details:    json.RawMessage(detailsStr),
 		}
@@ -0,0 +1,117 @@
+package logstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+)
+
+// UpdateInstanceState implements StateStore. The instance_status row is locked for the transaction, so a
+// state change is logged exactly once even if two replicas briefly both act as leader.
+func (s *PostgresStore) UpdateInstanceState(ctx context.Context, tenantUser, instanceID string, next models.InstanceState, changes func(prev *models.InstanceState) []ServiceLog) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Create the row first so that SELECT ... FOR UPDATE also serializes the very first observation.
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO instance_status (tenant_user, instance_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		tenantUser, instanceID); err != nil {
+		return err
+	}
+	var stateJSON sql.NullString
+	if err := tx.QueryRowContext(ctx,
+		`SELECT state::text FROM instance_status WHERE tenant_user = $1 AND instance_id = $2 FOR UPDATE`,
+		tenantUser, instanceID).Scan(&stateJSON); err != nil {
+		return err
+	}
+	var prev *models.InstanceState
+	if stateJSON.Valid {
+		prev = &models.InstanceState{}
+		if err := json.Unmarshal([]byte(stateJSON.String), prev); err != nil {
+			return fmt.Errorf("decode state of %q: %w", instanceID, err)
+		}
+		if reflect.DeepEqual(*prev, next) {
+			return nil
+		}
+	}
+
+	for _, l := range changes(prev) {
+		var metadataJSON []byte
+		if l.Metadata != nil {
+			if metadataJSON, err = json.Marshal(l.Metadata); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO service_logs (tenant_user, instance_id, event_type, message, metadata) VALUES ($1, $2, $3, $4, $5)`,
+			tenantUser, instanceID, l.EventType, l.Message, metadataJSON); err != nil {
+			return err
+		}
+	}
+	nextJSON, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE instance_status SET state = $3, updated_at = now() WHERE tenant_user = $1 AND instance_id = $2`,
+		tenantUser, instanceID, nextJSON); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteInstanceState implements StateStore.
+func (s *PostgresStore) DeleteInstanceState(ctx context.Context, tenantUser, instanceID string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM instance_status WHERE tenant_user = $1 AND instance_id = $2`,
+		tenantUser, instanceID)
+	return err
+}
+
+// AppendServiceLogOnce implements StateStore. The dedupe row is claimed and the log appended in one
+// transaction, so concurrent callers with the same key append at most one entry per window.
+func (s *PostgresStore) AppendServiceLogOnce(ctx context.Context, tenantUser, instanceID, dedupeKey string, window time.Duration, l ServiceLog) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO service_log_dedupe (tenant_user, dedupe_key, logged_at) VALUES ($1, $2, now())
+		 ON CONFLICT (tenant_user, dedupe_key) DO UPDATE SET logged_at = now()
+		 WHERE service_log_dedupe.logged_at < now() - make_interval(secs => $3)`,
+		tenantUser, dedupeKey, window.Seconds())
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	var metadataJSON []byte
+	if l.Metadata != nil {
+		if metadataJSON, err = json.Marshal(l.Metadata); err != nil {
+			return false, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO service_logs (tenant_user, instance_id, event_type, message, metadata) VALUES ($1, $2, $3, $4, $5)`,
+		tenantUser, instanceID, l.EventType, l.Message, metadataJSON); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// PruneServiceLogDedupe implements StateStore.
+func (s *PostgresStore) PruneServiceLogDedupe(ctx context.Context, before time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM service_log_dedupe WHERE logged_at < $1`, before)
+	return err
+}
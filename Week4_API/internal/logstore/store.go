@@ -4,12 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
 )
 
 // Store persists audit and service logs for user-centric monitoring.
 // If nil, handlers skip writing/reading logs (e.g. when DATABASE_URL is unset).
 type Store interface {
-	AppendAuditLog(ctx context.Context, tenantUser, instanceID, action string, details map[string]any) error
+	// AppendAuditLog records an action in the tenant's audit log. actor is the individual user who performed
+	// it, which differs from tenantUser when acting within an organization.
+	AppendAuditLog(ctx context.Context, tenantUser, actor, instanceID, action string, details map[string]any) error
 	AppendServiceLog(ctx context.Context, tenantUser, instanceID, eventType, message string, metadata map[string]any) error
 	ListLogs(ctx context.Context, tenantUser, instanceID string, opts ListOpts) ([]LogEntry, error)
 	// ListLogsAll returns logs for the tenant across all instances, optionally filtered by InstanceID.
@@ -18,6 +22,29 @@ type Store interface {
 	CountLogs(ctx context.Context, tenantUser string, opts ListOpts) (int, error)
 }
 
+// StateStore persists what the background watchers have seen and logged, so that changes and
+// Kubernetes Events are logged once across restarts and API replicas.
+type StateStore interface {
+	// UpdateInstanceState stores next as the instance's state and, in the same transaction, appends the
+	// service logs returned by changes. changes receives the previously stored state, or nil if there is
+	// none. Concurrent updates of one instance are serialized.
+	UpdateInstanceState(ctx context.Context, tenantUser, instanceID string, next models.InstanceState, changes func(prev *models.InstanceState) []ServiceLog) error
+	// DeleteInstanceState forgets the state of a deleted instance.
+	DeleteInstanceState(ctx context.Context, tenantUser, instanceID string) error
+	// AppendServiceLogOnce appends l unless an entry with the same dedupeKey was appended for the tenant
+	// within window, and reports whether it did.
+	AppendServiceLogOnce(ctx context.Context, tenantUser, instanceID, dedupeKey string, window time.Duration, l ServiceLog) (bool, error)
+	// PruneServiceLogDedupe forgets dedupe keys last used before the given time.
+	PruneServiceLogDedupe(ctx context.Context, before time.Time) error
+}
+
+// ServiceLog is a service log entry to append (see Store.AppendServiceLog).
+type ServiceLog struct {
+	EventType string
+	Message   string
+	Metadata  map[string]any
+}
+
 // ListOpts filters and paginates log listing.
 type ListOpts struct {
 	Type       string    // "audit", "service", or "" for both
@@ -37,5 +64,6 @@ type LogEntry struct {
 	Details    json.RawMessage `json:"details"`   // audit details (JSON); nil if empty
 	Metadata   json.RawMessage `json:"metadata"`  // service metadata (JSON); nil if empty
 	TenantUser string          `json:"tenantUser,omitempty"`
+	Actor      string          `json:"actor,omitempty"` // audit: user who performed the action
 	InstanceID string          `json:"instanceId"`
 }
@@ -1,10 +1,107 @@
 package models
 
+import "time"
+
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Org      string `json:"org,omitempty"` // optional organization to act in by default (token "org" claim)
 }
 
+// LoginResponse is returned by POST /api/login and POST /api/refresh.
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`        // short-lived access token (JWT)
+	RefreshToken string `json:"refreshToken"` // opaque; exchange via POST /api/refresh
+	ExpiresIn    int    `json:"expiresIn"`    // access token lifetime in seconds
+}
+
+// RefreshRequest is the body for POST /api/refresh and (optionally) POST /api/logout.
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// RegisterUserRequest is the body for POST /api/register and POST /api/v1/users.
+type RegisterUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// User is the public representation of a local account (never includes the password hash).
+type User struct {
+	Username  string    `json:"username"`
+	Role      string    `json:"role"` // viewer, operator or owner
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SetUserRoleRequest is the body for PUT /api/v1/users/:username/role.
+type SetUserRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// OIDCLinkResponse is the response of POST /api/v1/oidc/link: open URL in the browser to sign in with the
+// account to link.
+type OIDCLinkResponse struct {
+	URL string `json:"url"`
+}
+
+// LinkIdentityRequest is the body for POST /api/v1/users/:username/identities: Subject is the "sub" of the
+// account at the configured OIDC provider.
+type LinkIdentityRequest struct {
+	Subject string `json:"subject"`
+}
+
+// CreateAPIKeyRequest is the body for POST /api/v1/apikeys.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"` // optional; key never expires if omitted
+}
+
+// APIKey is the public representation of an API key (never includes the secret or its hash).
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // first characters of the key, to recognise it in CI settings
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// CreateAPIKeyResponse is returned once by POST /api/v1/apikeys; Key cannot be retrieved again.
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// CreateOrgRequest is the body for POST /api/v1/orgs.
+type CreateOrgRequest struct {
+	Name string `json:"name"`
+}
+
+// OrgMember is a membership of Username in Org, returned by the organization endpoints.
+type OrgMember struct {
+	Org       string    `json:"org"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"` // viewer, operator or owner within the organization
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// InviteRequest is the body for POST /api/v1/orgs/:org/invitations.
+type InviteRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// Invitation is a pending invitation to join an organization.
+type Invitation struct {
+	ID        string    `json:"id"`
+	Org       string    `json:"org"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	InvitedBy string    `json:"invitedBy"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
 }
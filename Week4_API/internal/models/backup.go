@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Backup states.
+const (
+	BackupRunning   = "running"   // the backup Job is snapshotting or uploading
+	BackupCompleted = "completed" // the RDB file is in object storage
+	BackupFailed    = "failed"    // the backup Job failed or disappeared
+)
+
+// Backup is an RDB snapshot of an instance in object storage (POST/GET /instances/:id/backups).
+type Backup struct {
+	ID          string     `json:"id"`
+	InstanceID  string     `json:"instanceId"`
+	State       string     `json:"state"`
+	Location    string     `json:"location"`            // s3://<bucket>/<key> of the RDB file
+	SizeBytes   int64      `json:"sizeBytes,omitempty"` // set once completed
+	Error       string     `json:"error,omitempty"`     // set when State is failed
+	CreatedBy   string     `json:"createdBy,omitempty"`
+	Scheduled   bool       `json:"scheduled,omitempty"` // taken by the backup schedule, pruned by its retention
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// BackupSchedule takes backups of an instance periodically and prunes old ones (POST /instances,
+// PATCH /instances/:id). Backups taken by hand are never pruned.
+type BackupSchedule struct {
+	Cron     string `json:"cron"`               // five-field cron expression in UTC, e.g. "0 3 * * *"
+	KeepLast int    `json:"keepLast,omitempty"` // scheduled backups kept; 7 if neither KeepLast nor MaxAge is set
+	MaxAge   string `json:"maxAge,omitempty"`   // scheduled backups older than this are pruned, e.g. "168h"
+}
+
+// Done reports whether the backup reached a final state.
+func (b Backup) Done() bool {
+	return b.State == BackupCompleted || b.State == BackupFailed
+}
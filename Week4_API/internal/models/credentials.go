@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// RotateCredentialsRequest is the body of POST /instances/:id/credentials/rotate.
+type RotateCredentialsRequest struct {
+	// GracePeriodSeconds is how long the previous password keeps working; nil uses the default (300),
+	// 0 invalidates it right away.
+	GracePeriodSeconds *int `json:"gracePeriodSeconds,omitempty"`
+}
+
+// CredentialsRotation is the result of a password rotation.
+type CredentialsRotation struct {
+	InstanceID string    `json:"instanceId"`
+	Password   string    `json:"password"`
+	RotatedAt  time.Time `json:"rotatedAt"`
+	// PreviousPasswordExpiresAt is when the previous password stops working; unset without grace period.
+	PreviousPasswordExpiresAt *time.Time `json:"previousPasswordExpiresAt,omitempty"`
+}
+
+// InstanceCredentials is the access data of an instance (GET /instances/:id/credentials).
+type InstanceCredentials struct {
+	InstanceID string `json:"instanceId"`
+	Endpoint   string `json:"endpoint"` // host:port for Redis clients, as RedisInstance.PublicEndpoint
+	Password   string `json:"password"`
+}
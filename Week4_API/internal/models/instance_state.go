@@ -0,0 +1,16 @@
+package models
+
+// InstanceState is the last-known state of an instance as observed by the status watcher. It is
+// persisted so that changes are detected across restarts and API replicas.
+type InstanceState struct {
+	Status string `json:"status"`
+	Master string `json:"master,omitempty"` // name of the pod currently holding the Redis master role
+	// Containers maps "<pod>/<container>" to its restart count and last termination reason.
+	Containers map[string]ContainerState `json:"containers,omitempty"`
+}
+
+// ContainerState is the restart bookkeeping of one container of an instance pod.
+type ContainerState struct {
+	Restarts   int    `json:"restarts"`
+	LastReason string `json:"lastReason,omitempty"` // e.g. OOMKilled, Error
+}
@@ -16,5 +16,6 @@ type LogEntry struct {
 	Details    json.RawMessage `json:"details"`   // audit payload (JSON object)
 	Metadata   json.RawMessage `json:"metadata"`   // service log extra data (JSON object)
 	TenantUser string          `json:"tenantUser,omitempty"`
+	Actor      string          `json:"actor,omitempty"` // audit: user who performed the action (org member)
 	InstanceID string          `json:"instanceId"`
 }
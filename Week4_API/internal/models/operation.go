@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Operation states.
+const (
+	OperationPending   = "pending"   // accepted, not yet observed in the cluster
+	OperationRunning   = "running"   // the operator is rolling pods
+	OperationSucceeded = "succeeded" // the spec is rolled out and all pods are ready (delete: the instance and its pods are gone)
+	OperationFailed    = "failed"    // a pod failed or the operation timed out
+)
+
+// Operation is the response of POST/PATCH/DELETE on instances and of GET /api/v1/operations/:id.
+// It tracks the rollout the call started until the instance's pods reflect it.
+type Operation struct {
+	ID          string         `json:"id"`
+	Type        string         `json:"type"` // create, update or delete
+	InstanceID  string         `json:"instanceId"`
+	State       string         `json:"state"`
+	Message     string         `json:"message,omitempty"`  // progress, e.g. "4/6 pods ready"
+	Error       string         `json:"error,omitempty"`    // set when State is failed
+	Instance    *RedisInstance `json:"instance,omitempty"` // instance as returned by the call (create, update)
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+	CompletedAt *time.Time     `json:"completedAt,omitempty"`
+}
+
+// Done reports whether the operation reached a final state.
+func (o Operation) Done() bool {
+	return o.State == OperationSucceeded || o.State == OperationFailed
+}
+
+// InstanceProgress is the rollout state of an instance as seen from its pods.
+type InstanceProgress struct {
+	Status       string // instance status (see RedisInstance.Status)
+	ReadyPods    int
+	Pods         int
+	ExpectedPods int // Redis plus Sentinel replicas of the spec
+	// RolledOut is set once the Redis and Sentinel workloads run the current spec and no pod of a previous
+	// revision is left; pods can be all ready before a change has reached them.
+	RolledOut bool
+	// Deleted is set once the instance no longer exists; Pods then counts its pods still terminating.
+	Deleted bool
+}
@@ -0,0 +1,19 @@
+package models
+
+// Plan is a service tier of the catalog (GET /api/v1/plans). Creating an instance with a plan expands
+// it into replicas, resources and storage; PATCH may switch to one of UpgradesTo or DowngradesTo.
+type Plan struct {
+	Name             string `json:"name"`
+	Description      string `json:"description,omitempty"`
+	RedisReplicas    int    `json:"redisReplicas"`
+	SentinelReplicas int    `json:"sentinelReplicas"`
+	CPURequest       string `json:"cpuRequest"`
+	MemoryRequest    string `json:"memoryRequest"`
+	CPULimit         string `json:"cpuLimit"`
+	MemoryLimit      string `json:"memoryLimit"`
+	Storage          string `json:"storage"` // PVC size per Redis replica
+
+	UpgradesTo   []string `json:"upgradesTo,omitempty"`
+	DowngradesTo []string `json:"downgradesTo,omitempty"`
+	Default      bool     `json:"default,omitempty"` // used for creates without plan or explicit resources
+}
@@ -7,7 +7,9 @@ type RedisInstance struct {
 	Name             string `json:"name"`
 	Namespace        string `json:"namespace"`
 	Status           string `json:"status"`
-	Capacity         string `json:"capacity"`
+	Capacity         string `json:"capacity"`              // empty without persistent storage
+	Persistence      string `json:"persistence,omitempty"` // none, rdb, aof or rdb+aof
+	Plan             string `json:"plan,omitempty"`        // catalog plan, or "custom" for explicit resources
 	RedisReplicas    int    `json:"redisReplicas,omitempty"`
 	SentinelReplicas int    `json:"sentinelReplicas,omitempty"`
 
@@ -16,14 +18,47 @@ type RedisInstance struct {
 	PublicHostname    string `json:"publicHostname"`    // e.g. "<name>-redis.default.svc.cluster.local"
 	PublicPort        int    `json:"publicPort"`        // 6379
 	PublicEndpoint    string `json:"publicEndpoint"`    // host:port for Redis clients
-	Password          string `json:"password,omitempty"` // Password for Redis authentication
+	Password          string `json:"password,omitempty"` // Password for Redis authentication; only in the create response (see GET /instances/:id/credentials)
+
+	RestoredFrom          string          `json:"restoredFrom,omitempty"` // s3://<bucket>/<key> of the RDB file the instance was seeded from
+	BackupSchedule        *BackupSchedule `json:"backupSchedule,omitempty"`
+	RevealCredentialsOnce bool            `json:"revealCredentialsOnce,omitempty"` // the password is only returned by create and rotate
+
+	Config map[string]string `json:"config,omitempty"` // Redis configuration parameters set for the instance
+
+	StorageResize *VolumeResize `json:"storageResize,omitempty"` // set while volumes are smaller than Capacity
+}
+
+// VolumeResize is the progress of a capacity increase on the instance's volumes (PVCs).
+type VolumeResize struct {
+	Capacity string         `json:"capacity"` // requested size
+	Volumes  []VolumeStatus `json:"volumes"`  // volumes not at that size yet
+}
+
+// VolumeStatus is a volume of an instance that is being resized.
+type VolumeStatus struct {
+	Name     string `json:"name"`     // PVC name
+	Capacity string `json:"capacity"` // current size
+	// Pending (new size not requested yet), Resizing, FileSystemResizePending (the volume grows once the
+	// pod restarts), a resize error such as ControllerResizeError, or the PVC's allocated resource status.
+	State   string `json:"state"`
+	Message string `json:"message,omitempty"`
 }
 
 // CreateRedisRequest is the body for POST /instances
 // Optional fields use pointers or empty string; the backend applies defaults when not set.
 type CreateRedisRequest struct {
 	Name     string `json:"name" validate:"required"`
-	Capacity string `json:"capacity" validate:"required"`
+	Capacity string `json:"capacity,omitempty"` // optional: defaults to the storage of Plan (or the default plan); not set with persistence "none"
+
+	// Optional: how Redis keeps data: "none" (no volume, data is lost when a pod restarts), "rdb"
+	// (snapshots, the default), "aof" (append-only file) or "rdb+aof". Cannot be changed later; CloneFrom
+	// and RestoreFrom need "none" or "rdb".
+	Persistence string `json:"persistence,omitempty"`
+
+	// Optional: catalog plan (GET /plans) providing replicas, resources and storage. Cannot be combined
+	// with the explicit replica and resource fields below; Capacity may only enlarge the plan's storage.
+	Plan string `json:"plan,omitempty"`
 
 	// Optional: replicas (defaults applied by backend if not set)
 	RedisReplicas    *int `json:"redisReplicas,omitempty"`
@@ -37,6 +72,39 @@ type CreateRedisRequest struct {
 	MemoryRequest string `json:"memoryRequest,omitempty"` // e.g. "128Mi"
 	CPULimit      string `json:"cpuLimit,omitempty"`      // e.g. "500m"
 	MemoryLimit   string `json:"memoryLimit,omitempty"`    // e.g. "512Mi"
+
+	// Optional: sentinel resources; unset values use the namespace's container defaults. Requests may
+	// not exceed limits. Not part of plans.
+	SentinelCPURequest    string `json:"sentinelCpuRequest,omitempty"`    // e.g. "50m"
+	SentinelMemoryRequest string `json:"sentinelMemoryRequest,omitempty"` // e.g. "64Mi"
+	SentinelCPULimit      string `json:"sentinelCpuLimit,omitempty"`      // e.g. "100m"
+	SentinelMemoryLimit   string `json:"sentinelMemoryLimit,omitempty"`   // e.g. "128Mi"
+
+	// Optional: seed the new instance's data before Redis starts, either with a fresh snapshot of another
+	// instance of the tenant or with an RDB file in the backup bucket. At most one may be set.
+	CloneFrom   *CloneSource   `json:"cloneFrom,omitempty"`
+	RestoreFrom *RestoreSource `json:"restoreFrom,omitempty"`
+
+	// Optional: periodic backups with retention; requires backups to be configured.
+	BackupSchedule *BackupSchedule `json:"backupSchedule,omitempty"`
+
+	// Optional: never return the password from GET /instances/:id/credentials; it is only in the
+	// responses of this call and of password rotations.
+	RevealCredentialsOnce bool `json:"revealCredentialsOnce,omitempty"`
+
+	// Optional: Redis configuration parameters, e.g. {"maxmemory-policy": "allkeys-lru"}. Only
+	// allowlisted parameters may be set; values are checked per parameter.
+	Config map[string]string `json:"config,omitempty"`
+}
+
+// CloneSource names the instance whose data a new instance starts with.
+type CloneSource struct {
+	InstanceID string `json:"instanceId"`
+}
+
+// RestoreSource names the RDB file a new instance starts with, e.g. the location of a backup.
+type RestoreSource struct {
+	RDBURL string `json:"rdbUrl"` // s3://<bucket>/<key>
 }
 
 // PatchInstanceRequest is the body for PATCH /instances/:id (partial update).
@@ -53,4 +121,28 @@ type PatchInstanceRequest struct {
 
 	// New number of Sentinel replicas.
 	SentinelReplicas *int `json:"sentinelReplicas,omitempty"`
+
+	// New Redis resources, e.g. "250m" / "256Mi". Like replica changes, they mark the instance as
+	// "custom". Requests may not exceed the (new or current) limits.
+	CPURequest    *string `json:"cpuRequest,omitempty"`
+	MemoryRequest *string `json:"memoryRequest,omitempty"`
+	CPULimit      *string `json:"cpuLimit,omitempty"`
+	MemoryLimit   *string `json:"memoryLimit,omitempty"`
+
+	// New Sentinel resources; an empty value removes the setting (the container default applies).
+	SentinelCPURequest    *string `json:"sentinelCpuRequest,omitempty"`
+	SentinelMemoryRequest *string `json:"sentinelMemoryRequest,omitempty"`
+	SentinelCPULimit      *string `json:"sentinelCpuLimit,omitempty"`
+	SentinelMemoryLimit   *string `json:"sentinelMemoryLimit,omitempty"`
+
+	// New plan; must be reachable from the current plan (Plan.UpgradesTo / DowngradesTo). Cannot be
+	// combined with Capacity, replica or Redis resource changes. Storage is never reduced by a downgrade.
+	Plan *string `json:"plan,omitempty"`
+
+	// New backup schedule; an empty Cron removes the schedule (existing backups are kept).
+	BackupSchedule *BackupSchedule `json:"backupSchedule,omitempty"`
+
+	// Redis configuration parameters to set; other parameters are kept. An empty value sets a
+	// parameter back to the Redis default, also on running pods (the default is then listed in Config).
+	Config map[string]string `json:"config,omitempty"`
 }
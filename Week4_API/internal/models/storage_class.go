@@ -0,0 +1,11 @@
+package models
+
+// StorageClass is a Kubernetes StorageClass instances may use (GET /api/v1/storage-classes).
+type StorageClass struct {
+	Name        string `json:"name"`
+	Provisioner string `json:"provisioner"`
+	// AllowVolumeExpansion reports whether the capacity of instances on this class can be increased.
+	AllowVolumeExpansion bool `json:"allowVolumeExpansion"`
+	// Default marks the class used when CreateRedisRequest.StorageClass is empty.
+	Default bool `json:"default"`
+}
@@ -0,0 +1,73 @@
+package opstore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+)
+
+// MemoryStore implements Store in process memory. Data is lost on restart and not shared between replicas.
+type MemoryStore struct {
+	mu  sync.RWMutex
+	ops map[string]operation // key: id
+}
+
+type operation struct {
+	tenant string
+	op     models.Operation
+}
+
+// Ensure MemoryStore implements Store.
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{ops: make(map[string]operation)}
+}
+
+// CreateOperation stores the operation by id.
+func (s *MemoryStore) CreateOperation(ctx context.Context, tenant string, op models.Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ops[op.ID] = operation{tenant: tenant, op: op}
+	return nil
+}
+
+// GetOperation returns a copy of the tenant's operation.
+func (s *MemoryStore) GetOperation(ctx context.Context, tenant, id string) (*models.Operation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o, ok := s.ops[id]
+	if !ok || o.tenant != tenant {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return &o.op, nil
+}
+
+// UpdateOperation replaces the mutable fields of the stored operation unless it has completed.
+func (s *MemoryStore) UpdateOperation(ctx context.Context, tenant string, op models.Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.ops[op.ID]
+	if !ok || o.tenant != tenant || o.op.CompletedAt != nil {
+		return fmt.Errorf("%w: %s", ErrNotFound, op.ID)
+	}
+	o.op.State, o.op.Message, o.op.Error, o.op.UpdatedAt, o.op.CompletedAt = op.State, op.Message, op.Error, op.UpdatedAt, op.CompletedAt
+	s.ops[op.ID] = o
+	return nil
+}
+
+// DeleteCompletedBefore removes operations that completed before cutoff.
+func (s *MemoryStore) DeleteCompletedBefore(ctx context.Context, cutoff time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, o := range s.ops {
+		if o.op.CompletedAt != nil && o.op.CompletedAt.Before(cutoff) {
+			delete(s.ops, id)
+		}
+	}
+	return nil
+}
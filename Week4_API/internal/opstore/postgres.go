@@ -0,0 +1,88 @@
+package opstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+)
+
+// PostgresStore implements Store using the PostgreSQL operations table. It shares the *sql.DB opened by
+// logstore.NewPostgresStore; closing is left to the owner of the connection.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// Ensure PostgresStore implements Store.
+var _ Store = (*PostgresStore)(nil)
+
+// NewPostgresStore returns a store backed by an existing database connection.
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// CreateOperation inserts an operations row; the instance is stored as JSON.
+func (s *PostgresStore) CreateOperation(ctx context.Context, tenant string, op models.Operation) error {
+	var instance []byte
+	if op.Instance != nil {
+		var err error
+		if instance, err = json.Marshal(op.Instance); err != nil {
+			return fmt.Errorf("marshal instance: %w", err)
+		}
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO operations (id, tenant_user, type, instance_id, state, message, error, instance, created_at, updated_at, completed_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		op.ID, tenant, op.Type, op.InstanceID, op.State, op.Message, op.Error, instance, op.CreatedAt, op.UpdatedAt, op.CompletedAt)
+	return err
+}
+
+// GetOperation returns the operations row by tenant and id.
+func (s *PostgresStore) GetOperation(ctx context.Context, tenant, id string) (*models.Operation, error) {
+	var op models.Operation
+	var instance []byte
+	var completedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, type, instance_id, state, message, error, instance, created_at, updated_at, completed_at FROM operations WHERE tenant_user = $1 AND id = $2`,
+		tenant, id).Scan(&op.ID, &op.Type, &op.InstanceID, &op.State, &op.Message, &op.Error, &instance, &op.CreatedAt, &op.UpdatedAt, &completedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(instance) > 0 {
+		op.Instance = &models.RedisInstance{}
+		if err := json.Unmarshal(instance, op.Instance); err != nil {
+			return nil, fmt.Errorf("unmarshal instance: %w", err)
+		}
+	}
+	if completedAt.Valid {
+		t := completedAt.Time
+		op.CompletedAt = &t
+	}
+	return &op, nil
+}
+
+// UpdateOperation updates state, message, error, updated_at and completed_at of a row not yet completed.
+func (s *PostgresStore) UpdateOperation(ctx context.Context, tenant string, op models.Operation) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE operations SET state = $3, message = $4, error = $5, updated_at = $6, completed_at = $7 WHERE tenant_user = $1 AND id = $2 AND completed_at IS NULL`,
+		tenant, op.ID, op.State, op.Message, op.Error, op.UpdatedAt, op.CompletedAt)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, op.ID)
+	}
+	return nil
+}
+
+// DeleteCompletedBefore deletes the rows that completed before cutoff.
+func (s *PostgresStore) DeleteCompletedBefore(ctx context.Context, cutoff time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM operations WHERE completed_at < $1`, cutoff)
+	return err
+}
@@ -0,0 +1,29 @@
+// Package opstore persists instance operations (see models.Operation), so that any API replica can report
+// and finish an operation another replica started, also after a restart.
+package opstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+)
+
+// ErrNotFound is returned when the requested operation does not exist or belongs to another tenant.
+var ErrNotFound = errors.New("operation not found")
+
+// Store persists operations. PostgresStore is used when DATABASE_URL is set; MemoryStore otherwise (and in
+// tests).
+type Store interface {
+	// CreateOperation stores a new operation of the tenant.
+	CreateOperation(ctx context.Context, tenant string, op models.Operation) error
+	// GetOperation returns the tenant's operation by id. Returns ErrNotFound if it does not exist.
+	GetOperation(ctx context.Context, tenant, id string) (*models.Operation, error)
+	// UpdateOperation stores the state, message, error, update and completion time of op. Returns
+	// ErrNotFound if it does not exist or has already completed, so that only one caller records the
+	// outcome.
+	UpdateOperation(ctx context.Context, tenant string, op models.Operation) error
+	// DeleteCompletedBefore removes operations that completed before cutoff.
+	DeleteCompletedBefore(ctx context.Context, cutoff time.Time) error
+}
@@ -0,0 +1,273 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/backupstore"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/cron"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/k8s"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+)
+
+// BackupLeaseName is the Lease API replicas compete for; only the holder runs the BackupScheduler.
+const BackupLeaseName = "paas-api-backup-scheduler"
+
+const (
+	// defaultBackupInterval is how often schedules are checked; cron expressions have minute resolution.
+	defaultBackupInterval = time.Minute
+	// defaultKeepLast is the retention of schedules with neither KeepLast nor MaxAge.
+	defaultKeepLast = 7
+	// scheduledBackupActor is recorded as the creator of scheduled backups.
+	scheduledBackupActor = "backup-scheduler"
+)
+
+// Service log event types written by the BackupScheduler. Finished backups use the same types as the
+// API does for backups taken by hand.
+const (
+	EventBackupCompleted = "backup_completed"
+	EventBackupFailed    = "backup_failed"
+	EventBackupPruned    = "backup_pruned"
+)
+
+// BackupSource is the part of k8s.RedisFailoverStore the BackupScheduler reads from.
+type BackupSource interface {
+	BackupSchedules(ctx context.Context) ([]k8s.ScheduledBackup, error)
+	NamespaceTenant(ctx context.Context, ns string) string
+}
+
+// ServiceLogs appends service logs; implemented by logstore.Store.
+type ServiceLogs interface {
+	AppendServiceLog(ctx context.Context, tenantUser, instanceID, eventType, message string, metadata map[string]any) error
+}
+
+// BackupScheduler takes the backups of instances with a backup schedule (k8s.AnnotationBackupSchedule)
+// with the same Jobs as the API, records the outcome of all running backups (also those taken by hand)
+// and prunes scheduled backups beyond the schedule's retention. Each outcome is written as a service log.
+// Run it on one replica only (see k8s.RunWhileLeader).
+type BackupScheduler struct {
+	Source   BackupSource
+	Jobs     k8s.BackupJobs
+	Backups  backupstore.Store
+	Logs     ServiceLogs
+	Logger   *slog.Logger
+	Interval time.Duration // 0 uses defaultBackupInterval
+}
+
+// Run checks the schedules every Interval until ctx ends. Runs missed while no replica was scheduling
+// are caught up with a single backup.
+func (s *BackupScheduler) Run(ctx context.Context) {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = defaultBackupInterval
+	}
+	s.Logger.Info("backup scheduler started")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.runOnce(ctx, time.Now().UTC())
+		select {
+		case <-ctx.Done():
+			s.Logger.Info("backup scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *BackupScheduler) runOnce(ctx context.Context, now time.Time) {
+	s.refreshRunning(ctx, now)
+	scheduled, err := s.Source.BackupSchedules(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.Logger.Warn("list backup schedules failed", "error", err)
+		}
+		return
+	}
+	for _, sb := range scheduled {
+		if err := s.sync(ctx, sb, now); err != nil && ctx.Err() == nil {
+			s.Logger.Warn("scheduled backup failed", "namespace", sb.Namespace, "instanceId", sb.Name, "error", err)
+		}
+	}
+}
+
+// refreshRunning records the outcome of every running backup, so that backups taken by hand finish (and
+// are logged) even if no one reads them before their Job is removed.
+func (s *BackupScheduler) refreshRunning(ctx context.Context, now time.Time) {
+	running, err := s.Backups.ListRunningBackups(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.Logger.Warn("list running backups failed", "error", err)
+		}
+		return
+	}
+	for i := range running {
+		b := &running[i]
+		tctx, err := k8s.WithTenant(ctx, b.Tenant)
+		if err != nil {
+			s.Logger.Warn("backup of invalid tenant", "backupId", b.ID, "tenant", b.Tenant, "error", err)
+			continue
+		}
+		s.refresh(tctx, b, now)
+	}
+}
+
+// sync starts a backup of the instance if one is due and none is running (refreshRunning recorded the
+// finished ones before), and prunes scheduled backups beyond the retention. The first backup is due at
+// the first matching time after the instance was created, so a schedule added later starts with a backup.
+func (s *BackupScheduler) sync(ctx context.Context, sb k8s.ScheduledBackup, now time.Time) error {
+	tenant := s.Source.NamespaceTenant(ctx, sb.Namespace)
+	if tenant == "" {
+		return nil
+	}
+	sched, err := cron.Parse(sb.Schedule.Cron)
+	if err != nil {
+		return err
+	}
+	ctx = k8s.WithNamespace(ctx, sb.Namespace)
+	backups, err := s.Backups.ListBackups(ctx, tenant, sb.Name)
+	if err != nil {
+		return fmt.Errorf("list backups: %w", err)
+	}
+	last, running := sb.CreatedAt, false
+	for i := range backups {
+		b := &backups[i]
+		if !b.Scheduled {
+			continue
+		}
+		running = running || b.State == models.BackupRunning
+		if b.CreatedAt.After(last) {
+			last = b.CreatedAt
+		}
+	}
+	if next := sched.Next(last.UTC()); !running && !next.IsZero() && !now.Before(next) {
+		b, err := s.start(ctx, tenant, sb.Name, now)
+		if err != nil {
+			return err
+		}
+		backups = append([]backupstore.Backup{*b}, backups...)
+	}
+	return s.prune(ctx, sb, backups, now)
+}
+
+// start starts a scheduled backup. A backup that cannot be started is recorded as failed, so that it is
+// retried at the next scheduled time rather than on every check.
+func (s *BackupScheduler) start(ctx context.Context, tenant, instanceID string, now time.Time) (*backupstore.Backup, error) {
+	id, err := backupstore.NewID()
+	if err != nil {
+		return nil, fmt.Errorf("generate backup id: %w", err)
+	}
+	b := &backupstore.Backup{
+		ID:         id,
+		Tenant:     tenant,
+		InstanceID: instanceID,
+		State:      models.BackupRunning,
+		CreatedBy:  scheduledBackupActor,
+		Scheduled:  true,
+		CreatedAt:  now,
+	}
+	if b.Location, err = s.Jobs.StartBackup(ctx, instanceID, id); err != nil {
+		b.State, b.Error, b.CompletedAt = models.BackupFailed, err.Error(), &now
+	}
+	if err := s.Backups.CreateBackup(ctx, *b); err != nil {
+		// Without its record no one would finish or prune the backup: remove the Job and its file.
+		if b.State == models.BackupRunning {
+			if derr := s.Jobs.DeleteBackupObject(ctx, id, b.Location); derr != nil {
+				s.Logger.Warn("failed to remove unrecorded backup", "backupId", id, "error", derr)
+			}
+		}
+		return nil, fmt.Errorf("store backup %s: %w", id, err)
+	}
+	if b.State == models.BackupFailed {
+		s.logOutcome(ctx, *b)
+	}
+	return b, nil
+}
+
+// refresh records the outcome of a running backup once its Job finished. Like the API, it logs the
+// outcome only if it was the one to record it.
+func (s *BackupScheduler) refresh(ctx context.Context, b *backupstore.Backup, now time.Time) {
+	st, err := s.Jobs.BackupStatus(ctx, b.ID, b.Location)
+	if err != nil {
+		s.Logger.Warn("backup status check failed", "backupId", b.ID, "error", err)
+		return
+	}
+	if st.State == models.BackupRunning {
+		return
+	}
+	b.State, b.SizeBytes, b.Error, b.CompletedAt = st.State, st.SizeBytes, st.Error, &now
+	if err := s.Backups.UpdateBackup(ctx, *b); err != nil {
+		if !errors.Is(err, backupstore.ErrNotFound) {
+			s.Logger.Warn("backup update failed", "backupId", b.ID, "error", err)
+		}
+		return
+	}
+	s.logOutcome(ctx, *b)
+}
+
+// prune deletes finished scheduled backups beyond the retention: all but the newest KeepLast and those
+// older than MaxAge. Failed backups count towards KeepLast; the newest completed backup is always kept.
+// backups must be sorted newest first.
+func (s *BackupScheduler) prune(ctx context.Context, sb k8s.ScheduledBackup, backups []backupstore.Backup, now time.Time) error {
+	keep := sb.Schedule.KeepLast
+	var maxAge time.Duration
+	if sb.Schedule.MaxAge != "" {
+		maxAge, _ = time.ParseDuration(sb.Schedule.MaxAge)
+	}
+	if keep == 0 && maxAge == 0 {
+		keep = defaultKeepLast
+	}
+	var errs []error
+	n, keptCompleted := 0, false
+	for _, b := range backups {
+		if !b.Scheduled || b.State == models.BackupRunning {
+			continue
+		}
+		n++
+		expired := (keep > 0 && n > keep) || (maxAge > 0 && now.Sub(b.CreatedAt) > maxAge)
+		if b.State == models.BackupCompleted && !keptCompleted {
+			keptCompleted, expired = true, false
+		}
+		if !expired {
+			continue
+		}
+		if err := s.Jobs.DeleteBackupObject(ctx, b.ID, b.Location); err != nil {
+			errs = append(errs, fmt.Errorf("delete backup %s: %w", b.ID, err))
+			continue
+		}
+		if err := s.Backups.DeleteBackup(ctx, b.Tenant, b.ID); err != nil && !errors.Is(err, backupstore.ErrNotFound) {
+			errs = append(errs, fmt.Errorf("delete backup %s: %w", b.ID, err))
+			continue
+		}
+		s.appendLog(ctx, b, EventBackupPruned, "scheduled backup "+b.ID+" pruned")
+	}
+	return errors.Join(errs...)
+}
+
+func (s *BackupScheduler) logOutcome(ctx context.Context, b backupstore.Backup) {
+	eventType := EventBackupCompleted
+	if b.State == models.BackupFailed {
+		eventType = EventBackupFailed
+	}
+	message := "backup " + b.ID + " " + b.State
+	if b.Scheduled {
+		message = "scheduled " + message
+	}
+	s.appendLog(ctx, b, eventType, message)
+}
+
+func (s *BackupScheduler) appendLog(ctx context.Context, b backupstore.Backup, eventType, message string) {
+	err := s.Logs.AppendServiceLog(ctx, b.Tenant, b.InstanceID, eventType, message, map[string]any{
+		"backupId":  b.ID,
+		"location":  b.Location,
+		"sizeBytes": b.SizeBytes,
+		"error":     b.Error,
+		"scheduled": b.Scheduled,
+	})
+	if err != nil && ctx.Err() == nil {
+		s.Logger.Warn("service log write failed", "instanceId", b.InstanceID, "eventType", eventType, "error", err)
+	}
+}
@@ -0,0 +1,181 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/backupstore"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/k8s"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+)
+
+// fakeBackupJobs starts backups of "cache" only; jobs maps backup ids to their Job's state.
+type fakeBackupJobs struct {
+	mu      sync.Mutex
+	jobs    map[string]string
+	deleted []string
+}
+
+func (f *fakeBackupJobs) StartBackup(_ context.Context, instanceID, backupID string) (string, error) {
+	if instanceID != "cache" {
+		return "", errors.New("redis master not reachable")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.jobs[backupID] = models.BackupRunning
+	return "s3://backups/" + backupID + ".rdb", nil
+}
+
+func (f *fakeBackupJobs) BackupStatus(_ context.Context, backupID, _ string) (*k8s.BackupStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &k8s.BackupStatus{State: f.jobs[backupID], SizeBytes: 1024}, nil
+}
+
+func (f *fakeBackupJobs) DeleteBackupObject(_ context.Context, backupID, _ string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleted = append(f.deleted, backupID)
+	return nil
+}
+
+// completeAll marks every running Job as completed.
+func (f *fakeBackupJobs) completeAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id, state := range f.jobs {
+		if state == models.BackupRunning {
+			f.jobs[id] = models.BackupCompleted
+		}
+	}
+}
+
+// fakeSchedules is a BackupSource; the tests call sync with the schedules directly.
+type fakeSchedules struct{ fakeSource }
+
+func (fakeSchedules) BackupSchedules(context.Context) ([]k8s.ScheduledBackup, error) {
+	return nil, nil
+}
+
+type memoryServiceLogs struct{ types []string }
+
+func (m *memoryServiceLogs) AppendServiceLog(_ context.Context, _, _, eventType, _ string, _ map[string]any) error {
+	m.types = append(m.types, eventType)
+	return nil
+}
+
+func TestBackupScheduler_Sync(t *testing.T) {
+	created := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	jobs := &fakeBackupJobs{jobs: map[string]string{}}
+	logs := &memoryServiceLogs{}
+	store := backupstore.NewMemoryStore()
+	s := &BackupScheduler{
+		Source:  fakeSchedules{fakeSource{}},
+		Jobs:    jobs,
+		Backups: store,
+		Logs:    logs,
+		Logger:  slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)),
+	}
+	ctx := context.Background()
+	cache := k8s.ScheduledBackup{
+		InstanceKey: k8s.InstanceKey{Namespace: "tenant-alice", Name: "cache"},
+		Schedule:    models.BackupSchedule{Cron: "0 3 * * *", KeepLast: 2},
+		CreatedAt:   created,
+	}
+	// sync runs one check of the schedule, like runOnce.
+	sync := func(sb k8s.ScheduledBackup, now time.Time) {
+		t.Helper()
+		s.refreshRunning(ctx, now)
+		if err := s.sync(ctx, sb, now); err != nil {
+			t.Fatalf("sync at %s: %v", now, err)
+		}
+	}
+	list := func(instanceID string) []backupstore.Backup {
+		t.Helper()
+		backups, err := store.ListBackups(ctx, "alice", instanceID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return backups
+	}
+
+	// A backup taken by hand is never pruned.
+	manual := backupstore.Backup{ID: "manual", Tenant: "alice", InstanceID: "cache", State: models.BackupCompleted, CreatedAt: created, CompletedAt: &created}
+	if err := store.CreateBackup(ctx, manual); err != nil {
+		t.Fatal(err)
+	}
+
+	sync(cache, created.Add(2*time.Hour+59*time.Minute))
+	if n := len(list("cache")); n != 1 {
+		t.Fatalf("before the first run: %d backups", n)
+	}
+	day := created.Add(3 * time.Hour)
+	sync(cache, day)
+	sync(cache, day.Add(time.Minute)) // still running: no second backup
+	if backups := list("cache"); len(backups) != 2 || backups[0].State != models.BackupRunning || !backups[0].Scheduled {
+		t.Fatalf("after the first run: %+v", backups)
+	}
+	for i := 0; i < 3; i++ {
+		jobs.completeAll()
+		sync(cache, day.Add(2*time.Minute)) // records the outcome
+		day = day.AddDate(0, 0, 1)
+		sync(cache, day)
+	}
+	jobs.completeAll()
+	sync(cache, day.Add(time.Minute))
+
+	// Four scheduled backups were taken; the two oldest are pruned.
+	backups := list("cache")
+	if len(backups) != 3 || backups[2].ID != "manual" || len(jobs.deleted) != 2 {
+		t.Fatalf("after four runs: %+v, deleted %v", backups, jobs.deleted)
+	}
+	want := []string{
+		EventBackupCompleted, EventBackupCompleted, EventBackupCompleted, EventBackupPruned,
+		EventBackupCompleted, EventBackupPruned,
+	}
+	if !reflect.DeepEqual(logs.types, want) {
+		t.Fatalf("logs %v, want %v", logs.types, want)
+	}
+
+	// A backup that cannot be started is recorded as failed and not retried before the next run.
+	logs.types = nil
+	broken := cache
+	broken.Name = "broken"
+	sync(broken, day)
+	sync(broken, day.Add(time.Minute))
+	if backups := list("broken"); len(backups) != 1 || backups[0].State != models.BackupFailed || backups[0].Error == "" {
+		t.Fatalf("failed start: %+v", backups)
+	}
+	if !reflect.DeepEqual(logs.types, []string{EventBackupFailed}) {
+		t.Fatalf("logs %v", logs.types)
+	}
+
+	// Running backups taken by hand are finished too, also of instances without a schedule.
+	logs.types = nil
+	running := backupstore.Backup{ID: "by-hand", Tenant: "alice", InstanceID: "other", State: models.BackupRunning, CreatedAt: day}
+	jobs.jobs["by-hand"] = models.BackupCompleted
+	if err := store.CreateBackup(ctx, running); err != nil {
+		t.Fatal(err)
+	}
+	s.refreshRunning(ctx, day)
+	if backups := list("other"); len(backups) != 1 || backups[0].State != models.BackupCompleted || backups[0].CompletedAt == nil {
+		t.Fatalf("backup taken by hand: %+v", backups)
+	}
+	if !reflect.DeepEqual(logs.types, []string{EventBackupCompleted}) {
+		t.Fatalf("logs %v", logs.types)
+	}
+
+	// Instances outside tenant namespaces are ignored.
+	other := cache
+	other.Namespace = "kube-system"
+	sync(other, day.AddDate(0, 0, 1))
+	if len(jobs.jobs) != 5 {
+		t.Fatalf("%d backup jobs, want 5", len(jobs.jobs))
+	}
+}
@@ -0,0 +1,214 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/logstore"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// EventLeaseName is the Lease API replicas compete for; only the holder runs the EventWatcher.
+const EventLeaseName = "paas-api-event-watcher"
+
+// defaultDedupeWindow is how long a repeating Kubernetes Event is logged only once.
+const defaultDedupeWindow = time.Hour
+
+// Service log event types written by the EventWatcher.
+const (
+	EventSchedulingFailed   = "scheduling_failed"
+	EventProvisioningFailed = "provisioning_failed"
+	EventCrashBackOff       = "crash_backoff"
+	EventVolumeFailed       = "volume_failed"
+	EventKubernetesWarning  = "kubernetes_warning"
+)
+
+// EventSource is the part of k8s.RedisFailoverStore the EventWatcher reads from.
+type EventSource interface {
+	WatchWarningEvents(ctx context.Context, fn func(*unstructured.Unstructured)) error
+	EventInstance(ctx context.Context, ns, kind, name string) string
+	NamespaceTenant(ctx context.Context, ns string) string
+}
+
+// EventWatcher follows Warning Events in tenant namespaces and writes the ones about an instance's objects
+// (RedisFailover, pods, PVCs, ...) as service logs, so tenants see why an instance does not come up.
+// An Event that keeps repeating is logged once per DedupeWindow. Run it on one replica only (see
+// k8s.RunWhileLeader).
+type EventWatcher struct {
+	Source       EventSource
+	States       logstore.StateStore
+	Logger       *slog.Logger
+	Workers      int           // 0 uses defaultWorkers
+	DedupeWindow time.Duration // 0 uses defaultDedupeWindow
+}
+
+// warningEvent holds the fields of a Kubernetes Event the EventWatcher logs.
+type warningEvent struct {
+	Namespace string
+	Kind      string // of the involved object
+	Object    string
+	Reason    string
+	Message   string
+	Count     int64
+	First     time.Time
+	Last      time.Time
+	Source    string
+}
+
+// Run logs Events until ctx ends. Existing Events are processed at the start; those already logged
+// within the dedupe window are skipped.
+func (w *EventWatcher) Run(ctx context.Context) {
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[warningEvent]())
+	if err := w.Source.WatchWarningEvents(ctx, func(obj *unstructured.Unstructured) {
+		if ev, ok := parseEvent(obj); ok {
+			queue.Add(ev)
+		}
+	}); err != nil {
+		w.Logger.Error("event watcher not started", "error", err)
+		return
+	}
+	w.Logger.Info("event watcher started")
+
+	go w.pruneLoop(ctx)
+	runWorkers(ctx, queue, w.Workers, func(ev warningEvent) error {
+		err := w.sync(ctx, ev, time.Now())
+		if err != nil && ctx.Err() == nil {
+			w.Logger.Warn("event sync failed", "namespace", ev.Namespace, "object", ev.Kind+"/"+ev.Object, "reason", ev.Reason, "error", err)
+		}
+		return err
+	})
+	w.Logger.Info("event watcher stopped")
+}
+
+func (w *EventWatcher) window() time.Duration {
+	if w.DedupeWindow > 0 {
+		return w.DedupeWindow
+	}
+	return defaultDedupeWindow
+}
+
+// pruneLoop forgets dedupe keys that are past the window.
+func (w *EventWatcher) pruneLoop(ctx context.Context) {
+	ticker := time.NewTicker(w.window())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.States.PruneServiceLogDedupe(ctx, time.Now().Add(-w.window())); err != nil && ctx.Err() == nil {
+				w.Logger.Warn("prune service log dedupe failed", "error", err)
+			}
+		}
+	}
+}
+
+// sync logs ev for the instance it is about, unless it is not about an instance in a tenant namespace,
+// last occurred before the dedupe window or was logged within it.
+func (w *EventWatcher) sync(ctx context.Context, ev warningEvent, now time.Time) error {
+	if now.Sub(ev.Last) > w.window() {
+		return nil
+	}
+	tenant := w.Source.NamespaceTenant(ctx, ev.Namespace)
+	if tenant == "" {
+		return nil
+	}
+	instance := w.Source.EventInstance(ctx, ev.Namespace, ev.Kind, ev.Object)
+	if instance == "" {
+		return nil
+	}
+	dedupeKey := strings.Join([]string{"event", ev.Namespace, ev.Kind, ev.Object, ev.Reason}, "/")
+	_, err := w.States.AppendServiceLogOnce(ctx, tenant, instance, dedupeKey, w.window(), eventLog(ev))
+	return err
+}
+
+// parseEvent reads a core/v1 Event. Events recorded through the events.k8s.io API carry eventTime and
+// series instead of the timestamps and count.
+func parseEvent(obj *unstructured.Unstructured) (warningEvent, bool) {
+	str := func(fields ...string) string {
+		v, _, _ := unstructured.NestedString(obj.Object, fields...)
+		return v
+	}
+	timestamp := func(fields ...string) time.Time {
+		t, _ := time.Parse(time.RFC3339Nano, str(fields...))
+		return t
+	}
+	ev := warningEvent{
+		Namespace: obj.GetNamespace(),
+		Kind:      str("involvedObject", "kind"),
+		Object:    str("involvedObject", "name"),
+		Reason:    str("reason"),
+		Message:   str("message"),
+		First:     timestamp("firstTimestamp"),
+		Last:      timestamp("lastTimestamp"),
+		Source:    str("source", "component"),
+	}
+	if ev.Kind == "" || ev.Object == "" || ev.Reason == "" {
+		return warningEvent{}, false
+	}
+	ev.Count, _, _ = unstructured.NestedInt64(obj.Object, "count")
+	if ev.Count == 0 {
+		ev.Count, _, _ = unstructured.NestedInt64(obj.Object, "series", "count")
+	}
+	if ev.Count == 0 {
+		ev.Count = 1
+	}
+	if ev.First.IsZero() {
+		ev.First = timestamp("eventTime")
+	}
+	if ev.Last.IsZero() {
+		ev.Last = timestamp("series", "lastObservedTime")
+	}
+	if ev.Last.IsZero() {
+		ev.Last = ev.First
+	}
+	if ev.Last.IsZero() {
+		ev.Last = obj.GetCreationTimestamp().Time
+	}
+	if ev.Source == "" {
+		ev.Source = str("reportingComponent")
+	}
+	return ev, true
+}
+
+// eventLog translates an Event into a service log, with a message tenants can act on for the reasons
+// that usually keep an instance from starting.
+func eventLog(ev warningEvent) logstore.ServiceLog {
+	l := logstore.ServiceLog{
+		EventType: EventKubernetesWarning,
+		Message:   fmt.Sprintf("%s %s: %s: %s", ev.Kind, ev.Object, ev.Reason, ev.Message),
+		Metadata: map[string]any{
+			"reason":  ev.Reason,
+			"kind":    ev.Kind,
+			"object":  ev.Object,
+			"count":   ev.Count,
+			"message": ev.Message,
+			"source":  ev.Source,
+		},
+	}
+	if !ev.First.IsZero() {
+		l.Metadata["firstTimestamp"] = ev.First.UTC().Format(time.RFC3339)
+	}
+	if !ev.Last.IsZero() {
+		l.Metadata["lastTimestamp"] = ev.Last.UTC().Format(time.RFC3339)
+	}
+	switch ev.Reason {
+	case "FailedScheduling":
+		l.EventType = EventSchedulingFailed
+		l.Message = fmt.Sprintf("Pod %s cannot be scheduled: %s", ev.Object, ev.Message)
+	case "ProvisioningFailed":
+		l.EventType = EventProvisioningFailed
+		l.Message = fmt.Sprintf("Volume %s could not be provisioned: %s", ev.Object, ev.Message)
+	case "BackOff":
+		l.EventType = EventCrashBackOff
+		l.Message = fmt.Sprintf("Pod %s is backing off: %s", ev.Object, ev.Message)
+	case "FailedMount", "FailedAttachVolume":
+		l.EventType = EventVolumeFailed
+		l.Message = fmt.Sprintf("Volume of pod %s could not be attached: %s", ev.Object, ev.Message)
+	}
+	return l
+}
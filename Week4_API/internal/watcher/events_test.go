@@ -0,0 +1,129 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testEvent(ns, kind, object, reason string, last time.Time) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion":     "v1",
+		"kind":           "Event",
+		"metadata":       map[string]interface{}{"namespace": ns, "name": object + ".1"},
+		"involvedObject": map[string]interface{}{"kind": kind, "name": object},
+		"type":           "Warning",
+		"reason":         reason,
+		"message":        "0/3 nodes are available",
+		"count":          int64(4),
+		"firstTimestamp": last.Add(-time.Minute).Format(time.RFC3339),
+		"lastTimestamp":  last.Format(time.RFC3339),
+		"source":         map[string]interface{}{"component": "default-scheduler"},
+	}}
+}
+
+func TestParseEvent(t *testing.T) {
+	last := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ev, ok := parseEvent(testEvent("tenant-alice", "Pod", "rfr-cache-0", "FailedScheduling", last))
+	if !ok {
+		t.Fatal("event not parsed")
+	}
+	want := warningEvent{
+		Namespace: "tenant-alice",
+		Kind:      "Pod",
+		Object:    "rfr-cache-0",
+		Reason:    "FailedScheduling",
+		Message:   "0/3 nodes are available",
+		Count:     4,
+		First:     last.Add(-time.Minute),
+		Last:      last,
+		Source:    "default-scheduler",
+	}
+	if !reflect.DeepEqual(ev, want) {
+		t.Fatalf("got %+v, want %+v", ev, want)
+	}
+	l := eventLog(ev)
+	if l.EventType != EventSchedulingFailed || l.Metadata["count"] != int64(4) || l.Metadata["lastTimestamp"] != "2024-05-01T12:00:00Z" {
+		t.Fatalf("log %+v", l)
+	}
+
+	// events.k8s.io Events have no count or legacy timestamps.
+	obj := testEvent("tenant-alice", "PersistentVolumeClaim", "data-rfr-cache-0", "ProvisioningFailed", last)
+	unstructured.RemoveNestedField(obj.Object, "count")
+	unstructured.RemoveNestedField(obj.Object, "firstTimestamp")
+	unstructured.RemoveNestedField(obj.Object, "lastTimestamp")
+	obj.Object["eventTime"] = last.Format(time.RFC3339Nano)
+	if ev, ok = parseEvent(obj); !ok || ev.Count != 1 || !ev.Last.Equal(last) {
+		t.Fatalf("events.k8s.io event: %+v, %v", ev, ok)
+	}
+	if eventLog(ev).EventType != EventProvisioningFailed {
+		t.Fatalf("event type %q", eventLog(ev).EventType)
+	}
+
+	unstructured.RemoveNestedField(obj.Object, "reason")
+	if _, ok := parseEvent(obj); ok {
+		t.Fatal("event without reason parsed")
+	}
+}
+
+// fakeEvents correlates objects named "rfr-cache-*" with the instance "cache".
+type fakeEvents struct{ fakeSource }
+
+func (fakeEvents) WatchWarningEvents(context.Context, func(*unstructured.Unstructured)) error {
+	return nil
+}
+
+func (fakeEvents) EventInstance(_ context.Context, _, _, name string) string {
+	if strings.HasPrefix(name, "rfr-cache-") {
+		return "cache"
+	}
+	return ""
+}
+
+func TestEventWatcher_Sync(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	states := &memoryStates{states: map[string]models.InstanceState{}, now: now}
+	w := &EventWatcher{
+		Source: fakeEvents{fakeSource{}},
+		States: states,
+		Logger: slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)),
+	}
+	ctx := context.Background()
+	sync := func(ns, object, reason string, last time.Time) {
+		t.Helper()
+		ev, ok := parseEvent(testEvent(ns, "Pod", object, reason, last))
+		if !ok {
+			t.Fatal("event not parsed")
+		}
+		if err := w.sync(ctx, ev, now); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+	}
+	sync("tenant-alice", "rfr-cache-0", "FailedScheduling", now)
+	sync("tenant-alice", "rfr-cache-0", "FailedScheduling", now) // count update of the same Event
+	sync("tenant-alice", "rfr-cache-0", "BackOff", now)
+	sync("tenant-alice", "rfr-other-0", "BackOff", now)                   // not an instance object
+	sync("kube-system", "rfr-cache-0", "BackOff", now)                    // not a tenant namespace
+	sync("tenant-alice", "rfr-cache-1", "BackOff", now.Add(-2*time.Hour)) // older than the window
+	if got := eventTypes(states.logs); !reflect.DeepEqual(got, []string{EventSchedulingFailed, EventCrashBackOff}) {
+		t.Fatalf("logs %v", got)
+	}
+
+	// After the window the Event is logged again.
+	states.now = now.Add(2 * time.Hour)
+	if err := states.PruneServiceLogDedupe(ctx, states.now.Add(-defaultDedupeWindow)); err != nil {
+		t.Fatal(err)
+	}
+	now = states.now
+	sync("tenant-alice", "rfr-cache-0", "FailedScheduling", now)
+	if len(states.logs) != 3 {
+		t.Fatalf("logs %v, want the repeated event logged again", eventTypes(states.logs))
+	}
+}
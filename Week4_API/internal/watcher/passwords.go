@@ -0,0 +1,80 @@
+package watcher
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/k8s"
+)
+
+// PasswordLeaseName is the Lease API replicas compete for; only the holder runs the PasswordRetirer.
+const PasswordLeaseName = "paas-api-password-retirer"
+
+// defaultPasswordInterval is how often expired grace periods are looked for.
+const defaultPasswordInterval = 30 * time.Second
+
+// EventPasswordRetired is the service log event type written by the PasswordRetirer.
+const EventPasswordRetired = "password_retired"
+
+// PasswordSource is the part of k8s.RedisFailoverStore the PasswordRetirer works with.
+type PasswordSource interface {
+	ExpiredPasswordGrace(ctx context.Context, now time.Time) ([]k8s.InstanceKey, error)
+	RetirePreviousPassword(ctx context.Context, key k8s.InstanceKey) error
+	NamespaceTenant(ctx context.Context, ns string) string
+}
+
+// PasswordRetirer removes the previous password of instances whose password was rotated once its grace
+// period ended (see k8s.RedisFailoverStore.RotatePassword) and writes a service log for each. Logs may
+// be nil. Run it on one replica only (see k8s.RunWhileLeader).
+type PasswordRetirer struct {
+	Source   PasswordSource
+	Logs     ServiceLogs
+	Logger   *slog.Logger
+	Interval time.Duration // 0 uses defaultPasswordInterval
+}
+
+// Run retires expired passwords every Interval until ctx ends.
+func (r *PasswordRetirer) Run(ctx context.Context) {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = defaultPasswordInterval
+	}
+	r.Logger.Info("password retirer started")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		r.runOnce(ctx, time.Now().UTC())
+		select {
+		case <-ctx.Done():
+			r.Logger.Info("password retirer stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *PasswordRetirer) runOnce(ctx context.Context, now time.Time) {
+	keys, err := r.Source.ExpiredPasswordGrace(ctx, now)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.Logger.Warn("list password rotations failed", "error", err)
+		}
+		return
+	}
+	for _, key := range keys {
+		if err := r.Source.RetirePreviousPassword(ctx, key); err != nil {
+			if ctx.Err() == nil {
+				r.Logger.Warn("retire previous password failed", "namespace", key.Namespace, "instanceId", key.Name, "error", err)
+			}
+			continue
+		}
+		tenant := r.Source.NamespaceTenant(ctx, key.Namespace)
+		if r.Logs == nil || tenant == "" {
+			continue
+		}
+		if err := r.Logs.AppendServiceLog(ctx, tenant, key.Name, EventPasswordRetired, "previous password of "+key.Name+" no longer accepted", nil); err != nil && ctx.Err() == nil {
+			r.Logger.Warn("service log write failed", "instanceId", key.Name, "eventType", EventPasswordRetired, "error", err)
+		}
+	}
+}
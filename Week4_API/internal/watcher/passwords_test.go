@@ -0,0 +1,58 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/k8s"
+)
+
+// fakePasswords is a PasswordSource; expired instances are retired unless listed in failing.
+type fakePasswords struct {
+	fakeSource
+	expired []k8s.InstanceKey
+	failing map[string]bool
+	retired []string
+}
+
+func (f *fakePasswords) ExpiredPasswordGrace(context.Context, time.Time) ([]k8s.InstanceKey, error) {
+	return f.expired, nil
+}
+
+func (f *fakePasswords) RetirePreviousPassword(_ context.Context, key k8s.InstanceKey) error {
+	if f.failing[key.Name] {
+		return errors.New("pod unreachable")
+	}
+	f.retired = append(f.retired, key.Name)
+	return nil
+}
+
+func TestPasswordRetirer_RunOnce(t *testing.T) {
+	src := &fakePasswords{
+		expired: []k8s.InstanceKey{{Namespace: "tenant-alice", Name: "a"}, {Namespace: "tenant-alice", Name: "b"}, {Namespace: "tenant-bob", Name: "c"}},
+		failing: map[string]bool{"b": true},
+	}
+	logs := &memoryServiceLogs{}
+	r := &PasswordRetirer{Source: src, Logs: logs, Logger: slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))}
+	r.runOnce(context.Background(), time.Now())
+
+	// c is retired but its namespace has no tenant to log for.
+	if len(src.retired) != 2 || src.retired[0] != "a" || src.retired[1] != "c" {
+		t.Fatalf("retired %v", src.retired)
+	}
+	if len(logs.types) != 1 || logs.types[0] != EventPasswordRetired {
+		t.Fatalf("service logs %v", logs.types)
+	}
+
+	// Without a log store passwords are still retired.
+	r.Logs = nil
+	src.retired = nil
+	r.runOnce(context.Background(), time.Now())
+	if len(src.retired) != 2 {
+		t.Fatalf("retired without logs %v", src.retired)
+	}
+}
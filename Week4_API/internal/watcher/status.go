@@ -0,0 +1,181 @@
+// Package watcher runs background controllers that turn cluster changes into tenant service logs.
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/k8s"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/logstore"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// StatusLeaseName is the Lease API replicas compete for; only the holder runs the StatusWatcher.
+const StatusLeaseName = "paas-api-status-watcher"
+
+// defaultWorkers is the number of instances synced in parallel.
+const defaultWorkers = 2
+
+// Service log event types written by the StatusWatcher.
+const (
+	EventStatusChange = "status_change"
+	EventPodRestart   = "pod_restart"
+	EventFailover     = "failover"
+	EventOOMKilled    = "oom_killed"
+)
+
+// InstanceSource is the part of k8s.RedisFailoverStore the StatusWatcher reads from.
+type InstanceSource interface {
+	WatchInstances(fn func(k8s.InstanceKey)) (*k8s.InstanceWatch, error)
+	InstanceState(ctx context.Context, key k8s.InstanceKey) (*models.InstanceState, error)
+	NamespaceTenant(ctx context.Context, ns string) string
+}
+
+// StatusWatcher follows RedisFailovers and their pods and writes status_change, pod_restart, failover
+// and oom_killed service logs when an instance's state differs from the last state persisted in States.
+// Run it on one replica only (see k8s.RunWhileLeader).
+type StatusWatcher struct {
+	Source  InstanceSource
+	States  logstore.StateStore
+	Logger  *slog.Logger
+	Workers int // 0 uses defaultWorkers
+}
+
+// Run syncs instances until ctx ends. Every existing instance is synced once at the start, so changes
+// that happened while no replica was watching are logged then.
+func (w *StatusWatcher) Run(ctx context.Context) {
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[k8s.InstanceKey]())
+	watch, err := w.Source.WatchInstances(func(key k8s.InstanceKey) { queue.Add(key) })
+	if err != nil {
+		w.Logger.Error("status watcher not started", "error", err)
+		return
+	}
+	defer watch.Stop()
+	w.Logger.Info("status watcher started")
+
+	runWorkers(ctx, queue, w.Workers, func(key k8s.InstanceKey) error {
+		err := w.sync(ctx, key)
+		if err != nil && ctx.Err() == nil {
+			w.Logger.Warn("status sync failed", "namespace", key.Namespace, "instanceId", key.Name, "error", err)
+		}
+		return err
+	})
+	w.Logger.Info("status watcher stopped")
+}
+
+// runWorkers processes queue items with process on the given number of workers (0 uses defaultWorkers) until
+// ctx ends. Failed items are retried with the queue's rate limiter.
+func runWorkers[T comparable](ctx context.Context, queue workqueue.TypedRateLimitingInterface[T], workers int, process func(T) error) {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for processNext(ctx, queue, process) {
+			}
+		}()
+	}
+	<-ctx.Done()
+	queue.ShutDown()
+	wg.Wait()
+}
+
+func processNext[T comparable](ctx context.Context, queue workqueue.TypedRateLimitingInterface[T], process func(T) error) bool {
+	item, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+	defer queue.Done(item)
+	if err := process(item); err != nil {
+		if ctx.Err() == nil {
+			queue.AddRateLimited(item)
+		}
+		return true
+	}
+	queue.Forget(item)
+	return true
+}
+
+// sync compares the instance's current state with the stored one and logs the differences.
+func (w *StatusWatcher) sync(ctx context.Context, key k8s.InstanceKey) error {
+	tenant := w.Source.NamespaceTenant(ctx, key.Namespace)
+	if tenant == "" {
+		return nil
+	}
+	state, err := w.Source.InstanceState(ctx, key)
+	if errors.Is(err, k8s.ErrNotFound) {
+		return w.States.DeleteInstanceState(ctx, tenant, key.Name)
+	}
+	if err != nil {
+		return err
+	}
+	return w.States.UpdateInstanceState(ctx, tenant, key.Name, *state, func(prev *models.InstanceState) []logstore.ServiceLog {
+		return stateChanges(prev, *state)
+	})
+}
+
+// stateChanges returns the service logs for the transition from prev to next. The first observation of
+// an instance (prev nil) is the baseline and logs nothing.
+func stateChanges(prev *models.InstanceState, next models.InstanceState) []logstore.ServiceLog {
+	if prev == nil {
+		return nil
+	}
+	var logs []logstore.ServiceLog
+	if prev.Status != next.Status {
+		logs = append(logs, logstore.ServiceLog{
+			EventType: EventStatusChange,
+			Message:   "Instance status changed to " + next.Status,
+			Metadata:  map[string]any{"previous": prev.Status, "status": next.Status},
+		})
+	}
+	if prev.Master != "" && next.Master != "" && prev.Master != next.Master {
+		logs = append(logs, logstore.ServiceLog{
+			EventType: EventFailover,
+			Message:   fmt.Sprintf("Redis master failed over from %s to %s", prev.Master, next.Master),
+			Metadata:  map[string]any{"previousMaster": prev.Master, "master": next.Master},
+		})
+	}
+	keys := make([]string, 0, len(next.Containers))
+	for k := range next.Containers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		old, ok := prev.Containers[k]
+		cur := next.Containers[k]
+		// Containers of new pods start from their first observed count.
+		if !ok || cur.Restarts <= old.Restarts {
+			continue
+		}
+		pod, container, _ := strings.Cut(k, "/")
+		metadata := map[string]any{
+			"pod":       pod,
+			"container": container,
+			"restarts":  cur.Restarts,
+			"reason":    cur.LastReason,
+		}
+		if cur.LastReason == "OOMKilled" {
+			logs = append(logs, logstore.ServiceLog{
+				EventType: EventOOMKilled,
+				Message:   fmt.Sprintf("Container %s of pod %s was killed for running out of memory", container, pod),
+				Metadata:  metadata,
+			})
+			continue
+		}
+		logs = append(logs, logstore.ServiceLog{
+			EventType: EventPodRestart,
+			Message:   fmt.Sprintf("Container %s of pod %s restarted (%d restarts)", container, pod, cur.Restarts),
+			Metadata:  metadata,
+		})
+	}
+	return logs
+}
@@ -0,0 +1,152 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/k8s"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/logstore"
+	"github.com/Fearcon14/level3-cloud/Week4_API/internal/models"
+)
+
+func eventTypes(logs []logstore.ServiceLog) []string {
+	var out []string
+	for _, l := range logs {
+		out = append(out, l.EventType)
+	}
+	return out
+}
+
+func TestStateChanges(t *testing.T) {
+	running := models.InstanceState{
+		Status: "running",
+		Master: "rfr-a-0",
+		Containers: map[string]models.ContainerState{
+			"rfr-a-0/redis": {Restarts: 0},
+			"rfr-a-1/redis": {Restarts: 1},
+		},
+	}
+	for _, tc := range []struct {
+		name string
+		prev *models.InstanceState
+		next models.InstanceState
+		want []string
+	}{
+		{"baseline", nil, running, nil},
+		{"unchanged", &running, running, nil},
+		{"status", &running, models.InstanceState{Status: "pending", Master: "rfr-a-0", Containers: running.Containers}, []string{EventStatusChange}},
+		{"failover", &running, models.InstanceState{Status: "running", Master: "rfr-a-1", Containers: running.Containers}, []string{EventFailover}},
+		{"master unknown", &running, models.InstanceState{Status: "running", Containers: running.Containers}, nil},
+		{"restart and oom", &running, models.InstanceState{Status: "running", Master: "rfr-a-0", Containers: map[string]models.ContainerState{
+			"rfr-a-0/redis": {Restarts: 1, LastReason: "Error"},
+			"rfr-a-1/redis": {Restarts: 2, LastReason: "OOMKilled"},
+			"rfr-a-2/redis": {Restarts: 3},
+		}}, []string{EventPodRestart, EventOOMKilled}},
+	} {
+		if got := eventTypes(stateChanges(tc.prev, tc.next)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// memoryStates is an in-memory logstore.StateStore.
+type memoryStates struct {
+	states map[string]models.InstanceState
+	logs   []logstore.ServiceLog
+	dedupe map[string]time.Time
+	now    time.Time
+}
+
+func (m *memoryStates) UpdateInstanceState(_ context.Context, tenant, id string, next models.InstanceState, changes func(*models.InstanceState) []logstore.ServiceLog) error {
+	var prev *models.InstanceState
+	if s, ok := m.states[tenant+"/"+id]; ok {
+		prev = &s
+	}
+	m.logs = append(m.logs, changes(prev)...)
+	m.states[tenant+"/"+id] = next
+	return nil
+}
+
+func (m *memoryStates) DeleteInstanceState(_ context.Context, tenant, id string) error {
+	delete(m.states, tenant+"/"+id)
+	return nil
+}
+
+func (m *memoryStates) AppendServiceLogOnce(_ context.Context, tenant, _, key string, window time.Duration, l logstore.ServiceLog) (bool, error) {
+	if m.dedupe == nil {
+		m.dedupe = map[string]time.Time{}
+	}
+	if last, ok := m.dedupe[tenant+"/"+key]; ok && m.now.Sub(last) < window {
+		return false, nil
+	}
+	m.dedupe[tenant+"/"+key] = m.now
+	m.logs = append(m.logs, l)
+	return true, nil
+}
+
+func (m *memoryStates) PruneServiceLogDedupe(_ context.Context, before time.Time) error {
+	for k, t := range m.dedupe {
+		if t.Before(before) {
+			delete(m.dedupe, k)
+		}
+	}
+	return nil
+}
+
+// fakeSource serves fixed instance states.
+type fakeSource map[k8s.InstanceKey]models.InstanceState
+
+func (f fakeSource) WatchInstances(func(k8s.InstanceKey)) (*k8s.InstanceWatch, error) {
+	return &k8s.InstanceWatch{}, nil
+}
+
+func (f fakeSource) InstanceState(_ context.Context, key k8s.InstanceKey) (*models.InstanceState, error) {
+	s, ok := f[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", k8s.ErrNotFound, key.Name)
+	}
+	return &s, nil
+}
+
+func (f fakeSource) NamespaceTenant(_ context.Context, ns string) string {
+	if ns == "tenant-alice" {
+		return "alice"
+	}
+	return ""
+}
+
+func TestStatusWatcher_Sync(t *testing.T) {
+	key := k8s.InstanceKey{Namespace: "tenant-alice", Name: "cache"}
+	source := fakeSource{key: {Status: "pending"}}
+	states := &memoryStates{states: map[string]models.InstanceState{}}
+	w := &StatusWatcher{Source: source, States: states, Logger: slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))}
+	ctx := context.Background()
+
+	sync := func() {
+		t.Helper()
+		if err := w.sync(ctx, key); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+	}
+	sync()
+	source[key] = models.InstanceState{Status: "running"}
+	sync()
+	sync() // repeated events for the same state log nothing
+	if got := eventTypes(states.logs); !reflect.DeepEqual(got, []string{EventStatusChange}) {
+		t.Fatalf("logs %v, want one status_change", got)
+	}
+
+	delete(source, key)
+	sync()
+	if _, ok := states.states["alice/cache"]; ok {
+		t.Fatal("state of deleted instance kept")
+	}
+	if err := w.sync(ctx, k8s.InstanceKey{Namespace: "kube-system", Name: "x"}); err != nil {
+		t.Fatalf("non-tenant namespace: %v", err)
+	}
+}
@@ -5,31 +5,46 @@ import axios from 'axios'
 export const useUserStore = defineStore('user', () => {
   const savedUser = localStorage.getItem('paas-user')
   const savedToken = localStorage.getItem('paas-token')
+  const savedRefreshToken = localStorage.getItem('paas-refresh-token')
 
   const username = ref(savedUser || null)
   const token = ref(savedToken || null)
+  const refreshToken = ref(savedRefreshToken || null)
 
   // Initialize axios header if token exists
   if (token.value) {
     axios.defaults.headers.common['Authorization'] = `Bearer ${token.value}`
   }
 
+  function setTokens(authToken, newRefreshToken) {
+    token.value = authToken
+    refreshToken.value = newRefreshToken
+    localStorage.setItem('paas-token', authToken)
+    localStorage.setItem('paas-refresh-token', newRefreshToken)
+    axios.defaults.headers.common['Authorization'] = `Bearer ${authToken}`
+  }
+
+  function clearSession() {
+    username.value = null
+    token.value = null
+    refreshToken.value = null
+    localStorage.removeItem('paas-user')
+    localStorage.removeItem('paas-token')
+    localStorage.removeItem('paas-refresh-token')
+    delete axios.defaults.headers.common['Authorization']
+  }
+
   async function login(name, password) {
     try {
-      const response = await axios.post('/api/login', {
-        username: name,
-        password: password
-      })
-
-      const authToken = response.data.token
+      const response = await axios.post(
+        '/api/login',
+        { username: name, password: password },
+        { skipAuthRefresh: true }
+      )
 
       username.value = name
-      token.value = authToken
-
       localStorage.setItem('paas-user', name)
-      localStorage.setItem('paas-token', authToken)
-
-      axios.defaults.headers.common['Authorization'] = `Bearer ${authToken}`
+      setTokens(response.data.token, response.data.refreshToken)
       return true
     } catch (error) {
       console.error('Login failed:', error)
@@ -37,13 +52,58 @@ export const useUserStore = defineStore('user', () => {
     }
   }
 
-  function logout() {
-    username.value = null
-    token.value = null
-    localStorage.removeItem('paas-user')
-    localStorage.removeItem('paas-token')
-    delete axios.defaults.headers.common['Authorization']
+  // Access tokens are short-lived; exchange the refresh token for a new pair.
+  // Concurrent 401s share one in-flight refresh because the refresh token is single-use.
+  let refreshing = null
+  function refresh() {
+    if (!refreshToken.value) {
+      return Promise.reject(new Error('no refresh token'))
+    }
+    if (!refreshing) {
+      refreshing = axios
+        .post('/api/refresh', { refreshToken: refreshToken.value }, { skipAuthRefresh: true })
+        .then((response) => {
+          setTokens(response.data.token, response.data.refreshToken)
+          return response.data.token
+        })
+        .finally(() => {
+          refreshing = null
+        })
+    }
+    return refreshing
   }
 
+  async function logout() {
+    if (token.value) {
+      try {
+        await axios.post(
+          '/api/logout',
+          { refreshToken: refreshToken.value },
+          { headers: { Authorization: `Bearer ${token.value}` }, skipAuthRefresh: true }
+        )
+      } catch (error) {
+        console.error('Logout request failed:', error)
+      }
+    }
+    clearSession()
+  }
+
+  // Retry a request once with a fresh access token when it fails with 401.
+  axios.interceptors.response.use(undefined, async (error) => {
+    const config = error.config
+    if (error.response?.status !== 401 || !config || config.skipAuthRefresh || config._retried) {
+      throw error
+    }
+    try {
+      const newToken = await refresh()
+      config._retried = true
+      config.headers = { ...config.headers, Authorization: `Bearer ${newToken}` }
+      return axios(config)
+    } catch {
+      clearSession()
+      throw error
+    }
+  })
+
   return { username, token, login, logout }
 })
@@ -29,3 +29,159 @@ CREATE INDEX IF NOT EXISTS idx_service_logs_tenant_instance_created
 
 CREATE INDEX IF NOT EXISTS idx_service_logs_instance_created
   ON service_logs (instance_id, created_at DESC);
+
+-- Local user accounts for POST /api/login (password_hash is bcrypt).
+CREATE TABLE IF NOT EXISTS users (
+  username VARCHAR(255) PRIMARY KEY,
+  password_hash TEXT NOT NULL,
+  disabled BOOLEAN NOT NULL DEFAULT false,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Refresh tokens for POST /api/refresh (only the SHA-256 hash of the token is stored).
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+  id VARCHAR(64) PRIMARY KEY,
+  username VARCHAR(255) NOT NULL,
+  token_hash VARCHAR(64) NOT NULL UNIQUE,
+  expires_at TIMESTAMPTZ NOT NULL,
+  revoked_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_username
+  ON refresh_tokens (username);
+
+-- Access tokens revoked by POST /api/logout (by jti); rows are pruned once the token has expired.
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+  jti VARCHAR(64) PRIMARY KEY,
+  username VARCHAR(255) NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  revoked_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Tenant-scoped API keys (POST /api/v1/apikeys). Only the SHA-256 hash of the key value is stored.
+CREATE TABLE IF NOT EXISTS api_keys (
+  id VARCHAR(32) PRIMARY KEY,
+  tenant VARCHAR(255) NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  key_hash VARCHAR(64) NOT NULL,
+  scopes JSONB NOT NULL DEFAULT '[]',
+  created_by VARCHAR(255) NOT NULL,
+  expires_at TIMESTAMPTZ,
+  last_used_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_tenant
+  ON api_keys (tenant);
+
+-- Role within the tenant (viewer, operator, owner); added after the tables above, hence ALTER.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'owner';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'owner';
+
+-- Organizations: tenants shared by several users (namespace tenant-org-<name>).
+CREATE TABLE IF NOT EXISTS orgs (
+  name VARCHAR(255) PRIMARY KEY,
+  created_by VARCHAR(255) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS org_members (
+  org VARCHAR(255) NOT NULL REFERENCES orgs (name) ON DELETE CASCADE,
+  username VARCHAR(255) NOT NULL,
+  role VARCHAR(16) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (org, username)
+);
+
+CREATE INDEX IF NOT EXISTS idx_org_members_username
+  ON org_members (username);
+
+-- Pending invitations; deleted once accepted or declined.
+CREATE TABLE IF NOT EXISTS org_invitations (
+  id VARCHAR(64) PRIMARY KEY,
+  org VARCHAR(255) NOT NULL REFERENCES orgs (name) ON DELETE CASCADE,
+  username VARCHAR(255) NOT NULL,
+  role VARCHAR(16) NOT NULL,
+  invited_by VARCHAR(255) NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (org, username)
+);
+
+-- Individual user behind an audit entry (differs from tenant_user for org tenants); organization
+-- selected at login, kept across token refresh.
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS actor VARCHAR(255);
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS org VARCHAR(255) NOT NULL DEFAULT '';
+
+-- Last-known state of each instance, kept by the status watcher (one elected API replica) to log
+-- status_change, pod_restart, failover and oom_killed service events exactly once.
+CREATE TABLE IF NOT EXISTS instance_status (
+  tenant_user VARCHAR(255) NOT NULL,
+  instance_id VARCHAR(255) NOT NULL,
+  state JSONB,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (tenant_user, instance_id)
+);
+
+-- Kubernetes Events recently turned into service logs by the event watcher, so that an Event that
+-- keeps repeating is logged once per dedupe window.
+CREATE TABLE IF NOT EXISTS service_log_dedupe (
+  tenant_user VARCHAR(255) NOT NULL,
+  dedupe_key VARCHAR(512) NOT NULL,
+  logged_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (tenant_user, dedupe_key)
+);
+
+-- Instance backups (POST /api/v1/instances/:id/backups). The RDB files live in object storage at location.
+CREATE TABLE IF NOT EXISTS backups (
+  id VARCHAR(64) PRIMARY KEY,
+  tenant_user VARCHAR(255) NOT NULL,
+  instance_id VARCHAR(255) NOT NULL,
+  state VARCHAR(32) NOT NULL,
+  location TEXT NOT NULL,
+  size_bytes BIGINT NOT NULL DEFAULT 0,
+  error TEXT NOT NULL DEFAULT '',
+  created_by VARCHAR(255) NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_backups_tenant_instance_created
+  ON backups (tenant_user, instance_id, created_at DESC);
+
+-- Backups taken by an instance's backup schedule (pruned by its retention); added later, hence ALTER.
+ALTER TABLE backups ADD COLUMN IF NOT EXISTS scheduled BOOLEAN NOT NULL DEFAULT false;
+
+-- SSO accounts (OIDC issuer and subject) linked to local users. Created on first SSO login or by an
+-- explicit link; the username claim is never used to find an existing user.
+CREATE TABLE IF NOT EXISTS user_identities (
+  issuer VARCHAR(512) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  username VARCHAR(255) NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_username
+  ON user_identities (username);
+
+-- Instance operations (create, update, delete) shared by all API replicas; instance is the RedisInstance
+-- returned by the call (without its password). Completed operations are deleted after an hour.
+CREATE TABLE IF NOT EXISTS operations (
+  id VARCHAR(64) PRIMARY KEY,
+  tenant_user VARCHAR(255) NOT NULL,
+  type VARCHAR(32) NOT NULL,
+  instance_id VARCHAR(255) NOT NULL,
+  state VARCHAR(32) NOT NULL,
+  message TEXT NOT NULL DEFAULT '',
+  error TEXT NOT NULL DEFAULT '',
+  instance JSONB,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_operations_completed
+  ON operations (completed_at);